@@ -1,7 +1,12 @@
 package http
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
 	"time"
 
 	"github.com/BDNK1/sflowg/runtime/plugin"
@@ -14,8 +19,19 @@ type Config struct {
 	MaxRetries  int           `yaml:"max_retries" default:"3" validate:"gte=0,lte=10"`
 	Debug       bool          `yaml:"debug" default:"false"`
 	RetryWaitMS int           `yaml:"retry_wait_ms" default:"100" validate:"gte=0,lte=10000"`
+	// RaiseForStatus fails requests answered with a 4xx or 5xx status
+	// instead of returning the response. Requests can override it.
+	RaiseForStatus bool `yaml:"raise_for_status" default:"false"`
 }
 
+// Error codes of failed requests. Error statuses raised with raise_for_status
+// use HTTP_<status>, e.g. HTTP_503.
+const (
+	ErrorCodeTimeout          = "HTTP_TIMEOUT"
+	ErrorCodeConnectionFailed = "HTTP_CONNECTION_FAILED"
+	ErrorCodeRequestFailed    = "HTTP_REQUEST_FAILED"
+)
+
 // RequestInput defines the typed input for HTTP requests
 type RequestInput struct {
 	URL         string            `json:"url" validate:"required,url"`
@@ -24,6 +40,8 @@ type RequestInput struct {
 	QueryParams map[string]string `json:"query_parameters"`
 	Body        map[string]any    `json:"body"`
 	ContentType string            `json:"content_type" validate:"omitempty,oneof=json form"` // "json" (default) or "form"
+	// RaiseForStatus overrides the raise_for_status plugin setting.
+	RaiseForStatus *bool `json:"raise_for_status"`
 }
 
 // RequestOutput defines the typed output for HTTP requests
@@ -84,7 +102,7 @@ func (h *HTTPPlugin) Request(exec *plugin.Execution, input RequestInput) (Reques
 	resp, err := req.Execute(input.Method, input.URL)
 	if err != nil {
 		log.Error("HTTP request failed", "error", err)
-		return RequestOutput{}, fmt.Errorf("HTTP request failed: %w", err)
+		return RequestOutput{}, classifyRequestError(err)
 	}
 
 	// Extract response headers (first value for each header)
@@ -107,6 +125,13 @@ func (h *HTTPPlugin) Request(exec *plugin.Execution, input RequestInput) (Reques
 	if resp.IsError() {
 		log.Warn("HTTP request completed with error response", "status_code", resp.StatusCode())
 		output.Body = errorResponse
+		raise := h.Config.RaiseForStatus
+		if input.RaiseForStatus != nil {
+			raise = *input.RaiseForStatus
+		}
+		if raise {
+			return RequestOutput{}, statusError(output)
+		}
 	} else {
 		log.Info("HTTP request completed", "status_code", resp.StatusCode())
 		output.Body = response
@@ -115,6 +140,42 @@ func (h *HTTPPlugin) Request(exec *plugin.Execution, input RequestInput) (Reques
 	return output, nil
 }
 
+// classifyRequestError classifies a request that got no response. Timeouts
+// and connection failures are transient; anything else, such as an invalid
+// URL, is permanent.
+func classifyRequestError(err error) *plugin.Error {
+	wrapped := fmt.Errorf("HTTP request failed: %w", err)
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return plugin.WrapError(plugin.ErrorTransient, ErrorCodeTimeout, wrapped, nil)
+	}
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return plugin.WrapError(plugin.ErrorTransient, ErrorCodeConnectionFailed, wrapped, nil)
+	}
+	return plugin.WrapError(plugin.ErrorPermanent, ErrorCodeRequestFailed, wrapped, nil)
+}
+
+// statusError classifies an error response: 5xx, 408 and 429 are transient,
+// other 4xx statuses permanent. The status code, headers and body are kept
+// as meta.
+func statusError(output RequestOutput) *plugin.Error {
+	errType := plugin.ErrorPermanent
+	if output.StatusCode >= http.StatusInternalServerError ||
+		output.StatusCode == http.StatusRequestTimeout || output.StatusCode == http.StatusTooManyRequests {
+		errType = plugin.ErrorTransient
+	}
+	return plugin.NewError(errType, fmt.Sprintf("HTTP_%d", output.StatusCode), "upstream responded "+output.Status, map[string]any{
+		"status_code": output.StatusCode,
+		"headers":     output.Headers,
+		"body":        output.Body,
+	})
+}
+
 // flattenToFormData converts a nested map to form-encoded format with bracket notation
 // Example: {"metadata": {"key": "value"}} -> {"metadata[key]": "value"}
 func flattenToFormData(data map[string]any, prefix string) map[string]string {
@@ -1,7 +1,14 @@
 package http
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/BDNK1/sflowg/runtime/plugin"
+	"github.com/go-resty/resty/v2"
 )
 
 func TestFlattenToFormData(t *testing.T) {
@@ -131,3 +138,60 @@ func TestFlattenToFormData(t *testing.T) {
 		})
 	}
 }
+
+func TestClassifyRequestError(t *testing.T) {
+	// A closed listener refuses connections.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + ln.Addr().String()
+	ln.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+
+	client := resty.New().SetTimeout(50 * time.Millisecond)
+	tests := []struct {
+		url      string
+		wantType plugin.ErrorType
+		wantCode string
+	}{
+		{refused, plugin.ErrorTransient, ErrorCodeConnectionFailed},
+		{slow.URL, plugin.ErrorTransient, ErrorCodeTimeout},
+		{"ftp://example.com/file", plugin.ErrorPermanent, ErrorCodeRequestFailed},
+	}
+	for _, tt := range tests {
+		_, err := client.R().Get(tt.url)
+		if err == nil {
+			t.Fatalf("GET %s: expected an error", tt.url)
+		}
+		fe := classifyRequestError(err)
+		if fe.Type != tt.wantType || fe.Code != tt.wantCode {
+			t.Errorf("GET %s: classified as %s/%s, want %s/%s", tt.url, fe.Type, fe.Code, tt.wantType, tt.wantCode)
+		}
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status   int
+		wantType plugin.ErrorType
+	}{
+		{http.StatusServiceUnavailable, plugin.ErrorTransient},
+		{http.StatusTooManyRequests, plugin.ErrorTransient},
+		{http.StatusNotFound, plugin.ErrorPermanent},
+		{http.StatusUnprocessableEntity, plugin.ErrorPermanent},
+	}
+	for _, tt := range tests {
+		fe := statusError(RequestOutput{StatusCode: tt.status, Body: map[string]any{"error": "nope"}})
+		if fe.Type != tt.wantType || fe.Meta["status_code"] != tt.status {
+			t.Errorf("status %d: got %s with meta %v, want %s", tt.status, fe.Type, fe.Meta, tt.wantType)
+		}
+	}
+	if fe := statusError(RequestOutput{StatusCode: 503}); fe.Code != "HTTP_503" {
+		t.Errorf("code = %s, want HTTP_503", fe.Code)
+	}
+}
@@ -1,20 +1,46 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/BDNK1/sflowg/runtime/plugin"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// ErrorCodeConnectionFailed is the code of queries that could not reach the
+// database. Errors reported by Postgres use POSTGRES_<CONDITION>, e.g.
+// POSTGRES_SERIALIZATION_FAILURE or POSTGRES_UNIQUE_VIOLATION.
+const ErrorCodeConnectionFailed = "POSTGRES_CONNECTION_FAILED"
+
+// transientSQLStates are the SQLSTATEs worth retrying: the same statement can
+// succeed once the conflict or overload is gone.
+var transientSQLStates = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"55P03": true, // lock_not_available
+	"53300": true, // too_many_connections
+	"57014": true, // query_canceled (statement_timeout)
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
 // Config holds the Postgres plugin configuration
 type Config struct {
 	ConnectionString  string `yaml:"connection_string" validate:"required"`
 	MaxOpenConns      int    `yaml:"max_open_conns" default:"10" validate:"gte=1,lte=100"`
 	MaxIdleConns      int    `yaml:"max_idle_conns" default:"5" validate:"gte=0,lte=50"`
 	ConnMaxLifetimeMs int    `yaml:"conn_max_lifetime_ms" default:"300000" validate:"gte=0"` // 5 min default
+	ExecutionStore    bool   `yaml:"execution_store" default:"false"`                        // checkpoint flows with a recovery policy
+	IdempotencyStore  bool   `yaml:"idempotency_store" default:"false"`                      // keep idempotent HTTP responses
 }
 
 // GetInput defines input for postgres.get task
@@ -44,6 +70,8 @@ type ExecOutput struct {
 type PostgresPlugin struct {
 	Config Config
 	db     *sql.DB
+	store  *plugin.SQLExecutionStore
+	idem   *plugin.SQLIdempotencyStore
 }
 
 // Initialize opens the database connection pool
@@ -70,10 +98,43 @@ func (p *PostgresPlugin) Initialize(log plugin.Logger) error {
 		return fmt.Errorf("postgres: failed to ping database: %w", err)
 	}
 
+	if p.Config.ExecutionStore {
+		store := plugin.NewSQLExecutionStore(db, plugin.SQLDialectPostgres)
+		if err := store.EnsureSchema(context.Background()); err != nil {
+			db.Close()
+			return fmt.Errorf("postgres: failed to create execution store table: %w", err)
+		}
+		p.store = store
+	}
+	if p.Config.IdempotencyStore {
+		idem := plugin.NewSQLIdempotencyStore(db, plugin.SQLDialectPostgres)
+		if err := idem.EnsureSchema(context.Background()); err != nil {
+			db.Close()
+			return fmt.Errorf("postgres: failed to create idempotency table: %w", err)
+		}
+		p.idem = idem
+	}
+
 	p.db = db
 	return nil
 }
 
+// ExecutionStore returns the checkpoint store when execution_store is enabled.
+func (p *PostgresPlugin) ExecutionStore() plugin.ExecutionStore {
+	if p.store == nil {
+		return nil
+	}
+	return p.store
+}
+
+// IdempotencyStore returns the idempotency key store when idempotency_store is enabled.
+func (p *PostgresPlugin) IdempotencyStore() plugin.IdempotencyStore {
+	if p.idem == nil {
+		return nil
+	}
+	return p.idem
+}
+
 // Shutdown closes the database connection pool
 func (p *PostgresPlugin) Shutdown(_ plugin.Logger) error {
 	if p.db != nil {
@@ -91,7 +152,7 @@ func (p *PostgresPlugin) Get(exec *plugin.Execution, input GetInput) (GetOutput,
 
 	rows, err := p.db.Query(input.Query, input.Params...)
 	if err != nil {
-		return GetOutput{}, fmt.Errorf("postgres.get: query failed: %w", err)
+		return GetOutput{}, classifyError(fmt.Errorf("postgres.get: query failed: %w", err))
 	}
 	defer rows.Close()
 
@@ -129,7 +190,7 @@ func (p *PostgresPlugin) Exec(exec *plugin.Execution, input ExecInput) (ExecOutp
 
 	result, err := p.db.Exec(input.Query, input.Params...)
 	if err != nil {
-		return ExecOutput{}, fmt.Errorf("postgres.exec: query failed: %w", err)
+		return ExecOutput{}, classifyError(fmt.Errorf("postgres.exec: query failed: %w", err))
 	}
 
 	affected, err := result.RowsAffected()
@@ -140,6 +201,39 @@ func (p *PostgresPlugin) Exec(exec *plugin.Execution, input ExecInput) (ExecOutp
 	return ExecOutput{AffectedRows: affected}, nil
 }
 
+// classifyError classifies a failed query so steps retry it without a `when:`
+// expression when that can help. Serialization failures, deadlocks, lock and
+// connection errors are transient; other Postgres errors, such as constraint
+// violations, are permanent. Errors that are neither, including context
+// errors, are returned as they are.
+func classifyError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		errType := plugin.ErrorPermanent
+		if transientSQLStates[pqErr.Code] || pqErr.Code.Class() == "08" {
+			errType = plugin.ErrorTransient
+		}
+		name := pqErr.Code.Name()
+		if name == "" {
+			name = string(pqErr.Code)
+		}
+		meta := map[string]any{"sqlstate": string(pqErr.Code)}
+		for key, v := range map[string]string{"constraint": pqErr.Constraint, "table": pqErr.Table, "column": pqErr.Column, "detail": pqErr.Detail} {
+			if v != "" {
+				meta[key] = v
+			}
+		}
+		return plugin.WrapError(errType, "POSTGRES_"+strings.ToUpper(name), err, meta)
+	}
+
+	var opErr *net.OpError
+	if errors.Is(err, driver.ErrBadConn) || errors.As(err, &opErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return plugin.WrapError(plugin.ErrorTransient, ErrorCodeConnectionFailed, err, nil)
+	}
+	return err
+}
+
 // scanRow scans a single row into a map, handling postgres-specific types
 func scanRow(cols []string, colTypes []*sql.ColumnType, rows *sql.Rows) (map[string]any, error) {
 	// Create slice for scanning
@@ -0,0 +1,45 @@
+package postgres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/BDNK1/sflowg/runtime/plugin"
+	"github.com/lib/pq"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err      error
+		wantType plugin.ErrorType
+		wantCode string
+	}{
+		{&pq.Error{Code: "40001"}, plugin.ErrorTransient, "POSTGRES_SERIALIZATION_FAILURE"},
+		{&pq.Error{Code: "40P01"}, plugin.ErrorTransient, "POSTGRES_DEADLOCK_DETECTED"},
+		{&pq.Error{Code: "08006"}, plugin.ErrorTransient, "POSTGRES_CONNECTION_FAILURE"},
+		{&pq.Error{Code: "23505", Constraint: "payments_pkey"}, plugin.ErrorPermanent, "POSTGRES_UNIQUE_VIOLATION"},
+		{driver.ErrBadConn, plugin.ErrorTransient, ErrorCodeConnectionFailed},
+	}
+	for _, tt := range tests {
+		err := classifyError(fmt.Errorf("postgres.exec: query failed: %w", tt.err))
+		var fe *plugin.Error
+		if !errors.As(err, &fe) {
+			t.Fatalf("%v: not classified", tt.err)
+		}
+		if fe.Type != tt.wantType || fe.Code != tt.wantCode {
+			t.Errorf("%v: classified as %s/%s, want %s/%s", tt.err, fe.Type, fe.Code, tt.wantType, tt.wantCode)
+		}
+	}
+
+	err := classifyError(fmt.Errorf("postgres.exec: query failed: %w", &pq.Error{Code: "23505", Constraint: "payments_pkey"}))
+	if fe := err.(*plugin.Error); fe.Meta["sqlstate"] != "23505" || fe.Meta["constraint"] != "payments_pkey" {
+		t.Errorf("meta = %v", fe.Meta)
+	}
+
+	plain := errors.New("sql: no rows in result set")
+	if err := classifyError(plain); err != plain {
+		t.Errorf("unclassified error changed to %v", err)
+	}
+}
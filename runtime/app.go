@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,10 +20,15 @@ type App struct {
 	Flows            map[string]Flow
 	GlobalProperties map[string]any // Global properties from flow-config.yaml
 	server           *http.Server
+	schedules        []*ScheduleHandler
+	pluginTriggers   []*pluginEntrypoint
 	loader           FlowLoader
 	evaluator        ExpressionEvaluator
 	stepExecutor     StepExecutor
 	newValueStore    func() ValueStore
+	recoveries       sync.WaitGroup
+	recoveryStop     chan struct{}
+	recoveryDone     chan struct{}
 }
 
 // NewApp creates a new application with the given container and engine components.
@@ -63,11 +69,23 @@ func (a *App) Start(ctx context.Context, port string, flowsDir string) error {
 	if err := a.applyMetricContext(); err != nil {
 		return err
 	}
+	if err := a.applyAsyncConfig(); err != nil {
+		return err
+	}
+	if err := a.applyErrorResponseConfig(); err != nil {
+		return err
+	}
 
 	// Load flows at startup (runtime resolution)
 	if err := a.loadFlows(flowsDir); err != nil {
 		return err
 	}
+	if err := a.Container.RegisterCircuitBreakers(a.Flows); err != nil {
+		return err
+	}
+	if err := a.Container.RegisterBulkheads(a.Flows); err != nil {
+		return err
+	}
 
 	// Setup Gin router
 	gin.SetMode(gin.ReleaseMode)
@@ -76,10 +94,33 @@ func (a *App) Start(ctx context.Context, port string, flowsDir string) error {
 	// Create executor for flow execution
 	executor := NewExecutor(a.evaluator, a.stepExecutor)
 
-	// Register flow endpoints
+	// Status endpoints for mode: async entrypoints and circuit breakers.
+	// Registered first so a flow declaring the same route fails to register instead.
+	if a.hasAsyncFlows() {
+		router.GET(ExecutionStatusRoute, executionStatusHandler(a.Container))
+	}
+	if len(a.Container.CircuitBreakers()) > 0 {
+		router.GET(CircuitBreakersRoute, circuitBreakersHandler(a.Container))
+	}
+
+	// Register flow entrypoints. The same copies back flow.call().
+	flows := make(map[string]*Flow, len(a.Flows))
 	for flowID := range a.Flows {
 		flow := a.Flows[flowID] // Copy to avoid pointer issues
-		NewHttpHandler(&flow, a.Container, executor, a.GlobalProperties, a.newValueStore, router)
+		flows[flowID] = &flow
+		if err := a.registerEntrypoint(&flow, executor, router); err != nil {
+			return fmt.Errorf("registering entrypoint: %w", err)
+		}
+	}
+	a.Container.RegisterFlows(flows, executor, a.GlobalProperties, a.newValueStore)
+	if err := a.checkRecovery(flows); err != nil {
+		return err
+	}
+	if err := a.startRecovery(ctx, executor, flows); err != nil {
+		return err
+	}
+	if err := a.startEntrypoints(ctx); err != nil {
+		return err
 	}
 
 	// Create HTTP server
@@ -155,6 +196,14 @@ func (a *App) loadFlows(flowsDir string) error {
 			return fmt.Errorf("error resolving properties for flow %s: %w", flow.ID, err)
 		}
 		flow.Properties = resolvedProps
+		if err := a.validateEntrypoint(flow); err != nil {
+			return fmt.Errorf("error loading flow from %s: %w", file, err)
+		}
+		if checker, ok := a.loader.(FlowChecker); ok {
+			for _, warning := range checker.CheckFlow(flow, a.Container, a.GlobalProperties) {
+				a.Container.Logger().Warn(warning, "flow_id", flow.ID)
+			}
+		}
 		a.registerFlow(flow)
 	}
 
@@ -174,7 +223,11 @@ func (a *App) initialize(ctx context.Context) error {
 // Calls plugin Shutdown methods in reverse order of initialization.
 func (a *App) shutdown(ctx context.Context) error {
 	var errors []error
-	// Shutdown HTTP server first
+	// Stop schedules and plugin entrypoints first so no new runs start;
+	// in-flight runs may finish.
+	errors = append(errors, a.stopEntrypoints(ctx, a.schedules, a.pluginTriggers)...)
+
+	// Shutdown HTTP server
 	if a.server != nil {
 		a.Container.Logger().Info("Shutting down HTTP server")
 		if err := a.server.Shutdown(ctx); err != nil {
@@ -182,6 +235,19 @@ func (a *App) shutdown(ctx context.Context) error {
 		}
 	}
 
+	// Async and recovered executions may still use plugins; let them finish
+	// first. Callbacks still retrying when ctx ends are dropped.
+	stopCallbacks := context.AfterFunc(ctx, a.Container.cancelCallbacks)
+	defer stopCallbacks()
+	a.stopRecovery()
+	if err := a.Container.stopAsync(ctx); err != nil {
+		errors = append(errors, err)
+	}
+	a.recoveries.Wait()
+	if err := a.releaseInstance(ctx); err != nil {
+		errors = append(errors, fmt.Errorf("releasing instance: %w", err))
+	}
+
 	// Shutdown container (calls plugin Shutdown methods)
 	a.Container.Logger().Info("Shutting down plugins")
 	if err := a.Container.Shutdown(ctx); err != nil {
@@ -199,6 +265,118 @@ func (a *App) shutdown(ctx context.Context) error {
 	return nil
 }
 
+// startEntrypoints starts the schedules and the plugin entrypoints. If a
+// plugin entrypoint fails to start, the ones started before it are stopped
+// again.
+func (a *App) startEntrypoints(ctx context.Context) error {
+	for _, schedule := range a.schedules {
+		schedule.Start()
+	}
+	for i, trigger := range a.pluginTriggers {
+		if err := trigger.start(); err != nil {
+			// The failing provider may have started some of its entrypoints.
+			for _, stopErr := range a.stopEntrypoints(ctx, a.schedules, a.pluginTriggers[:i+1]) {
+				a.Container.Logger().Error("Stopping entrypoints failed", "error", stopErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// stopEntrypoints stops schedules and the providers of triggers, each
+// provider once.
+func (a *App) stopEntrypoints(ctx context.Context, schedules []*ScheduleHandler, triggers []*pluginEntrypoint) []error {
+	var errors []error
+	if len(schedules) > 0 {
+		a.Container.Logger().Info("Stopping scheduled flows")
+		for _, schedule := range schedules {
+			if err := schedule.Stop(ctx); err != nil {
+				errors = append(errors, err)
+			}
+		}
+	}
+
+	stopped := make(map[string]bool)
+	for _, trigger := range triggers {
+		typ := trigger.provider.EntrypointType()
+		if stopped[typ] {
+			continue
+		}
+		stopped[typ] = true
+		if err := trigger.provider.StopEntrypoints(ctx); err != nil {
+			errors = append(errors, fmt.Errorf("%s entrypoint shutdown: %w", typ, err))
+		}
+	}
+	return errors
+}
+
+// registerEntrypoint wires a flow to its trigger according to the entrypoint type.
+func (a *App) registerEntrypoint(flow *Flow, executor *Executor, router *gin.Engine) error {
+	switch flow.Entrypoint.Type {
+	case EntrypointHTTP, "":
+		return NewHttpHandler(flow, a.Container, executor, a.GlobalProperties, a.newValueStore, router)
+	case EntrypointSchedule:
+		schedule, err := NewScheduleHandler(flow, a.Container, executor, a.GlobalProperties, a.newValueStore)
+		if err != nil {
+			return err
+		}
+		a.schedules = append(a.schedules, schedule)
+		return nil
+	case EntrypointInternal:
+		// Only reachable through flow.call().
+		return nil
+	default:
+		provider, ok := a.Container.EntrypointProvider(flow.Entrypoint.Type)
+		if !ok {
+			return fmt.Errorf("flow %s: unsupported entrypoint type %q", flow.ID, flow.Entrypoint.Type)
+		}
+		a.pluginTriggers = append(a.pluginTriggers, &pluginEntrypoint{
+			provider: provider,
+			runner: &triggerRunner{
+				flow:             flow,
+				container:        a.Container,
+				executor:         executor,
+				globalProperties: a.GlobalProperties,
+				newValueStore:    a.newValueStore,
+				triggerType:      flow.Entrypoint.Type,
+			},
+		})
+		return nil
+	}
+}
+
+// validateEntrypoint checks that a loaded flow's entrypoint type is served and
+// lets plugin providers reject invalid config before anything starts.
+func (a *App) validateEntrypoint(flow Flow) error {
+	switch flow.Entrypoint.Type {
+	case EntrypointHTTP, EntrypointSchedule, EntrypointInternal, "":
+		return nil
+	}
+	provider, ok := a.Container.EntrypointProvider(flow.Entrypoint.Type)
+	if !ok {
+		return fmt.Errorf("flow %s: unsupported entrypoint type %q", flow.ID, flow.Entrypoint.Type)
+	}
+	if err := provider.ValidateEntrypoint(flow.ID, flow.Entrypoint.Config); err != nil {
+		return fmt.Errorf("flow %s: invalid %s entrypoint: %w", flow.ID, flow.Entrypoint.Type, err)
+	}
+	return nil
+}
+
+// checkRecovery fails startup when a flow asks for durable execution but no
+// ExecutionStore is configured.
+func (a *App) checkRecovery(flows map[string]*Flow) error {
+	if a.Container.ExecutionStore() != nil {
+		return nil
+	}
+	for id, flow := range flows {
+		if flow.Recovery != "" {
+			return fmt.Errorf("flow %s sets recovery but no execution store is configured", id)
+		}
+	}
+	return nil
+}
+
 func (a *App) registerFlow(flow Flow) {
 	a.Flows[flow.ID] = flow
 }
@@ -221,6 +399,56 @@ func (a *App) applyMetricContext() error {
 	return nil
 }
 
+// applyAsyncConfig sizes the async worker pool from properties.async
+// ({workers, queue_size}).
+func (a *App) applyAsyncConfig() error {
+	raw, err := extractNestedMap(a.GlobalProperties, "async")
+	if err != nil {
+		return fmt.Errorf("properties.async: %w", err)
+	}
+	var cfg AsyncConfig
+	for key, v := range raw {
+		n, ok := toInt64(v)
+		if !ok || n < 1 {
+			return fmt.Errorf("properties.async.%s must be a positive integer, got %v", key, v)
+		}
+		switch key {
+		case "workers":
+			cfg.Workers = int(n)
+		case "queue_size":
+			cfg.QueueSize = int(n)
+		default:
+			return fmt.Errorf("properties.async: unsupported option %q (allowed: workers, queue_size)", key)
+		}
+	}
+	a.Container.SetAsyncConfig(cfg)
+	return nil
+}
+
+// applyErrorResponseConfig reads how failed flows answer from
+// properties.errors ({debug, types, codes}).
+func (a *App) applyErrorResponseConfig() error {
+	raw, err := extractNestedMap(a.GlobalProperties, "errors")
+	if err != nil {
+		return fmt.Errorf("properties.errors: %w", err)
+	}
+	cfg, err := parseErrorResponseConfig(raw)
+	if err != nil {
+		return fmt.Errorf("properties.errors: %w", err)
+	}
+	a.Container.SetErrorResponseConfig(cfg)
+	return nil
+}
+
+func (a *App) hasAsyncFlows() bool {
+	for _, flow := range a.Flows {
+		if mode, _ := flow.Entrypoint.Config[ModeKey].(string); mode == ModeAsync {
+			return true
+		}
+	}
+	return false
+}
+
 // extractNestedMap navigates a chain of string keys through nested map[string]any values.
 // Returns nil, nil if any key is absent. Returns an error if a key exists but its value
 // is not a map[string]any.
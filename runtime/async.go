@@ -0,0 +1,443 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ModeKey selects how an http entrypoint runs its flow: ModeSync (the
+	// default) answers with the flow's response, ModeAsync answers 202 and
+	// runs the flow on the async worker pool.
+	ModeKey   = "mode"
+	ModeSync  = "sync"
+	ModeAsync = "async"
+
+	// CallbackURLKey is the http entrypoint option naming a webhook that
+	// receives the ExecutionRecord when an async execution ends.
+	CallbackURLKey = "callback_url"
+
+	// ExecutionStatusRoute serves the ExecutionRecord of async executions.
+	ExecutionStatusRoute = "/_executions/:id"
+
+	DefaultAsyncWorkers   = 16
+	DefaultAsyncQueueSize = 1000
+
+	ErrorCodeAsyncQueueFull       FlowErrorCode = "ASYNC_QUEUE_FULL"
+	ErrorCodeExecutionInterrupted FlowErrorCode = "EXECUTION_INTERRUPTED"
+	ErrorCodeExecutionNotFound    FlowErrorCode = "EXECUTION_NOT_FOUND"
+)
+
+// Async execution states reported by GET /_executions/:id.
+const (
+	RecordQueued    = "queued"
+	RecordRunning   = "running"
+	RecordSucceeded = "succeeded"
+	RecordFailed    = "failed"
+)
+
+// ExecutionRecord is the status of an async execution.
+type ExecutionRecord struct {
+	ExecutionID string              `json:"execution_id"`
+	FlowID      string              `json:"flow_id"`
+	Status      string              `json:"status"`
+	Response    *ResponseDescriptor `json:"response,omitempty"` // response set by the flow, if any
+	Error       *FlowError          `json:"error,omitempty"`
+	Owner       string              `json:"owner,omitempty"` // instance running the execution
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// ExecutionRecordStore persists the status of async executions so it can be
+// polled after a restart. FileExecutionStore and SQLExecutionStore implement
+// it next to ExecutionStore.
+type ExecutionRecordStore interface {
+	// SaveRecord creates or replaces the record of an execution.
+	SaveRecord(ctx context.Context, record *ExecutionRecord) error
+	// GetRecord returns the record of an execution, or nil if it is unknown.
+	GetRecord(ctx context.Context, executionID string) (*ExecutionRecord, error)
+	// ClaimPending makes owner the owner of the queued or running records
+	// whose owner is not live (see ExecutionStore.Heartbeat) and that have no
+	// incomplete checkpoint, and returns them. Each record is claimed by one
+	// instance only.
+	ClaimPending(ctx context.Context, owner string) ([]*ExecutionRecord, error)
+}
+
+// AsyncConfig sizes the worker pool of async http entrypoints. It is read
+// from `properties.async` in flow-config.yaml.
+type AsyncConfig struct {
+	Workers   int // executions running at once
+	QueueSize int // accepted executions waiting for a worker
+}
+
+// asyncPool runs async executions on a fixed number of workers. Submit never
+// blocks: a full queue rejects the execution.
+type asyncPool struct {
+	jobs    chan func()
+	wg      sync.WaitGroup
+	mu      sync.RWMutex
+	stopped bool
+}
+
+func newAsyncPool(cfg AsyncConfig) *asyncPool {
+	p := &asyncPool{jobs: make(chan func(), cfg.QueueSize)}
+	for range cfg.Workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+func (p *asyncPool) submit(job func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.stopped {
+		return false
+	}
+	select {
+	case p.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop rejects new executions and waits for the queued and running ones.
+// Executions still queued when ctx ends are reported as interrupted on the
+// next start.
+func (p *asyncPool) stop(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.jobs)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("async executions still running: %w", ctx.Err())
+	}
+}
+
+// asyncEntrypoint runs the flow of a `mode: async` http entrypoint.
+type asyncEntrypoint struct {
+	flow        *Flow
+	container   *Container
+	executor    *Executor
+	callbackURL string
+}
+
+func parseAsyncEntrypoint(flow *Flow, container *Container, executor *Executor) (*asyncEntrypoint, error) {
+	config := flow.Entrypoint.Config
+	mode, _ := config[ModeKey].(string)
+	callbackURL, _ := config[CallbackURLKey].(string)
+	switch mode {
+	case "", ModeSync:
+		if callbackURL != "" {
+			return nil, fmt.Errorf("%s requires %s: %s", CallbackURLKey, ModeKey, ModeAsync)
+		}
+		return nil, nil
+	case ModeAsync:
+		return &asyncEntrypoint{flow: flow, container: container, executor: executor, callbackURL: callbackURL}, nil
+	default:
+		return nil, fmt.Errorf("invalid %s %q (allowed: %s, %s)", ModeKey, mode, ModeSync, ModeAsync)
+	}
+}
+
+// accept queues the execution and answers 202 with its status location.
+// The returned descriptor is the response stored for idempotent replays.
+func (a *asyncEntrypoint) accept(c *gin.Context, scope *requestScope) (*ResponseDescriptor, error) {
+	e := scope.execution
+	records := a.container.ExecutionRecordStore()
+	now := time.Now().UTC()
+	record := &ExecutionRecord{ExecutionID: e.ID, FlowID: a.flow.ID, Status: RecordQueued, Owner: a.container.InstanceID(), CreatedAt: now, UpdatedAt: now}
+	if err := records.SaveRecord(e, record); err != nil {
+		scope.log.Error("Saving execution record failed", "error", err)
+		writeFlowError(c, a.container.ErrorResponses(), fmt.Errorf("queueing execution: %w", err))
+		return nil, err
+	}
+
+	// The request context ends with this handler; the run keeps the request
+	// span as parent but not its cancellation.
+	runCtx := context.WithoutCancel(scope.spanCtx)
+	scope.detached = a.container.asyncPool().submit(func() {
+		defer removeRequestFiles(e)
+		a.run(e.WithContext(runCtx), record)
+	})
+	if !scope.detached {
+		record.Status, record.UpdatedAt = RecordFailed, time.Now().UTC()
+		record.Error = &FlowError{Type: ErrorTypeTransient, Code: string(ErrorCodeAsyncQueueFull), Message: "async queue is full", Step: "request"}
+		if err := records.SaveRecord(context.WithoutCancel(e), record); err != nil {
+			scope.log.Error("Saving execution record failed", "error", err)
+		}
+		reqErr := NewRequestError(http.StatusServiceUnavailable, string(ErrorCodeAsyncQueueFull), "Too many queued executions, retry later", nil)
+		c.Header("Retry-After", "1")
+		writeRequestError(c, a.container.ErrorResponses(), reqErr)
+		return nil, reqErr.FlowError()
+	}
+
+	location := executionLocation(e.ID)
+	accepted := &ResponseDescriptor{
+		HandlerName: "http.json",
+		Args: map[string]any{
+			"status":  http.StatusAccepted,
+			"headers": map[string]any{"Location": location},
+			"body":    map[string]any{"execution_id": e.ID, "status": RecordQueued, "location": location},
+		},
+	}
+	scope.log.Info("Execution queued", "location", location)
+	handler, _ := a.container.ResponseHandlers.Get(accepted.HandlerName)
+	return accepted, handler.Handle(c, e, accepted.Args)
+}
+
+// run executes the flow on a worker and records the outcome.
+func (a *asyncEntrypoint) run(e *Execution, record *ExecutionRecord) {
+	spanCtx, span := e.Tracer().Start(e, fmt.Sprintf("async flow %s", a.flow.ID),
+		trace.WithAttributes(
+			attribute.String("flow.id", a.flow.ID),
+			attribute.String("execution.id", e.ID),
+		),
+	)
+	defer span.End()
+
+	ctx := spanCtx
+	if a.flow.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(spanCtx, time.Duration(a.flow.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	e = e.WithContext(ctx)
+
+	records := a.container.ExecutionRecordStore()
+	record.Status, record.UpdatedAt = RecordRunning, time.Now().UTC()
+	if err := records.SaveRecord(context.WithoutCancel(e), record); err != nil {
+		e.Logger().Error("Saving execution record failed", "error", err)
+	}
+
+	start := time.Now()
+	err := a.executor.ExecuteSteps(e)
+	e.Metrics().RecordFlow(spanCtx, a.flow.ID, classifyMetricOutcome(err), time.Since(start))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		e.Logger().Error("Async execution failed", "error", err)
+	}
+	finishExecutionRecord(e, record, err, a.callbackURL)
+}
+
+// finishExecutionRecord stores the outcome of an execution and sends it to
+// the callback URL, if any.
+func finishExecutionRecord(e *Execution, record *ExecutionRecord, err error, callbackURL string) {
+	ctx := context.WithoutCancel(e)
+	record.Response = e.State().Response()
+	record.Status = RecordSucceeded
+	if err != nil {
+		record.Status = RecordFailed
+		record.Error = toFlowError(err, "", 0)
+	}
+	record.UpdatedAt = time.Now().UTC()
+	if err := e.Container.ExecutionRecordStore().SaveRecord(ctx, record); err != nil {
+		e.Logger().Error("Saving execution record failed", "error", err)
+	}
+	if callbackURL != "" {
+		sendExecutionCallback(e.Container.callbacks, e.Logger(), callbackURL, record.view(e.Container.ErrorResponses()))
+	}
+}
+
+// callbackAttempts and callbackTimeout bound webhook delivery.
+const (
+	callbackAttempts = 3
+	callbackTimeout  = 10 * time.Second
+)
+
+// sendExecutionCallback POSTs the record as JSON. Non-2xx answers and
+// network errors are retried with a growing delay, then logged. Retries stop
+// when ctx ends.
+func sendExecutionCallback(ctx context.Context, log Logger, url string, record executionRecordView) {
+	body, err := json.Marshal(record)
+	if err != nil {
+		log.Error("Encoding execution callback failed", "error", err)
+		return
+	}
+	client := &http.Client{Timeout: callbackTimeout}
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		err = postCallback(ctx, client, url, body)
+		if err == nil {
+			return
+		}
+		if attempt == callbackAttempts {
+			break
+		}
+		timer := time.NewTimer(time.Duration(attempt) * time.Second)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			log.Error("Execution callback abandoned", "callback_url", url, "attempts", attempt, "error", err)
+			return
+		}
+	}
+	log.Error("Execution callback failed", "callback_url", url, "attempts", callbackAttempts, "error", err)
+}
+
+func postCallback(ctx context.Context, client *http.Client, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func executionLocation(id string) string {
+	return "/_executions/" + id
+}
+
+// executionRecordView is a record as clients see it: the error is rendered
+// like the problem response of a synchronous request, so internals only show
+// in debug mode.
+type executionRecordView struct {
+	ExecutionID string              `json:"execution_id"`
+	FlowID      string              `json:"flow_id"`
+	Status      string              `json:"status"`
+	Response    *ResponseDescriptor `json:"response,omitempty"`
+	Error       gin.H               `json:"error,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+func (r *ExecutionRecord) view(cfg ErrorResponseConfig) executionRecordView {
+	v := executionRecordView{
+		ExecutionID: r.ExecutionID,
+		FlowID:      r.FlowID,
+		Status:      r.Status,
+		Response:    r.Response,
+		CreatedAt:   r.CreatedAt,
+		UpdatedAt:   r.UpdatedAt,
+	}
+	if r.Error != nil {
+		_, v.Error = cfg.problem(r.Error)
+	}
+	return v
+}
+
+// executionStatusHandler serves GET /_executions/:id.
+func executionStatusHandler(container *Container) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		record, err := container.ExecutionRecordStore().GetRecord(c.Request.Context(), c.Param("id"))
+		switch {
+		case err != nil:
+			container.Logger().Error("Reading execution record failed", "execution_id", c.Param("id"), "error", err)
+			writeFlowError(c, container.ErrorResponses(), fmt.Errorf("reading execution: %w", err))
+		case record == nil:
+			writeRequestError(c, container.ErrorResponses(),
+				NewRequestError(http.StatusNotFound, string(ErrorCodeExecutionNotFound), "Execution not found", nil))
+		default:
+			c.JSON(http.StatusOK, record.view(container.ErrorResponses()))
+		}
+	}
+}
+
+// markInterruptedRecords fails the async executions left queued or running
+// by an instance that is no longer live. Executions with a checkpoint are
+// recovered instead.
+func markInterruptedRecords(ctx context.Context, container *Container) error {
+	records := container.ExecutionRecordStore()
+	pending, err := records.ClaimPending(ctx, container.InstanceID())
+	if err != nil {
+		return fmt.Errorf("claiming pending executions: %w", err)
+	}
+	for _, record := range pending {
+		record.Status, record.UpdatedAt = RecordFailed, time.Now().UTC()
+		record.Error = &FlowError{
+			Type:    ErrorTypeTransient,
+			Code:    string(ErrorCodeExecutionInterrupted),
+			Message: "execution was interrupted by a restart",
+		}
+		if err := records.SaveRecord(ctx, record); err != nil {
+			return err
+		}
+		container.Logger().Warn("Marked interrupted async execution as failed",
+			"execution_id", record.ExecutionID, "flow_id", record.FlowID)
+	}
+	return nil
+}
+
+// memoryExecutionRecordStore keeps the most recent records in memory. It is
+// used when the configured ExecutionStore does not persist records.
+type memoryExecutionRecordStore struct {
+	mu      sync.Mutex
+	records map[string]*ExecutionRecord
+	order   []string
+	limit   int
+}
+
+// DefaultMemoryRecordLimit bounds the in-memory record store; the oldest
+// records are dropped first.
+const DefaultMemoryRecordLimit = 10000
+
+func newMemoryExecutionRecordStore(limit int) *memoryExecutionRecordStore {
+	return &memoryExecutionRecordStore{records: make(map[string]*ExecutionRecord), limit: limit}
+}
+
+func (s *memoryExecutionRecordStore) SaveRecord(_ context.Context, record *ExecutionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[record.ExecutionID]; !ok {
+		s.order = append(s.order, record.ExecutionID)
+		if len(s.order) > s.limit {
+			delete(s.records, s.order[0])
+			s.order = s.order[1:]
+		}
+	}
+	copied := *record
+	s.records[record.ExecutionID] = &copied
+	return nil
+}
+
+func (s *memoryExecutionRecordStore) GetRecord(_ context.Context, executionID string) (*ExecutionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[executionID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func (s *memoryExecutionRecordStore) ClaimPending(_ context.Context, _ string) ([]*ExecutionRecord, error) {
+	// Records do not outlive the process, so nothing is left over from a
+	// previous run.
+	return nil, nil
+}
@@ -0,0 +1,229 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAsyncRouter(t *testing.T, container *Container, stepExecutor StepExecutor, config map[string]any) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.GET(ExecutionStatusRoute, executionStatusHandler(container))
+	entrypoint := map[string]any{"method": "POST", "path": "/reports", ModeKey: ModeAsync}
+	for k, v := range config {
+		entrypoint[k] = v
+	}
+	flow := &Flow{
+		ID:         "reports",
+		Entrypoint: Entrypoint{Type: "http", Config: entrypoint},
+		Steps:      []Step{{ID: "build"}},
+	}
+	if err := NewHttpHandler(flow, container, NewExecutor(noopEvaluator{}, stepExecutor), nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+	t.Cleanup(func() { container.stopAsync(context.Background()) })
+	return router
+}
+
+func pollRecord(t *testing.T, router *gin.Engine, location string) executionRecordView {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, location, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", location, rec.Code)
+		}
+		var record executionRecordView
+		if err := json.Unmarshal(rec.Body.Bytes(), &record); err != nil {
+			t.Fatalf("decoding record: %v", err)
+		}
+		if record.Status != RecordQueued && record.Status != RecordRunning {
+			return record
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("execution still %s", record.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAsync_AcceptsAndReportsResult(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	router := newAsyncRouter(t, container, &chargeStepExecutor{}, nil)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reports", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", rec.Code)
+	}
+	location := rec.Header().Get("Location")
+	if !strings.HasPrefix(location, "/_executions/") {
+		t.Fatalf("Location = %q", location)
+	}
+
+	record := pollRecord(t, router, location)
+	if record.Status != RecordSucceeded || record.FlowID != "reports" {
+		t.Fatalf("record = %+v", record)
+	}
+	if record.Response == nil || record.Response.Args["status"] != float64(201) {
+		t.Fatalf("response = %+v", record.Response)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/_executions/unknown", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown execution status = %d, want 404", rec.Code)
+	}
+}
+
+func TestAsync_ReportsFailureAndCallsBack(t *testing.T) {
+	received := make(chan executionRecordView, 1)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var record executionRecordView
+		json.NewDecoder(r.Body).Decode(&record)
+		received <- record
+	}))
+	defer callback.Close()
+
+	stepExecutor := &chargeStepExecutor{}
+	stepExecutor.fail.Store(true)
+	container := NewContainer(NewLogger(nil))
+	router := newAsyncRouter(t, container, stepExecutor, map[string]any{CallbackURLKey: callback.URL})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reports", nil))
+	record := pollRecord(t, router, rec.Header().Get("Location"))
+	if record.Status != RecordFailed || record.Error["code"] != string(ErrorCodeRuntimeError) || record.Error["status"] != float64(500) {
+		t.Fatalf("record = %+v", record)
+	}
+	// The error is rendered like a synchronous problem response.
+	if _, ok := record.Error["detail"]; ok {
+		t.Fatalf("internal error leaked: %v", record.Error)
+	}
+
+	select {
+	case got := <-received:
+		if got.ExecutionID != record.ExecutionID || got.Status != RecordFailed || got.Error["code"] != string(ErrorCodeRuntimeError) {
+			t.Fatalf("callback record = %+v", got)
+		}
+		if _, ok := got.Error["debug"]; ok {
+			t.Fatalf("internal error leaked: %v", got.Error)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback not received")
+	}
+}
+
+func TestAsync_RejectsWhenQueueIsFull(t *testing.T) {
+	stepExecutor := &chargeStepExecutor{started: make(chan struct{}, 2), release: make(chan struct{})}
+	container := NewContainer(NewLogger(nil))
+	container.SetAsyncConfig(AsyncConfig{Workers: 1, QueueSize: 1})
+	router := newAsyncRouter(t, container, stepExecutor, nil)
+	defer close(stepExecutor.release)
+
+	post := func() int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reports", nil))
+		return rec.Code
+	}
+	if code := post(); code != http.StatusAccepted {
+		t.Fatalf("first = %d, want 202", code)
+	}
+	<-stepExecutor.started // the worker is busy
+	if code := post(); code != http.StatusAccepted {
+		t.Fatalf("second = %d, want 202 (queued)", code)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reports", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.HasPrefix(rec.Header().Get("Content-Type"), ProblemContentType) {
+		t.Fatalf("third = %d (%s), want a 503 problem", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), `"code":"ASYNC_QUEUE_FULL"`) {
+		t.Fatalf("body = %s", rec.Body.String())
+	}
+}
+
+func TestSendExecutionCallback_StopsRetryingWhenContextEnds(t *testing.T) {
+	var calls atomic.Int32
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer callback.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	sendExecutionCallback(ctx, NewLogger(nil), callback.URL, executionRecordView{ExecutionID: "e1"})
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("callback kept retrying for %v after the context ended", elapsed)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("calls = %d, want 1", got)
+	}
+}
+
+func TestAsync_InvalidMode(t *testing.T) {
+	flow := &Flow{ID: "reports", Entrypoint: Entrypoint{Type: "http", Config: map[string]any{
+		"method": "POST", "path": "/reports", ModeKey: "later",
+	}}}
+	err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), NewExecutor(noopEvaluator{}, noopStepExecutor{}), nil, newTestValueStore, gin.New())
+	if err == nil || !strings.Contains(err.Error(), "invalid mode") {
+		t.Fatalf("expected invalid mode error, got %v", err)
+	}
+}
+
+func TestMarkInterruptedRecords(t *testing.T) {
+	store, err := NewFileExecutionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, record := range []*ExecutionRecord{
+		{ExecutionID: "queued-1", FlowID: "reports", Status: RecordQueued, Owner: "crashed"},
+		{ExecutionID: "running-1", FlowID: "reports", Status: RecordRunning, Owner: "crashed"},
+		{ExecutionID: "running-2", FlowID: "reports", Status: RecordRunning, Owner: "peer"},
+		{ExecutionID: "done-1", FlowID: "reports", Status: RecordSucceeded},
+	} {
+		if err := store.SaveRecord(ctx, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// running-1 is recovered from its checkpoint; running-2 runs on a live instance.
+	if err := store.SaveCheckpoint(ctx, &Checkpoint{ExecutionID: "running-1", FlowID: "reports", Owner: "crashed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Heartbeat(ctx, "peer", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	container := newDurableContainer(store)
+
+	if err := markInterruptedRecords(ctx, container); err != nil {
+		t.Fatalf("markInterruptedRecords failed: %v", err)
+	}
+	want := map[string]string{"queued-1": RecordFailed, "running-1": RecordRunning, "running-2": RecordRunning, "done-1": RecordSucceeded}
+	for id, status := range want {
+		record, _ := store.GetRecord(ctx, id)
+		if record.Status != status {
+			t.Errorf("%s status = %s, want %s", id, record.Status, status)
+		}
+	}
+	record, _ := store.GetRecord(ctx, "queued-1")
+	if record.Error == nil || record.Error.Code != string(ErrorCodeExecutionInterrupted) {
+		t.Errorf("queued-1 error = %+v", record.Error)
+	}
+	if record.Owner != container.InstanceID() {
+		t.Errorf("queued-1 owner = %q, want this instance", record.Owner)
+	}
+}
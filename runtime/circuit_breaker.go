@@ -0,0 +1,283 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CircuitBreakersRoute lists the state of every circuit breaker.
+	CircuitBreakersRoute = "/_circuit_breakers"
+
+	DefaultBreakerFailureThreshold = 5
+	DefaultBreakerOpenFor          = 30000 // ms
+	DefaultBreakerHalfOpenMax      = 1
+
+	ErrorCodeCircuitOpen FlowErrorCode = "CIRCUIT_OPEN"
+)
+
+// Circuit breaker states.
+const (
+	BreakerClosed   = "closed"    // calls pass; consecutive failures are counted
+	BreakerOpen     = "open"      // calls fail fast with CIRCUIT_OPEN
+	BreakerHalfOpen = "half_open" // a few trial calls decide whether to close
+)
+
+// CircuitBreakerConfig is the `circuit_breaker` step option. Steps naming the
+// same breaker share its state across flows and requests.
+type CircuitBreakerConfig struct {
+	Name             string `json:"name"`
+	FailureThreshold int    `json:"failure_threshold"` // consecutive failures that open the breaker
+	OpenFor          int    `json:"open_for"`          // ms the breaker stays open before a trial
+	HalfOpenMax      int    `json:"half_open_max"`     // trial calls at once while half open
+}
+
+// withDefaults fills unset fields.
+func (c CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if c.OpenFor <= 0 {
+		c.OpenFor = DefaultBreakerOpenFor
+	}
+	if c.HalfOpenMax <= 0 {
+		c.HalfOpenMax = DefaultBreakerHalfOpenMax
+	}
+	return c
+}
+
+// BreakerStatus is the state of a circuit breaker reported by
+// GET /_circuit_breakers.
+type BreakerStatus struct {
+	Name     string               `json:"name"`
+	State    string               `json:"state"`
+	Failures int                  `json:"failures"`            // consecutive failures while closed
+	OpenedAt *time.Time           `json:"opened_at,omitempty"` // set while open or half open
+	Config   CircuitBreakerConfig `json:"config"`
+}
+
+// circuitBreaker tracks the health of one dependency. Only transient errors
+// and deadline timeouts count as failures: a declined card or a validation
+// error shows the dependency is answering.
+type circuitBreaker struct {
+	config    CircuitBreakerConfig
+	container *Container
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trials   int // half-open calls in flight
+}
+
+// allow reports whether a call may proceed. Calls admitted while half open
+// take a trial slot that record releases.
+func (b *circuitBreaker) allow(ctx context.Context) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen {
+		if time.Since(b.openedAt) < time.Duration(b.config.OpenFor)*time.Millisecond {
+			return false
+		}
+		b.transition(ctx, BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.trials >= b.config.HalfOpenMax {
+			return false
+		}
+		b.trials++
+	}
+	return true
+}
+
+// record reports the outcome of a call admitted by allow.
+func (b *circuitBreaker) record(ctx context.Context, fe *FlowError) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerHalfOpen && b.trials > 0 {
+		b.trials--
+	}
+
+	switch {
+	case fe == nil || !countsAsBreakerFailure(fe):
+		if fe != nil && fe.Code == string(ErrorCodeContextCancelled) {
+			return // the caller gave up; says nothing about the dependency
+		}
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			b.transition(ctx, BreakerClosed)
+		}
+	case b.state == BreakerHalfOpen:
+		b.transition(ctx, BreakerOpen)
+	case b.state == BreakerClosed:
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.transition(ctx, BreakerOpen)
+		}
+	}
+}
+
+// transition moves the breaker to state; b.mu must be held.
+func (b *circuitBreaker) transition(ctx context.Context, state string) {
+	from := b.state
+	b.state = state
+	switch state {
+	case BreakerOpen:
+		b.openedAt = time.Now()
+		b.trials = 0
+	case BreakerClosed:
+		b.failures = 0
+		b.trials = 0
+	}
+
+	log := b.container.Logger()
+	msg := fmt.Sprintf("Circuit breaker %s: %s -> %s", b.config.Name, from, state)
+	if state == BreakerOpen {
+		log.Warn(msg, "failures", b.failures, "open_for_ms", b.config.OpenFor)
+	} else {
+		log.Info(msg)
+	}
+	b.container.Metrics().RecordBreakerTransition(ctx, b.config.Name, from, state)
+}
+
+// retryAfter is the time left until an open breaker admits a trial call.
+func (b *circuitBreaker) retryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != BreakerOpen {
+		return 0
+	}
+	left := time.Duration(b.config.OpenFor)*time.Millisecond - time.Since(b.openedAt)
+	return max(left, 0)
+}
+
+func (b *circuitBreaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStatus{Name: b.config.Name, State: b.state, Failures: b.failures, Config: b.config}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt.UTC()
+		s.OpenedAt = &openedAt
+	}
+	return s
+}
+
+func countsAsBreakerFailure(fe *FlowError) bool {
+	return fe.Type == ErrorTypeTransient || fe.Code == string(ErrorCodeDeadlineExceeded)
+}
+
+// circuitOpenError is the transient error of a call rejected by an open breaker.
+func circuitOpenError(b *circuitBreaker, stepID string) *FlowError {
+	return &FlowError{
+		Type:    ErrorTypeTransient,
+		Code:    string(ErrorCodeCircuitOpen),
+		Message: fmt.Sprintf("circuit breaker %s is open", b.config.Name),
+		Step:    stepID,
+		Meta: map[string]any{
+			"circuit_breaker": b.config.Name,
+			"retry_after_ms":  b.retryAfter().Milliseconds(),
+		},
+	}
+}
+
+// breakerRegistry holds the process-wide circuit breakers by name.
+type breakerRegistry struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// circuitBreaker returns the breaker named by cfg, creating it on first use.
+// A breaker keeps the configuration it was created with.
+func (c *Container) circuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	c.breakers.mu.Lock()
+	defer c.breakers.mu.Unlock()
+	if b, ok := c.breakers.breakers[cfg.Name]; ok {
+		return b
+	}
+	if c.breakers.breakers == nil {
+		c.breakers.breakers = make(map[string]*circuitBreaker)
+	}
+	b := &circuitBreaker{config: cfg.withDefaults(), container: c, state: BreakerClosed}
+	c.breakers.breakers[cfg.Name] = b
+	return b
+}
+
+// RegisterCircuitBreakers creates the breakers the steps of flows declare, so
+// they are listed before their first call. Steps naming the same breaker
+// must configure it identically.
+func (c *Container) RegisterCircuitBreakers(flows map[string]Flow) error {
+	declared := make(map[string]string) // breaker name -> "flow/step" declaring it
+	return walkFlowSteps(flows, func(flowID string, s Step) error {
+		if s.CircuitBreaker == nil {
+			return nil
+		}
+		b := c.circuitBreaker(*s.CircuitBreaker)
+		where := flowID + "/" + s.ID
+		if first, ok := declared[b.config.Name]; ok && !reflect.DeepEqual(b.config, s.CircuitBreaker.withDefaults()) {
+			return fmt.Errorf("step %s: circuit breaker %q is configured differently in %s", where, b.config.Name, first)
+		}
+		declared[b.config.Name] = where
+		return nil
+	})
+}
+
+// walkFlowSteps calls fn for every step of flows, including parallel
+// branches, in flow ID order.
+func walkFlowSteps(flows map[string]Flow, fn func(flowID string, s Step) error) error {
+	var walk func(flowID string, steps []Step) error
+	walk = func(flowID string, steps []Step) error {
+		for _, s := range steps {
+			if s.Parallel != nil {
+				if err := walk(flowID, s.Parallel.Steps); err != nil {
+					return err
+				}
+			}
+			if err := fn(flowID, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	ids := make([]string, 0, len(flows))
+	for id := range flows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := walk(id, flows[id].Steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CircuitBreakers returns the state of every breaker, sorted by name.
+func (c *Container) CircuitBreakers() []BreakerStatus {
+	c.breakers.mu.Lock()
+	breakers := make([]*circuitBreaker, 0, len(c.breakers.breakers))
+	for _, b := range c.breakers.breakers {
+		breakers = append(breakers, b)
+	}
+	c.breakers.mu.Unlock()
+
+	out := make([]BreakerStatus, len(breakers))
+	for i, b := range breakers {
+		out[i] = b.status()
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func circuitBreakersHandler(container *Container) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"circuit_breakers": container.CircuitBreakers()})
+	}
+}
@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// flakyStepExecutor fails the primary body of every step with err while it
+// is set and stores "fallback" when a fallback body runs.
+type flakyStepExecutor struct {
+	calls atomic.Int32
+	err   atomic.Pointer[FlowError]
+}
+
+func (s *flakyStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	if execution.ActivePath() == SuccessPathFallback {
+		execution.State().Store().Set(step.ID, "fallback")
+		return "", nil
+	}
+	s.calls.Add(1)
+	if fe := s.err.Load(); fe != nil {
+		copy := *fe
+		return "", &copy
+	}
+	execution.State().Store().Set(step.ID, "primary")
+	return "", nil
+}
+
+func runBreakerStep(t *testing.T, container *Container, stepExecutor StepExecutor, step Step) (any, error) {
+	t.Helper()
+	flow := &Flow{ID: "payments", Steps: []Step{step}}
+	execution := NewExecution(flow, container, nil, newTestValueStore())
+	err := NewExecutor(noopEvaluator{}, stepExecutor).ExecuteSteps(execution)
+	return execution.Values()[step.ID], err
+}
+
+func TestCircuitBreaker_OpensAndFailsFast(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	stepExecutor := &flakyStepExecutor{}
+	stepExecutor.err.Store(&FlowError{Type: ErrorTypeTransient, Code: "UPSTREAM_DOWN", Message: "stripe unavailable"})
+	step := Step{
+		ID:             "charge",
+		Retry:          &RetryConfig{MaxAttempts: 2},
+		CircuitBreaker: &CircuitBreakerConfig{Name: "stripe", FailureThreshold: 3, OpenFor: 50},
+	}
+
+	// Two requests: 2 + 1 attempts reach the threshold on the third call.
+	for range 2 {
+		if _, err := runBreakerStep(t, container, stepExecutor, step); err == nil {
+			t.Fatal("expected failure")
+		}
+	}
+	if got := stepExecutor.calls.Load(); got != 3 {
+		t.Fatalf("calls = %d, want 3", got)
+	}
+
+	_, err := runBreakerStep(t, container, stepExecutor, step)
+	fe, ok := err.(*FlowError)
+	if !ok || fe.Code != string(ErrorCodeCircuitOpen) || fe.Type != ErrorTypeTransient || fe.Meta["circuit_breaker"] != "stripe" {
+		t.Fatalf("expected CIRCUIT_OPEN, got %v", err)
+	}
+	if got := stepExecutor.calls.Load(); got != 3 {
+		t.Fatalf("an open breaker must not call the step, calls = %d", got)
+	}
+
+	// The fallback runs right away.
+	withFallback := step
+	withFallback.FallbackBody = "cached()"
+	if result, err := runBreakerStep(t, container, stepExecutor, withFallback); err != nil || result != "fallback" {
+		t.Fatalf("result = %v, err = %v, want fallback", result, err)
+	}
+
+	// After open_for a trial call closes the breaker again.
+	time.Sleep(60 * time.Millisecond)
+	stepExecutor.err.Store(nil)
+	if result, err := runBreakerStep(t, container, stepExecutor, step); err != nil || result != "primary" {
+		t.Fatalf("result = %v, err = %v, want primary", result, err)
+	}
+	if states := container.CircuitBreakers(); len(states) != 1 || states[0].State != BreakerClosed {
+		t.Fatalf("breakers = %+v, want stripe closed", states)
+	}
+}
+
+func TestCircuitBreaker_HalfOpenFailureReopens(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	b := container.circuitBreaker(CircuitBreakerConfig{Name: "stripe", FailureThreshold: 1, OpenFor: 20, HalfOpenMax: 1})
+	ctx := context.Background()
+	down := &FlowError{Type: ErrorTypeTransient, Code: "UPSTREAM_DOWN"}
+
+	b.allow(ctx)
+	b.record(ctx, down)
+	if b.allow(ctx) {
+		t.Fatal("open breaker admitted a call")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !b.allow(ctx) {
+		t.Fatal("half open breaker rejected the trial call")
+	}
+	if b.allow(ctx) {
+		t.Fatal("half open breaker admitted more than half_open_max calls")
+	}
+	b.record(ctx, down)
+	if s := b.status(); s.State != BreakerOpen || s.OpenedAt == nil {
+		t.Fatalf("status = %+v, want open", s)
+	}
+}
+
+func TestCircuitBreaker_PermanentErrorsDoNotCount(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	stepExecutor := &flakyStepExecutor{}
+	stepExecutor.err.Store(&FlowError{Type: ErrorTypePermanent, Code: "CARD_DECLINED", Message: "declined"})
+	step := Step{ID: "charge", CircuitBreaker: &CircuitBreakerConfig{Name: "stripe", FailureThreshold: 2}}
+
+	for range 5 {
+		_, err := runBreakerStep(t, container, stepExecutor, step)
+		if fe, _ := err.(*FlowError); fe == nil || fe.Code != "CARD_DECLINED" {
+			t.Fatalf("expected CARD_DECLINED, got %v", err)
+		}
+	}
+	if got := stepExecutor.calls.Load(); got != 5 {
+		t.Fatalf("calls = %d, want 5", got)
+	}
+}
+
+func TestRegisterCircuitBreakers(t *testing.T) {
+	stripe := &CircuitBreakerConfig{Name: "stripe", FailureThreshold: 5}
+	flows := map[string]Flow{
+		"charge": {ID: "charge", Steps: []Step{{ID: "charge", CircuitBreaker: stripe}}},
+		"refund": {ID: "refund", Steps: []Step{{ID: "fanout", Parallel: &ParallelGroup{Steps: []Step{
+			{ID: "refund", CircuitBreaker: &CircuitBreakerConfig{Name: "stripe", FailureThreshold: 5, OpenFor: DefaultBreakerOpenFor}},
+			{ID: "notify", CircuitBreaker: &CircuitBreakerConfig{Name: "mailer"}},
+		}}}}},
+	}
+	container := NewContainer(NewLogger(nil))
+	if err := container.RegisterCircuitBreakers(flows); err != nil {
+		t.Fatalf("RegisterCircuitBreakers failed: %v", err)
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	router.GET(CircuitBreakersRoute, circuitBreakersHandler(container))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, CircuitBreakersRoute, nil))
+	var body struct {
+		CircuitBreakers []BreakerStatus `json:"circuit_breakers"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if len(body.CircuitBreakers) != 2 || body.CircuitBreakers[0].Name != "mailer" || body.CircuitBreakers[1].State != BreakerClosed {
+		t.Fatalf("circuit breakers = %+v", body.CircuitBreakers)
+	}
+	if cfg := body.CircuitBreakers[0].Config; cfg.FailureThreshold != DefaultBreakerFailureThreshold || cfg.HalfOpenMax != DefaultBreakerHalfOpenMax {
+		t.Fatalf("mailer config = %+v, want defaults", cfg)
+	}
+
+	flows["refund"].Steps[0].Parallel.Steps[0].CircuitBreaker.FailureThreshold = 10
+	err := NewContainer(NewLogger(nil)).RegisterCircuitBreakers(flows)
+	if err == nil || !strings.Contains(err.Error(), `circuit breaker "stripe" is configured differently`) {
+		t.Fatalf("expected a conflict error, got %v", err)
+	}
+}
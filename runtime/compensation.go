@@ -0,0 +1,208 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CompensationResult is the outcome of one compensation run during a
+// rollback. The results are exposed to on_error as error.compensations.
+type CompensationResult struct {
+	Step     string      `json:"step"`
+	Path     SuccessPath `json:"path"`
+	Success  bool        `json:"success"`
+	Error    *FlowError  `json:"error,omitempty"`
+	Attempts int         `json:"attempts"`
+}
+
+// ToMap converts the result to a map suitable for injection into Risor contexts.
+func (r CompensationResult) ToMap() map[string]any {
+	m := map[string]any{
+		"step":     r.Step,
+		"path":     string(r.Path),
+		"success":  r.Success,
+		"error":    nil,
+		"attempts": r.Attempts,
+	}
+	if r.Error != nil {
+		m["error"] = r.Error.ToMap()
+	}
+	return m
+}
+
+// DeadLetter records a compensation that still failed after its retries, so
+// the side effect it should have undone can be repaired by hand.
+type DeadLetter struct {
+	ExecutionID string            `json:"execution_id"`
+	FlowID      string            `json:"flow_id"`
+	Entry       CompensationEntry `json:"entry"`
+	Error       *FlowError        `json:"error"`
+	Attempts    int               `json:"attempts"`
+	FailedAt    time.Time         `json:"failed_at"`
+}
+
+// DeadLetterSink receives compensations that could not be completed.
+type DeadLetterSink interface {
+	WriteDeadLetter(ctx context.Context, letter *DeadLetter) error
+}
+
+// FileDeadLetterSink writes each dead letter as a JSON file into a directory.
+type FileDeadLetterSink struct {
+	dir string
+}
+
+// NewFileDeadLetterSink creates the directory if needed.
+func NewFileDeadLetterSink(dir string) (*FileDeadLetterSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating dead letter directory: %w", err)
+	}
+	return &FileDeadLetterSink{dir: dir}, nil
+}
+
+func (s *FileDeadLetterSink) WriteDeadLetter(_ context.Context, letter *DeadLetter) error {
+	data, err := json.MarshalIndent(letter, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding dead letter: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s-%d", letter.ExecutionID, letter.Entry.StepID, letter.FailedAt.UnixNano())
+	path, err := storeFilePath(s.dir, name)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// runCompensations iterates the CompensationStack in LIFO order and executes
+// each compensation body under its retry and timeout policy. Failures do not
+// stop remaining compensations; they are reported in the returned results and
+// written to the container's DeadLetterSink, if any.
+// Uses a detached context so compensation DB/HTTP calls complete even if the flow
+// context was already cancelled (e.g. by a timeout).
+func (e *Executor) runCompensations(execution *Execution) []CompensationResult {
+	oee, ok := e.stepExecutor.(OnErrorExecutor)
+	if !ok {
+		return nil
+	}
+
+	safeExec := execution.WithContext(context.WithoutCancel(execution))
+	stack := execution.State().CompensationSnapshot()
+	var results []CompensationResult
+	for i := len(stack) - 1; i >= 0; i-- {
+		results = append(results, e.runCompensation(safeExec, oee, stack[i]))
+	}
+	return results
+}
+
+// runCompensation runs one compensation body with retries inside its own span.
+// The timeout bounds all attempts together, like a step timeout.
+func (e *Executor) runCompensation(execution *Execution, oee OnErrorExecutor, entry CompensationEntry) CompensationResult {
+	if entry.Iteration != nil {
+		execution = execution.WithIteration(entry.Iteration)
+	}
+	log := execution.Logger()
+	result := CompensationResult{Step: entry.StepID, Path: entry.Path}
+	start := time.Now()
+
+	spanName := fmt.Sprintf("compensate %s", entry.StepID)
+	spanAttrs := []attribute.KeyValue{
+		attribute.String("step.id", entry.StepID),
+		attribute.String("compensation.path", string(entry.Path)),
+	}
+	if entry.Iteration != nil {
+		spanName = fmt.Sprintf("compensate %s[%d]", entry.StepID, entry.Iteration.Index)
+		spanAttrs = append(spanAttrs, attribute.Int("step.iteration", entry.Iteration.Index))
+	}
+	spanCtx, span := execution.Tracer().Start(execution.ctx, spanName, trace.WithAttributes(spanAttrs...))
+	defer span.End()
+
+	ctx := context.Context(spanCtx)
+	cancel := func() {}
+	if entry.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(spanCtx, time.Duration(entry.Timeout)*time.Millisecond)
+	}
+	defer cancel()
+
+	maxAttempts := 1
+	if entry.Retry != nil && entry.Retry.MaxAttempts > 1 {
+		maxAttempts = entry.Retry.MaxAttempts
+	}
+	// shouldRetry reads the policy from a step.
+	policy := Step{ID: entry.StepID, Retry: entry.Retry}
+
+	log.Info(fmt.Sprintf("Running compensation for step %s (path: %s)", entry.StepID, entry.Path))
+attemptLoop:
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 && entry.Retry.Delay > 0 {
+			select {
+			case <-time.After(e.computeDelay(entry.Retry, attempt)):
+			case <-ctx.Done():
+				result.Error = e.flowError(execution, entry.StepID, ctx.Err())
+				result.Error.Retries = attempt
+				break attemptLoop
+			}
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			result.Error = e.flowError(execution, entry.StepID, ctxErr)
+			result.Error.Retries = attempt
+			break
+		}
+
+		result.Attempts++
+		err := oee.ExecuteCompensation(execution.WithContext(ctx), entry.Body, entry.StepID, entry.Path)
+		if err == nil {
+			result.Success = true
+			result.Error = nil
+			break
+		}
+		result.Error = toFlowError(err, entry.StepID, attempt)
+		result.Error.Retries = attempt
+		log.Error(fmt.Sprintf("Compensation failed for step %s (attempt %d/%d)", entry.StepID, attempt+1, maxAttempts),
+			"error_type", result.Error.Type,
+			"error_code", result.Error.Code,
+			"error", result.Error.Message)
+
+		if attempt+1 < maxAttempts && e.shouldRetry(execution, policy, result.Error) {
+			continue
+		}
+		break
+	}
+
+	execution.Metrics().RecordCompensation(spanCtx, execFlowID(execution), entry.StepID, string(entry.Path),
+		classifyMetricOutcome(lastFlowError(result.Error)), time.Since(start))
+	span.SetAttributes(attribute.Int("compensation.attempts", result.Attempts))
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		span.SetStatus(codes.Error, result.Error.Message)
+		e.deadLetter(execution, entry, result)
+	}
+	return result
+}
+
+// deadLetter hands a failed compensation to the container's DeadLetterSink.
+func (e *Executor) deadLetter(execution *Execution, entry CompensationEntry, result CompensationResult) {
+	if execution.Container == nil {
+		return
+	}
+	sink := execution.Container.DeadLetterSink()
+	if sink == nil {
+		return
+	}
+	letter := &DeadLetter{
+		ExecutionID: execution.ID,
+		FlowID:      execFlowID(execution),
+		Entry:       entry,
+		Error:       result.Error,
+		Attempts:    result.Attempts,
+		FailedAt:    time.Now().UTC(),
+	}
+	if err := sink.WriteDeadLetter(execution, letter); err != nil {
+		execution.Logger().Error(fmt.Sprintf("Writing dead letter for step %s failed", entry.StepID), "error", err)
+	}
+}
@@ -0,0 +1,143 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rollbackStepExecutor fails the step named "fail". Compensations fail with a
+// transient error while failures[stepID] is positive and block until their
+// context is done when the body is "hang".
+type rollbackStepExecutor struct {
+	failures map[string]int
+	attempts map[string]int
+	handled  *FlowError
+}
+
+func (s *rollbackStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	if step.ID == "fail" {
+		return "", errors.New("payment declined")
+	}
+	return "", nil
+}
+
+func (s *rollbackStepExecutor) ExecuteOnErrorHandler(execution *Execution, body string, fe *FlowError) error {
+	s.handled = fe
+	return nil
+}
+
+func (s *rollbackStepExecutor) ExecuteCompensation(execution *Execution, body string, stepID string, path SuccessPath) error {
+	s.attempts[stepID]++
+	if body == "hang" {
+		<-execution.Done()
+		return execution.Err()
+	}
+	if s.failures[stepID] > 0 {
+		s.failures[stepID]--
+		return &FlowError{Type: ErrorTypeTransient, Code: "REFUND_UNAVAILABLE", Message: "refund service unavailable"}
+	}
+	return nil
+}
+
+func runRollback(t *testing.T, container *Container, stepExecutor *rollbackStepExecutor, steps ...Step) {
+	t.Helper()
+	flow := &Flow{ID: "checkout", Steps: append(steps, Step{ID: "fail"}), OnErrorBody: "handle()"}
+	execution := NewExecution(flow, container, nil, newTestValueStore())
+	if err := NewExecutor(noopEvaluator{}, stepExecutor).ExecuteSteps(execution); err != nil {
+		t.Fatalf("on_error should handle the failure, got %v", err)
+	}
+	if stepExecutor.handled == nil {
+		t.Fatal("on_error was not called")
+	}
+}
+
+func TestCompensation_RetriesAndReportsResults(t *testing.T) {
+	stepExecutor := &rollbackStepExecutor{
+		failures: map[string]int{"reserve": 2, "charge": 5},
+		attempts: map[string]int{},
+	}
+	runRollback(t, NewContainer(NewLogger(nil)), stepExecutor,
+		Step{ID: "reserve", CompensateBody: "release()", CompensateRetry: &RetryConfig{MaxAttempts: 3}},
+		Step{ID: "charge", CompensateBody: "refund()", CompensateRetry: &RetryConfig{MaxAttempts: 2}},
+	)
+
+	if stepExecutor.attempts["reserve"] != 3 || stepExecutor.attempts["charge"] != 2 {
+		t.Fatalf("attempts = %v, want reserve 3, charge 2", stepExecutor.attempts)
+	}
+
+	results := stepExecutor.handled.Compensations
+	if len(results) != 2 {
+		t.Fatalf("compensations = %+v, want 2 results", results)
+	}
+	// LIFO: the last completed step is compensated first.
+	if r := results[0]; r.Step != "charge" || r.Success || r.Attempts != 2 || r.Error == nil || r.Error.Code != "REFUND_UNAVAILABLE" {
+		t.Errorf("charge result = %+v", r)
+	}
+	if r := results[1]; r.Step != "reserve" || !r.Success || r.Attempts != 3 || r.Error != nil {
+		t.Errorf("reserve result = %+v", r)
+	}
+
+	reported, ok := stepExecutor.handled.ToMap()["compensations"].([]any)
+	if !ok || len(reported) != 2 {
+		t.Fatalf("error.compensations = %v", stepExecutor.handled.ToMap()["compensations"])
+	}
+	if first := reported[0].(map[string]any); first["step"] != "charge" || first["success"] != false {
+		t.Errorf("error.compensations[0] = %v", first)
+	}
+}
+
+func TestCompensation_TimeoutBoundsAllAttempts(t *testing.T) {
+	stepExecutor := &rollbackStepExecutor{attempts: map[string]int{}}
+	start := time.Now()
+	runRollback(t, NewContainer(NewLogger(nil)), stepExecutor,
+		Step{ID: "reserve", CompensateBody: "hang", CompensateTimeout: 50, CompensateRetry: &RetryConfig{MaxAttempts: 5}},
+	)
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("compensation took %v, want it bounded by its timeout", elapsed)
+	}
+	r := stepExecutor.handled.Compensations[0]
+	if r.Success || r.Error == nil || r.Error.Code != string(ErrorCodeDeadlineExceeded) {
+		t.Fatalf("result = %+v, want a deadline error", r)
+	}
+}
+
+func TestCompensation_WritesDeadLetter(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewFileDeadLetterSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := NewContainer(NewLogger(nil))
+	container.SetDeadLetterSink(sink)
+	stepExecutor := &rollbackStepExecutor{
+		failures: map[string]int{"reserve": 1, "charge": 1},
+		attempts: map[string]int{},
+	}
+	runRollback(t, container, stepExecutor,
+		Step{ID: "reserve", CompensateBody: "release()", CompensateRetry: &RetryConfig{MaxAttempts: 2}},
+		Step{ID: "charge", CompensateBody: "refund()"},
+	)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("dead letters = %v, want only the charge refund", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var letter DeadLetter
+	if err := json.Unmarshal(data, &letter); err != nil {
+		t.Fatalf("decoding dead letter: %v", err)
+	}
+	if letter.FlowID != "checkout" || letter.Entry.StepID != "charge" || letter.Entry.Body != "refund()" ||
+		letter.Attempts != 1 || letter.Error == nil || letter.ExecutionID == "" {
+		t.Fatalf("dead letter = %+v", letter)
+	}
+}
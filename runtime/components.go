@@ -8,11 +8,14 @@ type Flow struct {
 	Return      Return         `yaml:"return"`
 	OnErrorBody string         `yaml:"-"`
 	Timeout     int            `yaml:"-"`
+	Recovery    string         `yaml:"recovery,omitempty"` // RecoveryResume or RecoveryCompensate enables checkpoints
+	Globals     map[string]any `yaml:"-"`                  // set by the flow loader for step code, e.g. imported modules
 }
 
 type Entrypoint struct {
 	Type   string         `yaml:"type"`
 	Config map[string]any `yaml:"config"`
+	Schema *RequestSchema `yaml:"-"` // compiled request schema, set by the flow loader
 }
 
 type Step struct {
@@ -20,12 +23,58 @@ type Step struct {
 	Type           string         `yaml:"type"`
 	Condition      string         `yaml:"condition,omitempty"`
 	Args           map[string]any `yaml:"args"`
-	Next           string         `yaml:"next,omitempty"`
+	Next           string         `yaml:"next,omitempty"`           // step ID or expression choosing the next step
+	MaxIterations  int            `yaml:"max_iterations,omitempty"` // backward-jump guard, DefaultMaxIterations when 0
 	Retry          *RetryConfig   `yaml:"retry,omitempty"`
 	Body           string         `yaml:"-"`
 	Timeout        int            `yaml:"-"`
 	FallbackBody   string         `yaml:"-"`
 	CompensateBody string         `yaml:"-"`
+	// CompensateRetry and CompensateTimeout come from compensate(retry: ..., timeout: N).
+	CompensateRetry   *RetryConfig          `yaml:"-"`
+	CompensateTimeout int                   `yaml:"-"`
+	Catches           []CatchBlock          `yaml:"-"` // catch(code: ..., type: ...) blocks, tried in order
+	CircuitBreaker    *CircuitBreakerConfig `yaml:"-"` // shared breaker guarding the primary body
+	Bulkhead          *BulkheadConfig       `yaml:"-"` // concurrency: {key, limit, queue_timeout}
+	Parallel          *ParallelGroup        `yaml:"-"` // set when the step is a parallel group
+	ForEach           *ForEachConfig        `yaml:"-"` // set when the step fans out over a collection
+}
+
+// CatchBlock handles the errors of a step that match its code and type.
+// Empty fields match any value, so a block without options catches everything.
+type CatchBlock struct {
+	Code string
+	Type FlowErrorType
+	Body string
+}
+
+// Matches reports whether the block handles fe.
+func (c CatchBlock) Matches(fe *FlowError) bool {
+	return (c.Code == "" || c.Code == fe.Code) && (c.Type == "" || c.Type == fe.Type)
+}
+
+// Parallel group failure modes.
+const (
+	ParallelFailFast   = "fail_fast"   // cancel remaining branches on the first failure
+	ParallelCollectAll = "collect_all" // let every branch finish, then report all failures
+)
+
+// ParallelGroup runs its steps concurrently and joins on completion.
+// Each branch keeps its own condition, retry, timeout, fallback and
+// compensation, and stores its result under its own step ID.
+type ParallelGroup struct {
+	Mode  string
+	Steps []Step
+}
+
+// ForEachConfig runs a step once per item of a collection. Each item gets
+// its own span, retry policy, fallback and compensation; the item results
+// are collected into a list under the step ID.
+type ForEachConfig struct {
+	Items       string // expression evaluating to the collection
+	As          string // name the current item is exposed under (default "item")
+	Concurrency int    // items run at once (default 1)
+	MaxFailures int    // failed items tolerated before the step fails
 }
 
 type Return struct {
@@ -2,7 +2,9 @@ package runtime
 
 import (
 	"context"
+	"sync"
 
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -10,16 +12,35 @@ import (
 const (
 	InterfaceInitializer = "Initializer"
 	InterfaceShutdowner  = "Shutdowner"
+	InterfaceEntrypoint  = "EntrypointProvider"
+	InterfaceExecStore   = "ExecutionStoreProvider"
+	InterfaceIdemStore   = "IdempotencyStoreProvider"
+	InterfaceDeadLetter  = "DeadLetterSinkProvider"
 )
 
 type Container struct {
 	tasks            map[string]Task
 	ResponseHandlers *ResponseHandlerRegistry
 	plugins          *pluginRegistry
+	flows            *flowRegistry
 	observability    *ObservabilityRuntime
 	logger           Logger
 	tracer           trace.Tracer
 	metrics          *Metrics
+	executionStore   ExecutionStore
+	idempotencyStore IdempotencyStore
+	deadLetterSink   DeadLetterSink
+	breakers         breakerRegistry
+	bulkheads        bulkheadRegistry
+	recordStore      ExecutionRecordStore
+	recordStoreOnce  sync.Once
+	asyncConfig      AsyncConfig
+	errorResponses   ErrorResponseConfig
+	async            *asyncPool
+	asyncOnce        sync.Once
+	instanceID       string
+	callbacks        context.Context // ends when shutdown gives up on callbacks
+	cancelCallbacks  context.CancelFunc
 }
 
 // Logger returns the container's logger for framework-level (non-execution) logs.
@@ -42,7 +63,113 @@ func (c *Container) Metrics() *Metrics {
 	return c.metrics
 }
 
+// InstanceID identifies this process among the replicas sharing an
+// ExecutionStore. Executions it runs are owned by it until it stops
+// heartbeating.
+func (c *Container) InstanceID() string {
+	return c.instanceID
+}
+
+// ExecutionStore returns the store checkpointing flows with a recovery
+// policy, or nil when durability is not configured.
+func (c *Container) ExecutionStore() ExecutionStore {
+	return c.executionStore
+}
+
+// SetExecutionStore configures where execution checkpoints are kept.
+// Plugins can provide a store instead by implementing ExecutionStoreProvider.
+func (c *Container) SetExecutionStore(store ExecutionStore) {
+	c.executionStore = store
+}
+
+// IdempotencyStore returns the store backing HTTP idempotency keys, or nil
+// when none is configured.
+func (c *Container) IdempotencyStore() IdempotencyStore {
+	return c.idempotencyStore
+}
+
+// SetIdempotencyStore configures where idempotent responses are kept.
+// Plugins can provide a store instead by implementing IdempotencyStoreProvider.
+func (c *Container) SetIdempotencyStore(store IdempotencyStore) {
+	c.idempotencyStore = store
+}
+
+// DeadLetterSink returns where compensations that failed after their retries
+// are written, or nil when failures are only logged and reported to on_error.
+func (c *Container) DeadLetterSink() DeadLetterSink {
+	return c.deadLetterSink
+}
+
+// SetDeadLetterSink configures where failed compensations are written.
+// Plugins can provide a sink instead by implementing DeadLetterSinkProvider.
+func (c *Container) SetDeadLetterSink(sink DeadLetterSink) {
+	c.deadLetterSink = sink
+}
+
+// ExecutionRecordStore returns where async execution records are kept: the
+// store set with SetExecutionRecordStore, else the ExecutionStore when it
+// also implements ExecutionRecordStore, else process memory.
+func (c *Container) ExecutionRecordStore() ExecutionRecordStore {
+	c.recordStoreOnce.Do(func() {
+		if c.recordStore != nil {
+			return
+		}
+		if store, ok := c.executionStore.(ExecutionRecordStore); ok {
+			c.recordStore = store
+			return
+		}
+		c.recordStore = newMemoryExecutionRecordStore(DefaultMemoryRecordLimit)
+	})
+	return c.recordStore
+}
+
+// SetExecutionRecordStore configures where async execution records are kept.
+// It must be called before the first async request.
+func (c *Container) SetExecutionRecordStore(store ExecutionRecordStore) {
+	c.recordStore = store
+}
+
+// SetAsyncConfig sizes the worker pool of async http entrypoints. Zero
+// fields keep their defaults. It must be called before flows are registered.
+func (c *Container) SetAsyncConfig(cfg AsyncConfig) {
+	c.asyncConfig = cfg
+}
+
+// SetErrorResponseConfig sets how flows failing without a response answer.
+func (c *Container) SetErrorResponseConfig(cfg ErrorResponseConfig) {
+	c.errorResponses = cfg
+}
+
+// ErrorResponses returns how flows failing without a response answer.
+func (c *Container) ErrorResponses() ErrorResponseConfig {
+	return c.errorResponses
+}
+
+// asyncPool starts the async worker pool on first use.
+func (c *Container) asyncPool() *asyncPool {
+	c.asyncOnce.Do(func() {
+		cfg := c.asyncConfig
+		if cfg.Workers <= 0 {
+			cfg.Workers = DefaultAsyncWorkers
+		}
+		if cfg.QueueSize <= 0 {
+			cfg.QueueSize = DefaultAsyncQueueSize
+		}
+		c.async = newAsyncPool(cfg)
+	})
+	return c.async
+}
+
+// stopAsync waits for queued and running async executions.
+func (c *Container) stopAsync(ctx context.Context) error {
+	if c.async == nil {
+		return nil
+	}
+	return c.async.stop(ctx)
+}
+
 func NewContainer(logger Logger) *Container {
+	callbacks, cancelCallbacks := context.WithCancel(context.Background())
 	return &Container{
 		tasks:            make(map[string]Task),
 		ResponseHandlers: NewResponseHandlerRegistry(),
@@ -50,6 +177,9 @@ func NewContainer(logger Logger) *Container {
 		logger:           logger,
 		tracer:           newNoopTracer(),
 		metrics:          NewNoopMetrics(),
+		instanceID:       uuid.New().String(),
+		callbacks:        callbacks,
+		cancelCallbacks:  cancelCallbacks,
 	}
 }
 
@@ -11,6 +11,7 @@ type pluginRegistry struct {
 	plugins            map[string]any
 	pluginsByInterface map[string][]any
 	pluginNameIndex    map[any]string
+	entrypoints        map[string]EntrypointProvider
 }
 
 func newPluginRegistry() *pluginRegistry {
@@ -18,6 +19,7 @@ func newPluginRegistry() *pluginRegistry {
 		plugins:            make(map[string]any),
 		pluginsByInterface: make(map[string][]any),
 		pluginNameIndex:    make(map[any]string),
+		entrypoints:        make(map[string]EntrypointProvider),
 	}
 }
 
@@ -26,6 +28,12 @@ func (r *pluginRegistry) Register(pluginName string, plugin any) ([]pluginexec.T
 		return nil, nil, fmt.Errorf("plugin cannot be nil")
 	}
 
+	if provider, ok := plugin.(EntrypointProvider); ok {
+		if err := r.registerEntrypoint(pluginName, provider); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	r.plugins[pluginName] = plugin
 	r.pluginNameIndex[plugin] = pluginName
 	r.detectPluginInterfaces(plugin)
@@ -71,6 +79,21 @@ func (r *pluginRegistry) Shutdown(ctx context.Context, logger Logger) error {
 	return nil
 }
 
+func (r *pluginRegistry) registerEntrypoint(pluginName string, provider EntrypointProvider) error {
+	typ := provider.EntrypointType()
+	switch typ {
+	case "":
+		return fmt.Errorf("plugin %q: entrypoint type cannot be empty", pluginName)
+	case EntrypointHTTP, EntrypointSchedule, EntrypointInternal:
+		return fmt.Errorf("plugin %q: entrypoint type %q is built in", pluginName, typ)
+	}
+	if existing, ok := r.entrypoints[typ]; ok {
+		return fmt.Errorf("plugin %q: entrypoint type %q already provided by plugin %q", pluginName, typ, r.pluginName(existing))
+	}
+	r.entrypoints[typ] = provider
+	return nil
+}
+
 func (r *pluginRegistry) detectPluginInterfaces(plugin any) {
 	if _, ok := plugin.(Initializer); ok {
 		r.pluginsByInterface[InterfaceInitializer] = append(r.pluginsByInterface[InterfaceInitializer], plugin)
@@ -79,6 +102,22 @@ func (r *pluginRegistry) detectPluginInterfaces(plugin any) {
 	if _, ok := plugin.(Shutdowner); ok {
 		r.pluginsByInterface[InterfaceShutdowner] = append(r.pluginsByInterface[InterfaceShutdowner], plugin)
 	}
+
+	if _, ok := plugin.(EntrypointProvider); ok {
+		r.pluginsByInterface[InterfaceEntrypoint] = append(r.pluginsByInterface[InterfaceEntrypoint], plugin)
+	}
+
+	if _, ok := plugin.(ExecutionStoreProvider); ok {
+		r.pluginsByInterface[InterfaceExecStore] = append(r.pluginsByInterface[InterfaceExecStore], plugin)
+	}
+
+	if _, ok := plugin.(IdempotencyStoreProvider); ok {
+		r.pluginsByInterface[InterfaceIdemStore] = append(r.pluginsByInterface[InterfaceIdemStore], plugin)
+	}
+
+	if _, ok := plugin.(DeadLetterSinkProvider); ok {
+		r.pluginsByInterface[InterfaceDeadLetter] = append(r.pluginsByInterface[InterfaceDeadLetter], plugin)
+	}
 }
 
 func (r *pluginRegistry) pluginName(plugin any) string {
@@ -105,8 +144,72 @@ func (c *Container) GetPlugin(name string) any {
 	return c.plugins.Get(name)
 }
 
+// EntrypointProvider returns the plugin serving the given entrypoint type.
+func (c *Container) EntrypointProvider(entrypointType string) (EntrypointProvider, bool) {
+	provider, ok := c.plugins.entrypoints[entrypointType]
+	return provider, ok
+}
+
+// Initialize runs plugin Initialize methods, then adopts the execution and
+// idempotency stores and the dead letter sink provided by plugins unless they
+// were set explicitly.
 func (c *Container) Initialize(ctx context.Context) error {
-	return c.plugins.Initialize(ctx, c.logger)
+	if err := c.plugins.Initialize(ctx, c.logger); err != nil {
+		return err
+	}
+	if c.executionStore == nil {
+		store, err := providedStore(c, InterfaceExecStore, "execution store", func(p any) (ExecutionStore, bool) {
+			s := p.(ExecutionStoreProvider).ExecutionStore()
+			return s, s != nil
+		})
+		if err != nil {
+			return err
+		}
+		c.executionStore = store
+	}
+	if c.idempotencyStore == nil {
+		store, err := providedStore(c, InterfaceIdemStore, "idempotency store", func(p any) (IdempotencyStore, bool) {
+			s := p.(IdempotencyStoreProvider).IdempotencyStore()
+			return s, s != nil
+		})
+		if err != nil {
+			return err
+		}
+		c.idempotencyStore = store
+	}
+	if c.deadLetterSink == nil {
+		sink, err := providedStore(c, InterfaceDeadLetter, "dead letter sink", func(p any) (DeadLetterSink, bool) {
+			s := p.(DeadLetterSinkProvider).DeadLetterSink()
+			return s, s != nil
+		})
+		if err != nil {
+			return err
+		}
+		c.deadLetterSink = sink
+	}
+	return nil
+}
+
+// providedStore returns the store supplied by the plugins implementing iface.
+// Plugins returning no store are skipped; two plugins supplying one is an error.
+func providedStore[T any](c *Container, iface, kind string, get func(plugin any) (T, bool)) (T, error) {
+	var store T
+	var from string
+	for _, p := range c.plugins.pluginsByInterface[iface] {
+		s, ok := get(p)
+		if !ok {
+			continue
+		}
+		name := c.plugins.pluginName(p)
+		if from != "" {
+			return store, fmt.Errorf("plugins %s and %s both provide an %s", from, name, kind)
+		}
+		store, from = s, name
+	}
+	if from != "" {
+		c.logger.Info("Using "+kind, "plugin", from)
+	}
+	return store, nil
 }
 
 func (c *Container) Shutdown(ctx context.Context) error {
@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	base := time.Date(2026, time.March, 6, 10, 7, 30, 0, time.UTC) // Friday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"*/5 * * * *", time.Date(2026, time.March, 6, 10, 10, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2026, time.March, 6, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2026, time.March, 7, 2, 30, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2026, time.March, 9, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 */3 *", time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"15,45 10 * * *", time.Date(2026, time.March, 6, 10, 15, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.March, 8, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * fri", time.Date(2026, time.March, 13, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2026, time.March, 7, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron failed: %v", err)
+			}
+			if got := s.Next(base); !got.Equal(tt.want) {
+				t.Fatalf("Next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCron_Timezone(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	s, _ := parseCron("0 9 * * *")
+
+	got := s.Next(time.Date(2026, time.June, 1, 12, 0, 0, 0, time.UTC).In(ny))
+	want := time.Date(2026, time.June, 1, 13, 0, 0, 0, time.UTC) // 09:00 EDT
+	if !got.Equal(want) {
+		t.Fatalf("Next = %v, want %v", got.UTC(), want)
+	}
+}
+
+func TestParseCron_Errors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * foo *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q): expected error", expr)
+		}
+	}
+}
+
+func TestCronSchedule_NeverMatches(t *testing.T) {
+	s, _ := parseCron("0 0 30 2 *")
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Fatalf("expected zero time, got %v", got)
+	}
+}
@@ -8,6 +8,13 @@ type FlowLoader interface {
 	Load(filePath string) (Flow, error)
 }
 
+// FlowChecker is implemented by FlowLoaders that check a loaded flow against
+// the application it runs in. The app logs the warnings; they never stop a
+// flow from loading.
+type FlowChecker interface {
+	CheckFlow(flow Flow, container *Container, globalProperties map[string]any) []string
+}
+
 // ExpressionEvaluator evaluates expressions within a given execution.
 // The *Execution carries both the variable namespace (via Values()) and the
 // deadline/cancellation signal (it implements context.Context), so a single
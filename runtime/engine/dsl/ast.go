@@ -0,0 +1,210 @@
+package dsl
+
+// This file defines the syntax tree of a .flow file as produced by ParseFile.
+// Risor code (step bodies, conditions, return expressions) is kept as source
+// text with the position it starts at, so tools can hand it to the Risor
+// parser and map its errors back into the .flow file.
+
+// Node is a node of the syntax tree.
+type Node interface {
+	Pos() Pos
+}
+
+// Decl is a top-level declaration.
+type Decl interface {
+	Node
+	declNode()
+}
+
+// Value is an option or property value.
+type Value interface {
+	Node
+	valueNode()
+}
+
+// File is a parsed .flow file.
+type File struct {
+	Name   string
+	Source string
+	Decls  []Decl
+}
+
+// Ident is a name: a step name, an entrypoint type or a map key.
+type Ident struct {
+	NamePos Pos
+	Name    string
+}
+
+// Block is a brace-delimited block of Risor code.
+type Block struct {
+	Lbrace  Pos
+	Rbrace  Pos
+	Code    string // without the braces and surrounding whitespace
+	CodePos Pos    // position of the first character of Code
+}
+
+// String is a quoted option value.
+type String struct {
+	ValuePos Pos
+	Raw      string // as written, with quotes
+	Value    string
+}
+
+// Expr is an unquoted option value or a return expression, kept as source.
+type Expr struct {
+	ValuePos Pos
+	Code     string
+}
+
+// ListLit is a [a, b] option value.
+type ListLit struct {
+	Lbrack Pos
+	Rbrack Pos
+	Items  []Value
+}
+
+// MapLit is a {key: value} option value, or the (key: value) options of a
+// step, clause or parallel group.
+type MapLit struct {
+	Lbrace  Pos
+	Rbrace  Pos
+	Entries []*Entry
+}
+
+// Entry is a key: value pair of a MapLit.
+type Entry struct {
+	Key   *Ident
+	Value Value
+}
+
+// ImportDecl is `import "lib/payments.risor" as payments`.
+type ImportDecl struct {
+	Keyword Pos
+	Path    *String
+	Name    *Ident
+}
+
+// EntrypointDecl is `entrypoint.TYPE { ... }`.
+type EntrypointDecl struct {
+	Keyword Pos
+	Type    *Ident
+	Config  *MapLit
+}
+
+// PropertiesDecl is `properties { ... }`.
+type PropertiesDecl struct {
+	Keyword Pos
+	Values  *MapLit
+}
+
+// StepDecl is `step NAME(options) { body }` with its suffix clauses.
+type StepDecl struct {
+	Keyword    Pos
+	Name       *Ident
+	Options    *MapLit // nil without options
+	Body       *Block
+	Fallback   *Clause
+	Compensate *Clause
+	Catches    []*Clause
+}
+
+// Clause is a fallback, compensate or catch block following a step.
+type Clause struct {
+	Keyword Pos
+	Name    string // fallback, compensate or catch
+	Options *MapLit
+	Body    *Block
+}
+
+// ParallelDecl is `parallel NAME(options) { step ... }`.
+type ParallelDecl struct {
+	Keyword Pos
+	Name    *Ident
+	Options *MapLit
+	Steps   []*StepDecl
+}
+
+// TemplateDecl is `template NAME(params) { step ... }`, a group of steps that
+// flows instantiate with use.
+type TemplateDecl struct {
+	Keyword Pos
+	Name    *Ident
+	Params  []*Ident
+	Steps   []Decl // *StepDecl and *ParallelDecl
+}
+
+// UseDecl is `use NAME(args) as PREFIX`, or `use IMPORT.NAME(args)` for a
+// template of an imported .flow file. As is nil without a prefix.
+type UseDecl struct {
+	Keyword  Pos
+	Import   *Ident // nil for a template of the same file
+	Template *Ident
+	Args     *MapLit
+	As       *Ident
+}
+
+// OnErrorDecl is `on_error { ... }`.
+type OnErrorDecl struct {
+	Keyword Pos
+	Body    *Block
+}
+
+// ReturnDecl is `return EXPR`.
+type ReturnDecl struct {
+	Keyword Pos
+	Value   *Expr
+}
+
+func (x *Ident) Pos() Pos          { return x.NamePos }
+func (x *Block) Pos() Pos          { return x.Lbrace }
+func (x *String) Pos() Pos         { return x.ValuePos }
+func (x *Expr) Pos() Pos           { return x.ValuePos }
+func (x *ListLit) Pos() Pos        { return x.Lbrack }
+func (x *MapLit) Pos() Pos         { return x.Lbrace }
+func (x *Entry) Pos() Pos          { return x.Key.NamePos }
+func (x *Clause) Pos() Pos         { return x.Keyword }
+func (x *ImportDecl) Pos() Pos     { return x.Keyword }
+func (x *EntrypointDecl) Pos() Pos { return x.Keyword }
+func (x *PropertiesDecl) Pos() Pos { return x.Keyword }
+func (x *StepDecl) Pos() Pos       { return x.Keyword }
+func (x *ParallelDecl) Pos() Pos   { return x.Keyword }
+func (x *TemplateDecl) Pos() Pos   { return x.Keyword }
+func (x *UseDecl) Pos() Pos        { return x.Keyword }
+func (x *OnErrorDecl) Pos() Pos    { return x.Keyword }
+func (x *ReturnDecl) Pos() Pos     { return x.Keyword }
+
+func (*String) valueNode()  {}
+func (*Expr) valueNode()    {}
+func (*ListLit) valueNode() {}
+func (*MapLit) valueNode()  {}
+
+func (*ImportDecl) declNode()     {}
+func (*EntrypointDecl) declNode() {}
+func (*PropertiesDecl) declNode() {}
+func (*StepDecl) declNode()       {}
+func (*ParallelDecl) declNode()   {}
+func (*TemplateDecl) declNode()   {}
+func (*UseDecl) declNode()        {}
+func (*OnErrorDecl) declNode()    {}
+func (*ReturnDecl) declNode()     {}
+
+// Name returns the name of the used template, qualified by its import.
+func (x *UseDecl) Name() string {
+	if x.Import != nil {
+		return x.Import.Name + "." + x.Template.Name
+	}
+	return x.Template.Name
+}
+
+// Lookup returns the entry for key, or nil.
+func (m *MapLit) Lookup(key string) *Entry {
+	if m == nil {
+		return nil
+	}
+	for _, e := range m.Entries {
+		if e.Key.Name == key {
+			return e
+		}
+	}
+	return nil
+}
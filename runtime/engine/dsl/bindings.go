@@ -0,0 +1,70 @@
+package dsl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BDNK1/sflowg/runtime"
+	"github.com/deepnoodle-ai/risor/v2/pkg/object"
+)
+
+// binding builds a global function for the execution that calls it. The
+// global modules (plugins, response, log, metric, flow) are maps of bindings,
+// possibly nested, so they can be built once per Container and still call
+// into the right execution.
+type binding func(exec *runtime.Execution) any
+
+// stepScope is what step code runs with: its execution, for bound functions,
+// and its globals, for the functions of imported modules.
+type stepScope struct {
+	exec    *runtime.Execution
+	globals map[string]any
+}
+
+type scopeKey struct{}
+
+// withScope returns ctx carrying the scope of step code run with it.
+func withScope(ctx context.Context, exec *runtime.Execution, globals map[string]any) context.Context {
+	return context.WithValue(ctx, scopeKey{}, &stepScope{exec: exec, globals: globals})
+}
+
+// bindModule converts a map of bindings into a Risor module whose functions
+// bind to the execution carried by the context of each call.
+func bindModule(name string, bindings map[string]any) *object.Module {
+	contents := make(map[string]object.Object, len(bindings))
+	for k, v := range bindings {
+		qualifiedName := fmt.Sprintf("%s.%s", name, k)
+		switch b := v.(type) {
+		case binding:
+			contents[k] = bindFunc(qualifiedName, b)
+		case map[string]any:
+			contents[k] = bindModule(qualifiedName, b)
+		}
+	}
+	return object.NewBuiltinsModule(name, contents)
+}
+
+// bindFunc converts a binding into a Risor builtin.
+func bindFunc(name string, bind binding) *object.Builtin {
+	return object.NewBuiltin(name, func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		scope, ok := ctx.Value(scopeKey{}).(*stepScope)
+		if !ok {
+			return nil, fmt.Errorf("%s can only be called by a step", name)
+		}
+		return callGoFunc(bind(scope.exec), args)
+	})
+}
+
+// bindAll builds the functions of a map of bindings for exec.
+func bindAll(bindings map[string]any, exec *runtime.Execution) map[string]any {
+	result := make(map[string]any, len(bindings))
+	for k, v := range bindings {
+		switch b := v.(type) {
+		case binding:
+			result[k] = b(exec)
+		case map[string]any:
+			result[k] = bindAll(b, exec)
+		}
+	}
+	return result
+}
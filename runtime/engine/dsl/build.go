@@ -0,0 +1,639 @@
+package dsl
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/BDNK1/sflowg/runtime"
+)
+
+// buildFlow converts a parsed file into a runtime.Flow, reporting invalid
+// options to diags at the position of the offending entry. Uses of templates
+// expand into steps; imported holds the templates of imported .flow files by
+// qualified name.
+func buildFlow(f *File, imported map[string]*TemplateDecl, diags *diagnosticList) runtime.Flow {
+	var flow runtime.Flow
+	seen := make(map[string]Pos)
+	once := func(what string, pos Pos) bool {
+		if first, ok := seen[what]; ok {
+			diags.add(pos, "duplicate %s block (first at %s)", what, first)
+			return false
+		}
+		seen[what] = pos
+		return true
+	}
+	stepIDs := make(map[string]bool)
+	addStep := func(name *Ident, step runtime.Step) {
+		if stepIDs[step.ID] {
+			diags.add(name.NamePos, "duplicate step %q", step.ID)
+		}
+		stepIDs[step.ID] = true
+		flow.Steps = append(flow.Steps, step)
+	}
+
+	// Imports and templates come first, as uses may precede them. Templates
+	// with problems map to nil, so their uses add no more errors.
+	imports := make(map[string]*ImportDecl)
+	declared := make(map[string]*TemplateDecl)
+	templates := maps.Clone(imported)
+	if templates == nil {
+		templates = make(map[string]*TemplateDecl)
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ImportDecl:
+			if first, ok := imports[d.Name.Name]; ok {
+				diags.add(d.Name.NamePos, "duplicate import %q (first at %s)", d.Name.Name, first.Keyword)
+				continue
+			}
+			imports[d.Name.Name] = d
+		case *TemplateDecl:
+			if first, ok := declared[d.Name.Name]; ok {
+				diags.add(d.Name.NamePos, "duplicate template %q (first at %s)", d.Name.Name, first.Keyword)
+				continue
+			}
+			declared[d.Name.Name] = d
+			templates[d.Name.Name] = nil
+			if checkTemplate(d, diags) {
+				templates[d.Name.Name] = d
+			}
+		}
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *EntrypointDecl:
+			if !once("entrypoint", d.Keyword) {
+				continue
+			}
+			config := mapValue(d.Config)
+			// The flow-level timeout and recovery policy live in the
+			// entrypoint block but are not entrypoint config.
+			if v, ok := config["timeout"]; ok {
+				flow.Timeout = toInt(v)
+				delete(config, "timeout")
+			}
+			recovery, err := extractRecovery(config)
+			if err != nil {
+				reportOption(diags, d.Config, atField("recovery", err), "entrypoint")
+			}
+			flow.Entrypoint = runtime.Entrypoint{Type: d.Type.Name, Config: config}
+			flow.Recovery = recovery
+
+		case *PropertiesDecl:
+			if !once("properties", d.Keyword) {
+				continue
+			}
+			props := mapValue(d.Values)
+			for k, v := range props {
+				if s, ok := v.(string); ok {
+					props[k] = resolveEnvCall(s)
+				}
+			}
+			flow.Properties = props
+
+		case *StepDecl:
+			addStep(d.Name, buildStep(diags, d))
+
+		case *ParallelDecl:
+			addStep(d.Name, buildParallel(diags, d))
+
+		case *UseDecl:
+			t, ok := templates[d.Name()]
+			if !ok {
+				diags.add(d.Template.NamePos, "%s", templateError(d, imports))
+				continue
+			}
+			if t == nil {
+				continue
+			}
+			name := d.Template
+			if d.As != nil {
+				name = d.As
+			}
+			for _, step := range expandUse(d, t, diags) {
+				addStep(&Ident{NamePos: name.NamePos, Name: step.ID}, step)
+			}
+
+		case *OnErrorDecl:
+			if once("on_error", d.Keyword) {
+				flow.OnErrorBody = d.Body.Code
+			}
+
+		case *ReturnDecl:
+			if once("return", d.Keyword) {
+				flow.Return = runtime.Return{Body: d.Value.Code}
+			}
+		}
+	}
+
+	// Imports are globals of the step bodies, so they must not hide one.
+	for name, d := range imports {
+		switch {
+		case stepIDs[name]:
+			diags.add(d.Name.NamePos, "import %q has the name of a step", name)
+		case slices.Contains(stepGlobals, name) || slices.Contains(executionGlobals, name):
+			diags.add(d.Name.NamePos, "import %q hides the %s global", name, name)
+		}
+	}
+	return flow
+}
+
+func buildStep(diags *diagnosticList, d *StepDecl) runtime.Step {
+	step := runtime.Step{ID: d.Name.Name, Body: d.Body.Code}
+	context := "step " + step.ID
+	if d.Options != nil {
+		if err := applyStepOptions(&step, mapValue(d.Options)); err != nil {
+			reportOption(diags, d.Options, err, context)
+		}
+	}
+	if d.Fallback != nil {
+		step.FallbackBody = d.Fallback.Body.Code
+	}
+	if d.Compensate != nil {
+		step.CompensateBody = d.Compensate.Body.Code
+		if d.Compensate.Options != nil {
+			if err := applyCompensateOptions(&step, mapValue(d.Compensate.Options)); err != nil {
+				reportOption(diags, d.Compensate.Options, err, context)
+			}
+		}
+	}
+
+	// A catch without options catches every error, so it must come last.
+	var catchAll *Clause
+	for _, c := range d.Catches {
+		if catchAll != nil {
+			diags.add(c.Keyword, "%s: catch block after a catch-all block (line %d) is unreachable", context, catchAll.Keyword.Line)
+			continue
+		}
+		block, err := parseCatchOptions(mapValue(c.Options))
+		if err != nil {
+			reportOption(diags, c.Options, err, context)
+			continue
+		}
+		if block.Code == "" && block.Type == "" {
+			catchAll = c
+		}
+		block.Body = c.Body.Code
+		step.Catches = append(step.Catches, block)
+	}
+	return step
+}
+
+// buildParallel turns a parallel group into a single step whose branches run
+// concurrently.
+func buildParallel(diags *diagnosticList, d *ParallelDecl) runtime.Step {
+	step := runtime.Step{ID: d.Name.Name, Parallel: &runtime.ParallelGroup{Mode: runtime.ParallelFailFast}}
+	context := "parallel " + step.ID
+	if d.Options != nil {
+		if err := applyParallelOptions(&step, mapValue(d.Options)); err != nil {
+			reportOption(diags, d.Options, err, context)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, sd := range d.Steps {
+		branch := buildStep(diags, sd)
+		if branch.Next != "" {
+			diags.add(sd.Options.Lookup("next").Key.NamePos, "%s: step %s: next is not supported inside a parallel group", context, branch.ID)
+		}
+		if seen[branch.ID] {
+			diags.add(sd.Name.NamePos, "%s: duplicate step %q", context, branch.ID)
+		}
+		seen[branch.ID] = true
+		step.Parallel.Steps = append(step.Parallel.Steps, branch)
+	}
+	if len(d.Steps) == 0 {
+		diags.add(d.Keyword, "%s: expected at least one step", context)
+	}
+	return step
+}
+
+// mapValue converts an option map to the map[string]any the option helpers
+// read. Strings and expressions become strings.
+func mapValue(m *MapLit) map[string]any {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(m.Entries))
+	for _, e := range m.Entries {
+		out[e.Key.Name] = valueToAny(e.Value)
+	}
+	return out
+}
+
+func valueToAny(v Value) any {
+	switch v := v.(type) {
+	case *String:
+		return v.Value
+	case *Expr:
+		return v.Code
+	case *ListLit:
+		var items []any
+		for _, item := range v.Items {
+			items = append(items, valueToAny(item))
+		}
+		return items
+	case *MapLit:
+		return mapValue(v)
+	}
+	return nil
+}
+
+// fieldError attributes an option error to a field of the option map, so the
+// diagnostic points at it rather than at the whole map.
+type fieldError struct {
+	field string
+	key   bool // the key itself is wrong, not its value
+	err   error
+}
+
+func (e *fieldError) Error() string { return e.err.Error() }
+func (e *fieldError) Unwrap() error { return e.err }
+
+// atField attributes err to the value of field.
+func atField(field string, err error) error {
+	return &fieldError{field: field, err: err}
+}
+
+// atKey attributes err to the key field.
+func atKey(field string, err error) error {
+	return &fieldError{field: field, key: true, err: err}
+}
+
+// reportOption reports an option error at the entry of v it is attributed to,
+// following nested maps.
+func reportOption(diags *diagnosticList, v Value, err error, context string) {
+	pos := v.Pos()
+	for inner := err; ; {
+		var fe *fieldError
+		if !errors.As(inner, &fe) {
+			break
+		}
+		m, ok := v.(*MapLit)
+		e := m.Lookup(fe.field)
+		if !ok || e == nil {
+			break
+		}
+		if fe.key {
+			pos = e.Key.NamePos
+			break
+		}
+		v, pos, inner = e.Value, e.Value.Pos(), fe.err
+	}
+	diags.add(pos, "%s: %v", context, err)
+}
+
+// extractRecovery removes the flow-level recovery policy from the entrypoint
+// config.
+func extractRecovery(config map[string]any) (string, error) {
+	v, ok := config["recovery"]
+	if !ok {
+		return "", nil
+	}
+	delete(config, "recovery")
+	policy, _ := v.(string)
+	if policy != runtime.RecoveryResume && policy != runtime.RecoveryCompensate {
+		return "", fmt.Errorf("invalid recovery %v (allowed: %s, %s)", v, runtime.RecoveryResume, runtime.RecoveryCompensate)
+	}
+	return policy, nil
+}
+
+// resolveEnvCall resolves env("VAR") or env("VAR", "default") patterns in property values.
+func resolveEnvCall(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "env(") || !strings.HasSuffix(s, ")") {
+		return s
+	}
+	// Convert env("VAR") to ${VAR} and env("VAR", "default") to ${VAR:default}
+	inner := strings.TrimPrefix(s, "env(")
+	inner = strings.TrimSuffix(inner, ")")
+	inner = strings.TrimSpace(inner)
+
+	parts := strings.SplitN(inner, ",", 2)
+	varName := strings.Trim(strings.TrimSpace(parts[0]), `"'`)
+
+	if len(parts) == 2 {
+		defaultVal := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+		return fmt.Sprintf("${%s:%s}", varName, defaultVal)
+	}
+
+	return fmt.Sprintf("${%s}", varName)
+}
+
+// applyStepOptions applies the parenthesized step options to step.
+// Supports fields: condition, timeout, next, max_iterations, for_each, as, concurrency, max_failures,
+// retry (max_attempts, delay, backoff, max_delay, jitter, when, non_retryable), circuit_breaker and
+// concurrency as a {key, limit, queue_timeout} map.
+func applyStepOptions(step *runtime.Step, m map[string]any) error {
+	if cond, ok := m["condition"]; ok {
+		step.Condition = fmt.Sprintf("%v", cond)
+	}
+
+	if t, ok := m["timeout"]; ok {
+		step.Timeout = toInt(t)
+	}
+
+	if v, ok := m["next"]; ok {
+		step.Next = strings.TrimSpace(fmt.Sprintf("%v", v))
+	}
+	if v, ok := m["max_iterations"]; ok {
+		if step.MaxIterations = toInt(v); step.MaxIterations < 1 {
+			return atField("max_iterations", fmt.Errorf("max_iterations must be at least 1, got %v", v))
+		}
+	}
+
+	// concurrency: {key, limit, queue_timeout} is a bulkhead; a number is
+	// the for_each concurrency.
+	if v, ok := m["concurrency"].(map[string]any); ok {
+		bulkhead, err := parseBulkhead(v)
+		if err != nil {
+			return atField("concurrency", err)
+		}
+		step.Bulkhead = bulkhead
+		delete(m, "concurrency")
+	}
+
+	if err := applyForEachOptions(step, m); err != nil {
+		return err
+	}
+
+	if retryRaw, ok := m["retry"]; ok {
+		retry, err := parseRetryConfig(retryRaw)
+		if err != nil {
+			return atField("retry", err)
+		}
+		step.Retry = retry
+	}
+
+	if v, ok := m["circuit_breaker"]; ok {
+		cb, err := parseCircuitBreaker(v)
+		if err != nil {
+			return atField("circuit_breaker", err)
+		}
+		step.CircuitBreaker = cb
+	}
+
+	return nil
+}
+
+// parseBulkhead reads a concurrency map (key, limit, queue_timeout).
+func parseBulkhead(m map[string]any) (*runtime.BulkheadConfig, error) {
+	b := &runtime.BulkheadConfig{}
+	for key, v := range m {
+		switch key {
+		case "key":
+			b.Key = strings.TrimSpace(fmt.Sprintf("%v", v))
+		case "limit":
+			if b.Limit = toInt(v); b.Limit < 1 {
+				return nil, atField(key, fmt.Errorf("concurrency.limit must be at least 1, got %v", v))
+			}
+		case "queue_timeout":
+			if b.QueueTimeout = toInt(v); b.QueueTimeout < 0 {
+				return nil, atField(key, fmt.Errorf("concurrency.queue_timeout must not be negative, got %v", v))
+			}
+		default:
+			return nil, atKey(key, fmt.Errorf("unsupported concurrency field: %s (allowed: key, limit, queue_timeout)", key))
+		}
+	}
+	if b.Key == "" || b.Limit == 0 {
+		return nil, fmt.Errorf("concurrency requires a key and a limit")
+	}
+	return b, nil
+}
+
+// parseCircuitBreaker reads a circuit_breaker map (name, failure_threshold,
+// open_for, half_open_max). Unset numbers keep the runtime defaults.
+func parseCircuitBreaker(raw any) (*runtime.CircuitBreakerConfig, error) {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("circuit_breaker must be a map")
+	}
+	cb := &runtime.CircuitBreakerConfig{}
+	for key, v := range m {
+		var field *int
+		switch key {
+		case "name":
+			cb.Name = strings.TrimSpace(fmt.Sprintf("%v", v))
+			continue
+		case "failure_threshold":
+			field = &cb.FailureThreshold
+		case "open_for":
+			field = &cb.OpenFor
+		case "half_open_max":
+			field = &cb.HalfOpenMax
+		default:
+			return nil, atKey(key, fmt.Errorf("unsupported circuit_breaker field: %s (allowed: name, failure_threshold, open_for, half_open_max)", key))
+		}
+		if *field = toInt(v); *field < 1 {
+			return nil, atField(key, fmt.Errorf("circuit_breaker.%s must be at least 1, got %v", key, v))
+		}
+	}
+	if cb.Name == "" {
+		return nil, fmt.Errorf("circuit_breaker requires a name")
+	}
+	return cb, nil
+}
+
+// applyCompensateOptions applies the options of a compensate block:
+// timeout (ms, covering all attempts) and retry, as for steps.
+func applyCompensateOptions(step *runtime.Step, m map[string]any) error {
+	for key, v := range m {
+		switch key {
+		case "timeout":
+			if step.CompensateTimeout = toInt(v); step.CompensateTimeout < 0 {
+				return atField(key, fmt.Errorf("compensate: timeout must not be negative, got %v", v))
+			}
+		case "retry":
+			retry, err := parseRetryConfig(v)
+			if err != nil {
+				return atField(key, fmt.Errorf("compensate: %w", err))
+			}
+			step.CompensateRetry = retry
+		default:
+			return atKey(key, fmt.Errorf("unsupported compensate option: %s (allowed: retry, timeout)", key))
+		}
+	}
+	return nil
+}
+
+// parseCatchOptions reads the options of a catch block: code and type. Both
+// are optional; a block without them catches every error.
+func parseCatchOptions(m map[string]any) (runtime.CatchBlock, error) {
+	var c runtime.CatchBlock
+	for key, v := range m {
+		value := strings.TrimSpace(fmt.Sprintf("%v", v))
+		switch key {
+		case "code":
+			c.Code = value
+		case "type":
+			switch t := runtime.FlowErrorType(value); t {
+			case runtime.ErrorTypeTransient, runtime.ErrorTypePermanent, runtime.ErrorTypeTimeout, runtime.ErrorTypeClient:
+				c.Type = t
+			default:
+				return c, atField(key, fmt.Errorf("invalid catch type %q (allowed: transient, permanent, timeout, client)", value))
+			}
+		default:
+			return c, atKey(key, fmt.Errorf("unsupported catch option: %s (allowed: code, type)", key))
+		}
+	}
+	return c, nil
+}
+
+// parseRetryConfig reads a retry map (max_attempts, delay, backoff, max_delay,
+// jitter, when, non_retryable).
+func parseRetryConfig(raw any) (*runtime.RetryConfig, error) {
+	retryMap, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("retry must be a map")
+	}
+	// Legacy aliases removed intentionally.
+	if _, ok := retryMap["maxRetries"]; ok {
+		return nil, atKey("maxRetries", fmt.Errorf("unsupported retry field: maxRetries (use max_attempts)"))
+	}
+	if _, ok := retryMap["condition"]; ok {
+		return nil, atKey("condition", fmt.Errorf("unsupported retry field: condition (use when)"))
+	}
+	retry := &runtime.RetryConfig{}
+
+	if v, ok := retryMap["max_attempts"]; ok {
+		retry.MaxAttempts = toInt(v)
+	}
+	if v, ok := retryMap["max_delay"]; ok {
+		retry.MaxDelay = toInt(v)
+	}
+	if v, ok := retryMap["jitter"]; ok {
+		retry.Jitter = toBool(v)
+	}
+	if v, ok := retryMap["when"]; ok {
+		retry.When = fmt.Sprintf("%v", v)
+	}
+	if v, ok := retryMap["non_retryable"]; ok {
+		if arr, ok := v.([]any); ok {
+			for _, item := range arr {
+				retry.NonRetryable = append(retry.NonRetryable, fmt.Sprintf("%v", item))
+			}
+		}
+	}
+	if v, ok := retryMap["backoff"]; ok {
+		s, ok := v.(string)
+		if !ok {
+			return nil, atField("backoff", fmt.Errorf("retry.backoff must be a string: none | linear | exponential"))
+		}
+		switch s {
+		case "none", "linear", "exponential":
+			retry.Backoff = s
+		default:
+			return nil, atField("backoff", fmt.Errorf("invalid retry.backoff value: %q (allowed: none, linear, exponential)", s))
+		}
+	}
+
+	if v, ok := retryMap["delay"]; ok {
+		retry.Delay = toInt(v)
+	}
+	return retry, nil
+}
+
+// applyForEachOptions reads the for_each, as, concurrency and max_failures
+// step options.
+func applyForEachOptions(step *runtime.Step, m map[string]any) error {
+	items, ok := m["for_each"]
+	if !ok {
+		for _, key := range []string{"as", "concurrency", "max_failures"} {
+			if _, ok := m[key]; ok {
+				return atKey(key, fmt.Errorf("step option %s requires for_each", key))
+			}
+		}
+		return nil
+	}
+
+	cfg := &runtime.ForEachConfig{Items: strings.TrimSpace(fmt.Sprintf("%v", items)), Concurrency: 1}
+	if cfg.Items == "" {
+		return atField("for_each", fmt.Errorf("for_each requires a collection expression"))
+	}
+	if v, ok := m["as"]; ok {
+		cfg.As = fmt.Sprintf("%v", v)
+		if !isIdentifier(cfg.As) {
+			return atField("as", fmt.Errorf("for_each: as must be an identifier, got %q", cfg.As))
+		}
+	}
+	if v, ok := m["concurrency"]; ok {
+		if cfg.Concurrency = toInt(v); cfg.Concurrency < 1 {
+			return atField("concurrency", fmt.Errorf("for_each: concurrency must be at least 1, got %v", v))
+		}
+	}
+	if v, ok := m["max_failures"]; ok {
+		if cfg.MaxFailures = toInt(v); cfg.MaxFailures < 0 {
+			return atField("max_failures", fmt.Errorf("for_each: max_failures must not be negative, got %v", v))
+		}
+	}
+	step.ForEach = cfg
+	return nil
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isWordChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyParallelOptions applies the options of a parallel group.
+// Supports fields: mode, condition, timeout.
+func applyParallelOptions(step *runtime.Step, m map[string]any) error {
+	for key, v := range m {
+		switch key {
+		case "condition":
+			step.Condition = fmt.Sprintf("%v", v)
+		case "timeout":
+			step.Timeout = toInt(v)
+		case "mode":
+			mode := fmt.Sprintf("%v", v)
+			switch mode {
+			case runtime.ParallelFailFast, runtime.ParallelCollectAll:
+				step.Parallel.Mode = mode
+			default:
+				return atField(key, fmt.Errorf("invalid mode %q (allowed: %s, %s)", mode, runtime.ParallelFailFast, runtime.ParallelCollectAll))
+			}
+		default:
+			return atKey(key, fmt.Errorf("unsupported option %q (allowed: mode, condition, timeout)", key))
+		}
+	}
+	return nil
+}
+
+func toInt(v any) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case string:
+		var i int
+		fmt.Sscanf(n, "%d", &i)
+		return i
+	default:
+		return 0
+	}
+}
+
+func toBool(v any) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	default:
+		return false
+	}
+}
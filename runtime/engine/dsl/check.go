@@ -0,0 +1,269 @@
+package dsl
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BDNK1/sflowg/runtime"
+	rerrors "github.com/deepnoodle-ai/risor/v2/pkg/errors"
+	risorparser "github.com/deepnoodle-ai/risor/v2/pkg/parser"
+)
+
+// codeSource is a piece of Risor code in a .flow file: a block body, an
+// option expression or the return expression.
+type codeSource struct {
+	code  string
+	pos   Pos             // position of the first character of code
+	body  bool            // a block with the step globals (plugins, response, ...) in scope
+	scope map[string]bool // parameters and steps of the template holding the code
+}
+
+// at maps a 1-based line and column of the code to its position in the file.
+func (s codeSource) at(line, column int) Pos {
+	offset := 0
+	for l := 1; l < line; l++ {
+		i := strings.IndexByte(s.code[offset:], '\n')
+		if i < 0 {
+			break
+		}
+		offset += i + 1
+	}
+	pos := Pos{File: s.pos.File, Offset: s.pos.Offset + offset + column - 1, Line: s.pos.Line + line - 1, Column: column}
+	if line <= 1 {
+		pos.Column = s.pos.Column + column - 1
+	}
+	return pos
+}
+
+// report adds the syntax or compile errors in err to diags.
+func (s codeSource) report(diags *diagnosticList, err error) {
+	var list *risorparser.Errors
+	var one risorparser.ParserError
+	var ce *rerrors.CompileError
+	switch {
+	case errors.As(err, &list):
+		for _, e := range list.Errors() {
+			start := e.StartPosition()
+			diags.add(s.at(start.LineNumber(), start.ColumnNumber()), "%s", e.Message())
+		}
+	case errors.As(err, &one):
+		start := one.StartPosition()
+		diags.add(s.at(start.LineNumber(), start.ColumnNumber()), "%s", one.Message())
+	case errors.As(err, &ce):
+		diags.add(s.at(ce.Line, ce.Column), "%s", ce.Message)
+	default:
+		diags.add(s.pos, "%v", err)
+	}
+}
+
+// flowSources returns the Risor code of f: step, clause, on_error and return
+// bodies, and the condition, for_each, next and retry.when options. Rate
+// limit keys of the entrypoint are expressions too, as are the arguments of
+// template uses.
+func flowSources(f *File) []codeSource {
+	var sources []codeSource
+	var scope map[string]bool
+	add := func(code string, pos Pos, body bool) {
+		if strings.TrimSpace(code) != "" {
+			sources = append(sources, codeSource{code: code, pos: pos, body: body, scope: scope})
+		}
+	}
+	block := func(b *Block) {
+		if b != nil {
+			add(b.Code, b.CodePos, true)
+		}
+	}
+	expr := func(e *Entry) {
+		if e == nil {
+			return
+		}
+		switch v := e.Value.(type) {
+		case *Expr:
+			add(v.Code, v.ValuePos, false)
+		case *String:
+			// Skip the opening quote; escapes may shift later columns.
+			pos := v.ValuePos
+			pos.Offset++
+			pos.Column++
+			add(v.Value, pos, false)
+		}
+	}
+	nested := func(m *MapLit, key, field string) {
+		if e := m.Lookup(key); e != nil {
+			if inner, ok := e.Value.(*MapLit); ok {
+				expr(inner.Lookup(field))
+			}
+		}
+	}
+	options := func(m *MapLit) {
+		expr(m.Lookup("condition"))
+		expr(m.Lookup("for_each"))
+		if e := m.Lookup("next"); e != nil && !runtime.IsStepReference(fmt.Sprintf("%v", valueToAny(e.Value))) {
+			expr(e)
+		}
+		nested(m, "retry", "when")
+	}
+	step := func(d *StepDecl) {
+		options(d.Options)
+		block(d.Body)
+		for _, c := range append([]*Clause{d.Fallback, d.Compensate}, d.Catches...) {
+			if c != nil {
+				options(c.Options)
+				block(c.Body)
+			}
+		}
+	}
+	parallel := func(d *ParallelDecl) {
+		options(d.Options)
+		for _, branch := range d.Steps {
+			step(branch)
+		}
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *EntrypointDecl:
+			nested(d.Config, "rate_limit", "key")
+		case *StepDecl:
+			step(d)
+		case *ParallelDecl:
+			parallel(d)
+		case *TemplateDecl:
+			scope = templateScope(d)
+			for _, decl := range d.Steps {
+				switch s := decl.(type) {
+				case *StepDecl:
+					step(s)
+				case *ParallelDecl:
+					parallel(s)
+				}
+			}
+			scope = nil
+		case *UseDecl:
+			for _, e := range d.Args.Entries {
+				expr(e)
+			}
+		case *OnErrorDecl:
+			block(d.Body)
+		case *ReturnDecl:
+			add(d.Value.Code, d.Value.ValuePos, true)
+		}
+	}
+	return sources
+}
+
+// flowRef is a global read by the Risor code of a flow.
+type flowRef struct {
+	pos      Pos
+	name     string
+	plugin   bool // called as a module in a body, e.g. http in http.request(...)
+	property bool // an attribute of properties, e.g. db in properties.db
+}
+
+// compileFlow compiles the Risor code of f into the program cache, reporting
+// syntax errors to diags at their position in the file, and returns the
+// globals the code reads.
+func compileFlow(f *File, diags *diagnosticList) []flowRef {
+	var refs []flowRef
+	for _, src := range flowSources(f) {
+		p, err := compileProgram(src.code)
+		if err != nil {
+			src.report(diags, err)
+			continue
+		}
+		for _, g := range p.globals {
+			if src.scope[g.name] {
+				continue
+			}
+			refs = append(refs, flowRef{pos: src.at(g.line, g.column), name: g.name, plugin: src.body && p.calls[g.name]})
+		}
+		for _, attr := range p.properties {
+			refs = append(refs, flowRef{pos: src.at(attr.line, attr.column), name: attr.name, property: true})
+		}
+	}
+	return refs
+}
+
+// executionGlobals are the names every execution may define besides step
+// results: the request, properties, subflow arguments, the trigger of async
+// flows, the caught error, compensation info and the for_each loop.
+var executionGlobals = []string{
+	"request", "properties", runtime.SubflowArgsKey, runtime.TriggerKey,
+	"error", "compensation", "loop",
+}
+
+// CheckFlow reports the globals read by the code of a loaded flow that
+// nothing defines: names that are neither a step or import of the flow nor a
+// plugin in container, and properties missing from the flow and globalProperties.
+// Plugins may store values of their own, so these are warnings.
+func (l *FlowLoader) CheckFlow(flow runtime.Flow, container *runtime.Container, globalProperties map[string]any) []string {
+	l.mu.Lock()
+	refs := l.refs[flow.ID]
+	l.mu.Unlock()
+
+	known := make(map[string]bool)
+	for _, name := range executionGlobals {
+		known[name] = true
+	}
+	for _, name := range stepGlobals {
+		known[name] = true
+	}
+	for name := range flow.Globals {
+		known[name] = true
+	}
+	var steps func([]runtime.Step)
+	steps = func(list []runtime.Step) {
+		for _, s := range list {
+			known[s.ID] = true
+			if s.ForEach != nil {
+				if s.ForEach.As != "" {
+					known[s.ForEach.As] = true
+				} else {
+					known[runtime.DefaultForEachVar] = true
+				}
+			}
+			if s.Parallel != nil {
+				steps(s.Parallel.Steps)
+			}
+		}
+	}
+	steps(flow.Steps)
+	plugins := make(map[string]bool)
+	container.RangeTasks(func(name string, _ runtime.Task) {
+		if plugin, _, ok := strings.Cut(name, "."); ok {
+			plugins[plugin] = true
+		}
+	})
+
+	// Warn once per name, at its first use.
+	refs = slices.Clone(refs)
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].pos.Offset < refs[j].pos.Offset })
+	warned := make(map[flowRef]bool)
+	var warnings []string
+	for _, ref := range refs {
+		key := flowRef{name: ref.name, property: ref.property}
+		if warned[key] {
+			continue
+		}
+		warned[key] = true
+		switch {
+		case ref.property:
+			if _, ok := flow.Properties[ref.name]; ok {
+				continue
+			}
+			if _, ok := globalProperties[ref.name]; ok {
+				continue
+			}
+			warnings = append(warnings, fmt.Sprintf("%s: properties.%s is not defined", ref.pos, ref.name))
+		case known[ref.name] || plugins[ref.name]:
+		case ref.plugin:
+			warnings = append(warnings, fmt.Sprintf("%s: plugin %q is not in flow-config.yaml", ref.pos, ref.name))
+		default:
+			warnings = append(warnings, fmt.Sprintf("%s: %q is not a step of this flow", ref.pos, ref.name))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,122 @@
+package dsl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pos is a position in a .flow file. Line and Column are 1-based; Column
+// counts bytes.
+type Pos struct {
+	File   string
+	Offset int
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position points into a file.
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// String renders the position as file:line:column, or line:column for
+// sources without a file name.
+func (p Pos) String() string {
+	s := strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+	if p.File != "" {
+		s = p.File + ":" + s
+	}
+	return s
+}
+
+// Diagnostic is a problem found in a .flow file, with the source line it
+// points into.
+type Diagnostic struct {
+	Pos     Pos
+	Message string
+	Line    string // source line of Pos, without the newline
+}
+
+// Error renders the diagnostic with a source excerpt and a caret under the
+// offending column:
+//
+//	orders.flow:3:20: unsupported retry field: maxRetries (use max_attempts)
+//	    3 | step charge(retry: {maxRetries: 3}) {
+//	      |                     ^
+func (d Diagnostic) Error() string {
+	if !d.Pos.IsValid() {
+		return d.Message
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", d.Pos, d.Message)
+	if d.Line == "" {
+		return b.String()
+	}
+	gutter := strconv.Itoa(d.Pos.Line)
+	fmt.Fprintf(&b, "\n    %s | %s\n    %s | ", gutter, d.Line, strings.Repeat(" ", len(gutter)))
+	// Keep tabs so the caret lines up with the excerpt.
+	for i := 0; i < d.Pos.Column-1 && i < len(d.Line); i++ {
+		if d.Line[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// Diagnostics is the error returned for a .flow file with problems. The
+// parser recovers after each problem, so one run reports all of them.
+type Diagnostics []Diagnostic
+
+func (ds Diagnostics) Error() string {
+	parts := make([]string, len(ds))
+	for i, d := range ds {
+		parts[i] = d.Error()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// diagnosticList collects the diagnostics of one source, and those of the
+// files it imports.
+type diagnosticList struct {
+	file     string
+	src      string
+	list     Diagnostics
+	imported Diagnostics // reported after list, in import order
+}
+
+func (l *diagnosticList) add(pos Pos, format string, args ...any) {
+	d := Diagnostic{Pos: pos, Message: fmt.Sprintf(format, args...)}
+	// Steps expanded from an imported template point into another file.
+	if pos.File == l.file {
+		d.Line = sourceLine(l.src, pos.Offset)
+	}
+	l.list = append(l.list, d)
+}
+
+// err returns the collected diagnostics in source order, followed by those of
+// imported files, or nil.
+func (l *diagnosticList) err() error {
+	if len(l.list) == 0 && len(l.imported) == 0 {
+		return nil
+	}
+	sort.SliceStable(l.list, func(i, j int) bool { return l.list[i].Pos.Offset < l.list[j].Pos.Offset })
+	return append(l.list, l.imported...)
+}
+
+// sourceLine returns the line of src holding offset.
+func sourceLine(src string, offset int) string {
+	if offset > len(src) {
+		return ""
+	}
+	start := strings.LastIndexByte(src[:offset], '\n') + 1
+	end := strings.IndexByte(src[offset:], '\n')
+	if end < 0 {
+		return strings.TrimRight(src[start:], "\r")
+	}
+	return strings.TrimRight(src[start:offset+end], "\r")
+}
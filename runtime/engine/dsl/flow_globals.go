@@ -0,0 +1,40 @@
+package dsl
+
+import (
+	"fmt"
+
+	"github.com/BDNK1/sflowg/runtime"
+)
+
+// BuildFlowGlobals creates the "flow" global module for Risor DSL code.
+//
+//	customer = flow.call("load_customer", {id: request.pathVariables.id})
+//
+// The called flow runs in-process with its own state; its response body is
+// returned, and its failure is raised in the calling step.
+func BuildFlowGlobals(exec *runtime.Execution) map[string]any {
+	return bindAll(flowBindings, exec)
+}
+
+var flowBindings = map[string]any{
+	"flow": map[string]any{
+		"call": binding(func(exec *runtime.Execution) any {
+			return func(args ...any) (any, error) {
+				if len(args) == 0 || len(args) > 2 {
+					return nil, fmt.Errorf("flow.call expects (flow_id, args), got %d arguments", len(args))
+				}
+				flowID, ok := args[0].(string)
+				if !ok || flowID == "" {
+					return nil, fmt.Errorf("flow.call: flow_id must be a non-empty string, got %T", args[0])
+				}
+				var callArgs map[string]any
+				if len(args) == 2 && args[1] != nil {
+					if callArgs, ok = args[1].(map[string]any); !ok {
+						return nil, fmt.Errorf("flow.call: args must be a map, got %T", args[1])
+					}
+				}
+				return exec.CallFlow(flowID, callArgs)
+			}
+		}),
+	},
+}
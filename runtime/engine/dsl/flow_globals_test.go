@@ -0,0 +1,116 @@
+package dsl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/BDNK1/sflowg/runtime"
+)
+
+func newSubflowTestApp(t *testing.T, flows ...*runtime.Flow) (*runtime.Container, *runtime.Executor) {
+	t.Helper()
+	container := runtime.NewContainer(runtime.NewLogger(nil))
+	executor := runtime.NewExecutor(NewExpressionEvaluator(), NewStepExecutor())
+	registry := make(map[string]*runtime.Flow, len(flows))
+	for _, f := range flows {
+		registry[f.ID] = f
+	}
+	container.RegisterFlows(registry, executor, nil, func() runtime.ValueStore { return runtime.NewValueStore() })
+	return container, executor
+}
+
+func TestFlowCall_ReturnsResponseBody(t *testing.T) {
+	loadCustomer := &runtime.Flow{
+		ID:         "load_customer",
+		Entrypoint: runtime.Entrypoint{Type: runtime.EntrypointInternal},
+		Steps: []runtime.Step{{
+			ID:   "respond",
+			Body: `response.json({status: 200, body: {id: args.id, tier: "gold", parent: trigger.parent_flow_id}})`,
+		}},
+	}
+	checkout := &runtime.Flow{
+		ID: "checkout",
+		Steps: []runtime.Step{{
+			ID:   "customer",
+			Body: `flow.call("load_customer", {id: "c1"})`,
+		}},
+	}
+	container, executor := newSubflowTestApp(t, loadCustomer, checkout)
+
+	exec := runtime.NewExecution(checkout, container, nil, runtime.NewValueStore())
+	if err := executor.ExecuteSteps(exec); err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+
+	customer, _ := exec.Values()["customer"].(map[string]any)
+	if customer["id"] != "c1" || customer["tier"] != "gold" || customer["parent"] != "checkout" {
+		t.Fatalf("unexpected subflow result: %#v", exec.Values()["customer"])
+	}
+	if exec.State().Response() != nil {
+		t.Fatal("child response must not leak into the caller")
+	}
+}
+
+func TestFlowCall_PropagatesFlowErrorToCallerRetry(t *testing.T) {
+	flaky := &runtime.Flow{
+		ID: "flaky",
+		Steps: []runtime.Step{{
+			ID:   "call_upstream",
+			Body: `raise("transient", "UPSTREAM_DOWN", "upstream unavailable")`,
+		}},
+	}
+	caller := &runtime.Flow{
+		ID: "caller",
+		Steps: []runtime.Step{{
+			ID:    "invoke",
+			Body:  `flow.call("flaky")`,
+			Retry: &runtime.RetryConfig{MaxAttempts: 3},
+		}},
+	}
+	container, executor := newSubflowTestApp(t, flaky, caller)
+
+	exec := runtime.NewExecution(caller, container, nil, runtime.NewValueStore())
+	err := executor.ExecuteSteps(exec)
+
+	var fe *runtime.FlowError
+	if !errors.As(err, &fe) {
+		t.Fatalf("expected FlowError, got %v", err)
+	}
+	if fe.Type != runtime.ErrorTypeTransient || fe.Code != "UPSTREAM_DOWN" || fe.Step != "invoke" || fe.Retries != 2 {
+		t.Fatalf("unexpected error: %+v", fe)
+	}
+	subflow, _ := fe.Meta["subflow"].(map[string]any)
+	if subflow["flow"] != "flaky" || subflow["step"] != "call_upstream" {
+		t.Fatalf("unexpected subflow meta: %#v", fe.Meta)
+	}
+}
+
+func TestFlowCall_UnknownFlowAndRecursionGuard(t *testing.T) {
+	recursive := &runtime.Flow{
+		ID:    "recursive",
+		Steps: []runtime.Step{{ID: "again", Body: `flow.call("recursive")`}},
+	}
+	missing := &runtime.Flow{
+		ID:    "missing",
+		Steps: []runtime.Step{{ID: "call", Body: `flow.call("nope")`}},
+	}
+	container, executor := newSubflowTestApp(t, recursive, missing)
+
+	tests := []struct {
+		flow *runtime.Flow
+		code runtime.FlowErrorCode
+	}{
+		{missing, runtime.ErrorCodeFlowNotFound},
+		{recursive, runtime.ErrorCodeSubflowDepthExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.flow.ID, func(t *testing.T) {
+			exec := runtime.NewExecution(tt.flow, container, nil, runtime.NewValueStore())
+			err := executor.ExecuteSteps(exec)
+			var fe *runtime.FlowError
+			if !errors.As(err, &fe) || fe.Code != string(tt.code) {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+}
@@ -5,20 +5,24 @@ import (
 	"fmt"
 	"reflect"
 
-	risor "github.com/deepnoodle-ai/risor/v2"
+	"github.com/BDNK1/sflowg/runtime"
 	"github.com/deepnoodle-ai/risor/v2/pkg/object"
 	"github.com/deepnoodle-ai/risor/v2/pkg/op"
 )
 
-// Interpreter wraps Risor's Eval.
-// v2 is sandboxed by default. Two conversion passes are applied to globals
-// before evaluation:
+// Interpreter runs Risor code, compiling each distinct source once.
+// v2 is sandboxed by default. Two conversion passes are applied to the globals
+// the code reads before evaluation:
 //   - maps with Go function values → *object.Module (avoids built-in method shadowing)
 //   - maps with plain values → *lenientMap (returns nil for missing attribute access)
 type Interpreter struct{}
 
 func (i *Interpreter) Eval(ctx context.Context, code string, globals map[string]any) (any, error) {
-	return risor.Eval(ctx, code, risor.WithEnv(convertGlobals(globals)))
+	p, err := compileProgram(code)
+	if err != nil {
+		return nil, err
+	}
+	return p.run(ctx, globals)
 }
 
 // convertGlobals prepares the globals map for Risor evaluation.
@@ -68,40 +72,45 @@ func mapToModule(name string, m map[string]any) *object.Module {
 }
 
 // wrapGoFunc wraps a Go function as a Risor *object.Builtin.
-// Uses v2's (Object, error) return signature — errors propagate natively.
 func wrapGoFunc(name string, fn any) *object.Builtin {
+	return object.NewBuiltin(name, func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		return callGoFunc(fn, args)
+	})
+}
+
+// callGoFunc calls a Go function with Risor arguments.
+// Uses v2's (Object, error) return signature — errors propagate natively.
+func callGoFunc(fn any, args []object.Object) (object.Object, error) {
 	fnVal := reflect.ValueOf(fn)
 	fnType := fnVal.Type()
 	errType := reflect.TypeOf((*error)(nil)).Elem()
 
-	return object.NewBuiltin(name, func(ctx context.Context, args ...object.Object) (object.Object, error) {
-		goArgs := make([]reflect.Value, len(args))
-		for i, arg := range args {
-			goVal := arg.Interface()
-			if i < fnType.NumIn() {
-				goArgs[i] = convertArg(goVal, fnType.In(i))
-			} else {
-				goArgs[i] = reflect.ValueOf(goVal)
-			}
+	goArgs := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		goVal := arg.Interface()
+		if i < fnType.NumIn() {
+			goArgs[i] = convertArg(goVal, fnType.In(i))
+		} else {
+			goArgs[i] = reflect.ValueOf(goVal)
 		}
+	}
 
-		results := fnVal.Call(goArgs)
-		if len(results) == 0 {
-			return object.Nil, nil
-		}
+	results := fnVal.Call(goArgs)
+	if len(results) == 0 {
+		return object.Nil, nil
+	}
 
-		lastIdx := len(results) - 1
-		if fnType.NumOut() > 0 && fnType.Out(lastIdx).Implements(errType) {
-			if !results[lastIdx].IsNil() {
-				return nil, results[lastIdx].Interface().(error)
-			}
-			if len(results) > 1 {
-				return anyToObject(results[0].Interface()), nil
-			}
-			return object.Nil, nil
+	lastIdx := len(results) - 1
+	if fnType.NumOut() > 0 && fnType.Out(lastIdx).Implements(errType) {
+		if !results[lastIdx].IsNil() {
+			return nil, results[lastIdx].Interface().(error)
 		}
-		return anyToObject(results[0].Interface()), nil
-	})
+		if len(results) > 1 {
+			return anyToObject(results[0].Interface()), nil
+		}
+		return object.Nil, nil
+	}
+	return anyToObject(results[0].Interface()), nil
 }
 
 func convertArg(val any, expected reflect.Type) reflect.Value {
@@ -119,13 +128,23 @@ func convertArg(val any, expected reflect.Type) reflect.Value {
 }
 
 // anyToObject converts a Go value to a Risor Object.
-// Maps become *lenientMap (nil for missing keys). Primitives use FromGoType.
+// Maps become *lenientMap (nil for missing keys), also inside lists; uploaded
+// files become *fileObject. Primitives use FromGoType.
 func anyToObject(v any) object.Object {
 	if v == nil {
 		return object.Nil
 	}
-	if m, ok := v.(map[string]any); ok {
-		return newLenientMap(m)
+	switch x := v.(type) {
+	case map[string]any:
+		return newLenientMap(x)
+	case []any:
+		items := make([]object.Object, len(x))
+		for i, item := range x {
+			items[i] = anyToObject(item)
+		}
+		return object.NewList(items)
+	case *runtime.RequestFile:
+		return newFileObject(x)
 	}
 	obj := object.FromGoType(v)
 	if obj == nil {
@@ -164,6 +183,30 @@ func (m *lenientMap) GetAttr(name string) (object.Object, bool) {
 	return object.Nil, true
 }
 
+// fileObject exposes an uploaded file as its metadata map plus read(), which
+// returns the content as bytes. Handed to a plugin it converts back to the
+// *runtime.RequestFile, so plugins can stream the content with Open.
+type fileObject struct {
+	*lenientMap
+	file *runtime.RequestFile
+}
+
+func newFileObject(file *runtime.RequestFile) *fileObject {
+	m := newLenientMap(file.Metadata())
+	m.Set("read", object.NewBuiltin("read", func(ctx context.Context, args ...object.Object) (object.Object, error) {
+		data, err := file.Bytes()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", file.Filename, err)
+		}
+		return object.NewBytes(data), nil
+	}))
+	return &fileObject{lenientMap: m, file: file}
+}
+
+func (f *fileObject) Interface() any {
+	return f.file
+}
+
 // RunOperation overrides the embedded map's operation to surface errors clearly.
 func (m *lenientMap) RunOperation(opType op.BinaryOpType, right object.Object) (object.Object, error) {
 	return nil, fmt.Errorf("map does not support operation %v", opType)
@@ -3,6 +3,8 @@ package dsl
 import (
 	"context"
 	"testing"
+
+	"github.com/BDNK1/sflowg/runtime"
 )
 
 func TestInterpreterEval_BasicTypes(t *testing.T) {
@@ -234,3 +236,29 @@ func TestInterpreterEval_NestedNonFuncMapRemainsLenient(t *testing.T) {
 		t.Errorf("expected true for missing key == nil, got %v", result)
 	}
 }
+
+func TestInterpreterEval_RequestFile(t *testing.T) {
+	interp := &Interpreter{}
+	file := &runtime.RequestFile{Filename: "invoice.pdf", ContentType: "application/pdf", Size: 8}
+	globals := map[string]any{
+		"request": map[string]any{"files": map[string]any{"document": file, "pages": []any{file}}},
+		"upload":  func(f any) any { return f },
+	}
+
+	result, err := interp.Eval(context.Background(), `request.files.document.filename == "invoice.pdf" && request.files.pages[0].size == 8`, globals)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != true {
+		t.Fatalf("result = %v", result)
+	}
+
+	// Plugins receive the handle itself.
+	result, err = interp.Eval(context.Background(), `upload(request.files.document)`, globals)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != file {
+		t.Fatalf("result = %#v, want the file handle", result)
+	}
+}
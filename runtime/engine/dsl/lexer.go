@@ -0,0 +1,216 @@
+package dsl
+
+import (
+	"strings"
+)
+
+// tokenKind classifies the tokens of a .flow file. The outer DSL only needs
+// to tell words, strings and delimiters apart; Risor code inside blocks and
+// option values is kept as source, so every other character is a tokOther.
+type tokenKind int
+
+const (
+	tokEOF     tokenKind = iota
+	tokNewline           // significant: it ends option values
+	tokWord              // letters, digits and underscores
+	tokString            // "...", '...' or `...`
+	tokLBrace
+	tokRBrace
+	tokLParen
+	tokRParen
+	tokLBrack
+	tokRBrack
+	tokColon
+	tokComma
+	tokDot
+	tokOther
+)
+
+var tokenNames = map[tokenKind]string{
+	tokEOF:     "end of file",
+	tokNewline: "end of line",
+	tokWord:    "name",
+	tokString:  "string",
+	tokLBrace:  "'{'",
+	tokRBrace:  "'}'",
+	tokLParen:  "'('",
+	tokRParen:  "')'",
+	tokLBrack:  "'['",
+	tokRBrack:  "']'",
+	tokColon:   "':'",
+	tokComma:   "','",
+	tokDot:     "'.'",
+}
+
+func (k tokenKind) String() string {
+	if name, ok := tokenNames[k]; ok {
+		return name
+	}
+	return "symbol"
+}
+
+// token is a lexeme of a .flow file. pos.Offset and end delimit its source
+// text.
+type token struct {
+	kind   tokenKind
+	text   string
+	pos    Pos
+	end    int
+	closed bool // strings: the closing quote was found
+}
+
+// describe names a token for diagnostics.
+func (t token) describe() string {
+	switch t.kind {
+	case tokWord, tokOther:
+		return "'" + t.text + "'"
+	case tokString:
+		return "string " + t.text
+	default:
+		return t.kind.String()
+	}
+}
+
+// lexer splits a .flow file into tokens. Comments (// and /* */) are
+// skipped, except that // directly after ':' is kept so unquoted URLs such
+// as https://example.com survive in option values.
+type lexer struct {
+	file   string
+	src    string
+	offset int
+	line   int
+	col    int
+	diags  *diagnosticList
+}
+
+func newLexer(file, src string, diags *diagnosticList) *lexer {
+	return &lexer{file: file, src: src, line: 1, col: 1, diags: diags}
+}
+
+// tokens lexes the whole source. The last token is always tokEOF.
+func (l *lexer) tokens() []token {
+	var toks []token
+	for {
+		t := l.next()
+		toks = append(toks, t)
+		if t.kind == tokEOF {
+			return toks
+		}
+	}
+}
+
+func (l *lexer) pos() Pos {
+	return Pos{File: l.file, Offset: l.offset, Line: l.line, Column: l.col}
+}
+
+func (l *lexer) advance() {
+	if l.src[l.offset] == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
+	l.offset++
+}
+
+func (l *lexer) peek(n int) byte {
+	if l.offset+n < len(l.src) {
+		return l.src[l.offset+n]
+	}
+	return 0
+}
+
+func (l *lexer) next() token {
+	l.skipSpaceAndComments()
+	start := l.pos()
+	if l.offset >= len(l.src) {
+		return token{kind: tokEOF, pos: start, end: l.offset}
+	}
+
+	ch := l.src[l.offset]
+	kind := tokOther
+	switch {
+	case ch == '\n':
+		kind = tokNewline
+	case isWordChar(ch):
+		for l.offset < len(l.src) && isWordChar(l.src[l.offset]) {
+			l.advance()
+		}
+		return token{kind: tokWord, text: l.src[start.Offset:l.offset], pos: start, end: l.offset}
+	case ch == '"' || ch == '\'' || ch == '`':
+		return l.readString(start, ch)
+	case ch == '{':
+		kind = tokLBrace
+	case ch == '}':
+		kind = tokRBrace
+	case ch == '(':
+		kind = tokLParen
+	case ch == ')':
+		kind = tokRParen
+	case ch == '[':
+		kind = tokLBrack
+	case ch == ']':
+		kind = tokRBrack
+	case ch == ':':
+		kind = tokColon
+	case ch == ',':
+		kind = tokComma
+	case ch == '.':
+		kind = tokDot
+	}
+	l.advance()
+	return token{kind: kind, text: l.src[start.Offset:l.offset], pos: start, end: l.offset}
+}
+
+// readString reads a quoted string. Backtick strings are raw; the others
+// honor backslash escapes.
+func (l *lexer) readString(start Pos, quote byte) token {
+	l.advance()
+	for l.offset < len(l.src) {
+		ch := l.src[l.offset]
+		if ch == '\\' && quote != '`' && l.offset+1 < len(l.src) {
+			l.advance()
+			l.advance()
+			continue
+		}
+		l.advance()
+		if ch == quote {
+			return token{kind: tokString, text: l.src[start.Offset:l.offset], pos: start, end: l.offset, closed: true}
+		}
+	}
+	l.diags.add(start, "unterminated string")
+	return token{kind: tokString, text: l.src[start.Offset:l.offset], pos: start, end: l.offset}
+}
+
+func (l *lexer) skipSpaceAndComments() {
+	for l.offset < len(l.src) {
+		ch := l.src[l.offset]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			l.advance()
+		case ch == '/' && l.peek(1) == '/' && (l.offset == 0 || l.src[l.offset-1] != ':'):
+			for l.offset < len(l.src) && l.src[l.offset] != '\n' {
+				l.advance()
+			}
+		case ch == '/' && l.peek(1) == '*':
+			start := l.pos()
+			end := strings.Index(l.src[l.offset+2:], "*/")
+			if end < 0 {
+				l.diags.add(start, "unterminated comment")
+				for l.offset < len(l.src) {
+					l.advance()
+				}
+				return
+			}
+			for stop := l.offset + 2 + end + 2; l.offset < stop; {
+				l.advance()
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isWordChar(ch byte) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '_'
+}
@@ -1,16 +1,27 @@
 package dsl
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/BDNK1/sflowg/runtime"
+	"github.com/deepnoodle-ai/risor/v2/pkg/ast"
+	risorparser "github.com/deepnoodle-ai/risor/v2/pkg/parser"
 )
 
-// FlowLoader loads flow definitions from .flow DSL files.
-type FlowLoader struct{}
+// FlowLoader loads flow definitions from .flow DSL files. Loading compiles
+// the Risor code of a flow, so syntax errors fail at startup and executions
+// run the compiled code.
+type FlowLoader struct {
+	mu      sync.Mutex
+	refs    map[string][]flowRef // globals read by each loaded flow, for CheckFlow
+	modules map[string]*module   // imported modules, by absolute path
+}
 
 func NewFlowLoader() *FlowLoader {
 	return &FlowLoader{}
@@ -26,13 +37,49 @@ func (l *FlowLoader) Load(filePath string) (runtime.Flow, error) {
 		return runtime.Flow{}, fmt.Errorf("error reading DSL file: %w", err)
 	}
 
-	flow, err := Parse(string(data))
-	if err != nil {
-		return runtime.Flow{}, fmt.Errorf("error parsing DSL file %s: %w", filePath, err)
+	diags := &diagnosticList{file: filePath, src: string(data)}
+	file := parseFile(filePath, string(data), diags)
+	templates := make(map[string]*TemplateDecl)
+	var refs []flowRef
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ImportDecl); ok && isTemplateImport(d) {
+			imported, templateRefs := importTemplates(d, filePath, diags)
+			maps.Copy(templates, imported)
+			refs = append(refs, templateRefs...)
+		}
+	}
+	flow := buildFlow(file, templates, diags)
+	refs = append(compileFlow(file, diags), refs...)
+	for _, decl := range file.Decls {
+		if d, ok := decl.(*ImportDecl); ok && !isTemplateImport(d) {
+			if m := l.importModule(d, filePath, nil, diags); m != nil {
+				if flow.Globals == nil {
+					flow.Globals = make(map[string]any)
+				}
+				flow.Globals[d.Name.Name] = m.object(d.Name.Name)
+			}
+		}
+	}
+	if err := diags.err(); err != nil {
+		return runtime.Flow{}, fmt.Errorf("error parsing DSL file:\n%w", err)
 	}
 
 	// Derive flow ID from filename (strip extension and path)
 	flow.ID = strings.TrimSuffix(filepath.Base(filePath), ".flow")
+	l.mu.Lock()
+	if l.refs == nil {
+		l.refs = make(map[string][]flowRef)
+	}
+	l.refs[flow.ID] = refs
+	l.mu.Unlock()
+
+	// Compile the request schema now so broken schemas fail at startup and
+	// schema files resolve relative to the flow file.
+	schema, err := runtime.CompileRequestSchema(flow.Entrypoint.Config, filepath.Dir(filePath))
+	if err != nil {
+		return runtime.Flow{}, fmt.Errorf("error compiling request schema in %s: %w", filePath, err)
+	}
+	flow.Entrypoint.Schema = schema
 
 	// Convert return body to a final step (return is just an unconditional step)
 	if flow.Return.Body != "" {
@@ -42,5 +89,84 @@ func (l *FlowLoader) Load(filePath string) (runtime.Flow, error) {
 		})
 	}
 
+	if err := validateJumps(&flow); err != nil {
+		return runtime.Flow{}, fmt.Errorf("error in %s: %w", filePath, err)
+	}
+
 	return flow, nil
 }
+
+// nextTargets returns the step IDs of the next() calls in body that take a
+// string literal. Method calls such as iter.next("x"), comments and strings
+// are not jumps. Bodies that do not parse have no known targets.
+func nextTargets(body string) []string {
+	program, err := risorparser.Parse(context.Background(), body, nil)
+	if err != nil {
+		return nil
+	}
+	var targets []string
+	var visit func(ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ObjectCall:
+			// Only the receiver and the arguments can hold a jump.
+			ast.Inspect(n.X, visit)
+			for _, arg := range n.Call.Args {
+				ast.Inspect(arg, visit)
+			}
+			return false
+		case *ast.Call:
+			fn, ok := n.Fun.(*ast.Ident)
+			if !ok || fn.Name != "next" || len(n.Args) != 1 {
+				return true
+			}
+			if target, ok := n.Args[0].(*ast.String); ok && target.Template == nil {
+				targets = append(targets, target.Value)
+			}
+		}
+		return true
+	}
+	ast.Inspect(program, visit)
+	return targets
+}
+
+// validateJumps checks that every statically known jump target exists:
+// `next:` options naming a step and next("...") calls with a literal ID.
+// Targets computed by expressions are checked when the jump happens.
+func validateJumps(flow *runtime.Flow) error {
+	check := func(stepID, target, source string) error {
+		if flow.StepIndex(target) < 0 {
+			return fmt.Errorf("step %s: %s target %q does not exist", stepID, source, target)
+		}
+		return nil
+	}
+
+	var walk func(steps []runtime.Step) error
+	walk = func(steps []runtime.Step) error {
+		for _, s := range steps {
+			if runtime.IsStepReference(s.Next) {
+				if err := check(s.ID, s.Next, "next"); err != nil {
+					return err
+				}
+			}
+			bodies := []string{s.Body, s.FallbackBody}
+			for _, c := range s.Catches {
+				bodies = append(bodies, c.Body)
+			}
+			for _, body := range bodies {
+				for _, target := range nextTargets(body) {
+					if err := check(s.ID, target, "next()"); err != nil {
+						return err
+					}
+				}
+			}
+			if s.Parallel != nil {
+				if err := walk(s.Parallel.Steps); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(flow.Steps)
+}
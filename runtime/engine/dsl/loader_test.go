@@ -0,0 +1,365 @@
+package dsl
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BDNK1/sflowg/runtime"
+)
+
+func loadFlowSource(t *testing.T, source string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jumps.flow")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewFlowLoader().Load(path)
+	return err
+}
+
+func TestLoad_ValidatesJumpTargets(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"next option", `step a(next: b) { 1 }`, `next target "b" does not exist`},
+		{"next call", `step a { next("missing") }`, `next() target "missing" does not exist`},
+		{"next call in fallback", "step a { 1 }\nfallback { next('gone') }", `next() target "gone" does not exist`},
+		{"branch next call", `parallel p { step a { next("nope") } }`, `next() target "nope" does not exist`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := loadFlowSource(t, tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoad_AcceptsValidJumps(t *testing.T) {
+	source := `
+step wait { 1 }
+step poll(next: request.query.next, max_iterations: 5) { next("done") }
+step done {
+	// next("later") once the backfill exists
+	cursor.next("page")
+	log.info("skipping next('missing')")
+}
+`
+	if err := loadFlowSource(t, source); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestLoad_ReportsRisorSyntaxErrors(t *testing.T) {
+	source := `step a(condition: request.body.total >) {
+	let x = 1
+	let = 2
+}
+`
+	err := loadFlowSource(t, source)
+	if err == nil {
+		t.Fatal("expected syntax errors")
+	}
+	for _, want := range []string{"jumps.flow:1:", "jumps.flow:3:6:"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoad_CachesCompiledCode(t *testing.T) {
+	body := `let total = request.body.amount * 2`
+	if err := loadFlowSource(t, "step double {\n\t"+body+"\n}\n"); err != nil {
+		t.Fatal(err)
+	}
+	cached, ok := programs.Load(body)
+	if !ok {
+		t.Fatal("step body was not compiled at load time")
+	}
+	p, err := compileProgram(body)
+	if err != nil || p != cached.(*program) {
+		t.Fatalf("compileProgram = %p, %v; want the cached program %p", p, err, cached)
+	}
+}
+
+type httpPlugin struct{}
+
+func (p *httpPlugin) Request(exec *runtime.Execution, args map[string]any) (map[string]any, error) {
+	return args, nil
+}
+
+func TestCheckFlow_WarnsOnUnknownGlobals(t *testing.T) {
+	source := `properties {
+	currency: "EUR"
+}
+
+step fetch(for_each: request.body.ids, as: id) {
+	http.request({url: properties.base_url + id})
+}
+
+step charge(condition: fetch != nil && missing_step.ok) {
+	stripe.charge({currency: properties.currency, items: fetch})
+	log.info(properties.region)
+}
+`
+	path := filepath.Join(t.TempDir(), "orders.flow")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	loader := NewFlowLoader()
+	flow, err := loader.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := runtime.NewContainer(runtime.NewLogger(nil))
+	if err := container.RegisterPlugin("http", &httpPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := loader.CheckFlow(flow, container, map[string]any{"region": "eu"})
+	want := []string{
+		path + `:6:32: properties.base_url is not defined`,
+		path + `:9:40: "missing_step" is not a step of this flow`,
+		path + `:10:2: plugin "stripe" is not in flow-config.yaml`,
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("warnings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// writeFiles writes files into a new directory and returns it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad_ImportsModuleFunctions(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"orders.flow": `import "lib/payments.risor" as payments
+
+step charge {
+	{url: payments.url(request.body.id), label: payments.label(request.body.id)}
+}
+`,
+		"lib/payments.risor": `import "money.risor" as money
+
+function url(id) {
+	return properties.base_url + "/charges/" + id
+}
+
+function label(id) {
+	return money.label(id)
+}
+`,
+		"lib/money.risor": `function label(id) {
+	return sprintf("charge %s", id)
+}
+`,
+	})
+	flow, err := NewFlowLoader().Load(filepath.Join(dir, "orders.flow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exec := runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+	exec.AddValue("request", map[string]any{"body": map[string]any{"id": "c1"}})
+	exec.AddValue("properties", map[string]any{"base_url": "https://pay"})
+	if _, err := NewStepExecutor().ExecuteStep(exec, exec, flow.Steps[0]); err != nil {
+		t.Fatal(err)
+	}
+	charge, _ := exec.Values()["charge"].(map[string]any)
+	if charge["url"] != "https://pay/charges/c1" || charge["label"] != "charge c1" {
+		t.Fatalf("charge = %#v", exec.Values()["charge"])
+	}
+}
+
+func TestImport_InitialisesModuleOncePerExecution(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.flow": `import "counter.risor" as counter
+
+step first { {a: counter.next(), b: counter.next()} }
+
+step second { counter.next() }
+`,
+		"counter.risor": `let inits = 0
+let calls = 0
+inits = inits + 1
+
+function next() {
+	calls = calls + 1
+	return sprintf("%d/%d", inits, calls)
+}
+`,
+	})
+	flow, err := NewFlowLoader().Load(filepath.Join(dir, "main.flow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executor := NewStepExecutor()
+	container := runtime.NewContainer(runtime.NewLogger(nil))
+	for range 2 {
+		exec := runtime.NewExecution(&flow, container, nil, runtime.NewValueStore())
+		for _, step := range flow.Steps {
+			if _, err := executor.ExecuteStep(exec, exec, step); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Each execution starts from a fresh module; its calls share one.
+		first, _ := exec.Values()["first"].(map[string]any)
+		if first["a"] != "1/1" || first["b"] != "1/2" || exec.Values()["second"] != "1/3" {
+			t.Fatalf("first = %#v, second = %#v", first, exec.Values()["second"])
+		}
+	}
+}
+
+func TestLoad_ReportsImportErrorsInImportedFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"a.risor": "import \"b.risor\" as b\nfunction f() { return b.g() }\n",
+				"b.risor": "// b calls back into a\nimport \"a.risor\" as a\nfunction g() { return a.f() }\n",
+			},
+			want: []string{`b.risor:2:8: import cycle: a.risor -> b.risor -> a.risor`},
+		},
+		{
+			name: "syntax error",
+			files: map[string]string{
+				"a.risor": "function f(x) {\n\treturn x +\n}\n",
+			},
+			want: []string{`a.risor:3:1:`},
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"a.risor": "import \"gone.risor\" as gone\n",
+			},
+			want: []string{`a.risor:1:8: cannot import "gone.risor"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.files["main.flow"] = "import \"a.risor\" as a\n\nstep s { a.f(1) }\n"
+			dir := writeFiles(t, tt.files)
+			_, err := NewFlowLoader().Load(filepath.Join(dir, "main.flow"))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), filepath.Join(dir, want)) {
+					t.Errorf("expected %q in:\n%v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestImport_RuntimeErrorsPointIntoModule(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"main.flow": "import \"lib.risor\" as lib\n\nstep s { lib.total(request.body) }\n",
+		"lib.risor": "function total(body) {\n\treturn body.amount + \"EUR\"\n}\n",
+	})
+	flow, err := NewFlowLoader().Load(filepath.Join(dir, "main.flow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exec := runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+	exec.AddValue("request", map[string]any{"body": map[string]any{"amount": 5}})
+	_, err = NewStepExecutor().ExecuteStep(exec, exec, flow.Steps[0])
+	want := filepath.Join(dir, "lib.risor") + ":2:"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected an error at %s, got %v", want, err)
+	}
+}
+
+func TestLoad_UsesTemplatesOfImportedFlowFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"orders.flow": `import "lib/lookups.flow" as lookups
+
+use lookups.fetch_or_404(table: "orders", id: request.body.id) as order
+
+step reply { {id: order_fetch.id, checked: order_check} }
+`,
+		"lib/lookups.flow": `template fetch_or_404(table, id) {
+	step fetch {
+		orders.get({table: table, id: id})
+	}
+	step check {
+		if (fetch.status != "paid") { raise({status: 404, message: sprintf("%s %s not found", table, id)}) }
+		true
+	}
+}
+`,
+	})
+	loader := NewFlowLoader()
+	flow, err := loader.Load(filepath.Join(dir, "orders.flow"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := runtime.NewContainer(runtime.NewLogger(nil))
+	if err := container.RegisterPlugin("orders", &benchPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if warnings := loader.CheckFlow(flow, container, nil); len(warnings) != 0 {
+		t.Errorf("unexpected warnings:\n%s", strings.Join(warnings, "\n"))
+	}
+
+	exec := runtime.NewExecution(&flow, container, nil, runtime.NewValueStore())
+	exec.AddValue("request", map[string]any{"body": map[string]any{"id": "o1"}})
+	executor := NewStepExecutor()
+	for _, step := range flow.Steps {
+		if _, err := executor.ExecuteStep(exec, exec, step); err != nil {
+			t.Fatalf("step %s: %v", step.ID, err)
+		}
+	}
+	reply, _ := exec.Values()["reply"].(map[string]any)
+	if reply["id"] != "o1" || reply["checked"] != true {
+		t.Fatalf("reply = %#v", exec.Values()["reply"])
+	}
+}
+
+func TestLoad_ReportsTemplateErrorsInImportedFile(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"orders.flow":  "import \"lookups.flow\" as lookups\n\nuse lookups.fetch(id: 1)\n",
+		"lookups.flow": "step stray { 1 }\n\ntemplate fetch(id) {\n\tstep get(retry: {maxRetries: 3}) { id }\n}\n",
+	})
+	_, err := NewFlowLoader().Load(filepath.Join(dir, "orders.flow"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	lookups := filepath.Join(dir, "lookups.flow")
+	for _, want := range []string{
+		lookups + ":1:1: only templates can be declared in an imported .flow file",
+		lookups + ":4:19: step get: unsupported retry field: maxRetries",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "orders.flow") {
+		t.Errorf("the use of a broken template should not be reported:\n%v", err)
+	}
+}
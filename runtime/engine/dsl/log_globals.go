@@ -7,17 +7,21 @@ import (
 )
 
 func BuildLogGlobals(exec *runtime.Execution) map[string]any {
-	logger := exec.Logger().ForUser()
+	return bindAll(logBindings, exec)
+}
 
-	logMethods := map[string]any{
-		"debug": makeLogFn(logger, slog.LevelDebug),
-		"info":  makeLogFn(logger, slog.LevelInfo),
-		"warn":  makeLogFn(logger, slog.LevelWarn),
-		"error": makeLogFn(logger, slog.LevelError),
-	}
+var logBindings = map[string]any{
+	"log": map[string]any{
+		"debug": bindLogFn(slog.LevelDebug),
+		"info":  bindLogFn(slog.LevelInfo),
+		"warn":  bindLogFn(slog.LevelWarn),
+		"error": bindLogFn(slog.LevelError),
+	},
+}
 
-	return map[string]any{
-		"log": logMethods,
+func bindLogFn(level slog.Level) binding {
+	return func(exec *runtime.Execution) any {
+		return makeLogFn(exec.Logger().ForUser(), level)
 	}
 }
 
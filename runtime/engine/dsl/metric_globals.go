@@ -9,19 +9,35 @@ import (
 // BuildMetricGlobals creates the `metric` module globals for DSL step evaluation.
 // Follows the same pattern as BuildLogGlobals.
 func BuildMetricGlobals(exec *runtime.Execution) map[string]any {
-	metrics := exec.Metrics()
-	logger := exec.Logger().ForUser()
+	return bindAll(metricBindings(exec.Metrics()), exec)
+}
 
+// metricBindings returns the metric module, with a handle for each metric
+// declared in metrics.
+func metricBindings(metrics *runtime.Metrics) map[string]any {
+	bind := func(makeFn func(*runtime.Execution, *runtime.Metrics, runtime.Logger) func(args ...any) error) binding {
+		return func(exec *runtime.Execution) any {
+			return makeFn(exec, exec.Metrics(), exec.Logger().ForUser())
+		}
+	}
 	metricMethods := map[string]any{
-		"counter":       makeCounterFn(exec, metrics, logger),
-		"updowncounter": makeUpDownCounterFn(exec, metrics, logger),
-		"histogram":     makeHistogramFn(exec, metrics, logger),
-		"gauge":         makeGaugeFn(exec, metrics, logger),
+		"counter":       bind(makeCounterFn),
+		"updowncounter": bind(makeUpDownCounterFn),
+		"histogram":     bind(makeHistogramFn),
+		"gauge":         bind(makeGaugeFn),
 	}
 
 	// Add predeclared handles.
 	for name, decl := range metrics.UserDeclarations() {
-		metricMethods[name] = buildPredeclaredHandle(exec, metrics, name, decl, logger)
+		method, ok := handleMethods[decl.Type]
+		if !ok {
+			continue
+		}
+		metricMethods[name] = map[string]any{
+			method: binding(func(exec *runtime.Execution) any {
+				return buildPredeclaredHandle(exec, exec.Metrics(), name, decl, exec.Logger().ForUser())[method]
+			}),
+		}
 	}
 
 	return map[string]any{
@@ -125,6 +141,14 @@ func makeGaugeFn(exec *runtime.Execution, metrics *runtime.Metrics, logger runti
 	}
 }
 
+// handleMethods is the method of a predeclared handle by metric type.
+var handleMethods = map[string]string{
+	"counter":       "inc",
+	"updowncounter": "add",
+	"histogram":     "observe",
+	"gauge":         "set",
+}
+
 // buildPredeclaredHandle builds a named handle map with the appropriate method
 // for the metric type. These are nested maps containing Go functions, which
 // will be recursively converted to Risor modules by mapToModule.
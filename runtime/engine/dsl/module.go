@@ -0,0 +1,271 @@
+package dsl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/BDNK1/sflowg/runtime"
+	"github.com/deepnoodle-ai/risor/v2/pkg/ast"
+	rerrors "github.com/deepnoodle-ai/risor/v2/pkg/errors"
+	"github.com/deepnoodle-ai/risor/v2/pkg/object"
+	risorparser "github.com/deepnoodle-ai/risor/v2/pkg/parser"
+	"github.com/deepnoodle-ai/risor/v2/pkg/vm"
+)
+
+// module is a .risor file of shared functions. A flow imports it with
+//
+//	import "lib/payments.risor" as payments
+//
+// and its step bodies call the top-level functions of the file as
+// payments.name(...). A module may import other modules the same way, in
+// lines at the top of the file.
+type module struct {
+	path      string
+	program   *program
+	functions []string
+	imports   map[string]*object.Module // by import name
+}
+
+// moduleImport matches an import line of a .risor file.
+var moduleImport = regexp.MustCompile(`^import\s+("[^"]*"|'[^']*')\s+as\s+([A-Za-z_][A-Za-z0-9_]*)\s*$`)
+
+// object returns the module as the Risor global name.
+func (m *module) object(name string) *object.Module {
+	contents := make(map[string]object.Object, len(m.functions))
+	for _, fn := range m.functions {
+		contents[fn] = object.NewBuiltin(name+"."+fn, func(ctx context.Context, args ...object.Object) (object.Object, error) {
+			return m.call(ctx, fn, args)
+		})
+	}
+	return object.NewBuiltinsModule(name, contents)
+}
+
+// call runs the function name of the module on the instance of the execution
+// calling it.
+func (m *module) call(ctx context.Context, name string, args []object.Object) (object.Object, error) {
+	if ctx.Value(moduleCallKey{m}) != nil {
+		return nil, fmt.Errorf("%s: %s called back into its own module", m.path, name)
+	}
+	inst, err := m.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// A VM runs one call at a time, so calls from parallel branches take turns.
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	fn, err := inst.machine.Get(name)
+	if err != nil {
+		return nil, m.locate(err)
+	}
+	closure, ok := fn.(*object.Closure)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not a function", m.path, name)
+	}
+	result, err := inst.machine.Call(context.WithValue(ctx, moduleCallKey{m}, true), closure, args)
+	if err != nil {
+		return nil, m.locate(err)
+	}
+	return result, nil
+}
+
+// moduleInstance is a module initialised for one execution. Its VM keeps the
+// module-level variables between calls.
+type moduleInstance struct {
+	once    sync.Once
+	mu      sync.Mutex // held while a call runs on machine
+	machine *vm.VirtualMachine
+	err     error
+}
+
+// moduleCallKey marks the context of a call running on the module's VM.
+type moduleCallKey struct{ m *module }
+
+// instance returns the instance of the module for the execution calling it,
+// running the top-level code of the module on first use. The globals the
+// module reads come from its imports or from the step making that first
+// call, so modules can call plugins, log and raise() like step bodies do.
+func (m *module) instance(ctx context.Context) (*moduleInstance, error) {
+	scope, ok := ctx.Value(scopeKey{}).(*stepScope)
+	if !ok {
+		inst := &moduleInstance{}
+		inst.machine, inst.err = m.start(ctx, nil)
+		return inst, inst.err
+	}
+	inst := scope.exec.State().Local(m, func() any { return &moduleInstance{} }).(*moduleInstance)
+	inst.once.Do(func() {
+		inst.machine, inst.err = m.start(ctx, scope.globals)
+	})
+	return inst, inst.err
+}
+
+// start creates a VM for the module and runs its top-level code.
+func (m *module) start(ctx context.Context, callerGlobals map[string]any) (*vm.VirtualMachine, error) {
+	env := make(map[string]any, len(m.program.globals))
+	for _, ref := range m.program.globals {
+		if dep, ok := m.imports[ref.name]; ok {
+			env[ref.name] = dep
+			continue
+		}
+		v, ok := callerGlobals[ref.name]
+		if !ok {
+			return nil, &moduleError{pos: fmt.Sprintf("%s:%d:%d", m.path, ref.line, ref.column), err: fmt.Errorf("undefined variable %q", ref.name)}
+		}
+		env[ref.name] = v
+	}
+
+	machine, err := vm.New(m.program.code, vm.WithGlobals(convertGlobals(env)))
+	if err != nil {
+		return nil, m.locate(err)
+	}
+	if err := machine.Run(ctx); err != nil {
+		return nil, m.locate(err)
+	}
+	return machine, nil
+}
+
+// moduleError is an error of a module function, at its position in the
+// module file.
+type moduleError struct {
+	pos string
+	err error
+}
+
+func (e *moduleError) Error() string { return e.pos + ": " + e.err.Error() }
+func (e *moduleError) Unwrap() error { return e.err }
+
+// locate prefixes Risor errors with their position in the module file.
+// FlowErrors raised by the module, and errors already located in a module it
+// imports, are returned as they are.
+func (m *module) locate(err error) error {
+	if _, ok := runtime.AsFlowError(err); ok {
+		return err
+	}
+	var located *moduleError
+	if errors.As(err, &located) {
+		return err
+	}
+	var se *rerrors.StructuredError
+	if errors.As(err, &se) && !se.Location.IsZero() {
+		return &moduleError{pos: fmt.Sprintf("%s:%d:%d", m.path, se.Location.Line, se.Location.Column), err: err}
+	}
+	return &moduleError{pos: m.path, err: err}
+}
+
+// importModule loads the module imported by d from the file from, reporting
+// problems in the importing file to diags and problems in the module, or in
+// modules it imports, at their position in those files. stack holds the
+// modules being imported, to detect cycles.
+func (l *FlowLoader) importModule(d *ImportDecl, from string, stack []string, diags *diagnosticList) *module {
+	path := filepath.Join(filepath.Dir(from), d.Path.Value)
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		diags.add(d.Path.ValuePos, "cannot import %q: %v", d.Path.Value, err)
+		return nil
+	}
+	if i := slices.Index(stack, abs); i >= 0 {
+		cycle := append(slices.Clone(stack[i:]), abs)
+		for j, p := range cycle {
+			cycle[j] = filepath.Base(p)
+		}
+		diags.add(d.Path.ValuePos, "import cycle: %s", strings.Join(cycle, " -> "))
+		return nil
+	}
+	l.mu.Lock()
+	m, ok := l.modules[abs]
+	l.mu.Unlock()
+	if ok {
+		return m
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		diags.add(d.Path.ValuePos, "cannot import %q: %v", d.Path.Value, err)
+		return nil
+	}
+	source := string(data)
+	md := &diagnosticList{file: path, src: source}
+	m = &module{path: path, imports: make(map[string]*object.Module)}
+
+	// Import lines are blanked so the code keeps the lines of the file.
+	code := []byte(source)
+	offset := 0
+	for _, line := range strings.SplitAfter(source, "\n") {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "//") {
+			offset += len(line)
+			continue
+		}
+		if !strings.HasPrefix(text, "import ") {
+			break
+		}
+		indent := strings.Index(line, text)
+		pos := Pos{File: path, Offset: offset + indent, Line: strings.Count(source[:offset], "\n") + 1, Column: indent + 1}
+		match := moduleImport.FindStringSubmatch(text)
+		if match == nil {
+			md.add(pos, `expected import "path" as NAME`)
+		} else {
+			pathPos := pos
+			pathPos.Offset += strings.Index(text, match[1])
+			pathPos.Column += strings.Index(text, match[1])
+			dep := &ImportDecl{
+				Keyword: pos,
+				Path:    &String{ValuePos: pathPos, Raw: match[1], Value: unquote(match[1])},
+				Name:    &Ident{Name: match[2]},
+			}
+			if _, dup := m.imports[dep.Name.Name]; dup {
+				md.add(pos, "duplicate import %q", dep.Name.Name)
+			} else if imported := l.importModule(dep, path, append(stack, abs), md); imported != nil {
+				m.imports[dep.Name.Name] = imported.object(dep.Name.Name)
+			}
+		}
+		for i := offset; i < offset+len(line); i++ {
+			if code[i] != '\n' && code[i] != '\r' {
+				code[i] = ' '
+			}
+		}
+		offset += len(line)
+	}
+
+	src := codeSource{code: string(code), pos: Pos{File: path, Line: 1, Column: 1}}
+	if p, err := compileProgram(src.code); err != nil {
+		src.report(md, err)
+	} else {
+		m.program = p
+		m.functions = moduleFunctions(src.code)
+	}
+
+	if err := md.err(); err != nil {
+		diags.imported = append(diags.imported, err.(Diagnostics)...)
+		return nil
+	}
+	l.mu.Lock()
+	if l.modules == nil {
+		l.modules = make(map[string]*module)
+	}
+	l.modules[abs] = m
+	l.mu.Unlock()
+	return m
+}
+
+// moduleFunctions returns the names of the top-level functions of code.
+func moduleFunctions(code string) []string {
+	tree, err := risorparser.Parse(context.Background(), code, nil)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, stmt := range tree.Stmts {
+		if fn, ok := stmt.(*ast.Func); ok && fn.Name != nil {
+			names = append(names, fn.Name.Name)
+		}
+	}
+	return names
+}
@@ -1,7 +1,7 @@
 package dsl
 
 import (
-	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/BDNK1/sflowg/runtime"
@@ -11,782 +11,672 @@ import (
 //
 // DSL syntax supports these top-level block types:
 //
+//	import "lib/payments.risor" as payments
 //	entrypoint.http { method: POST, path: /api/payments, timeout: 5000, ... }
 //	properties { key: value, ... }
 //	step step_name(condition: expr, timeout: 2000, retry: { ... }) { risor code }
 //	  fallback { risor code }          // optional suffix block
 //	  compensate { risor code }        // optional suffix block
+//	parallel group_name(mode: collect_all, timeout: 5000) { step a { ... } step b { ... } }
+//	template name(param, ...) { step ... }  // steps instantiated by use
+//	use name(param: expr, ...) as prefix   // expands to the template's steps
 //	on_error { risor code }            // flow-level error handler
 //	return response.json({ ... })
+//
+// Errors are Diagnostics listing every problem found, each with its line and
+// column.
 func Parse(source string) (runtime.Flow, error) {
-	p := &parser{source: source, pos: 0}
-	return p.parse()
+	return parseFlow("", source)
 }
 
-type parser struct {
-	source string
-	pos    int
+// ParseFile parses a .flow source into its syntax tree without building the
+// flow. filename is only used in positions. On syntax errors it returns the
+// declarations that parsed along with Diagnostics.
+func ParseFile(filename, source string) (*File, error) {
+	diags := &diagnosticList{file: filename, src: source}
+	f := parseFile(filename, source, diags)
+	return f, diags.err()
 }
 
-func (p *parser) parse() (runtime.Flow, error) {
-	var flow runtime.Flow
-
-	p.skipWhitespaceAndComments()
-	for p.pos < len(p.source) {
-		keyword := p.peekKeyword()
-
-		switch {
-		case strings.HasPrefix(keyword, "entrypoint"):
-			ep, timeout, err := p.parseEntrypoint()
-			if err != nil {
-				return flow, fmt.Errorf("parsing entrypoint: %w", err)
-			}
-			flow.Entrypoint = ep
-			flow.Timeout = timeout
-
-		case keyword == "properties":
-			props, err := p.parseProperties()
-			if err != nil {
-				return flow, fmt.Errorf("parsing properties: %w", err)
-			}
-			flow.Properties = props
+// parseFlow parses and builds a flow, collecting the syntax and the option
+// errors of the whole file.
+func parseFlow(filename, source string) (runtime.Flow, error) {
+	diags := &diagnosticList{file: filename, src: source}
+	flow := buildFlow(parseFile(filename, source, diags), nil, diags)
+	return flow, diags.err()
+}
 
-		case keyword == "step":
-			step, err := p.parseStep()
-			if err != nil {
-				return flow, fmt.Errorf("parsing step: %w", err)
-			}
-			flow.Steps = append(flow.Steps, step)
+// topLevelKeywords start the declarations of a .flow file. After an error the
+// parser skips to the next one at the start of a line.
+var topLevelKeywords = map[string]bool{
+	"import":     true,
+	"entrypoint": true,
+	"properties": true,
+	"step":       true,
+	"parallel":   true,
+	"template":   true,
+	"use":        true,
+	"on_error":   true,
+	"return":     true,
+}
 
-		case keyword == "on_error":
-			body, err := p.parseOnError()
-			if err != nil {
-				return flow, fmt.Errorf("parsing on_error: %w", err)
-			}
-			flow.OnErrorBody = body
+// bailout is panicked by parser.errorf to abandon the current declaration.
+type bailout struct{}
 
-		case keyword == "return":
-			ret, err := p.parseReturn()
-			if err != nil {
-				return flow, fmt.Errorf("parsing return: %w", err)
-			}
-			flow.Return = ret
+type parser struct {
+	file  string
+	src   string
+	toks  []token
+	depth []int // brace, paren and bracket depth before each token
+	lines []int // offsets of line starts
+	i     int
+	diags *diagnosticList
+}
 
-		default:
-			if p.pos < len(p.source) {
-				return flow, fmt.Errorf("unexpected token at position %d: %q", p.pos, p.source[p.pos:min(p.pos+20, len(p.source))])
-			}
+func parseFile(filename, source string, diags *diagnosticList) *File {
+	p := &parser{
+		file:  filename,
+		src:   source,
+		toks:  newLexer(filename, source, diags).tokens(),
+		lines: []int{0},
+		diags: diags,
+	}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			p.lines = append(p.lines, i+1)
+		}
+	}
+	p.depth = make([]int, len(p.toks))
+	depth := 0
+	for i, t := range p.toks {
+		// A declaration ends whatever was left open before it, so one
+		// unclosed delimiter does not swallow the rest of the file.
+		if p.declStart(i) {
+			depth = 0
+		}
+		p.depth[i] = depth
+		switch t.kind {
+		case tokLBrace, tokLParen, tokLBrack:
+			depth++
+		case tokRBrace, tokRParen, tokRBrack:
+			depth = max(depth-1, 0)
 		}
+	}
 
-		p.skipWhitespaceAndComments()
+	f := &File{Name: filename, Source: source}
+	for {
+		p.skipNewlines()
+		if p.tok().kind == tokEOF {
+			return f
+		}
+		if decl := p.parseDecl(); decl != nil {
+			f.Decls = append(f.Decls, decl)
+		}
 	}
+}
 
-	return flow, nil
+func (p *parser) tok() token {
+	return p.toks[p.i]
 }
 
-// peekKeyword reads the next word without advancing position.
-func (p *parser) peekKeyword() string {
-	start := p.pos
-	for start < len(p.source) && !isWordChar(p.source[start]) {
-		start++
-	}
-	end := start
-	for end < len(p.source) && (isWordChar(p.source[end]) || p.source[end] == '.') {
-		end++
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
 	}
-	return p.source[start:end]
+	return t
 }
 
-// readWord reads the next word and advances position.
-func (p *parser) readWord() string {
-	p.skipWhitespace()
-	start := p.pos
-	for p.pos < len(p.source) && (isWordChar(p.source[p.pos]) || p.source[p.pos] == '.') {
-		p.pos++
+func (p *parser) skipNewlines() {
+	for p.tok().kind == tokNewline {
+		p.i++
 	}
-	return p.source[start:p.pos]
 }
 
-// parseEntrypoint parses: entrypoint.http { ... }
-// Returns the Entrypoint, the flow-level timeout (extracted from "timeout" key), and any error.
-func (p *parser) parseEntrypoint() (runtime.Entrypoint, int, error) {
-	word := p.readWord() // "entrypoint.http"
-	parts := strings.SplitN(word, ".", 2)
-	if len(parts) != 2 {
-		return runtime.Entrypoint{}, 0, fmt.Errorf("expected entrypoint.TYPE, got %q", word)
+// skipSeparators skips the newlines and commas between entries of a map or a
+// list.
+func (p *parser) skipSeparators() {
+	for k := p.tok().kind; k == tokNewline || k == tokComma; k = p.tok().kind {
+		p.i++
 	}
-	epType := parts[1]
+}
 
-	p.skipWhitespace()
-	body, err := p.readBracedBlock()
-	if err != nil {
-		return runtime.Entrypoint{}, 0, err
-	}
+// posAt returns the position of a source offset.
+func (p *parser) posAt(offset int) Pos {
+	line := sort.Search(len(p.lines), func(i int) bool { return p.lines[i] > offset })
+	return Pos{File: p.file, Offset: offset, Line: line, Column: offset - p.lines[line-1] + 1}
+}
 
-	config, err := parseSimpleMap(body)
-	if err != nil {
-		return runtime.Entrypoint{}, 0, fmt.Errorf("parsing entrypoint config: %w", err)
-	}
+// errorf reports a syntax error and abandons the current declaration.
+func (p *parser) errorf(pos Pos, format string, args ...any) {
+	p.diags.add(pos, format, args...)
+	panic(bailout{})
+}
 
-	// Extract flow-level timeout from entrypoint config.
-	timeout := 0
-	if v, ok := config["timeout"]; ok {
-		timeout = toInt(v)
-		delete(config, "timeout")
+// declStart reports whether token i starts a declaration even inside an
+// unclosed block: a top-level keyword in the first column, followed by what a
+// declaration continues with rather than by an operator or a colon. return
+// also ends Risor functions, so it does not count.
+func (p *parser) declStart(i int) bool {
+	t := p.toks[i]
+	if t.kind != tokWord || !topLevelKeywords[t.text] || t.text == "return" || t.pos.Column != 1 {
+		return false
 	}
-
-	return runtime.Entrypoint{
-		Type:   epType,
-		Config: config,
-	}, timeout, nil
+	if i > 0 && p.toks[i-1].kind != tokNewline {
+		return false
+	}
+	switch p.toks[i+1].kind {
+	case tokWord, tokString, tokLBrace, tokDot, tokNewline:
+		return true
+	}
+	return false
 }
 
-// parseProperties parses: properties { key: value, ... }
-func (p *parser) parseProperties() (map[string]any, error) {
-	p.readWord() // consume "properties"
-	p.skipWhitespace()
-
-	body, err := p.readBracedBlock()
-	if err != nil {
-		return nil, err
+// sync skips to the next top-level keyword that starts a line outside any
+// block, past the declaration starting at token start.
+func (p *parser) sync(start int) {
+	p.i = max(p.i, start+1)
+	for t := p.tok(); t.kind != tokEOF; t = p.tok() {
+		if t.kind == tokWord && topLevelKeywords[t.text] && p.depth[p.i] == 0 && p.toks[p.i-1].kind == tokNewline {
+			return
+		}
+		p.i++
 	}
+}
 
-	props, err := parseSimpleMap(body)
-	if err != nil {
-		return nil, fmt.Errorf("parsing properties: %w", err)
+func (p *parser) parseDecl() (decl Decl) {
+	start := p.i
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			p.sync(start)
+			decl = nil
+		}
+	}()
+
+	t := p.tok()
+	if t.kind != tokWord || !topLevelKeywords[t.text] {
+		p.errorf(t.pos, "unexpected %s, expected import, entrypoint, properties, step, parallel, template, use, on_error or return", t.describe())
+	}
+	switch t.text {
+	case "import":
+		return p.parseImport()
+	case "entrypoint":
+		p.next()
+		if dot := p.tok(); dot.kind != tokDot {
+			p.errorf(dot.pos, "expected entrypoint.TYPE, got %s", dot.describe())
+		}
+		p.next()
+		d := &EntrypointDecl{Keyword: t.pos, Type: p.parseIdent("entrypoint type")}
+		p.skipNewlines()
+		d.Config = p.parseMap(tokLBrace, tokRBrace)
+		return d
+	case "properties":
+		p.next()
+		p.skipNewlines()
+		return &PropertiesDecl{Keyword: t.pos, Values: p.parseMap(tokLBrace, tokRBrace)}
+	case "step":
+		return p.parseStep()
+	case "parallel":
+		return p.parseParallel()
+	case "template":
+		return p.parseTemplate()
+	case "use":
+		return p.parseUse()
+	case "on_error":
+		p.next()
+		p.skipNewlines()
+		return &OnErrorDecl{Keyword: t.pos, Body: p.parseBlock("on_error")}
+	default: // return
+		return p.parseReturn()
 	}
+}
 
-	// Resolve env() calls in property values
-	for k, v := range props {
-		if s, ok := v.(string); ok {
-			props[k] = resolveEnvCall(s)
-		}
+// parseImport parses: import "lib/payments.risor" as payments
+func (p *parser) parseImport() *ImportDecl {
+	d := &ImportDecl{Keyword: p.next().pos}
+	t := p.tok()
+	if t.kind != tokString {
+		p.errorf(t.pos, "expected the quoted path of the imported file, got %s", t.describe())
+	}
+	p.next()
+	d.Path = &String{ValuePos: t.pos, Raw: t.text, Value: unquote(t.text)}
+	if as := p.tok(); as.kind != tokWord || as.text != "as" {
+		p.errorf(as.pos, "expected 'as NAME' after the import path, got %s", as.describe())
 	}
+	p.next()
+	d.Name = p.parseIdent("import name")
+	if !isIdentifier(d.Name.Name) {
+		p.errorf(d.Name.NamePos, "import name must be an identifier, got %q", d.Name.Name)
+	}
+	return d
+}
 
-	return props, nil
+func (p *parser) parseIdent(what string) *Ident {
+	t := p.tok()
+	if t.kind != tokWord {
+		p.errorf(t.pos, "expected %s, got %s", what, t.describe())
+	}
+	p.next()
+	return &Ident{NamePos: t.pos, Name: t.text}
 }
 
 // parseStep parses:
 //
 //	step NAME(condition: ..., timeout: N, retry: {...}) { body }
 //	  fallback { body }    // optional
-//	  compensate { body }  // optional
-func (p *parser) parseStep() (runtime.Step, error) {
-	p.readWord() // consume "step"
-	p.skipWhitespace()
-
-	// Read step name
-	name := p.readStepName()
-	if name == "" {
-		return runtime.Step{}, fmt.Errorf("expected step name")
-	}
-
-	var step runtime.Step
-	step.ID = name
-
-	p.skipWhitespace()
-
-	// Optional parenthesized options: (condition: ..., timeout: N, retry: {...})
-	if p.pos < len(p.source) && p.source[p.pos] == '(' {
-		opts, err := p.readParenBlock()
-		if err != nil {
-			return step, fmt.Errorf("parsing step options: %w", err)
-		}
-		if err := applyStepOptions(&step, opts); err != nil {
-			return step, err
-		}
-	}
-
-	p.skipWhitespace()
-
-	// Read the primary step body
-	body, err := p.readBracedBlock()
-	if err != nil {
-		return step, fmt.Errorf("parsing step body: %w", err)
+//	  compensate(retry: {...}, timeout: N) { body }  // optional, options too
+//	  catch(code: "X", type: "transient") { body }   // optional, repeatable
+//
+// The suffix blocks may come in any order.
+func (p *parser) parseStep() *StepDecl {
+	s := &StepDecl{Keyword: p.next().pos, Name: p.parseIdent("step name")}
+	name := s.Name.Name
+	if p.tok().kind == tokLParen {
+		s.Options = p.parseMap(tokLParen, tokRParen)
 	}
-	step.Body = body
+	p.skipNewlines()
+	s.Body = p.parseBlock("step " + name)
 
-	// Optionally read suffix blocks: fallback {} and compensate {} in any order.
-	for i := 0; i < 2; i++ {
-		p.skipWhitespaceAndComments()
-		kw := p.peekKeyword()
-		if kw == "fallback" {
-			p.readWord() // consume "fallback"
-			p.skipWhitespace()
-			fb, err := p.readBracedBlock()
-			if err != nil {
-				return step, fmt.Errorf("parsing fallback body for step %s: %w", name, err)
+	for {
+		save := p.i
+		p.skipNewlines()
+		t := p.tok()
+		if t.kind != tokWord {
+			p.i = save
+			return s
+		}
+		switch t.text {
+		case "fallback":
+			c := p.parseClause(false)
+			if s.Fallback != nil {
+				p.diags.add(c.Keyword, "step %s: duplicate fallback block", name)
+				continue
 			}
-			step.FallbackBody = fb
-		} else if kw == "compensate" {
-			p.readWord() // consume "compensate"
-			p.skipWhitespace()
-			cb, err := p.readBracedBlock()
-			if err != nil {
-				return step, fmt.Errorf("parsing compensate body for step %s: %w", name, err)
+			s.Fallback = c
+		case "compensate":
+			c := p.parseClause(true)
+			if s.Compensate != nil {
+				p.diags.add(c.Keyword, "step %s: duplicate compensate block", name)
+				continue
 			}
-			step.CompensateBody = cb
-		} else {
-			break
+			s.Compensate = c
+		case "catch":
+			s.Catches = append(s.Catches, p.parseClause(true))
+		default:
+			p.i = save
+			return s
 		}
 	}
-
-	return step, nil
 }
 
-// parseOnError parses: on_error { risor code }
-func (p *parser) parseOnError() (string, error) {
-	p.readWord() // consume "on_error"
-	p.skipWhitespace()
-	body, err := p.readBracedBlock()
-	if err != nil {
-		return "", err
+func (p *parser) parseClause(options bool) *Clause {
+	t := p.next()
+	c := &Clause{Keyword: t.pos, Name: t.text}
+	if options && p.tok().kind == tokLParen {
+		c.Options = p.parseMap(tokLParen, tokRParen)
 	}
-	return body, nil
+	p.skipNewlines()
+	c.Body = p.parseBlock(t.text)
+	return c
 }
 
-// parseReturn parses: return <expression>
-// Everything after "return " until end of meaningful content is the return body.
-func (p *parser) parseReturn() (runtime.Return, error) {
-	p.readWord() // consume "return"
-	p.skipWhitespace()
-
-	// Read the rest as the return expression (until next top-level keyword or EOF)
-	start := p.pos
-	// The return body could be a function call like response.json({...})
-	// We need to handle nested braces in the expression
-	depth := 0
-	inString := false
-	stringChar := byte(0)
-
-	for p.pos < len(p.source) {
-		ch := p.source[p.pos]
-
-		if inString {
-			if ch == '\\' {
-				p.pos++ // skip escape
-			} else if ch == stringChar {
-				inString = false
-			}
-			p.pos++
-			continue
+// parseParallel parses:
+//
+//	parallel NAME(mode: fail_fast|collect_all, condition: ..., timeout: N) {
+//	  step a { body }
+//	  step b(retry: {...}) { body } fallback { body }
+//	}
+func (p *parser) parseParallel() *ParallelDecl {
+	d := &ParallelDecl{Keyword: p.next().pos, Name: p.parseIdent("parallel group name")}
+	if p.tok().kind == tokLParen {
+		d.Options = p.parseMap(tokLParen, tokRParen)
+	}
+	p.skipNewlines()
+	lbrace := p.tok()
+	if lbrace.kind != tokLBrace {
+		p.errorf(lbrace.pos, "expected '{' to open parallel %s, got %s", d.Name.Name, lbrace.describe())
+	}
+	p.next()
+	for {
+		p.skipNewlines()
+		t := p.tok()
+		switch {
+		case t.kind == tokRBrace:
+			p.next()
+			return d
+		case t.kind == tokEOF:
+			p.errorf(lbrace.pos, "unclosed '{': parallel %s has no matching '}'", d.Name.Name)
+		case t.kind != tokWord || t.text != "step":
+			p.errorf(t.pos, "parallel %s: only steps are allowed inside a parallel group, got %s", d.Name.Name, t.describe())
 		}
+		d.Steps = append(d.Steps, p.parseStep())
+	}
+}
 
-		if ch == '"' || ch == '\'' || ch == '`' {
-			inString = true
-			stringChar = ch
-			p.pos++
-			continue
+// parseTemplate parses:
+//
+//	template NAME(param, ...) {
+//	  step a { body }
+//	  parallel p { step b { body } }
+//	}
+func (p *parser) parseTemplate() *TemplateDecl {
+	d := &TemplateDecl{Keyword: p.next().pos, Name: p.parseIdent("template name")}
+	lparen := p.tok()
+	if lparen.kind != tokLParen {
+		p.errorf(lparen.pos, "expected '(' after template %s, got %s", d.Name.Name, lparen.describe())
+	}
+	p.next()
+	for {
+		p.skipSeparators()
+		if t := p.tok(); t.kind == tokRParen {
+			p.next()
+			break
+		} else if t.kind == tokEOF {
+			p.errorf(lparen.pos, "unclosed '(' in template %s", d.Name.Name)
 		}
-
-		if ch == '(' || ch == '{' || ch == '[' {
-			depth++
-		} else if ch == ')' || ch == '}' || ch == ']' {
-			depth--
-			if depth < 0 {
-				break
-			}
-		} else if depth == 0 && ch == '\n' {
-			// Check if next non-whitespace is a top-level keyword
-			saved := p.pos
-			p.pos++
-			p.skipWhitespace()
-			if p.pos >= len(p.source) {
-				break
-			}
-			next := p.peekKeyword()
-			if next == "step" || next == "return" || next == "properties" || next == "on_error" || strings.HasPrefix(next, "entrypoint") {
-				p.pos = saved
-				break
-			}
-			continue
+		param := p.parseIdent("template parameter")
+		if !isIdentifier(param.Name) {
+			p.errorf(param.NamePos, "template %s: parameter must be an identifier, got %q", d.Name.Name, param.Name)
+		}
+		d.Params = append(d.Params, param)
+		if t := p.tok(); t.kind != tokComma && t.kind != tokNewline && t.kind != tokRParen {
+			p.errorf(t.pos, "expected ',' or ')' after parameter %s, got %s", param.Name, t.describe())
 		}
-
-		p.pos++
 	}
-
-	body := strings.TrimSpace(p.source[start:p.pos])
-	return runtime.Return{Body: body}, nil
-}
-
-// readBracedBlock reads content between { and }, handling nested braces and strings.
-func (p *parser) readBracedBlock() (string, error) {
-	if p.pos >= len(p.source) || p.source[p.pos] != '{' {
-		return "", fmt.Errorf("expected '{' at position %d", p.pos)
+	p.skipNewlines()
+	lbrace := p.tok()
+	if lbrace.kind != tokLBrace {
+		p.errorf(lbrace.pos, "expected '{' to open template %s, got %s", d.Name.Name, lbrace.describe())
 	}
-	p.pos++ // skip opening {
-
-	start := p.pos
-	depth := 1
-	inString := false
-	stringChar := byte(0)
-
-	for p.pos < len(p.source) && depth > 0 {
-		ch := p.source[p.pos]
-
-		if inString {
-			if ch == '\\' {
-				p.pos++ // skip escape
-			} else if ch == stringChar {
-				inString = false
-			}
-			p.pos++
-			continue
-		}
-
-		switch ch {
-		case '"', '\'', '`':
-			inString = true
-			stringChar = ch
-		case '{':
-			depth++
-		case '}':
-			depth--
-			if depth == 0 {
-				body := p.source[start:p.pos]
-				p.pos++ // skip closing }
-				return strings.TrimSpace(body), nil
-			}
-		case '/':
-			// Handle // line comments
-			if p.pos+1 < len(p.source) && p.source[p.pos+1] == '/' {
-				for p.pos < len(p.source) && p.source[p.pos] != '\n' {
-					p.pos++
-				}
-				continue
-			}
+	p.next()
+	for {
+		p.skipNewlines()
+		t := p.tok()
+		switch {
+		case t.kind == tokRBrace:
+			p.next()
+			return d
+		case t.kind == tokEOF:
+			p.errorf(lbrace.pos, "unclosed '{': template %s has no matching '}'", d.Name.Name)
+		case t.kind == tokWord && t.text == "step":
+			d.Steps = append(d.Steps, p.parseStep())
+		case t.kind == tokWord && t.text == "parallel":
+			d.Steps = append(d.Steps, p.parseParallel())
+		default:
+			p.errorf(t.pos, "template %s: only steps and parallel groups are allowed inside a template, got %s", d.Name.Name, t.describe())
 		}
-
-		p.pos++
 	}
-
-	return "", fmt.Errorf("unclosed brace block starting at position %d", start)
 }
 
-// readParenBlock reads content between ( and ).
-func (p *parser) readParenBlock() (string, error) {
-	if p.pos >= len(p.source) || p.source[p.pos] != '(' {
-		return "", fmt.Errorf("expected '(' at position %d", p.pos)
+// parseUse parses: use NAME(param: value, ...) as PREFIX
+// NAME may be qualified by an import, as in lookups.fetch_or_404, and the
+// prefix is optional.
+func (p *parser) parseUse() *UseDecl {
+	d := &UseDecl{Keyword: p.next().pos, Template: p.parseIdent("template name")}
+	if p.tok().kind == tokDot {
+		p.next()
+		d.Import, d.Template = d.Template, p.parseIdent("template name")
 	}
-	p.pos++ // skip opening (
-
-	start := p.pos
-	depth := 1
-	inString := false
-	stringChar := byte(0)
-
-	for p.pos < len(p.source) && depth > 0 {
-		ch := p.source[p.pos]
-
-		if inString {
-			if ch == '\\' {
-				p.pos++
-			} else if ch == stringChar {
-				inString = false
-			}
-			p.pos++
-			continue
+	d.Args = p.parseMap(tokLParen, tokRParen)
+	if t := p.tok(); t.kind == tokWord && t.text == "as" {
+		p.next()
+		d.As = p.parseIdent("step prefix")
+		if !isIdentifier(d.As.Name) {
+			p.errorf(d.As.NamePos, "use %s: prefix must be an identifier, got %q", d.Name(), d.As.Name)
 		}
+	}
+	return d
+}
 
-		switch ch {
-		case '"', '\'', '`':
-			inString = true
-			stringChar = ch
-		case '(':
+// parseReturn parses: return <expression>
+// The expression runs until a line starting with a top-level keyword, an
+// unmatched closing delimiter or the end of the file.
+func (p *parser) parseReturn() *ReturnDecl {
+	kw := p.next()
+	p.skipNewlines()
+	start, depth := p.i, 0
+loop:
+	for t := p.tok(); t.kind != tokEOF; t = p.tok() {
+		switch t.kind {
+		case tokLBrace, tokLParen, tokLBrack:
 			depth++
-		case ')':
-			depth--
+		case tokRBrace, tokRParen, tokRBrack:
 			if depth == 0 {
-				body := p.source[start:p.pos]
-				p.pos++ // skip closing )
-				return strings.TrimSpace(body), nil
+				break loop
+			}
+			depth--
+		case tokNewline:
+			j := p.i
+			for p.toks[j].kind == tokNewline {
+				j++
+			}
+			if next := p.toks[j]; next.kind == tokEOF || (depth == 0 && next.kind == tokWord && topLevelKeywords[next.text]) || p.declStart(j) {
+				break loop
 			}
 		}
-
-		p.pos++
+		p.next()
 	}
-
-	return "", fmt.Errorf("unclosed paren block starting at position %d", start)
-}
-
-func (p *parser) readStepName() string {
-	start := p.pos
-	for p.pos < len(p.source) && (isWordChar(p.source[p.pos]) || p.source[p.pos] == '_') {
-		p.pos++
+	end := p.i
+	for end > start && p.toks[end-1].kind == tokNewline {
+		end--
 	}
-	return p.source[start:p.pos]
-}
-
-func (p *parser) skipWhitespace() {
-	for p.pos < len(p.source) && (p.source[p.pos] == ' ' || p.source[p.pos] == '\t' || p.source[p.pos] == '\n' || p.source[p.pos] == '\r') {
-		p.pos++
+	if end == start {
+		p.errorf(kw.pos, "return requires an expression")
 	}
+	first := p.toks[start]
+	return &ReturnDecl{Keyword: kw.pos, Value: &Expr{ValuePos: first.pos, Code: p.src[first.pos.Offset:p.toks[end-1].end]}}
 }
 
-func (p *parser) skipWhitespaceAndComments() {
-	for {
-		p.skipWhitespace()
-		if p.pos+1 < len(p.source) && p.source[p.pos] == '/' && p.source[p.pos+1] == '/' {
-			// Skip line comment
-			for p.pos < len(p.source) && p.source[p.pos] != '\n' {
-				p.pos++
+// parseBlock reads a brace-delimited block of Risor code. Braces inside
+// strings and comments do not count.
+func (p *parser) parseBlock(what string) *Block {
+	lbrace := p.tok()
+	if lbrace.kind != tokLBrace {
+		p.errorf(lbrace.pos, "expected '{' to open the %s body, got %s", what, lbrace.describe())
+	}
+	p.next()
+	for depth := 1; ; {
+		t := p.tok()
+		if t.kind == tokEOF || p.declStart(p.i) {
+			p.errorf(lbrace.pos, "unclosed '{': the %s body has no matching '}'", what)
+		}
+		switch t.kind {
+		case tokLBrace:
+			depth++
+		case tokRBrace:
+			if depth--; depth == 0 {
+				p.next()
+				raw := p.src[lbrace.end:t.pos.Offset]
+				code := strings.TrimSpace(raw)
+				lead := len(raw) - len(strings.TrimLeft(raw, " \t\r\n"))
+				return &Block{Lbrace: lbrace.pos, Rbrace: t.pos, Code: code, CodePos: p.posAt(lbrace.end + lead)}
 			}
-			continue
 		}
-		break
+		p.next()
 	}
 }
 
-func isWordChar(ch byte) bool {
-	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || ch == '_'
-}
-
-// parseSimpleMap parses a simple key: value map from block contents.
-// Supports string values (quoted and unquoted), arrays [...], and nested maps {...}.
-func parseSimpleMap(block string) (map[string]any, error) {
-	result := make(map[string]any)
-	block = strings.TrimSpace(block)
-	if block == "" {
-		return result, nil
+// parseMap parses key: value entries between open and close. Entries are
+// separated by commas or newlines.
+func (p *parser) parseMap(open, close tokenKind) *MapLit {
+	lbrace := p.tok()
+	if lbrace.kind != open {
+		p.errorf(lbrace.pos, "expected %s, got %s", open, lbrace.describe())
 	}
-
-	i := 0
-	for i < len(block) {
-		// Skip whitespace and commas
-		for i < len(block) && (block[i] == ' ' || block[i] == '\t' || block[i] == '\n' || block[i] == '\r' || block[i] == ',') {
-			i++
-		}
-		if i >= len(block) {
-			break
-		}
-
-		// Skip comments
-		if i+1 < len(block) && block[i] == '/' && block[i+1] == '/' {
-			for i < len(block) && block[i] != '\n' {
-				i++
-			}
-			continue
-		}
-
-		// Read key
-		keyStart := i
-		for i < len(block) && block[i] != ':' && block[i] != ' ' && block[i] != '\n' {
-			i++
-		}
-		key := strings.TrimSpace(block[keyStart:i])
-		if key == "" {
-			break
-		}
-
-		// Skip to colon
-		for i < len(block) && block[i] != ':' {
-			i++
+	p.next()
+	m := &MapLit{Lbrace: lbrace.pos}
+	for {
+		p.skipSeparators()
+		t := p.tok()
+		switch t.kind {
+		case close:
+			p.next()
+			m.Rbrace = t.pos
+			return m
 		}
-		if i >= len(block) {
-			return nil, fmt.Errorf("expected ':' after key %q", key)
+		if t.kind == tokEOF || p.declStart(p.i) {
+			p.errorf(lbrace.pos, "unclosed %s", open)
 		}
-		i++ // skip colon
 
-		// Skip whitespace
-		for i < len(block) && (block[i] == ' ' || block[i] == '\t') {
-			i++
+		key := p.parseKey()
+		if m.Lookup(key.Name) != nil {
+			p.diags.add(key.NamePos, "duplicate key %q", key.Name)
 		}
+		m.Entries = append(m.Entries, &Entry{Key: key, Value: p.parseValue(key.Name, close)})
 
-		// Read value
-		value, newPos, err := readValue(block, i)
-		if err != nil {
-			return nil, fmt.Errorf("reading value for key %q: %w", key, err)
+		if t := p.tok(); t.kind != tokComma && t.kind != tokNewline && t.kind != close {
+			p.errorf(t.pos, "expected ',' or %s after the value of %s, got %s", close, key.Name, t.describe())
 		}
-		i = newPos
-
-		result[key] = value
 	}
-
-	return result, nil
 }
 
-// readValue reads a value starting at position i in the block string.
-// Returns the parsed value and the new position after the value.
-func readValue(block string, i int) (any, int, error) {
-	if i >= len(block) {
-		return "", i, nil
-	}
-
-	ch := block[i]
-
-	// Quoted string
-	if ch == '"' || ch == '\'' {
-		return readQuotedString(block, i)
-	}
-
-	// Array
-	if ch == '[' {
-		return readArray(block, i)
-	}
-
-	// Nested map
-	if ch == '{' {
-		return readNestedMap(block, i)
-	}
-
-	// Unquoted value — read until comma, newline, or closing delimiter
-	start := i
-	squareDepth := 0
-	parenDepth := 0
-	curlyDepth := 0
-	inString := false
-	stringChar := byte(0)
-
-	for i < len(block) {
-		c := block[i]
-
-		if inString {
-			if c == '\\' {
-				i++
-			} else if c == stringChar {
-				inString = false
-			}
-			i++
-			continue
-		}
-
-		switch c {
-		case '"', '\'', '`':
-			inString = true
-			stringChar = c
-		case '[':
-			squareDepth++
-		case ']':
-			if squareDepth > 0 {
-				squareDepth--
-			} else if parenDepth == 0 && curlyDepth == 0 {
-				// End of parent container (array) at top-level.
-				return strings.TrimSpace(block[start:i]), i, nil
-			}
-		case '(':
-			parenDepth++
-		case ')':
-			if parenDepth > 0 {
-				parenDepth--
-			}
-		case '{':
-			curlyDepth++
-		case '}':
-			if curlyDepth > 0 {
-				curlyDepth--
-			} else if squareDepth == 0 && parenDepth == 0 {
-				// End of parent container (map) at top-level.
-				return strings.TrimSpace(block[start:i]), i, nil
-			}
-		case ',', '\n':
-			if squareDepth == 0 && parenDepth == 0 && curlyDepth == 0 {
-				return strings.TrimSpace(block[start:i]), i, nil
+// parseKey reads a map key and its colon. Keys are quoted strings or the
+// source text up to the colon, so Content-Type works unquoted.
+func (p *parser) parseKey() *Ident {
+	first := p.tok()
+	key := &Ident{NamePos: first.pos}
+	if first.kind == tokString {
+		p.next()
+		key.Name = unquote(first.text)
+	} else {
+		// A key is one run of characters, such as Content-Type or x.y.
+		start := p.i
+		for k := p.tok().kind; k == tokWord || k == tokOther || k == tokDot; k = p.tok().kind {
+			if p.i > start && p.toks[p.i-1].end != p.tok().pos.Offset {
+				break
 			}
+			p.next()
 		}
-
-		i++
-	}
-
-	return strings.TrimSpace(block[start:i]), i, nil
-}
-
-func readQuotedString(block string, i int) (string, int, error) {
-	quote := block[i]
-	i++ // skip opening quote
-	start := i
-	for i < len(block) {
-		if block[i] == '\\' {
-			i += 2
-			continue
-		}
-		if block[i] == quote {
-			s := block[start:i]
-			i++ // skip closing quote
-			return s, i, nil
+		if p.i == start {
+			p.errorf(first.pos, "expected a key, got %s", first.describe())
 		}
-		i++
+		key.Name = p.src[first.pos.Offset:p.toks[p.i-1].end]
 	}
-	return "", i, fmt.Errorf("unclosed string starting at position %d", start-1)
-}
-
-func readArray(block string, i int) ([]any, int, error) {
-	i++ // skip [
-	var items []any
-	for i < len(block) {
-		// Skip whitespace and commas
-		for i < len(block) && (block[i] == ' ' || block[i] == '\t' || block[i] == '\n' || block[i] == '\r' || block[i] == ',') {
-			i++
-		}
-		if i >= len(block) || block[i] == ']' {
-			i++ // skip ]
-			return items, i, nil
-		}
-
-		val, newPos, err := readValue(block, i)
-		if err != nil {
-			return nil, newPos, err
-		}
-		items = append(items, val)
-		i = newPos
+	if t := p.tok(); t.kind != tokColon {
+		p.errorf(t.pos, "expected ':' after key %q, got %s", key.Name, t.describe())
 	}
-	return nil, i, fmt.Errorf("unclosed array")
+	p.next()
+	return key
 }
 
-func readNestedMap(block string, i int) (map[string]any, int, error) {
-	// Find matching closing brace
-	start := i
-	i++ // skip {
-	depth := 1
-	inStr := false
-	strChar := byte(0)
-
-	for i < len(block) && depth > 0 {
-		ch := block[i]
-		if inStr {
-			if ch == '\\' {
-				i++
-			} else if ch == strChar {
-				inStr = false
+// parseValue reads a map, a list, a lone quoted string, or else the source
+// text of an expression up to the next comma, newline, unmatched closing
+// delimiter or, after whitespace, the next key. A key there means a comma is
+// missing, which the caller reports.
+func (p *parser) parseValue(key string, close tokenKind) Value {
+	t := p.tok()
+	switch t.kind {
+	case tokLBrace:
+		return p.parseMap(tokLBrace, tokRBrace)
+	case tokLBrack:
+		return p.parseList(key)
+	case tokString:
+		if k := p.toks[p.i+1].kind; k == tokComma || k == tokNewline || k == close || k == tokEOF {
+			p.next()
+			return &String{ValuePos: t.pos, Raw: t.text, Value: unquote(t.text)}
+		}
+	}
+
+	start, depth := p.i, 0
+loop:
+	for t := p.tok(); t.kind != tokEOF && !p.declStart(p.i); t = p.tok() {
+		switch t.kind {
+		case tokComma, tokNewline:
+			if depth == 0 {
+				break loop
 			}
-			i++
-			continue
-		}
-		switch ch {
-		case '"', '\'':
-			inStr = true
-			strChar = ch
-		case '{':
+		case tokLBrace, tokLParen, tokLBrack:
 			depth++
-		case '}':
+		case tokRBrace, tokRParen, tokRBrack:
+			if depth == 0 {
+				break loop
+			}
 			depth--
+		case tokWord, tokString:
+			if depth == 0 && p.i > start && p.toks[p.i-1].end != t.pos.Offset && p.keyAt(p.i) {
+				break loop
+			}
 		}
-		i++
+		p.next()
 	}
-
-	inner := block[start+1 : i-1]
-	m, err := parseSimpleMap(inner)
-	if err != nil {
-		return nil, i, err
+	if p.i == start {
+		p.errorf(t.pos, "missing value for %s", key)
 	}
-	return m, i, nil
+	return &Expr{ValuePos: t.pos, Code: p.src[t.pos.Offset:p.toks[p.i-1].end]}
 }
 
-// resolveEnvCall resolves env("VAR") or env("VAR", "default") patterns in property values.
-func resolveEnvCall(s string) string {
-	s = strings.TrimSpace(s)
-	if !strings.HasPrefix(s, "env(") || !strings.HasSuffix(s, ")") {
-		return s
+// keyAt reports whether a map key and its colon start at token i.
+func (p *parser) keyAt(i int) bool {
+	if p.toks[i].kind == tokString {
+		return p.toks[i+1].kind == tokColon
 	}
-	// Convert env("VAR") to ${VAR} and env("VAR", "default") to ${VAR:default}
-	inner := strings.TrimPrefix(s, "env(")
-	inner = strings.TrimSuffix(inner, ")")
-	inner = strings.TrimSpace(inner)
-
-	parts := strings.SplitN(inner, ",", 2)
-	varName := strings.Trim(strings.TrimSpace(parts[0]), `"'`)
-
-	if len(parts) == 2 {
-		defaultVal := strings.Trim(strings.TrimSpace(parts[1]), `"'`)
-		return fmt.Sprintf("${%s:%s}", varName, defaultVal)
+	for j := i + 1; ; j++ {
+		switch k := p.toks[j].kind; {
+		case k == tokColon:
+			return p.toks[j-1].end == p.toks[j].pos.Offset
+		case (k == tokWord || k == tokOther || k == tokDot) && p.toks[j-1].end == p.toks[j].pos.Offset:
+		default:
+			return false
+		}
 	}
-
-	return fmt.Sprintf("${%s}", varName)
 }
 
-// applyStepOptions parses the parenthesized options string and applies to step.
-// Supports fields: max_attempts, delay, backoff, max_delay, jitter, when, non_retryable, timeout.
-func applyStepOptions(step *runtime.Step, opts string) error {
-	m, err := parseSimpleMap(opts)
-	if err != nil {
-		return fmt.Errorf("parsing step options: %w", err)
-	}
-
-	if cond, ok := m["condition"]; ok {
-		step.Condition = fmt.Sprintf("%v", cond)
-	}
-
-	if t, ok := m["timeout"]; ok {
-		step.Timeout = toInt(t)
-	}
-
-	if retryRaw, ok := m["retry"]; ok {
-		retryMap, ok := retryRaw.(map[string]any)
-		if !ok {
-			return fmt.Errorf("retry must be a map")
-		}
-		// Legacy aliases removed intentionally.
-		if _, ok := retryMap["maxRetries"]; ok {
-			return fmt.Errorf("unsupported retry field: maxRetries (use max_attempts)")
-		}
-		if _, ok := retryMap["condition"]; ok {
-			return fmt.Errorf("unsupported retry field: condition (use when)")
-		}
-		step.Retry = &runtime.RetryConfig{}
-
-		if v, ok := retryMap["max_attempts"]; ok {
-			step.Retry.MaxAttempts = toInt(v)
-		}
-		if v, ok := retryMap["max_delay"]; ok {
-			step.Retry.MaxDelay = toInt(v)
-		}
-		if v, ok := retryMap["jitter"]; ok {
-			step.Retry.Jitter = toBool(v)
-		}
-		if v, ok := retryMap["when"]; ok {
-			step.Retry.When = fmt.Sprintf("%v", v)
-		}
-		if v, ok := retryMap["non_retryable"]; ok {
-			if arr, ok := v.([]any); ok {
-				for _, item := range arr {
-					step.Retry.NonRetryable = append(step.Retry.NonRetryable, fmt.Sprintf("%v", item))
-				}
-			}
+func (p *parser) parseList(key string) *ListLit {
+	lbrack := p.next()
+	l := &ListLit{Lbrack: lbrack.pos}
+	for {
+		p.skipSeparators()
+		t := p.tok()
+		switch t.kind {
+		case tokRBrack:
+			p.next()
+			l.Rbrack = t.pos
+			return l
 		}
-		if v, ok := retryMap["backoff"]; ok {
-			s, ok := v.(string)
-			if !ok {
-				return fmt.Errorf("retry.backoff must be a string: none | linear | exponential")
-			}
-			switch s {
-			case "none", "linear", "exponential":
-				step.Retry.Backoff = s
-			default:
-				return fmt.Errorf("invalid retry.backoff value: %q (allowed: none, linear, exponential)", s)
-			}
+		if t.kind == tokEOF || p.declStart(p.i) {
+			p.errorf(lbrack.pos, "unclosed '[' in the value of %s", key)
 		}
-
-		if v, ok := retryMap["delay"]; ok {
-			step.Retry.Delay = toInt(v)
+		l.Items = append(l.Items, p.parseValue(key, tokRBrack))
+		if t := p.tok(); t.kind != tokComma && t.kind != tokNewline && t.kind != tokRBrack {
+			p.errorf(t.pos, "expected ',' or ']' in the value of %s, got %s", key, t.describe())
 		}
 	}
-
-	return nil
-}
-
-func toInt(v any) int {
-	switch n := v.(type) {
-	case int:
-		return n
-	case int64:
-		return int(n)
-	case float64:
-		return int(n)
-	case string:
-		var i int
-		fmt.Sscanf(n, "%d", &i)
-		return i
-	default:
-		return 0
-	}
 }
 
-func toBool(v any) bool {
-	switch b := v.(type) {
-	case bool:
-		return b
-	case string:
-		return b == "true"
-	default:
-		return false
+// unquote returns the value of a string token. Backtick strings are raw; the
+// others honor the usual backslash escapes.
+func unquote(text string) string {
+	quote := text[0]
+	body := text[1:]
+	if strings.HasSuffix(body, string(quote)) {
+		body = body[:len(body)-1]
+	}
+	if quote == '`' || !strings.Contains(body, `\`) {
+		return body
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i+1 == len(body) {
+			b.WriteByte(body[i])
+			continue
+		}
+		i++
+		switch body[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\', '"', '\'', '`':
+			b.WriteByte(body[i])
+		default:
+			b.WriteByte('\\')
+			b.WriteByte(body[i])
+		}
 	}
+	return b.String()
 }
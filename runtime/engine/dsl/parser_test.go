@@ -1,6 +1,8 @@
 package dsl
 
 import (
+	"errors"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -376,6 +378,29 @@ func TestParseEntrypointTimeout(t *testing.T) {
 	}
 }
 
+func TestParseEntrypointRecovery(t *testing.T) {
+	source := `entrypoint.http {
+	method: POST
+	path: /api/payments
+	recovery: compensate
+}`
+	flow, err := Parse(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flow.Recovery != "compensate" {
+		t.Errorf("flow recovery = %q, want compensate", flow.Recovery)
+	}
+	if _, ok := flow.Entrypoint.Config["recovery"]; ok {
+		t.Error("recovery should be removed from entrypoint config")
+	}
+
+	_, err = Parse("entrypoint.http {\n\tpath: /x\n\trecovery: retry\n}")
+	if err == nil || !strings.Contains(err.Error(), "invalid recovery") {
+		t.Fatalf("expected invalid recovery error, got %v", err)
+	}
+}
+
 func TestParseStepTimeout(t *testing.T) {
 	source := `step call_api(timeout: 2000) {
 	http.request({url: "https://api.example.com"})
@@ -479,6 +504,157 @@ fallback {
 	}
 }
 
+func TestParseCompensateOptions(t *testing.T) {
+	source := `step charge_card {
+	stripe.charge({amount: 100})
+}
+compensate(retry: {max_attempts: 3, delay: 200, backoff: "exponential"}, timeout: 5000) {
+	stripe.refund({charge_id: charge_card.id})
+}
+`
+	flow, err := Parse(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	step := flow.Steps[0]
+	if step.CompensateBody == "" {
+		t.Error("compensate body should not be empty")
+	}
+	if step.CompensateTimeout != 5000 {
+		t.Errorf("CompensateTimeout = %d, want 5000", step.CompensateTimeout)
+	}
+	r := step.CompensateRetry
+	if r == nil || r.MaxAttempts != 3 || r.Delay != 200 || r.Backoff != "exponential" {
+		t.Fatalf("CompensateRetry = %+v", r)
+	}
+	if step.Retry != nil {
+		t.Error("compensate retry must not set the step retry")
+	}
+
+	_, err = Parse(`step a { x() }
+compensate(condition: true) { undo() }
+`)
+	if err == nil || !strings.Contains(err.Error(), "unsupported compensate option: condition") {
+		t.Fatalf("expected unsupported option error, got %v", err)
+	}
+}
+
+func TestParseCatchBlocks(t *testing.T) {
+	flow, err := Parse(`step charge_card {
+	stripe.charge({amount: 100})
+}
+catch(code: "CARD_DECLINED") {
+	response.json({status: 402, body: {error: error.message}})
+}
+compensate {
+	stripe.refund({charge_id: charge_card.id})
+}
+catch(type: "transient", code: "RATE_LIMITED") {
+	raise(error)
+}
+catch {
+	{status: "unknown"}
+}
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	catches := flow.Steps[0].Catches
+	if len(catches) != 3 {
+		t.Fatalf("catches = %+v, want 3", catches)
+	}
+	if catches[0].Code != "CARD_DECLINED" || catches[0].Type != "" || catches[0].Body == "" {
+		t.Errorf("catch 0 = %+v", catches[0])
+	}
+	if catches[1].Code != "RATE_LIMITED" || catches[1].Type != "transient" {
+		t.Errorf("catch 1 = %+v", catches[1])
+	}
+	if catches[2].Code != "" || catches[2].Type != "" {
+		t.Errorf("catch 2 = %+v, want a catch-all", catches[2])
+	}
+	if flow.Steps[0].CompensateBody == "" {
+		t.Error("compensate body should not be empty")
+	}
+
+	for source, want := range map[string]string{
+		"step a { x() }\ncatch(type: \"fatal\") { y() }\n":            "invalid catch type",
+		"step a { x() }\ncatch(status: 500) { y() }\n":                "unsupported catch option: status",
+		"step a { x() }\ncatch { y() }\ncatch(code: \"X\") { z() }\n": "unreachable",
+		"step a { x() }\nfallback { y() }\nfallback { z() }\n":        "duplicate fallback",
+	} {
+		if _, err := Parse(source); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want %q", source, err, want)
+		}
+	}
+}
+
+func TestParseCircuitBreaker(t *testing.T) {
+	flow, err := Parse(`step charge(circuit_breaker: {name: "stripe", failure_threshold: 5, open_for: 30000, half_open_max: 2}) {
+	stripe.charge({amount: 100})
+}
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cb := flow.Steps[0].CircuitBreaker
+	if cb == nil || cb.Name != "stripe" || cb.FailureThreshold != 5 || cb.OpenFor != 30000 || cb.HalfOpenMax != 2 {
+		t.Fatalf("circuit breaker = %+v", cb)
+	}
+
+	for source, want := range map[string]string{
+		"step a(circuit_breaker: {failure_threshold: 5}) { x() }":     "requires a name",
+		"step a(circuit_breaker: {name: \"s\", open_for: 0}) { x() }": "open_for must be at least 1",
+		"step a(circuit_breaker: {name: \"s\", timeout: 10}) { x() }": "unsupported circuit_breaker field: timeout",
+	} {
+		if _, err := Parse(source); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want %q", source, err, want)
+		}
+	}
+}
+
+func TestParseConcurrencyLimits(t *testing.T) {
+	flow, err := Parse(`entrypoint.http {
+	method: POST
+	path: /orders
+	rate_limit: { rps: 100, burst: 20, key: request.headers.x_api_key }
+}
+
+step insert(concurrency: {key: "postgres", limit: 20, queue_timeout: 200}) {
+	postgres.exec({sql: "INSERT ..."})
+}
+
+step notify_all(for_each: orders, as: order, concurrency: 5) {
+	notify.send({to: order.email})
+}
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rl, ok := flow.Entrypoint.Config["rate_limit"].(map[string]any)
+	if !ok || rl["rps"] != "100" || rl["burst"] != "20" || rl["key"] != "request.headers.x_api_key" {
+		t.Fatalf("rate_limit = %#v", flow.Entrypoint.Config["rate_limit"])
+	}
+	b := flow.Steps[0].Bulkhead
+	if b == nil || b.Key != "postgres" || b.Limit != 20 || b.QueueTimeout != 200 || flow.Steps[0].ForEach != nil {
+		t.Fatalf("bulkhead = %+v", b)
+	}
+	if s := flow.Steps[1]; s.Bulkhead != nil || s.ForEach == nil || s.ForEach.Concurrency != 5 {
+		t.Fatalf("for_each concurrency step = %+v", s)
+	}
+
+	for source, want := range map[string]string{
+		`step a(concurrency: {limit: 2}) { x() }`:                               "requires a key and a limit",
+		`step a(concurrency: {key: "pg", limit: 0}) { x() }`:                    "limit must be at least 1",
+		`step a(concurrency: {key: "pg", limit: 2, queue_timeout: -1}) { x() }`: "must not be negative",
+		`step a(concurrency: {key: "pg", limit: 2, burst: 1}) { x() }`:          "unsupported concurrency field: burst",
+		`step a(concurrency: 5) { x() }`:                                        "concurrency requires for_each",
+	} {
+		if _, err := Parse(source); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want %q", source, err, want)
+		}
+	}
+}
+
 func TestParseRetryEnhanced(t *testing.T) {
 	source := `step call_api(retry: {
 	max_attempts: 5,
@@ -535,6 +711,188 @@ func TestParseRetryLegacyFieldsError(t *testing.T) {
 	}
 }
 
+func TestParseParallelGroup(t *testing.T) {
+	source := `step load { x := 1 }
+
+parallel fetch(mode: collect_all, timeout: 3000) {
+	// branches keep their own options and suffix blocks
+	step customer(retry: {max_attempts: 3}) {
+		http.request({url: "https://customers"})
+	}
+	step orders(timeout: 500) {
+		http.request({url: "https://orders"})
+	}
+	fallback {
+		[]
+	}
+}
+
+return response.json({status: 200})
+`
+	flow, err := Parse(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(flow.Steps) != 2 {
+		t.Fatalf("steps len = %d, want 2", len(flow.Steps))
+	}
+	group := flow.Steps[1]
+	if group.ID != "fetch" || group.Parallel == nil {
+		t.Fatalf("expected parallel group fetch, got %+v", group)
+	}
+	if group.Parallel.Mode != "collect_all" || group.Timeout != 3000 {
+		t.Errorf("mode = %q, timeout = %d", group.Parallel.Mode, group.Timeout)
+	}
+	branches := group.Parallel.Steps
+	if len(branches) != 2 || branches[0].ID != "customer" || branches[1].ID != "orders" {
+		t.Fatalf("unexpected branches: %+v", branches)
+	}
+	if branches[0].Retry == nil || branches[0].Retry.MaxAttempts != 3 {
+		t.Errorf("customer retry = %+v", branches[0].Retry)
+	}
+	if branches[1].Timeout != 500 || branches[1].FallbackBody == "" {
+		t.Errorf("orders timeout = %d, fallback = %q", branches[1].Timeout, branches[1].FallbackBody)
+	}
+	if flow.Return.Body == "" {
+		t.Error("return body should not be empty")
+	}
+}
+
+func TestParseParallelGroupErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"empty", `parallel fetch {}`, "expected at least one step"},
+		{"invalid mode", `parallel fetch(mode: race) { step a { 1 } }`, "invalid mode"},
+		{"retry on group", `parallel fetch(retry: {max_attempts: 2}) { step a { 1 } }`, "unsupported option"},
+		{"non-step", `parallel fetch { on_error { 1 } }`, "only steps are allowed"},
+		{"duplicate", `parallel fetch { step a { 1 } step a { 2 } }`, "duplicate step"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseTemplateUse(t *testing.T) {
+	source := `template fetch_or_404(table, id, attempts) {
+	step fetch(retry: {max_attempts: attempts}) {
+		db.get({table: table, id: id})
+	}
+	step check(condition: fetch == nil) {
+		let found = function(id) { return id != nil }
+		if (!found(fetch)) { raise({status: 404, message: sprintf("%s %s not found", table, id)}) }
+		next("done")
+	}
+	step done { fetch }
+}
+
+use fetch_or_404(table: "orders", id: request.pathVariables.id, attempts: 3) as order
+use fetch_or_404(table: "customers", id: order_fetch.customer_id, attempts: 1)
+
+step reply { {order: order_done, customer: fetch_or_404_done} }
+`
+	flow, err := Parse(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, s := range flow.Steps {
+		ids = append(ids, s.ID)
+	}
+	want := []string{"order_fetch", "order_check", "order_done", "fetch_or_404_fetch", "fetch_or_404_check", "fetch_or_404_done", "reply"}
+	if !slices.Equal(ids, want) {
+		t.Fatalf("steps = %v, want %v", ids, want)
+	}
+
+	fetch, check := flow.Steps[0], flow.Steps[1]
+	if fetch.Body != `db.get({table: ("orders"), id: (request.pathVariables.id)})` {
+		t.Errorf("fetch body = %q", fetch.Body)
+	}
+	if fetch.Retry == nil || fetch.Retry.MaxAttempts != 3 {
+		t.Errorf("fetch retry = %+v", fetch.Retry)
+	}
+	if check.Condition != "order_fetch == nil" {
+		t.Errorf("check condition = %q", check.Condition)
+	}
+	wantBody := `let found = function(id) { return id != nil }
+		if (!found(order_fetch)) { raise({status: 404, message: sprintf("%s %s not found", ("orders"), (request.pathVariables.id))}) }
+		next("order_done")`
+	if check.Body != wantBody {
+		t.Errorf("check body =\n%s\nwant\n%s", check.Body, wantBody)
+	}
+	if got := flow.Steps[3].Body; got != `db.get({table: ("customers"), id: (order_fetch.customer_id)})` {
+		t.Errorf("second use fetch body = %q", got)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"unknown template", `use missing(id: 1)`, "use missing: unknown template"},
+		{"unknown parameter", "template t(id) { step a { id } }\nuse t(id: 1, table: 2)", "use t: unknown parameter table"},
+		{"missing argument", "template t(id, table) { step a { id } }\nuse t(id: 1)", "use t: missing argument table"},
+		{"bad option argument", "template t(mode) { parallel p(mode: mode) { step a { 1 } } }\nuse t(mode: race)", "use t: parallel t_p: invalid mode"},
+		{"clashing uses", "template t(id) { step a { id } }\nuse t(id: 1)\nuse t(id: 2)", `duplicate step "t_a"`},
+		{"step named like a parameter", `template t(id) { step id { 1 } }`, `template t: step "id" has the name of a parameter`},
+		{"non-step", `template t() { on_error { 1 } }`, "only steps and parallel groups are allowed inside a template"},
+		{"empty", `template t() {}`, "template t: expected at least one step"},
+		{"module import", "import \"lib.risor\" as lib\nuse lib.t(id: 1)", "use lib.t: lib imports a Risor module, not templates"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.source)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseForEachOptions(t *testing.T) {
+	source := `step notify_all(for_each: orders.rows, as: order, concurrency: 5, max_failures: 2) {
+	notify.send({to: order.email})
+}`
+	flow, err := Parse(source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	cfg := flow.Steps[0].ForEach
+	if cfg == nil {
+		t.Fatal("expected for_each config")
+	}
+	if cfg.Items != "orders.rows" || cfg.As != "order" || cfg.Concurrency != 5 || cfg.MaxFailures != 2 {
+		t.Errorf("unexpected for_each config: %+v", cfg)
+	}
+}
+
+func TestParseForEachOptionErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{`step s(as: order) { 1 }`, "requires for_each"},
+		{`step s(for_each: items, as: "a b") { 1 }`, "must be an identifier"},
+		{`step s(for_each: items, concurrency: 0) { 1 }`, "concurrency must be at least 1"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.source); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q): expected error containing %q, got %v", tt.source, tt.want, err)
+		}
+	}
+}
+
 func TestResolveEnvCall(t *testing.T) {
 	tests := []struct {
 		input string
@@ -555,3 +913,189 @@ func TestResolveEnvCall(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDiagnostics_PointAtTheProblem(t *testing.T) {
+	source := "entrypoint.http {\n\tmethod: POST\n}\n\nstep charge(retry: {maxRetries: 3}) {\n\tstripe.charge()\n}\n"
+	_, err := parseFlow("orders.flow", source)
+	var diags Diagnostics
+	if !errors.As(err, &diags) || len(diags) != 1 {
+		t.Fatalf("error = %v, want one diagnostic", err)
+	}
+	d := diags[0]
+	if d.Pos.File != "orders.flow" || d.Pos.Line != 5 || d.Pos.Column != 21 {
+		t.Errorf("pos = %s, want orders.flow:5:21", d.Pos)
+	}
+	want := "orders.flow:5:21: step charge: unsupported retry field: maxRetries (use max_attempts)\n" +
+		"    5 | step charge(retry: {maxRetries: 3}) {\n" +
+		"      |                     ^"
+	if err.Error() != want {
+		t.Errorf("error =\n%s\nwant\n%s", err, want)
+	}
+}
+
+func TestParseDiagnostics_ReportsEveryError(t *testing.T) {
+	source := `entrypoint.http {
+	path /orders
+}
+
+step a(concurrency: {key: "pg", limit: 0}) { x() }
+
+step b { y( }
+
+step c(timeout: 100) { z() }
+catch { w() }
+catch(code: "X") { v() }
+
+step a { u() }
+`
+	flow, err := Parse(source)
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("error = %v, want Diagnostics", err)
+	}
+	wants := []struct {
+		line int
+		msg  string
+	}{
+		{2, `expected ':' after key "path"`},
+		{5, "concurrency.limit must be at least 1"},
+		{11, "unreachable"},
+		{13, `duplicate step "a"`},
+	}
+	if len(diags) != len(wants) {
+		t.Fatalf("got %d diagnostics, want %d:\n%v", len(diags), len(wants), err)
+	}
+	for i, want := range wants {
+		if diags[i].Pos.Line != want.line || !strings.Contains(diags[i].Message, want.msg) {
+			t.Errorf("diagnostic %d = %s: %s, want line %d: %q", i, diags[i].Pos, diags[i].Message, want.line, want.msg)
+		}
+	}
+	// Declarations after an error are still parsed.
+	if len(flow.Steps) != 4 || flow.Steps[2].Timeout != 100 {
+		t.Errorf("steps = %+v", flow.Steps)
+	}
+}
+
+func TestParseDiagnostics_MissingComma(t *testing.T) {
+	for source, want := range map[string]string{
+		"entrypoint.http { method: POST path: /a }":                  "1:32: expected ',' or '}' after the value of method, got 'path'",
+		"step a(timeout: 5 next: b) { x() }":                         "1:19: expected ',' or ')' after the value of timeout, got 'next'",
+		`step a(retry: {when: error.code == "X" "max_attempts": 2})`: "1:40: expected ',' or '}' after the value of when",
+	} {
+		_, err := Parse(source)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Parse(%q) error = %v, want %q", source, err, want)
+		}
+	}
+
+	// A colon inside a value does not start a key.
+	flow, err := Parse("entrypoint.http { path: https://x.io/a?b=c:d }")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := flow.Entrypoint.Config["path"]; got != "https://x.io/a?b=c:d" {
+		t.Errorf("path = %v", got)
+	}
+}
+
+func TestParseDiagnostics_RecoverAfterUnclosedDelimiter(t *testing.T) {
+	source := `step a {
+	if x {
+		y()
+}
+
+step b(timeout: 5 {
+	z()
+}
+
+step c(concurrency: {key: "pg", limit: 0}) { w() }
+
+step d(condition: ok(x) { v() }
+
+step e(timeout: 100) { u() }
+`
+	flow, err := Parse(source)
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("error = %v, want Diagnostics", err)
+	}
+	wants := []struct {
+		line int
+		msg  string
+	}{
+		{1, "unclosed '{': the step a body has no matching '}'"},
+		{6, "unclosed '('"},
+		{10, "concurrency.limit must be at least 1"},
+		{12, "unclosed '('"},
+	}
+	if len(diags) != len(wants) {
+		t.Fatalf("got %d diagnostics, want %d:\n%v", len(diags), len(wants), err)
+	}
+	for i, want := range wants {
+		if diags[i].Pos.Line != want.line || !strings.Contains(diags[i].Message, want.msg) {
+			t.Errorf("diagnostic %d = %s: %s, want line %d: %q", i, diags[i].Pos, diags[i].Message, want.line, want.msg)
+		}
+	}
+	if len(flow.Steps) != 2 || flow.Steps[1].ID != "e" || flow.Steps[1].Timeout != 100 {
+		t.Errorf("steps = %+v", flow.Steps)
+	}
+}
+
+func TestParse_DelimitersInStringOptions(t *testing.T) {
+	flow, err := Parse(`step notify(condition: event.note == "a } b, c", retry: {when: error.message == ")", max_attempts: 2}) {
+	send(` + "`{raw}`" + `)
+}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	step := flow.Steps[0]
+	if step.Condition != `event.note == "a } b, c"` {
+		t.Errorf("condition = %q", step.Condition)
+	}
+	if step.Retry == nil || step.Retry.When != `error.message == ")"` || step.Retry.MaxAttempts != 2 {
+		t.Errorf("retry = %+v", step.Retry)
+	}
+	if step.Body != "send(`{raw}`)" {
+		t.Errorf("body = %q", step.Body)
+	}
+}
+
+func TestParseFile_Positions(t *testing.T) {
+	file, err := ParseFile("orders.flow", `// orders
+entrypoint.http { method: POST }
+
+step load(timeout: 100) {
+	// comment
+	db.get()
+}
+fallback { [] }
+
+return response.json({status: 200})
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(file.Decls) != 3 {
+		t.Fatalf("decls = %d, want 3", len(file.Decls))
+	}
+	step, ok := file.Decls[1].(*StepDecl)
+	if !ok {
+		t.Fatalf("decl 1 = %T, want *StepDecl", file.Decls[1])
+	}
+	if step.Keyword.String() != "orders.flow:4:1" || step.Name.Pos().String() != "orders.flow:4:6" {
+		t.Errorf("step at %s, name at %s", step.Keyword, step.Name.Pos())
+	}
+	if e := step.Options.Lookup("timeout"); e == nil || e.Value.Pos().String() != "orders.flow:4:20" {
+		t.Errorf("timeout entry = %+v", e)
+	}
+	if step.Body.CodePos.Line != 5 || step.Body.CodePos.Column != 2 || !strings.HasPrefix(step.Body.Code, "// comment") {
+		t.Errorf("body at %s: %q", step.Body.CodePos, step.Body.Code)
+	}
+	if step.Fallback == nil || step.Fallback.Body.Code != "[]" {
+		t.Errorf("fallback = %+v", step.Fallback)
+	}
+	ret := file.Decls[2].(*ReturnDecl)
+	if ret.Value.Pos().Line != 10 || ret.Value.Pos().Column != 8 || ret.Value.Code != "response.json({status: 200})" {
+		t.Errorf("return at %s: %q", ret.Value.Pos(), ret.Value.Code)
+	}
+}
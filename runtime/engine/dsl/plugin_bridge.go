@@ -20,9 +20,15 @@ import (
 // Risor auto-wraps Go functions, so `http.request({url: "..."})` in DSL code
 // performs map attribute access on "http" then calls the "request" function.
 func BuildPluginGlobals(exec *runtime.Execution) map[string]any {
-	grouped := make(map[string]map[string]any)
+	return bindAll(pluginBindings(exec.Container), exec)
+}
+
+// pluginBindings returns the task functions of container grouped by plugin
+// prefix, as BuildPluginGlobals builds them.
+func pluginBindings(container *runtime.Container) map[string]any {
+	grouped := make(map[string]any)
 
-	exec.Container.RangeTasks(func(taskName string, task runtime.Task) {
+	container.RangeTasks(func(taskName string, task runtime.Task) {
 		parts := strings.SplitN(taskName, ".", 2)
 		if len(parts) != 2 {
 			return
@@ -36,26 +42,27 @@ func BuildPluginGlobals(exec *runtime.Execution) map[string]any {
 
 		// Capture task in closure for Risor to call
 		t := task
-		e := exec
-		grouped[pluginName][methodName] = func(args map[string]any) (map[string]any, error) {
-			return t.Execute(e, args)
-		}
+		grouped[pluginName].(map[string]any)[methodName] = binding(func(e *runtime.Execution) any {
+			return func(args map[string]any) (map[string]any, error) {
+				return t.Execute(e, args)
+			}
+		})
 	})
 
-	result := make(map[string]any, len(grouped))
-	for k, v := range grouped {
-		result[k] = v
-	}
-	return result
+	return grouped
 }
 
 // BuildResponseGlobals creates the "response" global module for Risor DSL code.
 // Both step bodies and return bodies use this — response.*() calls set
 // execution.ResponseDescriptor, and the ReturnHandler dispatches it to gin.
 func BuildResponseGlobals(exec *runtime.Execution) map[string]any {
+	return bindAll(responseBindings(exec.Container), exec)
+}
+
+func responseBindings(container *runtime.Container) map[string]any {
 	responseMethods := make(map[string]any)
 
-	for handlerName := range exec.Container.ResponseHandlers.All() {
+	for handlerName := range container.ResponseHandlers.All() {
 		parts := strings.SplitN(handlerName, ".", 2)
 		if len(parts) != 2 {
 			continue
@@ -63,17 +70,19 @@ func BuildResponseGlobals(exec *runtime.Execution) map[string]any {
 		methodName := parts[1]
 
 		hn := handlerName
-		responseMethods[methodName] = func(args ...any) error {
-			argsMap, err := normalizeResponseArgs(args)
-			if err != nil {
-				return err
+		responseMethods[methodName] = binding(func(exec *runtime.Execution) any {
+			return func(args ...any) error {
+				argsMap, err := normalizeResponseArgs(args)
+				if err != nil {
+					return err
+				}
+				exec.State().SetResponse(&runtime.ResponseDescriptor{
+					HandlerName: hn,
+					Args:        argsMap,
+				})
+				return nil
 			}
-			exec.State().SetResponse(&runtime.ResponseDescriptor{
-				HandlerName: hn,
-				Args:        argsMap,
-			})
-			return nil
-		}
+		})
 	}
 
 	return map[string]any{
@@ -0,0 +1,118 @@
+package dsl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	risor "github.com/deepnoodle-ai/risor/v2"
+	"github.com/deepnoodle-ai/risor/v2/pkg/ast"
+	"github.com/deepnoodle-ai/risor/v2/pkg/bytecode"
+	"github.com/deepnoodle-ai/risor/v2/pkg/compiler"
+	rerrors "github.com/deepnoodle-ai/risor/v2/pkg/errors"
+	risorparser "github.com/deepnoodle-ai/risor/v2/pkg/parser"
+)
+
+// program is Risor code compiled once and run by every execution that needs
+// it. Compiled code reads its globals by name, and Risor only compiles code
+// whose globals are declared up front, so compile discovers the free names of
+// the source and run hands the VM just those.
+type program struct {
+	code       *bytecode.Code
+	globals    []reference     // free names, at their first use
+	calls      map[string]bool // globals called as modules, e.g. http in http.request(...)
+	properties []reference     // attributes read from properties, e.g. db in properties.db
+}
+
+// reference is a name in a program, at a 1-based line and column of its
+// source.
+type reference struct {
+	name   string
+	line   int
+	column int
+}
+
+// programs caches compiled programs by source. FlowLoader fills it when a
+// flow loads, so executions neither parse nor compile.
+var programs sync.Map
+
+// compileProgram returns the cached program for source, compiling it on
+// first use.
+func compileProgram(source string) (*program, error) {
+	if p, ok := programs.Load(source); ok {
+		return p.(*program), nil
+	}
+	p, err := compile(source)
+	if err != nil {
+		return nil, err
+	}
+	cached, _ := programs.LoadOrStore(source, p)
+	return cached.(*program), nil
+}
+
+// compile parses and compiles source. Risor reports one undefined variable
+// per compilation, so each one is declared as a global and compilation
+// retried until the code compiles or fails for another reason.
+func compile(source string) (*program, error) {
+	tree, err := risorparser.Parse(context.Background(), source, nil)
+	if err != nil {
+		return nil, err
+	}
+	p := &program{calls: make(map[string]bool)}
+	var names []string
+	for {
+		code, err := compiler.Compile(tree, &compiler.Config{GlobalNames: slices.Sorted(slices.Values(names)), Source: source})
+		if err == nil {
+			p.code = code
+			break
+		}
+		var ce *rerrors.CompileError
+		if !errors.As(err, &ce) || ce.Code != rerrors.E2001 {
+			return nil, err
+		}
+		var name string
+		if _, scanErr := fmt.Sscanf(ce.Message, "undefined variable %q", &name); scanErr != nil || slices.Contains(names, name) {
+			return nil, err
+		}
+		names = append(names, name)
+		p.globals = append(p.globals, reference{name: name, line: ce.Line, column: ce.Column})
+	}
+
+	ast.Inspect(tree, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.ObjectCall:
+			if id, ok := n.X.(*ast.Ident); ok {
+				p.calls[id.Name] = true
+			}
+		case *ast.GetAttr:
+			if id, ok := n.X.(*ast.Ident); ok && id.Name == "properties" && slices.Contains(names, "properties") {
+				pos := n.Attr.NamePos
+				p.properties = append(p.properties, reference{name: n.Attr.Name, line: pos.LineNumber(), column: pos.ColumnNumber()})
+			}
+		}
+		return true
+	})
+	return p, nil
+}
+
+// run executes the program with its globals taken from globals. A global the
+// program reads but globals lacks fails the way Risor reports an undefined
+// variable.
+func (p *program) run(ctx context.Context, globals map[string]any) (any, error) {
+	env := make(map[string]any, len(p.globals))
+	for _, ref := range p.globals {
+		v, ok := globals[ref.name]
+		if !ok {
+			return nil, &rerrors.CompileError{
+				Code:    rerrors.E2001,
+				Message: fmt.Sprintf("undefined variable %q", ref.name),
+				Line:    ref.line,
+				Column:  ref.column,
+			}
+		}
+		env[ref.name] = v
+	}
+	return risor.Run(ctx, p.code, risor.WithEnv(convertGlobals(env)))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/BDNK1/sflowg/runtime"
 )
@@ -14,6 +15,7 @@ import (
 // per-step and flow-level timeouts propagate into the interpreter.
 type StepExecutor struct {
 	interpreter *Interpreter
+	globals     sync.Map // *runtime.Container → global modules, see modules
 }
 
 func NewStepExecutor() *StepExecutor {
@@ -27,52 +29,57 @@ func (e *StepExecutor) ExecuteStep(ctx context.Context, execution *runtime.Execu
 		return "", nil
 	}
 
+	// Catch blocks see the error they handle as `error` through Values().
 	globals := e.buildEnv(execution)
 
 	execution.Logger().Info(fmt.Sprintf("Executing DSL step: %s", step.ID))
 
 	// Pass execution as context.Context so Risor honours deadline/cancellation.
-	result, err := e.interpreter.Eval(ctx, step.Body, globals)
+	result, err := e.interpreter.Eval(withScope(ctx, execution, globals), step.Body, globals)
 	if err != nil {
-		// Preserve FlowError values raised by DSL code.
-		if _, ok := err.(*runtime.FlowError); !ok {
-			// Context cancellation/deadline from interpreter execution should
-			// remain timeout-classified for retry/on_error policies.
-			if errors.Is(err, context.DeadlineExceeded) {
-				return "", &runtime.FlowError{
-					Type:    runtime.ErrorTypeTimeout,
-					Code:    string(runtime.ErrorCodeDeadlineExceeded),
-					Message: err.Error(),
-					Step:    step.ID,
-					Cause:   err,
-				}
-			}
-			if errors.Is(err, context.Canceled) {
-				return "", &runtime.FlowError{
-					Type:    runtime.ErrorTypeTimeout,
-					Code:    string(runtime.ErrorCodeContextCancelled),
-					Message: err.Error(),
-					Step:    step.ID,
-					Cause:   err,
-				}
+		// Preserve FlowError values raised by DSL code and the classification
+		// of plugin errors.
+		if fe, ok := runtime.AsFlowError(err); ok {
+			return "", fe
+		}
+		// Context cancellation/deadline from interpreter execution should
+		// remain timeout-classified for retry/on_error policies.
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", &runtime.FlowError{
+				Type:    runtime.ErrorTypeTimeout,
+				Code:    string(runtime.ErrorCodeDeadlineExceeded),
+				Message: err.Error(),
+				Step:    step.ID,
+				Cause:   err,
 			}
-
-			// Wrap other interpreter failures as permanent runtime errors.
+		}
+		if errors.Is(err, context.Canceled) {
 			return "", &runtime.FlowError{
-				Type:    runtime.ErrorTypePermanent,
-				Code:    string(runtime.ErrorCodeRuntimeError),
+				Type:    runtime.ErrorTypeTimeout,
+				Code:    string(runtime.ErrorCodeContextCancelled),
 				Message: err.Error(),
 				Step:    step.ID,
 				Cause:   err,
 			}
 		}
-		return "", err
+
+		// Wrap other interpreter failures as permanent runtime errors.
+		return "", &runtime.FlowError{
+			Type:    runtime.ErrorTypePermanent,
+			Code:    string(runtime.ErrorCodeRuntimeError),
+			Message: err.Error(),
+			Step:    step.ID,
+			Cause:   err,
+		}
 	}
 
 	// Store the step result under the step ID, but skip if a response
 	// descriptor was set (the step produced a response, not a stored value).
+	// for_each items hand their result to the iteration, which collects it.
 	if result != nil && execution.State().Response() == nil {
-		if m, ok := result.(map[string]any); ok {
+		if it := execution.Iteration(); it != nil {
+			it.SetResult(result)
+		} else if m, ok := result.(map[string]any); ok {
 			execution.State().Store().SetNested(step.ID, m)
 		} else {
 			execution.State().Store().Set(step.ID, result)
@@ -87,7 +94,7 @@ func (e *StepExecutor) ExecuteStep(ctx context.Context, execution *runtime.Execu
 func (e *StepExecutor) ExecuteOnErrorHandler(execution *runtime.Execution, body string, fe *runtime.FlowError) error {
 	globals := e.buildEnv(execution)
 	globals["error"] = fe.ToMap()
-	_, err := e.interpreter.Eval(execution, body, globals)
+	_, err := e.interpreter.Eval(withScope(execution, execution, globals), body, globals)
 	return err
 }
 
@@ -100,56 +107,108 @@ func (e *StepExecutor) ExecuteCompensation(execution *runtime.Execution, body st
 		"step": stepID,
 		"path": string(path),
 	}
-	_, err := e.interpreter.Eval(execution, body, globals)
+	_, err := e.interpreter.Eval(withScope(execution, execution, globals), body, globals)
 	return err
 }
 
-// buildEnv assembles the env map for a step's Risor evaluation.
+// stepGlobals are the names buildEnv defines besides the execution values and
+// the plugin modules.
+var stepGlobals = []string{"response", "log", "metric", "flow", "sprintf", "base64_encode", "raise", "next"}
+
+// buildEnv assembles the env map for a step's Risor evaluation. The code must
+// run with a context from withScope for the global modules to reach the
+// execution.
 func (e *StepExecutor) buildEnv(execution *runtime.Execution) map[string]any {
-	globals := make(map[string]any)
+	modules := e.modules(execution.Container)
+	values := execution.Values()
+	globals := make(map[string]any, len(values)+len(modules))
 
-	for k, v := range execution.State().Store().Snapshot() {
+	for k, v := range values {
 		globals[k] = v
 	}
-
-	pluginGlobals := BuildPluginGlobals(execution)
-	for k, v := range pluginGlobals {
-		globals[k] = v
+	if execution.Flow != nil {
+		for k, v := range execution.Flow.Globals {
+			globals[k] = v
+		}
 	}
-
-	responseGlobals := BuildResponseGlobals(execution)
-	for k, v := range responseGlobals {
+	for k, v := range modules {
 		globals[k] = v
 	}
+	return globals
+}
 
-	logGlobals := BuildLogGlobals(execution)
-	for k, v := range logGlobals {
-		globals[k] = v
+// modules returns the global modules and functions of step code for
+// container, building them on first use. Plugins, response handlers and
+// declared metrics are registered before flows run, so they are fixed by then.
+func (e *StepExecutor) modules(container *runtime.Container) map[string]any {
+	if m, ok := e.globals.Load(container); ok {
+		return m.(map[string]any)
 	}
 
-	metricGlobals := BuildMetricGlobals(execution)
-	for k, v := range metricGlobals {
-		globals[k] = v
+	bindings := pluginBindings(container)
+	for _, m := range []map[string]any{responseBindings(container), logBindings, metricBindings(container.Metrics()), flowBindings} {
+		for k, v := range m {
+			bindings[k] = v
+		}
+	}
+	modules := make(map[string]any, len(bindings)+4)
+	for name, b := range bindings {
+		modules[name] = bindModule(name, b.(map[string]any))
 	}
 
-	globals["sprintf"] = fmt.Sprintf
-	globals["base64_encode"] = func(v any) string {
+	modules["sprintf"] = wrapGoFunc("sprintf", fmt.Sprintf)
+	modules["base64_encode"] = wrapGoFunc("base64_encode", func(v any) string {
 		return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%v", v)))
-	}
+	})
 
 	// raise() lets DSL code signal a FlowError explicitly.
-	// Signature: raise(type, code, message)  or  raise(code, message)
-	globals["raise"] = func(args ...any) (any, error) {
+	// Signature: raise(type, code, message), raise(code, message) or
+	// raise({type, code, message, status, details, meta})
+	modules["raise"] = wrapGoFunc("raise", func(args ...any) (any, error) {
 		return nil, parseRaiseArgs(args...)
-	}
+	})
 
-	return globals
+	// next() continues the flow at another step once this one completes.
+	// Signature: next(step_id)
+	modules["next"] = bindFunc("next", func(execution *runtime.Execution) any {
+		return func(args ...any) (any, error) {
+			return nil, requestJump(execution, args...)
+		}
+	})
+
+	m, _ := e.globals.LoadOrStore(container, modules)
+	return m.(map[string]any)
+}
+
+// requestJump validates the next() target and records it on the RunState.
+func requestJump(execution *runtime.Execution, args ...any) error {
+	stepID, ok := "", len(args) == 1
+	if ok {
+		stepID, ok = args[0].(string)
+	}
+	if !ok {
+		return &runtime.FlowError{
+			Type:    runtime.ErrorTypePermanent,
+			Code:    string(runtime.ErrorCodeInvalidNextTarget),
+			Message: "next() expects a single step ID string",
+		}
+	}
+	if execution.Flow == nil || execution.Flow.StepIndex(stepID) < 0 {
+		return &runtime.FlowError{
+			Type:    runtime.ErrorTypePermanent,
+			Code:    string(runtime.ErrorCodeUnknownStep),
+			Message: fmt.Sprintf("next step %q does not exist", stepID),
+		}
+	}
+	execution.State().SetJump(stepID)
+	return nil
 }
 
 // parseRaiseArgs converts variadic raise() arguments into a *FlowError.
 //
 //	raise("transient", "PAYMENT_TIMEOUT", "upstream timed out")
 //	raise("PAYMENT_TIMEOUT", "upstream timed out")   // defaults to permanent
+//	raise({code: "CARD_DECLINED", message: "card declined", status: 402, details: {reason: "insufficient_funds"}})
 func parseRaiseArgs(args ...any) *runtime.FlowError {
 	fe := &runtime.FlowError{
 		Type: runtime.ErrorTypePermanent,
@@ -198,13 +257,11 @@ func asFlowError(v any) (*runtime.FlowError, bool) {
 	if s, ok := m["step"].(string); ok {
 		fe.Step = s
 	}
-	switch r := m["retries"].(type) {
-	case int:
-		fe.Retries = r
-	case int64:
-		fe.Retries = int(r)
-	case float64:
-		fe.Retries = int(r)
+	fe.Retries = toInt(m["retries"])
+	fe.Status = toInt(m["status"])
+	fe.Details = m["details"]
+	if meta, ok := m["meta"].(map[string]any); ok {
+		fe.Meta = meta
 	}
 	if fe.Code == "" {
 		fe.Code = string(runtime.ErrorCodeRaise)
@@ -0,0 +1,254 @@
+package dsl
+
+import (
+	"io"
+	"log/slog"
+	"maps"
+	"testing"
+
+	"github.com/BDNK1/sflowg/runtime"
+	risor "github.com/deepnoodle-ai/risor/v2"
+)
+
+func TestForEach_ExposesItemAndCollectsResults(t *testing.T) {
+	flow, err := Parse(`
+step notify_all(for_each: orders, as: order, concurrency: 2) {
+	{id: order.id, position: loop.index, total: loop.count}
+}
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	executor := runtime.NewExecutor(NewExpressionEvaluator(), NewStepExecutor())
+	exec := runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+	exec.AddValue("orders", []any{map[string]any{"id": "o1"}, map[string]any{"id": "o2"}})
+	if err := executor.ExecuteSteps(exec); err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+
+	results, _ := exec.Values()["notify_all"].([]any)
+	if len(results) != 2 {
+		t.Fatalf("notify_all = %#v, want two results", exec.Values()["notify_all"])
+	}
+	for i, want := range []string{"o1", "o2"} {
+		r, _ := results[i].(map[string]any)
+		if r["id"] != want || r["position"] != int64(i) || r["total"] != int64(2) {
+			t.Errorf("result %d = %#v", i, results[i])
+		}
+	}
+	if _, leaked := exec.Values()["order"]; leaked {
+		t.Error("the item variable must not leak into the flow store")
+	}
+}
+
+func TestNext_PollsUntilReady(t *testing.T) {
+	flow, err := Parse(`
+step poll(max_iterations: 10) {
+	let attempts = poll.attempts + 1
+	if (attempts < 3) {
+		next("poll")
+	}
+	{attempts: attempts}
+}
+
+step done { {polled: poll.attempts} }
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	executor := runtime.NewExecutor(NewExpressionEvaluator(), NewStepExecutor())
+	exec := runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+	exec.AddValue("poll", map[string]any{"attempts": 0})
+	if err := executor.ExecuteSteps(exec); err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	done, _ := exec.Values()["done"].(map[string]any)
+	if done["polled"] != int64(3) {
+		t.Fatalf("done = %#v, want polled 3", exec.Values()["done"])
+	}
+}
+
+func TestNext_UnknownStepFails(t *testing.T) {
+	flow := runtime.Flow{ID: "jump", Steps: []runtime.Step{{ID: "start", Body: `let target = "nowhere"
+next(target)`}}}
+
+	executor := runtime.NewExecutor(NewExpressionEvaluator(), NewStepExecutor())
+	exec := runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+	err := executor.ExecuteSteps(exec)
+	fe, ok := err.(*runtime.FlowError)
+	if !ok || fe.Code != string(runtime.ErrorCodeUnknownStep) || fe.Step != "start" {
+		t.Fatalf("expected UNKNOWN_STEP from start, got %v", err)
+	}
+}
+
+func TestCatch_RunsFirstMatchingBlock(t *testing.T) {
+	flow, err := Parse(`
+step charge {
+	raise(kind, code, "charge failed")
+}
+catch(code: "CARD_DECLINED") {
+	{status: "declined", reason: error.message}
+}
+catch(type: "transient") {
+	raise("PAYMENTS_UNAVAILABLE", "retry later")
+}
+fallback {
+	{status: "fallback"}
+}
+`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := []struct {
+		kind, code string
+		wantResult any
+		wantErr    string
+	}{
+		{"permanent", "CARD_DECLINED", "declined", ""},
+		{"transient", "GATEWAY_DOWN", nil, "PAYMENTS_UNAVAILABLE"},
+		{"permanent", "FRAUD", "fallback", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			executor := runtime.NewExecutor(NewExpressionEvaluator(), NewStepExecutor())
+			exec := runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+			exec.AddValue("kind", tt.kind)
+			exec.AddValue("code", tt.code)
+
+			err := executor.ExecuteSteps(exec)
+			if tt.wantErr != "" {
+				fe, ok := err.(*runtime.FlowError)
+				if !ok || fe.Code != tt.wantErr {
+					t.Fatalf("expected %s, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExecuteSteps failed: %v", err)
+			}
+			charge, _ := exec.Values()["charge"].(map[string]any)
+			if charge["status"] != tt.wantResult {
+				t.Fatalf("charge = %#v, want status %v", exec.Values()["charge"], tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestRaise_MapCarriesStatusDetailsAndMeta(t *testing.T) {
+	body := `raise({code: "CARD_DECLINED", message: "card declined", status: 402, details: {reason: "insufficient_funds"}, meta: {upstream_status: 402}})`
+	flow := runtime.Flow{ID: "charge", Steps: []runtime.Step{{ID: "charge", Body: body}}}
+
+	executor := runtime.NewExecutor(NewExpressionEvaluator(), NewStepExecutor())
+	exec := runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+	fe, ok := executor.ExecuteSteps(exec).(*runtime.FlowError)
+	if !ok || fe.Code != "CARD_DECLINED" || fe.Status != 402 || fe.Meta["upstream_status"] != int64(402) {
+		t.Fatalf("error = %#v", fe)
+	}
+	if details, _ := fe.Details.(map[string]any); details["reason"] != "insufficient_funds" {
+		t.Fatalf("details = %#v", fe.Details)
+	}
+
+	// Handlers read the same fields from error.
+	flow.Steps[0].Catches = []runtime.CatchBlock{{Code: "CARD_DECLINED", Body: `{status: error.status, upstream: error.meta.upstream_status}`}}
+	exec = runtime.NewExecution(&flow, runtime.NewContainer(runtime.NewLogger(nil)), nil, runtime.NewValueStore())
+	if err := executor.ExecuteSteps(exec); err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	charge, _ := exec.Values()["charge"].(map[string]any)
+	if charge["status"] != int64(402) || charge["upstream"] != int64(402) {
+		t.Fatalf("charge = %#v", exec.Values()["charge"])
+	}
+}
+
+func TestStepExecutor_BindsSharedModulesToEachExecution(t *testing.T) {
+	container := runtime.NewContainer(runtime.NewLogger(nil))
+	if err := container.RegisterPlugin("orders", &benchPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	step := runtime.Step{ID: "load", Body: `orders.get({id: request.body.id})`}
+	flow := runtime.Flow{ID: "orders", Steps: []runtime.Step{step}}
+	executor := NewStepExecutor()
+
+	for _, id := range []string{"o1", "o2"} {
+		exec := runtime.NewExecution(&flow, container, nil, runtime.NewValueStore())
+		exec.AddValue("request", map[string]any{"body": map[string]any{"id": id}})
+		if _, err := executor.ExecuteStep(exec, exec, step); err != nil {
+			t.Fatal(err)
+		}
+		loaded, _ := exec.Values()["load"].(map[string]any)
+		if loaded["id"] != id {
+			t.Errorf("load = %#v, want id %s", exec.Values()["load"], id)
+		}
+	}
+	if first, again := executor.modules(container)["orders"], executor.modules(container)["orders"]; first != again {
+		t.Error("global modules are rebuilt for every step")
+	}
+}
+
+// benchPlugin gives the benchmark container a realistic number of tasks.
+type benchPlugin struct{}
+
+func (p *benchPlugin) Get(exec *runtime.Execution, args map[string]any) (map[string]any, error) {
+	return map[string]any{"id": args["id"], "status": "paid"}, nil
+}
+func (p *benchPlugin) Put(exec *runtime.Execution, args map[string]any) (map[string]any, error) {
+	return args, nil
+}
+func (p *benchPlugin) Delete(exec *runtime.Execution, args map[string]any) (map[string]any, error) {
+	return nil, nil
+}
+func (p *benchPlugin) Query(exec *runtime.Execution, args map[string]any) (map[string]any, error) {
+	return nil, nil
+}
+
+// BenchmarkExecuteStep measures the per-step cost of running a step body: a
+// plugin call, a log line and a result map. "compiled" is the step executor;
+// "per-step" is how steps used to run, building the global modules and
+// compiling the body for every step.
+func BenchmarkExecuteStep(b *testing.B) {
+	container := runtime.NewContainer(runtime.NewLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	for _, name := range []string{"orders", "payments", "customers", "inventory"} {
+		if err := container.RegisterPlugin(name, &benchPlugin{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	step := runtime.Step{ID: "load", Body: `let order = orders.get({id: request.body.id})
+log.debug("loaded order", order.id)
+{id: order.id, paid: order.status == "paid"}`}
+	flow := runtime.Flow{ID: "bench", Steps: []runtime.Step{step}}
+	newExecution := func() *runtime.Execution {
+		exec := runtime.NewExecution(&flow, container, nil, runtime.NewValueStore())
+		exec.AddValue("request", map[string]any{"body": map[string]any{"id": "o1"}})
+		return exec
+	}
+
+	b.Run("compiled", func(b *testing.B) {
+		executor := NewStepExecutor()
+		b.ReportAllocs()
+		for b.Loop() {
+			exec := newExecution()
+			if _, err := executor.ExecuteStep(exec, exec, step); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("per-step", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			exec := newExecution()
+			globals := exec.Values()
+			for _, build := range []func(*runtime.Execution) map[string]any{
+				BuildPluginGlobals, BuildResponseGlobals, BuildLogGlobals, BuildMetricGlobals, BuildFlowGlobals,
+			} {
+				maps.Copy(globals, build(exec))
+			}
+			if _, err := risor.Eval(exec, step.Body, risor.WithEnv(convertGlobals(globals))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
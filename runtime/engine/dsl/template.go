@@ -0,0 +1,506 @@
+package dsl
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BDNK1/sflowg/runtime"
+	"github.com/deepnoodle-ai/risor/v2/pkg/ast"
+	risorparser "github.com/deepnoodle-ai/risor/v2/pkg/parser"
+)
+
+// A template is a group of steps that flows instantiate with use:
+//
+//	template fetch_or_404(table, id) {
+//		step fetch { db.get({table: table, id: id}) }
+//		step check { if (fetch == nil) { raise({status: 404}) } }
+//	}
+//
+//	use fetch_or_404(table: "orders", id: request.pathVariables.id) as order
+//
+// A use expands into ordinary steps, here order_fetch and order_check, so the
+// executor, metrics and compensation see nothing new. The code of the
+// expanded steps reads the arguments in place of the parameters and the
+// prefixed IDs in place of the steps of the template.
+
+// templateScope returns the names a template defines for its code: its
+// parameters and its steps.
+func templateScope(t *TemplateDecl) map[string]bool {
+	scope := make(map[string]bool)
+	for _, p := range t.Params {
+		scope[p.Name] = true
+	}
+	for _, name := range templateSteps(t) {
+		scope[name] = true
+	}
+	return scope
+}
+
+// templateSteps returns the IDs of the steps of t, parallel branches included.
+func templateSteps(t *TemplateDecl) []string {
+	var names []string
+	for _, decl := range t.Steps {
+		switch d := decl.(type) {
+		case *StepDecl:
+			names = append(names, d.Name.Name)
+		case *ParallelDecl:
+			names = append(names, d.Name.Name)
+			for _, branch := range d.Steps {
+				names = append(names, branch.Name.Name)
+			}
+		}
+	}
+	return names
+}
+
+// checkTemplate reports the problems of a template declaration, building its
+// steps as they are written. Options set to a parameter are checked at each
+// use instead. It returns false if there were any problems.
+func checkTemplate(t *TemplateDecl, diags *diagnosticList) bool {
+	n := len(diags.list)
+	context := "template " + t.Name.Name
+	params := make(map[string]bool)
+	for _, p := range t.Params {
+		if params[p.Name] {
+			diags.add(p.NamePos, "%s: duplicate parameter %q", context, p.Name)
+		}
+		params[p.Name] = true
+	}
+	built := &diagnosticList{file: diags.file, src: diags.src}
+	steps := make(map[string]bool)
+	for _, decl := range t.Steps {
+		var name *Ident
+		switch d := decl.(type) {
+		case *StepDecl:
+			name = d.Name
+			buildStep(built, d)
+		case *ParallelDecl:
+			name = d.Name
+			buildParallel(built, d)
+		}
+		switch {
+		case steps[name.Name]:
+			diags.add(name.NamePos, "%s: duplicate step %q", context, name.Name)
+		case params[name.Name]:
+			diags.add(name.NamePos, "%s: step %q has the name of a parameter", context, name.Name)
+		}
+		steps[name.Name] = true
+	}
+	if len(t.Steps) == 0 {
+		diags.add(t.Keyword, "%s: expected at least one step", context)
+	}
+	skip := paramOptions(t)
+	for _, d := range built.list {
+		if !skip[d.Pos.Offset] {
+			diags.list = append(diags.list, d)
+		}
+	}
+	return len(diags.list) == n
+}
+
+// paramOptions returns the offsets of the option values of t that are just a
+// parameter.
+func paramOptions(t *TemplateDecl) map[int]bool {
+	offsets := make(map[int]bool)
+	var value func(v Value)
+	value = func(v Value) {
+		switch v := v.(type) {
+		case *Expr:
+			name := strings.TrimSpace(v.Code)
+			if slices.ContainsFunc(t.Params, func(p *Ident) bool { return p.Name == name }) {
+				offsets[v.ValuePos.Offset] = true
+			}
+		case *ListLit:
+			for _, item := range v.Items {
+				value(item)
+			}
+		case *MapLit:
+			if v != nil {
+				for _, e := range v.Entries {
+					value(e.Value)
+				}
+			}
+		}
+	}
+	step := func(d *StepDecl) {
+		value(d.Options)
+		for _, c := range append([]*Clause{d.Fallback, d.Compensate}, d.Catches...) {
+			if c != nil {
+				value(c.Options)
+			}
+		}
+	}
+	for _, decl := range t.Steps {
+		switch d := decl.(type) {
+		case *StepDecl:
+			step(d)
+		case *ParallelDecl:
+			value(d.Options)
+			for _, branch := range d.Steps {
+				step(branch)
+			}
+		}
+	}
+	return offsets
+}
+
+// expandUse returns the steps of t instantiated by u. Problems caused by the
+// arguments are reported at the use; those of the template itself were
+// reported by checkTemplate.
+func expandUse(u *UseDecl, t *TemplateDecl, diags *diagnosticList) []runtime.Step {
+	context := "use " + u.Name()
+	x := &expansion{args: make(map[string]Value), names: make(map[string]string), steps: make(map[string]string)}
+	ok := true
+	for _, e := range u.Args.Entries {
+		if !slices.ContainsFunc(t.Params, func(p *Ident) bool { return p.Name == e.Key.Name }) {
+			diags.add(e.Key.NamePos, "%s: unknown parameter %s", context, e.Key.Name)
+			ok = false
+			continue
+		}
+		x.args[e.Key.Name] = e.Value
+		x.names[e.Key.Name] = "(" + risorLiteral(e.Value) + ")"
+	}
+	for _, p := range t.Params {
+		if _, set := x.args[p.Name]; !set {
+			diags.add(u.Args.Rbrace, "%s: missing argument %s", context, p.Name)
+			ok = false
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	prefix := t.Name.Name
+	if u.As != nil {
+		prefix = u.As.Name
+	}
+	for _, name := range templateSteps(t) {
+		x.steps[name] = prefix + "_" + name
+		x.names[name] = x.steps[name]
+	}
+
+	// Errors here come from the arguments, e.g. timeout: ttl with ttl: "soon".
+	built := &diagnosticList{}
+	var steps []runtime.Step
+	for _, decl := range t.Steps {
+		switch d := decl.(type) {
+		case *StepDecl:
+			steps = append(steps, buildStep(built, x.step(d)))
+		case *ParallelDecl:
+			steps = append(steps, buildParallel(built, x.parallel(d)))
+		}
+	}
+	for _, d := range built.list {
+		diags.add(u.Keyword, "%s: %s", context, d.Message)
+	}
+	// Compile the expanded code now, so executions find it compiled.
+	for _, code := range x.code {
+		if _, err := compileProgram(code); err != nil {
+			diags.add(u.Keyword, "%s: %v", context, err)
+		}
+	}
+	return steps
+}
+
+// expansion rewrites the steps of a template for one use.
+type expansion struct {
+	args  map[string]Value  // by parameter
+	names map[string]string // code replacing each parameter and step name
+	steps map[string]string // prefixed ID of each step, for next("...")
+	code  []string          // rewritten code
+}
+
+func (x *expansion) step(d *StepDecl) *StepDecl {
+	s := *d
+	s.Name = &Ident{NamePos: d.Name.NamePos, Name: x.steps[d.Name.Name]}
+	s.Options = x.options(d.Options)
+	s.Body = x.block(d.Body)
+	s.Fallback = x.clause(d.Fallback)
+	s.Compensate = x.clause(d.Compensate)
+	s.Catches = nil
+	for _, c := range d.Catches {
+		s.Catches = append(s.Catches, x.clause(c))
+	}
+	return &s
+}
+
+func (x *expansion) parallel(d *ParallelDecl) *ParallelDecl {
+	p := *d
+	p.Name = &Ident{NamePos: d.Name.NamePos, Name: x.steps[d.Name.Name]}
+	p.Options = x.options(d.Options)
+	p.Steps = nil
+	for _, branch := range d.Steps {
+		p.Steps = append(p.Steps, x.step(branch))
+	}
+	return &p
+}
+
+func (x *expansion) clause(c *Clause) *Clause {
+	if c == nil {
+		return nil
+	}
+	out := *c
+	out.Options = x.options(c.Options)
+	out.Body = x.block(c.Body)
+	return &out
+}
+
+func (x *expansion) block(b *Block) *Block {
+	out := *b
+	out.Code = x.rewrite(b.Code)
+	return &out
+}
+
+// codeOptions are the options whose quoted values are Risor code too.
+var codeOptions = map[string]bool{"condition": true, "for_each": true, "next": true, "when": true}
+
+func (x *expansion) options(m *MapLit) *MapLit {
+	if m == nil {
+		return nil
+	}
+	out := &MapLit{Lbrace: m.Lbrace, Rbrace: m.Rbrace}
+	for _, e := range m.Entries {
+		out.Entries = append(out.Entries, &Entry{Key: e.Key, Value: x.value(e.Key.Name, e.Value)})
+	}
+	return out
+}
+
+// value rewrites an option value. A value that is just a parameter takes the
+// argument as it is written, so retry: {max_attempts: attempts} works with
+// attempts: 3.
+func (x *expansion) value(key string, v Value) Value {
+	switch v := v.(type) {
+	case *Expr:
+		if key == "as" {
+			return v
+		}
+		if arg, ok := x.args[strings.TrimSpace(v.Code)]; ok {
+			return arg
+		}
+		return &Expr{ValuePos: v.ValuePos, Code: x.rewrite(v.Code)}
+	case *String:
+		if !codeOptions[key] {
+			return v
+		}
+		code := x.rewrite(v.Value)
+		return &String{ValuePos: v.ValuePos, Raw: strconv.Quote(code), Value: code}
+	case *ListLit:
+		out := &ListLit{Lbrack: v.Lbrack, Rbrack: v.Rbrack}
+		for _, item := range v.Items {
+			out.Items = append(out.Items, x.value(key, item))
+		}
+		return out
+	case *MapLit:
+		return x.options(v)
+	}
+	return v
+}
+
+func (x *expansion) rewrite(code string) string {
+	out := renameGlobals(code, x.names, x.steps)
+	if out != code {
+		x.code = append(x.code, out)
+	}
+	return out
+}
+
+// renameGlobals replaces the globals of code named in names, and the string
+// literal targets of next() calls named in steps. Names bound inside the code,
+// such as function parameters, are left alone. Code that does not compile is
+// returned as it is.
+func renameGlobals(code string, names, steps map[string]string) string {
+	p, err := compileProgram(code)
+	if err != nil {
+		return code
+	}
+	free := make(map[string]bool)
+	for _, g := range p.globals {
+		if _, ok := names[g.name]; ok {
+			free[g.name] = true
+		}
+	}
+	tree, err := risorparser.Parse(context.Background(), code, nil)
+	if err != nil {
+		return code
+	}
+
+	type edit struct {
+		offset, length int
+		text           string
+	}
+	var edits []edit
+	// Positions in the expressions of template strings are relative to the
+	// expression, so walk adds base to them.
+	var walk func(node ast.Node, bound map[string]bool, base int)
+	walk = func(node ast.Node, bound map[string]bool, base int) {
+		ast.Inspect(node, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.Ident:
+				if free[n.Name] && !bound[n.Name] {
+					edits = append(edits, edit{base + n.NamePos.Char, len(n.Name), names[n.Name]})
+				}
+			case *ast.String:
+				from := base + n.ValuePos.Char
+				for _, expr := range n.Exprs {
+					start := strings.Index(code[from:], "${")
+					if start < 0 {
+						break
+					}
+					from += start + 2
+					walk(expr, bound, from)
+				}
+				return false
+			case *ast.ObjectCall:
+				// The method name is not a global.
+				walk(n.X, bound, base)
+				for _, arg := range n.Call.Args {
+					walk(arg, bound, base)
+				}
+				return false
+			case *ast.Map:
+				// Nor are bare keys.
+				for _, item := range n.Items {
+					if _, bare := item.Key.(*ast.Ident); !bare && item.Key != nil {
+						walk(item.Key, bound, base)
+					}
+					walk(item.Value, bound, base)
+				}
+				return false
+			case *ast.Assign:
+				if n.Index != nil {
+					walk(n.Index, bound, base)
+				}
+				walk(n.Value, bound, base)
+				return false
+			case *ast.Func:
+				inner := maps.Clone(bound)
+				if inner == nil {
+					inner = make(map[string]bool)
+				}
+				for _, param := range n.Params {
+					for _, name := range param.ParamNames() {
+						inner[name] = true
+					}
+				}
+				if n.RestParam != nil {
+					inner[n.RestParam.Name] = true
+				}
+				for _, def := range n.Defaults {
+					if def != nil {
+						walk(def, bound, base)
+					}
+				}
+				walk(n.Body, inner, base)
+				return false
+			case *ast.Call:
+				if fn, ok := n.Fun.(*ast.Ident); ok && fn.Name == "next" && len(n.Args) == 1 {
+					if target, ok := n.Args[0].(*ast.String); ok && target.Template == nil {
+						// A step name has no escapes, so the literal is the
+						// name between two quotes.
+						if id, ok := steps[target.Value]; ok {
+							edits = append(edits, edit{base + target.ValuePos.Char, len(target.Value) + 2, strconv.Quote(id)})
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+	walk(tree, nil, 0)
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].offset > edits[j].offset })
+	for _, e := range edits {
+		code = code[:e.offset] + e.text + code[e.offset+e.length:]
+	}
+	return code
+}
+
+// risorLiteral renders an argument as Risor code.
+func risorLiteral(v Value) string {
+	switch v := v.(type) {
+	case *String:
+		return strconv.Quote(v.Value)
+	case *Expr:
+		return v.Code
+	case *ListLit:
+		items := make([]string, len(v.Items))
+		for i, item := range v.Items {
+			items[i] = risorLiteral(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *MapLit:
+		entries := make([]string, len(v.Entries))
+		for i, e := range v.Entries {
+			entries[i] = strconv.Quote(e.Key.Name) + ": " + risorLiteral(e.Value)
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	}
+	return "nil"
+}
+
+// importTemplates loads the templates of the .flow file imported by d, keyed
+// by their name qualified with the import name. Problems in the imported file
+// are reported at their position in it, and the globals its templates read
+// are returned for CheckFlow.
+func importTemplates(d *ImportDecl, from string, diags *diagnosticList) (map[string]*TemplateDecl, []flowRef) {
+	path := filepath.Join(filepath.Dir(from), d.Path.Value)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		diags.add(d.Path.ValuePos, "cannot import %q: %v", d.Path.Value, err)
+		return nil, nil
+	}
+	td := &diagnosticList{file: path, src: string(data)}
+	file := parseFile(path, string(data), td)
+	// Templates with problems map to nil, so their uses add no more errors.
+	templates := make(map[string]*TemplateDecl)
+	for _, decl := range file.Decls {
+		t, ok := decl.(*TemplateDecl)
+		if !ok {
+			td.add(decl.Pos(), "only templates can be declared in an imported .flow file")
+			continue
+		}
+		name := d.Name.Name + "." + t.Name.Name
+		if first, dup := templates[name]; dup {
+			td.add(t.Name.NamePos, "duplicate template %q (first at %s)", t.Name.Name, first.Keyword)
+			continue
+		}
+		templates[name] = nil
+		if checkTemplate(t, td) {
+			templates[name] = t
+		}
+	}
+	refs := compileFlow(file, td)
+	if err := td.err(); err != nil {
+		diags.imported = append(diags.imported, err.(Diagnostics)...)
+		for name := range templates {
+			templates[name] = nil
+		}
+		return templates, nil
+	}
+	return templates, refs
+}
+
+// isTemplateImport reports whether d imports the templates of a .flow file
+// rather than a Risor module.
+func isTemplateImport(d *ImportDecl) bool {
+	return strings.HasSuffix(d.Path.Value, ".flow")
+}
+
+// templateError describes a use of a template that does not exist.
+func templateError(u *UseDecl, imports map[string]*ImportDecl) string {
+	if u.Import != nil {
+		if d, ok := imports[u.Import.Name]; !ok {
+			return fmt.Sprintf("use %s: no import named %s", u.Name(), u.Import.Name)
+		} else if !isTemplateImport(d) {
+			return fmt.Sprintf("use %s: %s imports a Risor module, not templates", u.Name(), u.Import.Name)
+		}
+	}
+	return fmt.Sprintf("use %s: unknown template", u.Name())
+}
@@ -0,0 +1,122 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Built-in entrypoint types. Other types are served by plugins implementing
+// EntrypointProvider.
+const (
+	EntrypointHTTP     = "http"
+	EntrypointSchedule = "schedule"
+
+	// TriggerKey is the global describing what started a non-HTTP execution.
+	TriggerKey = "trigger"
+)
+
+// EntrypointBinding connects one flow to an EntrypointProvider.
+type EntrypointBinding struct {
+	FlowID string
+	Config map[string]any
+	Log    Logger
+	// Dispatch runs the flow once as a new execution. trigger is exposed to
+	// steps as the `trigger` global; its "type" defaults to the entrypoint type.
+	Dispatch func(ctx context.Context, trigger map[string]any) (*TriggerResult, error)
+}
+
+// TriggerResult is what a dispatched run produced.
+type TriggerResult struct {
+	ExecutionID string
+	// Response is the descriptor set by a response step, nil if none was set.
+	Response *ResponseDescriptor
+}
+
+// triggerRunner executes a flow for triggers other than HTTP requests.
+// Each call is its own Execution with its own span and flow metrics.
+type triggerRunner struct {
+	flow             *Flow
+	container        *Container
+	executor         *Executor
+	globalProperties map[string]any
+	newValueStore    func() ValueStore
+	triggerType      string
+}
+
+func (r *triggerRunner) run(ctx context.Context, trigger map[string]any) (*Execution, error) {
+	data := make(map[string]any, len(trigger)+1)
+	for k, v := range trigger {
+		data[k] = v
+	}
+	if _, ok := data["type"]; !ok {
+		data["type"] = r.triggerType
+	}
+
+	e := NewExecution(r.flow, r.container, r.globalProperties, r.newValueStore())
+	e.AddValue(TriggerKey, data)
+
+	spanCtx, span := e.Tracer().Start(ctx, fmt.Sprintf("flow %s", r.flow.ID),
+		trace.WithAttributes(
+			attribute.String("flow.id", r.flow.ID),
+			attribute.String("execution.id", e.ID),
+			attribute.String("trigger.type", fmt.Sprint(data["type"])),
+		),
+	)
+	defer span.End()
+
+	runCtx := spanCtx
+	if r.flow.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(spanCtx, time.Duration(r.flow.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	e = e.WithContext(runCtx)
+
+	start := time.Now()
+	err := r.executor.ExecuteSteps(e)
+	duration := time.Since(start)
+	e.Metrics().RecordFlow(spanCtx, r.flow.ID, classifyMetricOutcome(err), duration)
+
+	log := e.Logger()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Error("Triggered run failed",
+			"trigger_type", data["type"],
+			"duration_ms", duration.Milliseconds(),
+			"error", err)
+		return e, err
+	}
+	log.Info("Triggered run completed",
+		"trigger_type", data["type"],
+		"duration_ms", duration.Milliseconds())
+	return e, nil
+}
+
+// pluginEntrypoint binds a flow to a plugin-provided entrypoint type.
+type pluginEntrypoint struct {
+	provider EntrypointProvider
+	runner   *triggerRunner
+}
+
+func (p *pluginEntrypoint) start() error {
+	flow := p.runner.flow
+	binding := EntrypointBinding{
+		FlowID: flow.ID,
+		Config: flow.Entrypoint.Config,
+		Log:    p.runner.container.Logger().With("flow_id", flow.ID, "entrypoint", flow.Entrypoint.Type),
+		Dispatch: func(ctx context.Context, trigger map[string]any) (*TriggerResult, error) {
+			e, err := p.runner.run(ctx, trigger)
+			return &TriggerResult{ExecutionID: e.ID, Response: e.State().Response()}, err
+		},
+	}
+	if err := p.provider.StartEntrypoint(binding); err != nil {
+		return fmt.Errorf("flow %s: starting %s entrypoint: %w", flow.ID, flow.Entrypoint.Type, err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type queueEntrypointPlugin struct {
+	typ      string
+	bindings []EntrypointBinding
+	stopped  int
+	startErr error // returned by StartEntrypoint when set
+}
+
+func (p *queueEntrypointPlugin) EntrypointType() string { return p.typ }
+
+func (p *queueEntrypointPlugin) ValidateEntrypoint(flowID string, config map[string]any) error {
+	if _, ok := config["topic"].(string); !ok {
+		return errors.New("topic is required")
+	}
+	return nil
+}
+
+func (p *queueEntrypointPlugin) StartEntrypoint(binding EntrypointBinding) error {
+	if p.startErr != nil {
+		return p.startErr
+	}
+	p.bindings = append(p.bindings, binding)
+	return nil
+}
+
+func (p *queueEntrypointPlugin) StopEntrypoints(ctx context.Context) error {
+	p.stopped++
+	return nil
+}
+
+func TestContainerRegisterPlugin_DiscoversEntrypointProvider(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	provider := &queueEntrypointPlugin{typ: "queue"}
+	if err := container.RegisterPlugin("queue", provider); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	got, ok := container.EntrypointProvider("queue")
+	if !ok || got != provider {
+		t.Fatalf("expected provider to be discovered, got %v", got)
+	}
+
+	err := container.RegisterPlugin("queue2", &queueEntrypointPlugin{typ: "queue"})
+	if err == nil || !strings.Contains(err.Error(), `already provided by plugin "queue"`) {
+		t.Fatalf("expected duplicate type error, got %v", err)
+	}
+	err = container.RegisterPlugin("web", &queueEntrypointPlugin{typ: EntrypointHTTP})
+	if err == nil || !strings.Contains(err.Error(), "is built in") {
+		t.Fatalf("expected built-in type error, got %v", err)
+	}
+}
+
+func TestApp_PluginEntrypointDispatchesFlow(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	provider := &queueEntrypointPlugin{typ: "queue"}
+	if err := container.RegisterPlugin("queue", provider); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+
+	stepExecutor := &capturingStepExecutor{}
+	newStore := func() ValueStore { return NewValueStore() }
+	app := NewApp(container, nil, noopEvaluator{}, stepExecutor, newStore)
+	flow := Flow{
+		ID:         "orders",
+		Entrypoint: Entrypoint{Type: "queue", Config: map[string]any{"topic": "orders"}},
+		Steps:      []Step{{ID: "capture"}},
+	}
+	if err := app.validateEntrypoint(flow); err != nil {
+		t.Fatalf("validateEntrypoint failed: %v", err)
+	}
+	if err := app.registerEntrypoint(&flow, NewExecutor(noopEvaluator{}, stepExecutor), nil); err != nil {
+		t.Fatalf("registerEntrypoint failed: %v", err)
+	}
+	if err := app.pluginTriggers[0].start(); err != nil {
+		t.Fatalf("start failed: %v", err)
+	}
+
+	binding := provider.bindings[0]
+	if binding.FlowID != "orders" || binding.Config["topic"] != "orders" {
+		t.Fatalf("unexpected binding: %+v", binding)
+	}
+	result, err := binding.Dispatch(context.Background(), map[string]any{"payload": "p1"})
+	if err != nil {
+		t.Fatalf("Dispatch failed: %v", err)
+	}
+	if result.ExecutionID == "" {
+		t.Fatal("expected an execution ID")
+	}
+	trigger, _ := stepExecutor.values[TriggerKey].(map[string]any)
+	if trigger["type"] != "queue" || trigger["payload"] != "p1" {
+		t.Fatalf("unexpected trigger global: %#v", trigger)
+	}
+
+	if err := app.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %v", err)
+	}
+	if provider.stopped != 1 {
+		t.Fatalf("StopEntrypoints called %d times, want 1", provider.stopped)
+	}
+}
+
+func TestApp_StartEntrypointsStopsStartedOnFailure(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	queue := &queueEntrypointPlugin{typ: "queue"}
+	broken := &queueEntrypointPlugin{typ: "stream", startErr: errors.New("broker unreachable")}
+	for name, p := range map[string]*queueEntrypointPlugin{"queue": queue, "stream": broken} {
+		if err := container.RegisterPlugin(name, p); err != nil {
+			t.Fatalf("RegisterPlugin failed: %v", err)
+		}
+	}
+
+	app := NewApp(container, nil, noopEvaluator{}, noopStepExecutor{}, newTestValueStore)
+	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
+	for _, flow := range []Flow{
+		{ID: "orders", Entrypoint: Entrypoint{Type: "queue", Config: map[string]any{"topic": "orders"}}},
+		{ID: "events", Entrypoint: Entrypoint{Type: "stream", Config: map[string]any{"topic": "events"}}},
+		{ID: "reconcile", Entrypoint: Entrypoint{Type: EntrypointSchedule, Config: map[string]any{"cron": "* * * * *"}}},
+	} {
+		if err := app.registerEntrypoint(&flow, executor, nil); err != nil {
+			t.Fatalf("registerEntrypoint failed: %v", err)
+		}
+	}
+
+	err := app.startEntrypoints(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "broker unreachable") {
+		t.Fatalf("expected the start error, got %v", err)
+	}
+	if len(queue.bindings) != 1 || queue.stopped != 1 || broken.stopped != 1 {
+		t.Fatalf("queue started %d and stopped %d times, stream stopped %d times, want 1 each",
+			len(queue.bindings), queue.stopped, broken.stopped)
+	}
+	select {
+	case <-app.schedules[0].done:
+	default:
+		t.Fatal("the schedule is still running")
+	}
+}
+
+func TestApp_ValidateEntrypoint(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	if err := container.RegisterPlugin("queue", &queueEntrypointPlugin{typ: "queue"}); err != nil {
+		t.Fatalf("RegisterPlugin failed: %v", err)
+	}
+	app := NewApp(container, nil, noopEvaluator{}, noopStepExecutor{}, newTestValueStore)
+
+	tests := []struct {
+		name string
+		ep   Entrypoint
+		want string
+	}{
+		{"unknown type", Entrypoint{Type: "grpc"}, `unsupported entrypoint type "grpc"`},
+		{"provider rejects config", Entrypoint{Type: "queue", Config: map[string]any{}}, "topic is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := app.validateEntrypoint(Flow{ID: "orders", Entrypoint: tt.ep})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
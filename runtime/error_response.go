@@ -0,0 +1,162 @@
+package runtime
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemContentType is the media type of RFC 7807 error responses.
+const ProblemContentType = "application/problem+json"
+
+// ErrorResponseConfig shapes the response of a flow that fails without
+// setting one. It is read from `properties.errors` in flow-config.yaml.
+type ErrorResponseConfig struct {
+	Debug bool                  // include step, retries, meta and cause in responses
+	Types map[FlowErrorType]int // status per error type
+	Codes map[string]int        // status per error code; wins over Types
+}
+
+// parseErrorResponseConfig reads properties.errors ({debug, types, codes}).
+func parseErrorResponseConfig(raw map[string]any) (ErrorResponseConfig, error) {
+	var cfg ErrorResponseConfig
+	for key, v := range raw {
+		switch key {
+		case "debug":
+			debug, err := strconv.ParseBool(fmt.Sprintf("%v", v))
+			if err != nil {
+				return cfg, fmt.Errorf("debug must be a boolean, got %v", v)
+			}
+			cfg.Debug = debug
+		case "types":
+			statuses, err := parseStatusMap(key, v)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Types = make(map[FlowErrorType]int, len(statuses))
+			for t, status := range statuses {
+				switch FlowErrorType(t) {
+				case ErrorTypeTransient, ErrorTypePermanent, ErrorTypeTimeout, ErrorTypeClient:
+				default:
+					return cfg, fmt.Errorf("types: unknown error type %q (allowed: transient, permanent, timeout, client)", t)
+				}
+				cfg.Types[FlowErrorType(t)] = status
+			}
+		case "codes":
+			statuses, err := parseStatusMap(key, v)
+			if err != nil {
+				return cfg, err
+			}
+			cfg.Codes = statuses
+		default:
+			return cfg, fmt.Errorf("unsupported option %q (allowed: debug, types, codes)", key)
+		}
+	}
+	return cfg, nil
+}
+
+func parseStatusMap(name string, raw any) (map[string]int, error) {
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map", name)
+	}
+	statuses := make(map[string]int, len(m))
+	for key, v := range m {
+		status, ok := toInt64(v)
+		if !ok || !isErrorStatus(int(status)) {
+			return nil, fmt.Errorf("%s.%s must be an HTTP status between 400 and 599, got %v", name, key, v)
+		}
+		statuses[key] = int(status)
+	}
+	return statuses, nil
+}
+
+func isErrorStatus(status int) bool {
+	return status >= 400 && status <= 599
+}
+
+// status is the HTTP status of a failed flow: the error's own Status, else
+// the configured status of its code, then of its type, else 400 for client
+// errors and 500 for the others.
+func (cfg ErrorResponseConfig) status(fe *FlowError) int {
+	if isErrorStatus(fe.Status) {
+		return fe.Status
+	}
+	if status, ok := cfg.Codes[fe.Code]; ok {
+		return status
+	}
+	if status, ok := cfg.Types[fe.Type]; ok {
+		return status
+	}
+	if fe.Type == ErrorTypeClient {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// problem renders fe as an RFC 7807 problem. The message is only shown for
+// 4xx statuses, where it describes what the client got wrong; step names,
+// causes and meta stay internal unless Debug is set.
+func (cfg ErrorResponseConfig) problem(fe *FlowError) (int, gin.H) {
+	status := cfg.status(fe)
+	body := gin.H{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"code":   fe.Code,
+	}
+	if status < http.StatusInternalServerError || cfg.Debug {
+		body["detail"] = fe.Message
+	}
+	if fe.Details != nil {
+		body["details"] = fe.Details
+	}
+	if cfg.Debug {
+		body["debug"] = gin.H{
+			"error_type": fe.Type,
+			"step":       fe.Step,
+			"retries":    fe.Retries,
+			"meta":       fe.Meta,
+			"cause":      causeValue(fe.Cause),
+		}
+	}
+	return status, body
+}
+
+// writeFlowError sends the default response of a flow that failed without
+// setting a response. It returns that response so idempotent requests replay
+// what the client received.
+func writeFlowError(c *gin.Context, cfg ErrorResponseConfig, err error) *ResponseDescriptor {
+	status, body := cfg.problem(toFlowError(err, "", 0))
+	writeProblem(c, status, body)
+	return problemResponse(status, body)
+}
+
+// writeRequestError sends the default response for a request rejected before
+// the flow ran. Schema violations are listed under errors.
+func writeRequestError(c *gin.Context, cfg ErrorResponseConfig, reqErr *RequestError) {
+	status, body := cfg.problem(reqErr.FlowError())
+	if len(reqErr.Violations) > 0 {
+		body["errors"] = reqErr.Violations
+	}
+	writeProblem(c, status, body)
+}
+
+func writeProblem(c *gin.Context, status int, body gin.H) {
+	c.Header("Content-Type", ProblemContentType)
+	c.JSON(status, body)
+}
+
+// problemResponse describes a problem body as an http.json response.
+func problemResponse(status int, body gin.H) *ResponseDescriptor {
+	return &ResponseDescriptor{
+		HandlerName: "http.json",
+		Args: map[string]any{
+			"status":  status,
+			"headers": map[string]any{"Content-Type": ProblemContentType},
+			"body":    map[string]any(body),
+		},
+	}
+}
@@ -0,0 +1,175 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serveFailingFlow(t *testing.T, cfg ErrorResponseConfig, err error) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	container := NewContainer(NewLogger(nil))
+	container.SetErrorResponseConfig(cfg)
+	flow := &Flow{
+		ID:         "checkout",
+		Entrypoint: Entrypoint{Type: "http", Config: map[string]any{"method": "POST", "path": "/checkout"}},
+		Steps:      []Step{{ID: "charge_card"}},
+	}
+	executor := NewExecutor(noopEvaluator{}, failingMetricStepExecutor{err: err})
+	if err := NewHttpHandler(flow, container, executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/checkout", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, ProblemContentType) {
+		t.Fatalf("Content-Type = %q, want %s", ct, ProblemContentType)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	return rec, body
+}
+
+func TestFlowErrorResponse_UsesErrorStatusAndDetails(t *testing.T) {
+	rec, body := serveFailingFlow(t, ErrorResponseConfig{}, &FlowError{
+		Type:    ErrorTypePermanent,
+		Code:    "CARD_DECLINED",
+		Message: "card was declined",
+		Status:  http.StatusPaymentRequired,
+		Details: map[string]any{"reason": "insufficient_funds"},
+		Meta:    map[string]any{"upstream_status": 402},
+	})
+
+	if rec.Code != http.StatusPaymentRequired {
+		t.Fatalf("status = %d, want 402", rec.Code)
+	}
+	if body["title"] != "Payment Required" || body["code"] != "CARD_DECLINED" || body["detail"] != "card was declined" {
+		t.Fatalf("body = %v", body)
+	}
+	if details, _ := body["details"].(map[string]any); details["reason"] != "insufficient_funds" {
+		t.Fatalf("details = %v", body["details"])
+	}
+	if _, ok := body["debug"]; ok {
+		t.Fatalf("debug info leaked: %v", body)
+	}
+}
+
+func TestFlowErrorResponse_HidesInternalsUnlessDebug(t *testing.T) {
+	err := errors.New("dial tcp 10.0.0.7:5432: connection refused")
+
+	rec, body := serveFailingFlow(t, ErrorResponseConfig{}, err)
+	if rec.Code != http.StatusInternalServerError || body["code"] != string(ErrorCodeRuntimeError) {
+		t.Fatalf("status = %d, body = %v", rec.Code, body)
+	}
+	if strings.Contains(rec.Body.String(), "10.0.0.7") || strings.Contains(rec.Body.String(), "charge_card") {
+		t.Fatalf("internal details leaked: %s", rec.Body.String())
+	}
+
+	_, body = serveFailingFlow(t, ErrorResponseConfig{Debug: true}, err)
+	debug, _ := body["debug"].(map[string]any)
+	if debug["step"] != "charge_card" || !strings.Contains(body["detail"].(string), "connection refused") {
+		t.Fatalf("debug body = %v", body)
+	}
+}
+
+func TestFlowErrorResponse_ConfiguredStatus(t *testing.T) {
+	cfg, err := parseErrorResponseConfig(map[string]any{
+		"debug": "false",
+		"types": map[string]any{"transient": 503, "timeout": "504"},
+		"codes": map[string]any{"CARD_DECLINED": 402},
+	})
+	if err != nil {
+		t.Fatalf("parseErrorResponseConfig failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		fe   *FlowError
+		want int
+	}{
+		{&FlowError{Type: ErrorTypeTransient, Code: "UPSTREAM_DOWN"}, http.StatusServiceUnavailable},
+		{&FlowError{Type: ErrorTypeTransient, Code: "CARD_DECLINED"}, http.StatusPaymentRequired},
+		{&FlowError{Type: ErrorTypeTimeout, Code: "CARD_DECLINED", Status: http.StatusConflict}, http.StatusConflict},
+		{&FlowError{Type: ErrorTypeTimeout, Code: string(ErrorCodeDeadlineExceeded)}, http.StatusGatewayTimeout},
+		{&FlowError{Type: ErrorTypeClient, Code: "BAD_INPUT"}, http.StatusBadRequest},
+		{&FlowError{Type: ErrorTypePermanent, Code: "BUG", Status: 200}, http.StatusInternalServerError},
+	} {
+		if got := cfg.status(tt.fe); got != tt.want {
+			t.Errorf("status(%s/%s) = %d, want %d", tt.fe.Type, tt.fe.Code, got, tt.want)
+		}
+	}
+
+	for _, raw := range []map[string]any{
+		{"debug": "maybe"},
+		{"types": map[string]any{"fatal": 500}},
+		{"codes": map[string]any{"CARD_DECLINED": 302}},
+		{"verbose": true},
+	} {
+		if _, err := parseErrorResponseConfig(raw); err == nil {
+			t.Errorf("expected an error for %v", raw)
+		}
+	}
+}
+
+func TestFlowErrorToMap_IncludesMetaAndCauseChain(t *testing.T) {
+	child := &FlowError{Type: ErrorTypeTransient, Code: "UPSTREAM_DOWN", Message: "stripe unavailable", Cause: errors.New("EOF")}
+	fe := &FlowError{Type: ErrorTypeTransient, Code: "UPSTREAM_DOWN", Message: "flow charge: stripe unavailable", Cause: child}
+
+	m := fe.ToMap()
+	if meta, ok := m["meta"].(map[string]any); !ok || len(meta) != 0 {
+		t.Fatalf("meta = %#v, want an empty map", m["meta"])
+	}
+	cause, ok := m["cause"].(map[string]any)
+	if !ok || cause["message"] != "stripe unavailable" || cause["cause"] != "EOF" {
+		t.Fatalf("cause = %#v", m["cause"])
+	}
+}
+
+// upstreamError classifies itself like a plugin error type would.
+type upstreamError struct{ status int }
+
+func (e upstreamError) Error() string { return fmt.Sprintf("upstream answered %d", e.status) }
+
+func (e upstreamError) FlowError() *FlowError {
+	return &FlowError{Type: ErrorTypeTransient, Code: "UPSTREAM_UNAVAILABLE", Message: e.Error(), Meta: map[string]any{"upstream_status": e.status}}
+}
+
+// classifiedStepExecutor fails every attempt with err.
+type classifiedStepExecutor struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (s *classifiedStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	s.calls.Add(1)
+	return "", s.err
+}
+
+func TestClassifiedError_IsRetriedWithoutWhen(t *testing.T) {
+	wrapped := fmt.Errorf("charge: %w", upstreamError{status: 503})
+	stepExecutor := &classifiedStepExecutor{err: wrapped}
+	step := Step{ID: "charge", Retry: &RetryConfig{MaxAttempts: 3}}
+
+	_, err := runBreakerStep(t, NewContainer(NewLogger(nil)), stepExecutor, step)
+	fe, ok := err.(*FlowError)
+	if !ok || fe.Code != "UPSTREAM_UNAVAILABLE" || fe.Type != ErrorTypeTransient || fe.Meta["upstream_status"] != 503 {
+		t.Fatalf("error = %#v", err)
+	}
+	if got := stepExecutor.calls.Load(); got != 3 {
+		t.Fatalf("calls = %d, want 3 attempts", got)
+	}
+	if fe.Cause != wrapped {
+		t.Fatalf("cause = %v, want the returned error", fe.Cause)
+	}
+}
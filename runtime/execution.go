@@ -15,25 +15,29 @@ var _ context.Context = &Execution{}
 // ResponseDescriptor captures a response set by steps (YAML return or DSL response.*() calls).
 // The HTTP handler dispatches them to the appropriate ResponseHandler.
 type ResponseDescriptor struct {
-	HandlerName string         // e.g. "http.json"
-	Args        map[string]any // e.g. {status: 404, body: {...}}
+	HandlerName string         `json:"handler"` // e.g. "http.json"
+	Args        map[string]any `json:"args"`    // e.g. {status: 404, body: {...}}
 }
 
-// SuccessPath identifies which execution path (primary or fallback) succeeded for a step.
+// SuccessPath identifies which execution path (primary, fallback or catch) succeeded for a step.
 type SuccessPath string
 
 const (
 	SuccessPathPrimary  SuccessPath = "primary"
 	SuccessPathFallback SuccessPath = "fallback"
+	SuccessPathCatch    SuccessPath = "catch"
 )
 
 // CompensationEntry records a step that produced side-effects and must be undone
 // if a later step fails. The Path field indicates which branch succeeded so
 // compensation logic can apply the correct undo operation.
 type CompensationEntry struct {
-	StepID string
-	Body   string
-	Path   SuccessPath
+	StepID    string       `json:"step_id"`
+	Body      string       `json:"body"`
+	Path      SuccessPath  `json:"path"`
+	Iteration *Iteration   `json:"iteration,omitempty"` // for_each item the entry undoes; nil for plain steps
+	Retry     *RetryConfig `json:"retry,omitempty"`     // compensate(retry: ...) policy
+	Timeout   int          `json:"timeout,omitempty"`   // compensate(timeout: ...) in ms, covering all attempts
 }
 
 // RunState holds the shared mutable state for a flow execution.
@@ -44,6 +48,8 @@ type RunState struct {
 	store     ValueStore
 	response  *ResponseDescriptor
 	compStack []CompensationEntry
+	jump      string // step requested by next(), consumed after the current step
+	locals    map[any]any
 }
 
 // Store returns the underlying ValueStore.
@@ -72,6 +78,41 @@ func (s *RunState) AppendCompensation(entry CompensationEntry) {
 	s.compStack = append(s.compStack, entry)
 }
 
+// SetJump records the step the flow continues at once the current top-level
+// step completes. The last call wins. Thread-safe.
+func (s *RunState) SetJump(stepID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jump = stepID
+}
+
+// takeJump returns and clears the pending jump. Thread-safe.
+func (s *RunState) takeJump() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jump := s.jump
+	s.jump = ""
+	return jump
+}
+
+// Local returns the value kept under key for this execution, calling create
+// to make it on first use. Engines keep per-execution state here, such as
+// initialised modules. create runs with the state locked, so it must be cheap
+// and must not call back into the RunState. Thread-safe.
+func (s *RunState) Local(key any, create func() any) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.locals[key]
+	if !ok {
+		if s.locals == nil {
+			s.locals = make(map[any]any)
+		}
+		v = create()
+		s.locals[key] = v
+	}
+	return v
+}
+
 // CompensationSnapshot returns a copy of the compensation stack in current order.
 // The copy is safe to iterate while other code may still append. Thread-safe.
 func (s *RunState) CompensationSnapshot() []CompensationEntry {
@@ -90,13 +131,18 @@ func (s *RunState) CompensationSnapshot() []CompensationEntry {
 // WithActivePlugin to create a new scope without mutating the parent.
 type Execution struct {
 	ID           string
+	ParentID     string // execution that started this one via flow.call(); empty otherwise
+	RootID       string // outermost execution of a flow.call() chain; ID for root executions
 	Flow         *Flow
 	Container    *Container
 	ctx          context.Context // real context carrying deadline/cancellation
 	activeStepID string
 	activePath   SuccessPath
 	activePlugin string
-	state        *RunState // shared across all derived copies within one request
+	iteration    *Iteration
+	caught       *FlowError // error handled by the catch block in scope
+	state        *RunState  // shared across all derived copies within one request
+	depth        int        // flow.call() nesting level
 }
 
 // context.Context implementation — delegates to the embedded ctx so that real
@@ -168,6 +214,22 @@ func (e *Execution) WithActivePlugin(pluginName string) *Execution {
 	return &copy
 }
 
+// WithIteration returns a shallow copy scoped to one for_each item.
+// The item variables are layered over the store in Values().
+func (e *Execution) WithIteration(it *Iteration) *Execution {
+	copy := *e
+	copy.iteration = it
+	return &copy
+}
+
+// WithCaught returns a shallow copy in scope of fe: a catch block handling
+// it, or a retry `when:` deciding on it. Values() exposes it as `error`.
+func (e *Execution) WithCaught(fe *FlowError) *Execution {
+	copy := *e
+	copy.caught = fe
+	return &copy
+}
+
 func (e *Execution) AddValue(k string, v any) {
 	e.state.store.Set(k, v)
 }
@@ -207,21 +269,51 @@ func (e *Execution) ActivePath() SuccessPath {
 	return e.activePath
 }
 
+// Caught returns the error handled by the catch block in scope, or nil.
+func (e *Execution) Caught() *FlowError {
+	return e.caught
+}
+
+// Iteration returns the for_each item in scope, or nil.
+func (e *Execution) Iteration() *Iteration {
+	return e.iteration
+}
+
 // Values returns the full context map for expression evaluation.
+// Inside a for_each item the item variables shadow store keys, and the error
+// in scope (see WithCaught) shadows `error`. Neither touches the shared store,
+// so concurrent items and branches each see their own.
 func (e *Execution) Values() map[string]any {
-	return e.state.store.Snapshot()
+	values := e.state.store.Snapshot()
+	if e.iteration != nil {
+		for k, v := range e.iteration.vars() {
+			values[k] = v
+		}
+	}
+	if e.caught != nil {
+		values["error"] = e.caught.ToMap()
+	}
+	return values
 }
 
 func (e *Execution) observabilityAttrs() []slog.Attr {
 	attrs := []slog.Attr{
 		slog.String("execution_id", e.ID),
 	}
+	if e.ParentID != "" {
+		attrs = append(attrs,
+			slog.String("parent_execution_id", e.ParentID),
+			slog.String("root_execution_id", e.RootID))
+	}
 	if e.Flow != nil && e.Flow.ID != "" {
 		attrs = append(attrs, slog.String("flow_id", e.Flow.ID))
 	}
 	if e.activeStepID != "" {
 		attrs = append(attrs, slog.String("step_id", e.activeStepID))
 	}
+	if e.iteration != nil {
+		attrs = append(attrs, slog.Int("iteration", e.iteration.Index))
+	}
 	if e.activePlugin != "" {
 		attrs = append(attrs, slog.String("plugin", e.activePlugin))
 	}
@@ -235,6 +327,7 @@ func NewExecution(flow *Flow, container *Container, globalProperties map[string]
 	id := uuid.New().String()
 	exec := &Execution{
 		ID:        id,
+		RootID:    id,
 		Flow:      flow,
 		Container: container,
 		ctx:       context.Background(),
@@ -0,0 +1,371 @@
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Recovery policies for checkpointed flows, set with `recovery:` on the
+// entrypoint. They decide what happens on startup to executions a crash
+// left incomplete.
+const (
+	RecoveryResume     = "resume"     // continue after the last completed step
+	RecoveryCompensate = "compensate" // undo the completed steps
+)
+
+// ExecutionStatus is the final state recorded when a checkpointed execution ends.
+type ExecutionStatus string
+
+const (
+	ExecutionCompleted   ExecutionStatus = "completed"
+	ExecutionFailed      ExecutionStatus = "failed"
+	ExecutionCompensated ExecutionStatus = "compensated"
+)
+
+// Checkpoint is the persisted state of an execution after its last completed
+// step. Values must be JSON-serializable; numbers come back as float64.
+type Checkpoint struct {
+	ExecutionID   string              `json:"execution_id"`
+	FlowID        string              `json:"flow_id"`
+	Cursor        int                 `json:"cursor"`               // index of the next step to run
+	LastStep      string              `json:"last_step,omitempty"`  // ID of the last completed step
+	Values        map[string]any      `json:"values"`               // value store snapshot
+	Compensations []CompensationEntry `json:"compensations"`        // compensation stack, oldest first
+	Iterations    map[string]int      `json:"iterations,omitempty"` // backward jumps taken per step
+	Owner         string              `json:"owner,omitempty"`      // instance running the execution
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// DefaultInstanceLease is how long an instance counts as live after its last
+// heartbeat. The executions of an instance that stops heartbeating are
+// claimed by another one once the lease runs out.
+const DefaultInstanceLease = 30 * time.Second
+
+// ExecutionStore persists checkpoints of flows that set a recovery policy,
+// so executions interrupted by a crash can be resumed or compensated.
+type ExecutionStore interface {
+	// SaveCheckpoint creates or replaces the checkpoint of an execution.
+	// A checkpoint of an execution claimed by another instance is dropped, so
+	// an instance that outlived its lease cannot overwrite the new owner's.
+	SaveCheckpoint(ctx context.Context, cp *Checkpoint) error
+	// CompleteExecution records that an execution ended. It is no longer
+	// claimed by ClaimIncomplete; stores may delete it.
+	CompleteExecution(ctx context.Context, executionID string, status ExecutionStatus) error
+	// Heartbeat records that instance is live until the given time.
+	Heartbeat(ctx context.Context, instance string, until time.Time) error
+	// ClaimIncomplete makes owner the owner of the executions that have not
+	// completed and whose owner is not live, and returns them oldest first.
+	// Each execution is claimed by one instance only.
+	ClaimIncomplete(ctx context.Context, owner string) ([]*Checkpoint, error)
+}
+
+// checkpointer saves the state of one execution after each step. A nil
+// checkpointer (flow without recovery policy or no store) does nothing.
+type checkpointer struct {
+	store      ExecutionStore
+	execution  *Execution
+	iterations map[string]int
+}
+
+func newCheckpointer(execution *Execution, iterations map[string]int) *checkpointer {
+	// Subflows are part of their caller's step and are not checkpointed.
+	if execution.Flow == nil || execution.Flow.Recovery == "" || execution.ParentID != "" || execution.Container == nil {
+		return nil
+	}
+	store := execution.Container.ExecutionStore()
+	if store == nil {
+		return nil
+	}
+	return &checkpointer{store: store, execution: execution, iterations: iterations}
+}
+
+// save records that the execution continues at the step with index cursor.
+// Store failures are logged: the flow keeps running without durability
+// rather than failing on a store outage.
+func (c *checkpointer) save(cursor int, lastStep string) {
+	if c == nil {
+		return
+	}
+	state := c.execution.State()
+	cp := &Checkpoint{
+		ExecutionID:   c.execution.ID,
+		FlowID:        c.execution.Flow.ID,
+		Cursor:        cursor,
+		LastStep:      lastStep,
+		Values:        checkpointValues(state.Store()),
+		Compensations: state.CompensationSnapshot(),
+		Iterations:    c.iterations,
+		Owner:         c.execution.Container.InstanceID(),
+		UpdatedAt:     time.Now().UTC(),
+	}
+	if err := c.store.SaveCheckpoint(context.WithoutCancel(c.execution), cp); err != nil {
+		c.execution.Logger().Error("Saving execution checkpoint failed", "cursor", cursor, "error", err)
+	}
+}
+
+// checkpointValues is the value store snapshot a checkpoint persists. Request
+// headers and the raw body are left out: they carry credentials such as
+// Authorization and Cookie, and stores write values in plain text. A resumed
+// execution sees no headers.
+func checkpointValues(store ValueStore) map[string]any {
+	values := store.Snapshot()
+	if request, ok := values["request"].(map[string]any); ok {
+		request[HeadersKey] = map[string]any{}
+		delete(request, strings.TrimPrefix(RequestRawBodyKey, "request."))
+	}
+	return values
+}
+
+func (c *checkpointer) finish(status ExecutionStatus) {
+	if c == nil {
+		return
+	}
+	if err := c.store.CompleteExecution(context.WithoutCancel(c.execution), c.execution.ID, status); err != nil {
+		c.execution.Logger().Error("Completing execution checkpoint failed", "status", status, "error", err)
+	}
+}
+
+// FileExecutionStore keeps one JSON file per incomplete execution in a
+// directory. Files are replaced atomically and removed on completion.
+// Async execution records are kept in its records/ subdirectory and instance
+// heartbeats in instances/. Claims are not atomic across processes, so a
+// directory must not be shared by several instances; use SQLExecutionStore
+// for replicas.
+type FileExecutionStore struct {
+	dir string
+}
+
+// NewFileExecutionStore creates the directory if needed.
+func NewFileExecutionStore(dir string) (*FileExecutionStore, error) {
+	for _, sub := range []string{fileRecordsDir, fileInstancesDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("creating execution store directory: %w", err)
+		}
+	}
+	return &FileExecutionStore{dir: dir}, nil
+}
+
+const (
+	fileRecordsDir   = "records"
+	fileInstancesDir = "instances"
+)
+
+func (s *FileExecutionStore) SaveCheckpoint(_ context.Context, cp *Checkpoint) error {
+	path, err := storeFilePath(s.dir, cp.ExecutionID)
+	if err != nil {
+		return err
+	}
+	if prior, err := readCheckpoint(path); err == nil && prior.Owner != "" && prior.Owner != cp.Owner {
+		return nil
+	}
+	return writeCheckpoint(path, cp)
+}
+
+func readCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("decoding checkpoint %s: %w", path, err)
+	}
+	return &cp, nil
+}
+
+func writeCheckpoint(path string, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces path so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileExecutionStore) CompleteExecution(_ context.Context, executionID string, _ ExecutionStatus) error {
+	path, err := storeFilePath(s.dir, executionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileExecutionStore) Heartbeat(_ context.Context, instance string, until time.Time) error {
+	path, err := storeFilePath(filepath.Join(s.dir, fileInstancesDir), instance)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(map[string]time.Time{"lease_until": until.UTC()})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// liveInstances returns the instances whose lease has not run out. Expired
+// heartbeat files are removed.
+func (s *FileExecutionStore) liveInstances(now time.Time) (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, fileInstancesDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[string]bool, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var lease struct {
+			LeaseUntil time.Time `json:"lease_until"`
+		}
+		if err := json.Unmarshal(data, &lease); err != nil {
+			return nil, fmt.Errorf("decoding heartbeat %s: %w", file, err)
+		}
+		if now.Before(lease.LeaseUntil) {
+			live[strings.TrimSuffix(filepath.Base(file), ".json")] = true
+		} else {
+			os.Remove(file)
+		}
+	}
+	return live, nil
+}
+
+func (s *FileExecutionStore) ClaimIncomplete(_ context.Context, owner string) ([]*Checkpoint, error) {
+	live, err := s.liveInstances(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := make([]*Checkpoint, 0, len(files))
+	for _, file := range files {
+		cp, err := readCheckpoint(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // completed meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if live[cp.Owner] {
+			continue
+		}
+		cp.Owner = owner
+		if err := writeCheckpoint(file, cp); err != nil {
+			return nil, err
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].UpdatedAt.Before(checkpoints[j].UpdatedAt)
+	})
+	return checkpoints, nil
+}
+
+func (s *FileExecutionStore) SaveRecord(_ context.Context, record *ExecutionRecord) error {
+	path, err := storeFilePath(filepath.Join(s.dir, fileRecordsDir), record.ExecutionID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encoding execution record: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+func (s *FileExecutionStore) GetRecord(_ context.Context, executionID string) (*ExecutionRecord, error) {
+	path, err := storeFilePath(filepath.Join(s.dir, fileRecordsDir), executionID)
+	if err != nil {
+		// Not a valid ID, so no such execution.
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record ExecutionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("decoding execution record %s: %w", path, err)
+	}
+	return &record, nil
+}
+
+func (s *FileExecutionStore) ClaimPending(ctx context.Context, owner string) ([]*ExecutionRecord, error) {
+	live, err := s.liveInstances(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(s.dir, fileRecordsDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var pending []*ExecutionRecord
+	for _, file := range files {
+		id := strings.TrimSuffix(filepath.Base(file), ".json")
+		record, err := s.GetRecord(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if record == nil || (record.Status != RecordQueued && record.Status != RecordRunning) {
+			continue
+		}
+		if live[record.Owner] {
+			continue
+		}
+		// Executions with a checkpoint are claimed through ClaimIncomplete.
+		if _, err := os.Stat(filepath.Join(s.dir, id+".json")); err == nil {
+			continue
+		}
+		record.Owner = owner
+		if err := s.SaveRecord(ctx, record); err != nil {
+			return nil, err
+		}
+		pending = append(pending, record)
+	}
+	return pending, nil
+}
+
+func storeFilePath(dir, executionID string) (string, error) {
+	if executionID == "" || strings.ContainsAny(executionID, `/\`) || strings.HasPrefix(executionID, ".") {
+		return "", fmt.Errorf("invalid execution ID %q", executionID)
+	}
+	return filepath.Join(dir, executionID+".json"), nil
+}
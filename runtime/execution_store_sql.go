@@ -0,0 +1,274 @@
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SQLDialect selects the SQL flavour of a SQLExecutionStore.
+type SQLDialect string
+
+const (
+	SQLDialectPostgres SQLDialect = "postgres"
+	SQLDialectSQLite   SQLDialect = "sqlite"
+)
+
+// DefaultExecutionTable is the table SQLExecutionStore uses unless told otherwise.
+const DefaultExecutionTable = "sflowg_executions"
+
+// DefaultExecutionRecordTable holds the status of async executions.
+const DefaultExecutionRecordTable = "sflowg_execution_records"
+
+// DefaultInstanceTable holds the heartbeats of the instances sharing the store.
+const DefaultInstanceTable = "sflowg_instances"
+
+// SQLExecutionStore keeps checkpoints in a SQL table, one row per incomplete
+// execution. It works with any database/sql driver for the chosen dialect;
+// the application imports the driver (e.g. lib/pq, modernc.org/sqlite).
+type SQLExecutionStore struct {
+	db            *sql.DB
+	dialect       SQLDialect
+	table         string
+	recordTable   string
+	instanceTable string
+}
+
+// NewSQLExecutionStore uses DefaultExecutionTable. Call EnsureSchema once
+// at startup to create the table.
+func NewSQLExecutionStore(db *sql.DB, dialect SQLDialect) *SQLExecutionStore {
+	return &SQLExecutionStore{
+		db:            db,
+		dialect:       dialect,
+		table:         DefaultExecutionTable,
+		recordTable:   DefaultExecutionRecordTable,
+		instanceTable: DefaultInstanceTable,
+	}
+}
+
+// EnsureSchema creates the checkpoint, execution record and instance tables
+// if they do not exist, and adds the owner column to tables created by
+// earlier versions.
+func (s *SQLExecutionStore) EnsureSchema(ctx context.Context) error {
+	var checkpoints, records, instances string
+	switch s.dialect {
+	case SQLDialectPostgres:
+		checkpoints = `CREATE TABLE IF NOT EXISTS %s (
+			execution_id TEXT PRIMARY KEY,
+			flow_id      TEXT NOT NULL,
+			checkpoint   JSONB NOT NULL,
+			owner        TEXT,
+			updated_at   TIMESTAMPTZ NOT NULL
+		)`
+		records = `CREATE TABLE IF NOT EXISTS %s (
+			execution_id TEXT PRIMARY KEY,
+			flow_id      TEXT NOT NULL,
+			status       TEXT NOT NULL,
+			record       JSONB NOT NULL,
+			owner        TEXT,
+			updated_at   TIMESTAMPTZ NOT NULL
+		)`
+		instances = `CREATE TABLE IF NOT EXISTS %s (
+			instance_id TEXT PRIMARY KEY,
+			lease_until TIMESTAMPTZ NOT NULL
+		)`
+	case SQLDialectSQLite:
+		checkpoints = `CREATE TABLE IF NOT EXISTS %s (
+			execution_id TEXT PRIMARY KEY,
+			flow_id      TEXT NOT NULL,
+			checkpoint   TEXT NOT NULL,
+			owner        TEXT,
+			updated_at   TIMESTAMP NOT NULL
+		)`
+		records = `CREATE TABLE IF NOT EXISTS %s (
+			execution_id TEXT PRIMARY KEY,
+			flow_id      TEXT NOT NULL,
+			status       TEXT NOT NULL,
+			record       TEXT NOT NULL,
+			owner        TEXT,
+			updated_at   TIMESTAMP NOT NULL
+		)`
+		instances = `CREATE TABLE IF NOT EXISTS %s (
+			instance_id TEXT PRIMARY KEY,
+			lease_until TIMESTAMP NOT NULL
+		)`
+	default:
+		return fmt.Errorf("unsupported SQL dialect %q", s.dialect)
+	}
+	for _, t := range []struct{ name, ddl string }{{s.table, checkpoints}, {s.recordTable, records}, {s.instanceTable, instances}} {
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(t.ddl, t.name)); err != nil {
+			return fmt.Errorf("creating %s: %w", t.name, err)
+		}
+	}
+	for _, table := range []string{s.table, s.recordTable} {
+		if err := s.ensureOwnerColumn(ctx, table); err != nil {
+			return fmt.Errorf("adding owner to %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLExecutionStore) ensureOwnerColumn(ctx context.Context, table string) error {
+	if s.dialect == SQLDialectPostgres {
+		_, err := s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS owner TEXT`, table))
+		return err
+	}
+	// SQLite has no ADD COLUMN IF NOT EXISTS.
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = 'owner'`, table).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN owner TEXT`, table))
+	return err
+}
+
+func (s *SQLExecutionStore) SaveCheckpoint(ctx context.Context, cp *Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+	query := rebind(s.dialect, fmt.Sprintf(`INSERT INTO %[1]s (execution_id, flow_id, checkpoint, owner, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (execution_id) DO UPDATE
+		SET checkpoint = excluded.checkpoint, owner = excluded.owner, updated_at = excluded.updated_at
+		WHERE %[1]s.owner IS NULL OR %[1]s.owner = excluded.owner`, s.table))
+	_, err = s.db.ExecContext(ctx, query, cp.ExecutionID, cp.FlowID, string(data), nullString(cp.Owner), cp.UpdatedAt)
+	return err
+}
+
+func (s *SQLExecutionStore) CompleteExecution(ctx context.Context, executionID string, _ ExecutionStatus) error {
+	query := rebind(s.dialect, fmt.Sprintf(`DELETE FROM %s WHERE execution_id = ?`, s.table))
+	_, err := s.db.ExecContext(ctx, query, executionID)
+	return err
+}
+
+// instanceHistory is how long heartbeats of stopped instances are kept.
+const instanceHistory = 24 * time.Hour
+
+func (s *SQLExecutionStore) Heartbeat(ctx context.Context, instance string, until time.Time) error {
+	query := rebind(s.dialect, fmt.Sprintf(`INSERT INTO %s (instance_id, lease_until) VALUES (?, ?)
+		ON CONFLICT (instance_id) DO UPDATE SET lease_until = excluded.lease_until`, s.instanceTable))
+	if _, err := s.db.ExecContext(ctx, query, instance, until.UTC()); err != nil {
+		return err
+	}
+	query = rebind(s.dialect, fmt.Sprintf(`DELETE FROM %s WHERE lease_until < ?`, s.instanceTable))
+	_, err := s.db.ExecContext(ctx, query, time.Now().UTC().Add(-instanceHistory))
+	return err
+}
+
+// ClaimIncomplete claims rows in a single UPDATE: a concurrent claim of the
+// same row waits for it and then sees the new, live owner.
+func (s *SQLExecutionStore) ClaimIncomplete(ctx context.Context, owner string) ([]*Checkpoint, error) {
+	query := rebind(s.dialect, fmt.Sprintf(`UPDATE %s SET owner = ?
+		WHERE owner IS NULL OR owner NOT IN (SELECT instance_id FROM %s WHERE lease_until > ?)
+		RETURNING checkpoint`, s.table, s.instanceTable))
+	rows, err := s.db.QueryContext(ctx, query, owner, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checkpoints []*Checkpoint
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var cp Checkpoint
+		if err := json.Unmarshal(data, &cp); err != nil {
+			return nil, fmt.Errorf("decoding checkpoint: %w", err)
+		}
+		cp.Owner = owner
+		checkpoints = append(checkpoints, &cp)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].UpdatedAt.Before(checkpoints[j].UpdatedAt)
+	})
+	return checkpoints, rows.Err()
+}
+
+func (s *SQLExecutionStore) SaveRecord(ctx context.Context, record *ExecutionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encoding execution record: %w", err)
+	}
+	query := rebind(s.dialect, fmt.Sprintf(`INSERT INTO %s (execution_id, flow_id, status, record, owner, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (execution_id) DO UPDATE
+		SET status = excluded.status, record = excluded.record, owner = excluded.owner, updated_at = excluded.updated_at`, s.recordTable))
+	_, err = s.db.ExecContext(ctx, query, record.ExecutionID, record.FlowID, record.Status, string(data), nullString(record.Owner), record.UpdatedAt)
+	return err
+}
+
+func (s *SQLExecutionStore) GetRecord(ctx context.Context, executionID string) (*ExecutionRecord, error) {
+	query := rebind(s.dialect, fmt.Sprintf(`SELECT record FROM %s WHERE execution_id = ?`, s.recordTable))
+	var data []byte
+	err := s.db.QueryRowContext(ctx, query, executionID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record ExecutionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("decoding execution record: %w", err)
+	}
+	return &record, nil
+}
+
+func (s *SQLExecutionStore) ClaimPending(ctx context.Context, owner string) ([]*ExecutionRecord, error) {
+	query := rebind(s.dialect, fmt.Sprintf(`UPDATE %s SET owner = ?
+		WHERE status IN (?, ?)
+		AND (owner IS NULL OR owner NOT IN (SELECT instance_id FROM %s WHERE lease_until > ?))
+		AND execution_id NOT IN (SELECT execution_id FROM %s)
+		RETURNING record`, s.recordTable, s.instanceTable, s.table))
+	rows, err := s.db.QueryContext(ctx, query, owner, RecordQueued, RecordRunning, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []*ExecutionRecord
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var record ExecutionRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("decoding execution record: %w", err)
+		}
+		record.Owner = owner
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// rebind rewrites ? placeholders to $n for Postgres.
+func rebind(dialect SQLDialect, query string) string {
+	if dialect != SQLDialectPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
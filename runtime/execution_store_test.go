@@ -0,0 +1,298 @@
+package runtime
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryExecutionStore keeps checkpoints in memory and records every save.
+type memoryExecutionStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]*Checkpoint
+	cursors     []int
+	statuses    map[string]ExecutionStatus
+}
+
+func newMemoryExecutionStore() *memoryExecutionStore {
+	return &memoryExecutionStore{checkpoints: map[string]*Checkpoint{}, statuses: map[string]ExecutionStatus{}}
+}
+
+func (s *memoryExecutionStore) SaveCheckpoint(_ context.Context, cp *Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[cp.ExecutionID] = cp
+	s.cursors = append(s.cursors, cp.Cursor)
+	return nil
+}
+
+func (s *memoryExecutionStore) CompleteExecution(_ context.Context, executionID string, status ExecutionStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.checkpoints, executionID)
+	s.statuses[executionID] = status
+	return nil
+}
+
+func (s *memoryExecutionStore) Heartbeat(_ context.Context, _ string, _ time.Time) error {
+	return nil
+}
+
+// ClaimIncomplete treats every other owner as stopped.
+func (s *memoryExecutionStore) ClaimIncomplete(_ context.Context, owner string) ([]*Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []*Checkpoint
+	for _, cp := range s.checkpoints {
+		if cp.Owner != owner {
+			cp.Owner = owner
+			list = append(list, cp)
+		}
+	}
+	return list, nil
+}
+
+// durableStepExecutor records the steps and compensations it runs. Each step
+// stores "done" under its ID; a step whose body is "fail" fails.
+type durableStepExecutor struct {
+	mu          sync.Mutex
+	ran         []string
+	compensated []string
+}
+
+func (s *durableStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	s.mu.Lock()
+	s.ran = append(s.ran, step.ID)
+	s.mu.Unlock()
+	if step.Body == "fail" {
+		return "", &FlowError{Type: ErrorTypePermanent, Code: "FAILED", Message: "failed", Step: step.ID}
+	}
+	execution.AddValue(step.ID, "done")
+	return "", nil
+}
+
+func (s *durableStepExecutor) ExecuteOnErrorHandler(execution *Execution, body string, fe *FlowError) error {
+	return nil
+}
+
+func (s *durableStepExecutor) ExecuteCompensation(execution *Execution, body string, stepID string, path SuccessPath) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compensated = append(s.compensated, stepID)
+	return nil
+}
+
+func newDurableContainer(store ExecutionStore) *Container {
+	container := NewContainer(NewLogger(nil))
+	container.SetExecutionStore(store)
+	return container
+}
+
+func TestFileExecutionStore_RoundTrip(t *testing.T) {
+	store, err := NewFileExecutionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	older := &Checkpoint{ExecutionID: "exec-1", FlowID: "orders", Cursor: 2, LastStep: "charge",
+		Values: map[string]any{"charge": map[string]any{"id": "ch_1"}}, UpdatedAt: time.Unix(100, 0).UTC()}
+	newer := &Checkpoint{ExecutionID: "exec-2", FlowID: "orders", Cursor: 1, UpdatedAt: time.Unix(200, 0).UTC(),
+		Compensations: []CompensationEntry{{StepID: "reserve", Body: "release()", Path: SuccessPathPrimary}}}
+	for _, cp := range []*Checkpoint{newer, older} {
+		if err := store.SaveCheckpoint(ctx, cp); err != nil {
+			t.Fatalf("SaveCheckpoint: %v", err)
+		}
+	}
+
+	list, err := store.ClaimIncomplete(ctx, "instance-1")
+	if err != nil {
+		t.Fatalf("ClaimIncomplete: %v", err)
+	}
+	older.Owner, newer.Owner = "instance-1", "instance-1"
+	if len(list) != 2 || !reflect.DeepEqual(list[0], older) || !reflect.DeepEqual(list[1], newer) {
+		t.Fatalf("ClaimIncomplete = %+v, want oldest first", list)
+	}
+
+	if err := store.CompleteExecution(ctx, "exec-1", ExecutionCompleted); err != nil {
+		t.Fatalf("CompleteExecution: %v", err)
+	}
+	list, _ = store.ClaimIncomplete(ctx, "instance-1")
+	if len(list) != 1 || list[0].ExecutionID != "exec-2" {
+		t.Fatalf("after completion: %+v", list)
+	}
+
+	if err := store.SaveCheckpoint(ctx, &Checkpoint{ExecutionID: "../escape"}); err == nil {
+		t.Fatal("expected an error for an execution ID with a path separator")
+	}
+}
+
+func TestFileExecutionStore_ClaimsFromStoppedInstancesOnly(t *testing.T) {
+	store, err := NewFileExecutionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	store.Heartbeat(ctx, "a", time.Now().Add(time.Minute))
+	store.Heartbeat(ctx, "b", time.Now().Add(time.Minute))
+	store.SaveCheckpoint(ctx, &Checkpoint{ExecutionID: "exec-1", FlowID: "orders", Cursor: 1, Owner: "a"})
+
+	if list, _ := store.ClaimIncomplete(ctx, "b"); len(list) != 0 {
+		t.Fatalf("claimed %+v from a live instance", list)
+	}
+
+	// a stops heartbeating.
+	store.Heartbeat(ctx, "a", time.Now().Add(-time.Second))
+	list, err := store.ClaimIncomplete(ctx, "b")
+	if err != nil || len(list) != 1 || list[0].Owner != "b" {
+		t.Fatalf("ClaimIncomplete = %+v, %v", list, err)
+	}
+	if list, _ := store.ClaimIncomplete(ctx, "c"); len(list) != 0 {
+		t.Fatalf("claimed %+v twice", list)
+	}
+
+	// A late checkpoint from a does not overwrite b's.
+	store.SaveCheckpoint(ctx, &Checkpoint{ExecutionID: "exec-1", FlowID: "orders", Cursor: 5, Owner: "a"})
+	store.Heartbeat(ctx, "b", time.Now().Add(-time.Second))
+	list, _ = store.ClaimIncomplete(ctx, "c")
+	if len(list) != 1 || list[0].Cursor != 1 {
+		t.Fatalf("checkpoint = %+v, want b's cursor 1", list)
+	}
+}
+
+func TestExecuteSteps_CheckpointsAfterEachStep(t *testing.T) {
+	store := newMemoryExecutionStore()
+	flow := &Flow{ID: "orders", Recovery: RecoveryResume, Steps: []Step{
+		{ID: "reserve", CompensateBody: "release"},
+		{ID: "charge"},
+	}}
+	execution := NewExecution(flow, newDurableContainer(store), nil, NewValueStore())
+
+	if err := NewExecutor(lookupEvaluator{}, &durableStepExecutor{}).ExecuteSteps(execution); err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	if want := []int{0, 1, 2}; !reflect.DeepEqual(store.cursors, want) {
+		t.Fatalf("checkpoint cursors = %v, want %v", store.cursors, want)
+	}
+	if store.statuses[execution.ID] != ExecutionCompleted {
+		t.Fatalf("status = %q, want completed", store.statuses[execution.ID])
+	}
+	if len(store.checkpoints) != 0 {
+		t.Fatal("completed executions must not stay incomplete")
+	}
+}
+
+func TestCheckpoint_LeavesOutRequestHeadersAndRawBody(t *testing.T) {
+	store := newMemoryExecutionStore()
+	flow := &Flow{ID: "orders", Recovery: RecoveryResume}
+	execution := NewExecution(flow, newDurableContainer(store), nil, NewValueStore())
+	execution.AddValue("request.headers.authorization", "Bearer secret")
+	execution.AddValue(RequestRawBodyKey, `{"id":"o1"}`)
+	execution.AddValue("request.body.id", "o1")
+
+	newCheckpointer(execution, nil).save(0, "")
+	values := store.checkpoints[execution.ID].Values
+	want := map[string]any{"headers": map[string]any{}, "body": map[string]any{"id": "o1"}}
+	if !reflect.DeepEqual(values["request"], want) {
+		t.Fatalf("checkpointed request = %#v, want %#v", values["request"], want)
+	}
+	// The running execution keeps them.
+	if v, _ := execution.State().Store().Get("request.headers.authorization"); v != "Bearer secret" {
+		t.Fatalf("authorization header = %v", v)
+	}
+}
+
+func TestExecuteSteps_FailedExecutionIsCompleted(t *testing.T) {
+	store := newMemoryExecutionStore()
+	flow := &Flow{ID: "orders", Recovery: RecoveryResume, Steps: []Step{{ID: "charge", Body: "fail"}}}
+	execution := NewExecution(flow, newDurableContainer(store), nil, NewValueStore())
+
+	if err := NewExecutor(lookupEvaluator{}, &durableStepExecutor{}).ExecuteSteps(execution); err == nil {
+		t.Fatal("expected the flow to fail")
+	}
+	if store.statuses[execution.ID] != ExecutionFailed {
+		t.Fatalf("status = %q, want failed", store.statuses[execution.ID])
+	}
+}
+
+func TestExecuteSteps_SubflowsAreNotCheckpointed(t *testing.T) {
+	store := newMemoryExecutionStore()
+	flow := &Flow{ID: "child", Recovery: RecoveryResume, Steps: []Step{{ID: "load"}}}
+	execution := NewExecution(flow, newDurableContainer(store), nil, NewValueStore())
+	execution.ParentID = "parent"
+
+	if err := NewExecutor(lookupEvaluator{}, &durableStepExecutor{}).ExecuteSteps(execution); err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	if len(store.cursors) != 0 || len(store.statuses) != 0 {
+		t.Fatalf("subflow was checkpointed: %v %v", store.cursors, store.statuses)
+	}
+}
+
+func TestResume_ContinuesAfterLastCompletedStep(t *testing.T) {
+	store := newMemoryExecutionStore()
+	container := newDurableContainer(store)
+	flow := &Flow{ID: "orders", Recovery: RecoveryResume, Steps: []Step{{ID: "reserve"}, {ID: "charge"}, {ID: "ship"}}}
+	cp := &Checkpoint{ExecutionID: "exec-1", FlowID: "orders", Cursor: 1, LastStep: "reserve",
+		Values: map[string]any{"reserve": "done"}}
+
+	execution := RestoreExecution(flow, container, nil, NewValueStore(), cp)
+	stepExecutor := &durableStepExecutor{}
+	if err := NewExecutor(lookupEvaluator{}, stepExecutor).Resume(execution, cp); err != nil {
+		t.Fatalf("Resume failed: %v", err)
+	}
+	if want := []string{"charge", "ship"}; !reflect.DeepEqual(stepExecutor.ran, want) {
+		t.Fatalf("ran %v, want %v", stepExecutor.ran, want)
+	}
+	if got := execution.Values()["reserve"]; got != "done" {
+		t.Fatalf("restored value reserve = %v", got)
+	}
+	if store.statuses["exec-1"] != ExecutionCompleted {
+		t.Fatalf("status = %q, want completed", store.statuses["exec-1"])
+	}
+}
+
+func TestRecoverExecutions_AppliesFlowPolicy(t *testing.T) {
+	store := newMemoryExecutionStore()
+	ctx := context.Background()
+	store.SaveCheckpoint(ctx, &Checkpoint{ExecutionID: "resume-1", FlowID: "orders", Cursor: 1,
+		Values: map[string]any{"reserve": "done"}})
+	store.SaveCheckpoint(ctx, &Checkpoint{ExecutionID: "undo-1", FlowID: "refunds", Cursor: 1,
+		Compensations: []CompensationEntry{{StepID: "debit", Body: "credit", Path: SuccessPathPrimary}}})
+	store.SaveCheckpoint(ctx, &Checkpoint{ExecutionID: "gone-1", FlowID: "removed"})
+
+	stepExecutor := &durableStepExecutor{}
+	app := NewApp(newDurableContainer(store), nil, lookupEvaluator{}, stepExecutor, newTestValueStore)
+	flows := map[string]*Flow{
+		"orders":  {ID: "orders", Recovery: RecoveryResume, Steps: []Step{{ID: "reserve"}, {ID: "ship"}}},
+		"refunds": {ID: "refunds", Recovery: RecoveryCompensate, Steps: []Step{{ID: "debit"}, {ID: "notify"}}},
+	}
+	if err := app.recoverExecutions(ctx, NewExecutor(lookupEvaluator{}, stepExecutor), flows); err != nil {
+		t.Fatalf("recoverExecutions failed: %v", err)
+	}
+	app.recoveries.Wait()
+
+	if want := []string{"ship"}; !reflect.DeepEqual(stepExecutor.ran, want) {
+		t.Errorf("ran %v, want %v", stepExecutor.ran, want)
+	}
+	if want := []string{"debit"}; !reflect.DeepEqual(stepExecutor.compensated, want) {
+		t.Errorf("compensated %v, want %v", stepExecutor.compensated, want)
+	}
+	want := map[string]ExecutionStatus{
+		"resume-1": ExecutionCompleted,
+		"undo-1":   ExecutionCompensated,
+		"gone-1":   ExecutionFailed,
+	}
+	if !reflect.DeepEqual(store.statuses, want) {
+		t.Errorf("statuses = %v, want %v", store.statuses, want)
+	}
+}
+
+func TestCheckRecovery_RequiresExecutionStore(t *testing.T) {
+	app := NewApp(NewContainer(NewLogger(nil)), nil, lookupEvaluator{}, &durableStepExecutor{}, newTestValueStore)
+	flows := map[string]*Flow{"orders": {ID: "orders", Recovery: RecoveryResume}}
+	if err := app.checkRecovery(flows); err == nil {
+		t.Fatal("expected an error without an execution store")
+	}
+}
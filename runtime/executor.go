@@ -40,100 +40,176 @@ func NewExecutor(evaluator ExpressionEvaluator, stepExecutor StepExecutor) *Exec
 // ExecuteSteps runs all steps in the flow for the given execution.
 // The *Execution carries its own context (set by the HTTP handler with any
 // flow-level timeout), so no separate ctx parameter is needed.
+// After each step, next() or the step's `next:` option may move the flow to
+// another step; backward jumps are bounded by the step's max_iterations.
+// Flows with a recovery policy are checkpointed after every step.
 func (e *Executor) ExecuteSteps(execution *Execution) error {
+	return e.executeFrom(execution, 0, make(map[string]int))
+}
+
+// executeFrom runs the flow starting at the step with index start.
+func (e *Executor) executeFrom(execution *Execution, start int, iterations map[string]int) error {
+	cp := newCheckpointer(execution, iterations)
+	cp.save(start, "")
+
+	err := e.runSteps(execution, start, iterations, cp)
+	if err != nil {
+		cp.finish(ExecutionFailed)
+	} else {
+		cp.finish(ExecutionCompleted)
+	}
+	return err
+}
+
+func (e *Executor) runSteps(execution *Execution, start int, iterations map[string]int, cp *checkpointer) error {
 	log := execution.Logger()
-	nextStep := ""
+	steps := execution.Flow.Steps
+
+	for i := start; i < len(steps); {
+		s := steps[i]
 
-	for _, s := range execution.Flow.Steps {
 		// Check context before starting each step.
 		if err := execution.Err(); err != nil {
 			fe := e.flowError(execution, s.ID, err)
-			return e.handleFailure(execution, fe)
+			return e.HandleFailure(execution, fe)
 		}
 
-		// Step sequencing / branching.
-		if nextStep != "" {
-			if s.ID != nextStep {
-				log.Info(fmt.Sprintf("Skipping step: %s", s.ID))
-				continue
-			}
-			nextStep = ""
-			log.Info(fmt.Sprintf("Resuming flow at step: %s", s.ID))
+		// A jump requested by a step that then failed must not leak.
+		execution.State().takeJump()
+		skipped, fe := e.runStep(execution, s)
+		if fe != nil {
+			return e.HandleFailure(execution, fe)
 		}
-
-		// Step condition guard.
-		if skip, err := e.evaluateCondition(execution, s); err != nil {
-			fe := toFlowError(err, s.ID, 0)
-			return e.handleFailure(execution, fe)
-		} else if skip {
-			log.Info(fmt.Sprintf("Skipping step (condition false): %s", s.ID))
+		if skipped {
+			i++
 			continue
 		}
 
-		// --- Primary body with retries ---
-		fe := e.executeStepWithRetries(execution, s, SuccessPathPrimary)
-
-		if fe == nil {
-			// Primary succeeded.
-			if s.CompensateBody != "" {
-				execution.State().AppendCompensation(CompensationEntry{
-					StepID: s.ID,
-					Body:   s.CompensateBody,
-					Path:   SuccessPathPrimary,
-				})
-			}
-		} else {
-			// Primary failed — try fallback if available.
-			if s.FallbackBody != "" {
-				log.Info(fmt.Sprintf("Primary failed for step %s, trying fallback", s.ID))
-				fbStep := s
-				fbStep.Body = s.FallbackBody
-				fbStep.Retry = nil // fallback has no retry policy
-				fbFE := e.executeStepWithRetries(execution, fbStep, SuccessPathFallback)
-
-				if fbFE == nil {
-					// Fallback succeeded — store its result under the original step ID
-					// so downstream steps and compensation code use a stable key.
-					if s.CompensateBody != "" {
-						execution.State().AppendCompensation(CompensationEntry{
-							StepID: s.ID,
-							Body:   s.CompensateBody,
-							Path:   SuccessPathFallback,
-						})
-					}
-					fe = nil // mark as success
-				} else {
-					// Both primary and fallback failed.
-					log.Error(fmt.Sprintf("Fallback also failed for step %s", s.ID), "error", fbFE)
-					return e.handleFailure(execution, fbFE)
-				}
-			} else {
-				// No fallback — propagate error.
-				return e.handleFailure(execution, fe)
-			}
-		}
-
 		// Early exit if a step set a response.
 		if execution.State().Response() != nil {
 			log.Info(fmt.Sprintf("Response produced at step: %s", s.ID))
 			break
 		}
 
-		if next := execution.Value(s.ID + ".__next"); next != nil {
-			nextStep = fmt.Sprintf("%v", next)
+		target, fe := e.resolveNext(execution, s)
+		if fe != nil {
+			return e.HandleFailure(execution, fe)
+		}
+		if target == "" {
+			i++
+		} else {
+			next, fe := jumpTo(execution, i, target, iterations)
+			if fe != nil {
+				return e.HandleFailure(execution, fe)
+			}
+			log.Info(fmt.Sprintf("Continuing at step %s (from %s)", target, s.ID))
+			i = next
+		}
+		cp.save(i, s.ID)
+	}
+
+	return nil
+}
+
+// runStep evaluates the step condition, then runs the step as a parallel
+// group, a for_each fan-out or a single body.
+// Returns skipped=true when the condition is false.
+func (e *Executor) runStep(execution *Execution, s Step) (skipped bool, fe *FlowError) {
+	log := execution.Logger()
+
+	// Step condition guard.
+	if skip, err := e.evaluateCondition(execution, s); err != nil {
+		return false, toFlowError(err, s.ID, 0)
+	} else if skip {
+		log.Info(fmt.Sprintf("Skipping step (condition false): %s", s.ID))
+		return true, nil
+	}
+
+	switch {
+	case s.Parallel != nil:
+		return false, e.executeParallel(execution, s)
+	case s.ForEach != nil:
+		return false, e.executeForEach(execution, s)
+	default:
+		return false, e.runBody(execution, s)
+	}
+}
+
+// runBody runs the primary body with retries. If the primary failed, the
+// first catch block matching the error runs, else the fallback body.
+// On success of the primary or fallback the compensate body, if any, is
+// pushed onto the compensation stack together with the for_each item in scope.
+func (e *Executor) runBody(execution *Execution, s Step) *FlowError {
+	log := execution.Logger()
+
+	// --- Primary body with retries ---
+	fe := e.executeStepWithRetries(execution, s, SuccessPathPrimary)
+	path := SuccessPathPrimary
+
+	if fe != nil {
+		if i := slices.IndexFunc(s.Catches, func(c CatchBlock) bool { return c.Matches(fe) }); i >= 0 {
+			return e.runCatch(execution, s, s.Catches[i], fe)
 		}
+		// Primary failed — try fallback if available.
+		if s.FallbackBody == "" {
+			// No fallback — propagate error.
+			return fe
+		}
+		log.Info(fmt.Sprintf("Primary failed for step %s, trying fallback", s.ID))
+		fbStep := s
+		fbStep.Body = s.FallbackBody
+		fbStep.Retry = nil          // fallback has no retry policy
+		fbStep.CircuitBreaker = nil // nor a circuit breaker
+		fbStep.Bulkhead = nil
+		if fbFE := e.executeStepWithRetries(execution, fbStep, SuccessPathFallback); fbFE != nil {
+			// Both primary and fallback failed.
+			log.Error(fmt.Sprintf("Fallback also failed for step %s", s.ID), "error", fbFE)
+			return fbFE
+		}
+		// Fallback succeeded — its result is stored under the original step ID
+		// so downstream steps and compensation code use a stable key.
+		path = SuccessPathFallback
 	}
 
+	if s.CompensateBody != "" {
+		execution.State().AppendCompensation(CompensationEntry{
+			StepID:    s.ID,
+			Body:      s.CompensateBody,
+			Path:      path,
+			Iteration: execution.Iteration(),
+			Retry:     s.CompensateRetry,
+			Timeout:   s.CompensateTimeout,
+		})
+	}
 	return nil
 }
 
-// handleFailure runs compensation and on_error handling.
+// runCatch runs a catch block for the error of the step's primary body. The
+// block may store a substitute result, set a response or raise; a caught step
+// has no side effects to undo, so its compensate body is not registered.
+func (e *Executor) runCatch(execution *Execution, s Step, c CatchBlock, fe *FlowError) *FlowError {
+	execution.Logger().Info(fmt.Sprintf("Step %s failed with %s, running catch block", s.ID, fe.Code))
+	catchStep := s
+	catchStep.Body = c.Body
+	catchStep.Retry = nil // catch blocks have no retry policy or circuit breaker
+	catchStep.CircuitBreaker = nil
+	catchStep.Bulkhead = nil
+	return e.executeStepWithRetries(execution.WithCaught(fe), catchStep, SuccessPathCatch)
+}
+
+// HandleFailure runs compensation and on_error handling.
+// It is also used by entrypoints to report failures that happen before the
+// step loop starts (e.g. a malformed request body).
 // Behavior:
 //   - If no on_error is configured (or executable), returns original error.
 //   - If on_error succeeds without raising, swallows the error (returns nil).
 //   - If on_error raises/returns an error, returns handler error instead of original.
-func (e *Executor) handleFailure(execution *Execution, fe *FlowError) error {
-	e.runCompensations(execution)
+//
+// The outcome of every compensation is attached to fe as Compensations.
+func (e *Executor) HandleFailure(execution *Execution, fe *FlowError) error {
+	if results := e.runCompensations(execution); len(results) > 0 {
+		fe.Compensations = results
+	}
 	handled, handlerErr := e.runOnErrorHandler(execution, fe)
 	if !handled {
 		return fe
@@ -154,11 +230,13 @@ func (e *Executor) executeStepWithRetries(execution *Execution, step Step, path
 	start := time.Now()
 	var lastFE *FlowError
 
-	spanCtx, span := execution.Tracer().Start(parentCtx, fmt.Sprintf("step %s", step.ID),
-		trace.WithAttributes(
-			attribute.String("step.id", step.ID),
-		),
-	)
+	spanName := fmt.Sprintf("step %s", step.ID)
+	spanAttrs := []attribute.KeyValue{attribute.String("step.id", step.ID)}
+	if it := execution.Iteration(); it != nil {
+		spanName = fmt.Sprintf("step %s[%d]", step.ID, it.Index)
+		spanAttrs = append(spanAttrs, attribute.Int("step.iteration", it.Index))
+	}
+	spanCtx, span := execution.Tracer().Start(parentCtx, spanName, trace.WithAttributes(spanAttrs...))
 	defer span.End()
 	defer func() {
 		execution.Metrics().RecordStep(
@@ -185,6 +263,11 @@ func (e *Executor) executeStepWithRetries(execution *Execution, step Step, path
 
 	log := execution.Logger()
 
+	var breaker *circuitBreaker
+	if step.CircuitBreaker != nil && execution.Container != nil {
+		breaker = execution.Container.circuitBreaker(*step.CircuitBreaker)
+	}
+
 attemptLoop:
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		// Context check before each attempt.
@@ -206,10 +289,33 @@ attemptLoop:
 			}
 		}
 
+		// Each attempt holds a slot of the step's bulkhead, if any.
+		release, limitFE := acquireBulkhead(stepCtx, execution, step)
+		if limitFE != nil {
+			lastFE = limitFE
+			lastFE.Retries = attempt
+			log.Warn(fmt.Sprintf("Step %s rejected: %s", step.ID, lastFE.Message))
+			break
+		}
+
+		// An open circuit breaker fails the step without calling it or retrying.
+		if breaker != nil && !breaker.allow(spanCtx) {
+			release()
+			lastFE = circuitOpenError(breaker, step.ID)
+			lastFE.Retries = attempt
+			execution.Metrics().RecordBreakerRejection(spanCtx, execFlowID(execution), step.ID, breaker.config.Name)
+			log.Warn(fmt.Sprintf("Step %s rejected: %s", step.ID, lastFE.Message))
+			break
+		}
+
 		var err error
 		stepExec := execution.WithContext(stepCtx).WithActivePath(path).WithActiveStep(step.ID)
 		_, err = e.stepExecutor.ExecuteStep(stepCtx, stepExec, step)
+		release()
 		if err == nil {
+			if breaker != nil {
+				breaker.record(spanCtx, nil)
+			}
 			lastFE = nil
 			return nil
 		}
@@ -218,6 +324,9 @@ attemptLoop:
 		fe := toFlowError(err, step.ID, attempt)
 		fe.Retries = attempt
 		lastFE = fe
+		if breaker != nil {
+			breaker.record(spanCtx, fe)
+		}
 
 		log.Error(fmt.Sprintf("Step %s failed (attempt %d/%d)", step.ID, attempt+1, maxAttempts),
 			"error_type", fe.Type,
@@ -265,11 +374,9 @@ func (e *Executor) shouldRetry(execution *Execution, step Step, fe *FlowError) b
 		return false
 	}
 
-	// If a `when` expression is set, evaluate it with `error` injected into the store.
+	// If a `when` expression is set, evaluate it with fe in scope as `error`.
 	if retry.When != "" {
-		execution.State().Store().Set("error", fe.ToMap())
-		result, err := e.evaluator.Eval(execution, retry.When)
-		execution.State().Store().Set("error", nil) // clean up regardless of result
+		result, err := e.evaluator.Eval(execution.WithCaught(fe), retry.When)
 		if err != nil {
 			execution.Logger().Error("error evaluating retry when expression", "error", err)
 			return false
@@ -312,29 +419,6 @@ func (e *Executor) computeDelay(retry *RetryConfig, attempt int) time.Duration {
 	return delay
 }
 
-// runCompensations iterates the CompensationStack in LIFO order and executes
-// each compensation body. Failures are logged but do not stop remaining compensations.
-// Uses a detached context so compensation DB/HTTP calls complete even if the flow
-// context was already cancelled (e.g. by a timeout).
-func (e *Executor) runCompensations(execution *Execution) {
-	oee, ok := e.stepExecutor.(OnErrorExecutor)
-	if !ok {
-		return
-	}
-
-	safeExec := execution.WithContext(context.WithoutCancel(execution))
-	log := safeExec.Logger()
-	stack := execution.State().CompensationSnapshot()
-	for i := len(stack) - 1; i >= 0; i-- {
-		entry := stack[i]
-		log.Info(fmt.Sprintf("Running compensation for step %s (path: %s)", entry.StepID, entry.Path))
-		if err := oee.ExecuteCompensation(safeExec, entry.Body, entry.StepID, entry.Path); err != nil {
-			log.Error(fmt.Sprintf("Compensation failed for step %s", entry.StepID), "error", err)
-			// Continue remaining compensations even on failure.
-		}
-	}
-}
-
 // runOnErrorHandler executes the flow-level on_error body if one is defined.
 // Uses a detached context so the handler can complete (set response, update DB, etc.)
 // even when the original flow context has already been cancelled by a timeout.
@@ -396,8 +480,17 @@ func (e *Executor) flowError(_ *Execution, stepID string, err error) *FlowError
 	return &FlowError{Type: ErrorTypeTimeout, Code: string(ErrorCodeContextCancelled), Message: err.Error(), Step: stepID}
 }
 
-// toFlowError converts any error to a *FlowError, preserving existing FlowErrors.
+// toFlowError converts any error to a *FlowError, preserving existing and
+// classified errors.
 func toFlowError(err error, stepID string, attempt int) *FlowError {
+	// An error that carries its classification keeps it, even when it wraps
+	// a context error.
+	if fe, ok := AsFlowError(err); ok {
+		if fe.Step == "" {
+			fe.Step = stepID
+		}
+		return fe
+	}
 	if errors.Is(err, context.DeadlineExceeded) {
 		return &FlowError{
 			Type:    ErrorTypeTimeout,
@@ -417,13 +510,6 @@ func toFlowError(err error, stepID string, attempt int) *FlowError {
 		}
 	}
 
-	var fe *FlowError
-	if errors.As(err, &fe) {
-		if fe.Step == "" {
-			fe.Step = stepID
-		}
-		return fe
-	}
 	return &FlowError{
 		Type:    ErrorTypePermanent,
 		Code:    string(ErrorCodeRuntimeError),
@@ -1,6 +1,9 @@
 package runtime
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // FlowErrorType classifies error severity and retry behavior.
 type FlowErrorType string
@@ -12,6 +15,8 @@ const (
 	ErrorTypePermanent FlowErrorType = "permanent"
 	// ErrorTypeTimeout signals the operation was cancelled by a deadline.
 	ErrorTypeTimeout FlowErrorType = "timeout"
+	// ErrorTypeClient signals the request was rejected because of invalid client input.
+	ErrorTypeClient FlowErrorType = "client"
 )
 
 // FlowErrorCode identifies known runtime/framework error codes.
@@ -24,6 +29,12 @@ const (
 	ErrorCodeContextCancelled FlowErrorCode = "CONTEXT_CANCELLED"
 	ErrorCodeDeadlineExceeded FlowErrorCode = "DEADLINE_EXCEEDED"
 
+	// Request extraction codes.
+	ErrorCodeInvalidRequest       FlowErrorCode = "INVALID_REQUEST"
+	ErrorCodeRequestTooLarge      FlowErrorCode = "REQUEST_TOO_LARGE"
+	ErrorCodeUnsupportedMediaType FlowErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	ErrorCodeValidationFailed     FlowErrorCode = "VALIDATION_FAILED"
+
 	// Default code used when DSL raise() is called without arguments.
 	ErrorCodeRaise FlowErrorCode = "RAISE"
 )
@@ -38,6 +49,14 @@ type FlowError struct {
 	Cause   any            `json:"cause,omitempty"`
 	Retries int            `json:"retries"`
 	Meta    map[string]any `json:"meta,omitempty"`
+	// Status is the HTTP status a failed request answers with; 0 leaves it
+	// to the configured mapping by code and type.
+	Status int `json:"status,omitempty"`
+	// Details is structured data meant for the client, such as the fields a
+	// request got wrong. Unlike Meta it is part of the error response.
+	Details any `json:"details,omitempty"`
+	// Compensations reports the rollback that ran because of this error.
+	Compensations []CompensationResult `json:"compensations,omitempty"`
 }
 
 func (e *FlowError) Error() string {
@@ -45,12 +64,119 @@ func (e *FlowError) Error() string {
 }
 
 // ToMap converts the error to a map suitable for injection into Risor/expr-lang contexts.
+// "compensations" lists the rollback results and is empty when nothing was compensated;
+// "meta" is always a map. A FlowError cause is converted too, so handlers can
+// walk the cause chain.
 func (e *FlowError) ToMap() map[string]any {
+	compensations := make([]any, len(e.Compensations))
+	for i, r := range e.Compensations {
+		compensations[i] = r.ToMap()
+	}
+	meta := e.Meta
+	if meta == nil {
+		meta = map[string]any{}
+	}
 	return map[string]any{
-		"type":    string(e.Type),
-		"code":    e.Code,
-		"message": e.Message,
-		"step":    e.Step,
-		"retries": e.Retries,
+		"type":          string(e.Type),
+		"code":          e.Code,
+		"message":       e.Message,
+		"step":          e.Step,
+		"retries":       e.Retries,
+		"status":        e.Status,
+		"details":       e.Details,
+		"meta":          meta,
+		"cause":         causeValue(e.Cause),
+		"compensations": compensations,
+	}
+}
+
+// causeValue renders a cause for DSL code and responses: a FlowError as its
+// map, any other error as its message.
+func causeValue(cause any) any {
+	switch c := cause.(type) {
+	case *FlowError:
+		return c.ToMap()
+	case error:
+		return c.Error()
+	default:
+		return c
+	}
+}
+
+// ClassifiedError is implemented by errors that know their own
+// classification, such as a plugin error wrapping a driver error. The executor
+// uses the FlowError it returns instead of failing with a permanent
+// RUNTIME_ERROR, so retries and catch blocks see the intended type and code.
+type ClassifiedError interface {
+	error
+	FlowError() *FlowError
+}
+
+// AsFlowError finds the first FlowError or ClassifiedError in err's chain.
+// A classified error without cause gets err as its cause.
+func AsFlowError(err error) (*FlowError, bool) {
+	var fe *FlowError
+	if errors.As(err, &fe) {
+		return fe, true
+	}
+	var classified ClassifiedError
+	if errors.As(err, &classified) {
+		fe := classified.FlowError()
+		if fe.Cause == nil {
+			fe.Cause = err
+		}
+		return fe, true
+	}
+	return nil, false
+}
+
+// RequestError is returned when request data cannot be extracted before any
+// step runs (malformed body, unsupported media type, oversized payload).
+// It carries the HTTP status the client should receive.
+type RequestError struct {
+	Status     int
+	Code       string
+	Message    string
+	Cause      error
+	Violations []FieldViolation // schema violations, one per failing field
+}
+
+func NewRequestError(status int, code string, message string, cause error) *RequestError {
+	return &RequestError{Status: status, Code: code, Message: message, Cause: cause}
+}
+
+func (e *RequestError) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %v", e.Message, e.Cause)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Cause
+}
+
+// FlowError converts the request error to a client FlowError so on_error
+// handlers and metrics treat it like any other flow failure.
+// The HTTP status is kept as Status and schema violations as meta.errors.
+func (e *RequestError) FlowError() *FlowError {
+	fe := &FlowError{
+		Type:    ErrorTypeClient,
+		Code:    e.Code,
+		Message: e.Message,
+		Step:    "request",
+		Status:  e.Status,
+		Meta:    map[string]any{},
+	}
+	if e.Cause != nil {
+		fe.Cause = e.Cause.Error()
+	}
+	if len(e.Violations) > 0 {
+		errs := make([]any, len(e.Violations))
+		for i, v := range e.Violations {
+			errs[i] = map[string]any{"field": v.Field, "message": v.Message}
+		}
+		fe.Meta["errors"] = errs
 	}
+	return fe
 }
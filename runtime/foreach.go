@@ -0,0 +1,208 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultForEachVar is the name the current item is exposed under when a
+// for_each step does not set `as`.
+const DefaultForEachVar = "item"
+
+// Iteration is the for_each item an execution scope is running. Besides the
+// item under its `as` name, the body sees `loop.index` and `loop.count`.
+type Iteration struct {
+	Index int    `json:"index"`
+	Count int    `json:"count"`
+	Item  any    `json:"item"`
+	As    string `json:"as"`
+
+	mu     sync.Mutex
+	result any
+}
+
+// SetResult records the value the step body produced for this item.
+// Step executors call it instead of writing the result under the step ID.
+func (it *Iteration) SetResult(v any) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.result = v
+}
+
+// Result returns the value recorded by SetResult, or nil.
+func (it *Iteration) Result() any {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	return it.result
+}
+
+func (it *Iteration) vars() map[string]any {
+	return map[string]any{
+		it.As: it.Item,
+		"loop": map[string]any{
+			"index": it.Index,
+			"count": it.Count,
+		},
+	}
+}
+
+// executeForEach runs the step body once per item of the for_each
+// collection, at most Concurrency items at a time. Item results are stored
+// as a list under the step ID, with nil for items that failed. The step fails
+// once more than MaxFailures items fail; remaining items are then cancelled.
+func (e *Executor) executeForEach(execution *Execution, s Step) *FlowError {
+	cfg := s.ForEach
+	raw, err := e.evaluator.Eval(execution, cfg.Items)
+	if err != nil {
+		return toFlowError(fmt.Errorf("error evaluating for_each %s: %w", cfg.Items, err), s.ID, 0)
+	}
+	items, ok := forEachItems(raw)
+	if !ok {
+		return &FlowError{
+			Type:    ErrorTypePermanent,
+			Code:    string(ErrorCodeRuntimeError),
+			Message: fmt.Sprintf("for_each %s evaluated to %T, expected a list", cfg.Items, raw),
+			Step:    s.ID,
+		}
+	}
+
+	as := cfg.As
+	if as == "" {
+		as = DefaultForEachVar
+	}
+	concurrency := max(cfg.Concurrency, 1)
+
+	parentCtx := execution.ctx
+	if parentCtx == nil {
+		parentCtx = context.Background()
+	}
+	spanCtx, span := execution.Tracer().Start(parentCtx, fmt.Sprintf("for_each %s", s.ID),
+		trace.WithAttributes(
+			attribute.String("step.id", s.ID),
+			attribute.Int("for_each.items", len(items)),
+			attribute.Int("for_each.concurrency", concurrency),
+		),
+	)
+	defer span.End()
+
+	loopCtx, cancel := context.WithCancel(spanCtx)
+	defer cancel()
+
+	log := execution.Logger()
+	log.Info(fmt.Sprintf("Running step %s for %d items (concurrency %d)", s.ID, len(items), concurrency))
+
+	itemExec := execution.WithContext(loopCtx)
+	results := make([]any, len(items))
+	failures := make([]*FlowError, len(items))
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		failed  int
+		first   *FlowError
+		started int
+	)
+	sem := make(chan struct{}, concurrency)
+
+dispatch:
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-loopCtx.Done():
+			break dispatch
+		}
+		if loopCtx.Err() != nil {
+			<-sem
+			break
+		}
+		started++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			it := &Iteration{Index: i, Count: len(items), Item: item, As: as}
+			if fe := e.runBody(itemExec.WithIteration(it), s); fe != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				failures[i] = fe
+				failed++
+				if failed > cfg.MaxFailures && first == nil {
+					first = fe
+					cancel()
+				}
+				return
+			}
+			results[i] = it.Result()
+		}()
+	}
+	wg.Wait()
+
+	var fe *FlowError
+	switch {
+	case first != nil:
+		fe = forEachFailure(s.ID, first, failures)
+	case started < len(items):
+		// The flow context ended before every item was dispatched.
+		fe = e.flowError(execution, s.ID, loopCtx.Err())
+	}
+	if fe != nil {
+		span.RecordError(fe)
+		span.SetStatus(codes.Error, fe.Message)
+		return fe
+	}
+
+	if failed > 0 {
+		log.Warn(fmt.Sprintf("Step %s: %d of %d items failed (tolerated: %d)", s.ID, failed, len(items), cfg.MaxFailures))
+	}
+	span.SetAttributes(attribute.Int("for_each.failed", failed))
+	if execution.State().Response() == nil {
+		execution.State().Store().Set(s.ID, results)
+	}
+	return nil
+}
+
+// forEachItems converts the evaluated for_each collection to a list.
+// nil is treated as an empty collection.
+func forEachItems(v any) ([]any, bool) {
+	switch t := v.(type) {
+	case nil:
+		return nil, true
+	case []any:
+		return t, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]any, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, true
+}
+
+// forEachFailure reports the failed items of a for_each step. The error keeps
+// the type and code of the failure that crossed the threshold so retry and
+// on_error policies classify the step like that item.
+func forEachFailure(stepID string, cause *FlowError, failures []*FlowError) *FlowError {
+	var items []any
+	for i, fe := range failures {
+		if fe != nil {
+			items = append(items, map[string]any{"index": i, "error": fe.ToMap()})
+		}
+	}
+	return &FlowError{
+		Type: cause.Type,
+		Code: cause.Code,
+		Message: fmt.Sprintf("for_each %s: %d of %d items failed: %s",
+			stepID, len(items), len(failures), cause.Message),
+		Step: stepID,
+		Meta: map[string]any{"items": items},
+	}
+}
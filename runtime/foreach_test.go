@@ -0,0 +1,206 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lookupEvaluator resolves an expression as a single key of the execution values.
+type lookupEvaluator struct{}
+
+func (lookupEvaluator) Eval(execution *Execution, expression string) (any, error) {
+	return execution.Values()[expression], nil
+}
+
+// itemStepExecutor doubles the current item, failing for items listed in
+// fail and on the first attempt for items listed in flaky.
+type itemStepExecutor struct {
+	fail  map[int]bool
+	flaky map[int]bool
+	delay time.Duration
+
+	running    atomic.Int32
+	maxRunning atomic.Int32
+	mu         sync.Mutex
+	attempts   map[int]int
+	compensate []string
+}
+
+func (s *itemStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		max := s.maxRunning.Load()
+		if n <= max || s.maxRunning.CompareAndSwap(max, n) {
+			break
+		}
+	}
+
+	it := execution.Iteration()
+	item := execution.Values()[it.As].(int)
+	s.mu.Lock()
+	if s.attempts == nil {
+		s.attempts = map[int]int{}
+	}
+	s.attempts[item]++
+	attempt := s.attempts[item]
+	s.mu.Unlock()
+
+	if s.delay > 0 {
+		select {
+		case <-time.After(s.delay):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	if s.fail[item] {
+		return "", &FlowError{Type: ErrorTypePermanent, Code: "ITEM_FAILED", Message: fmt.Sprintf("item %d failed", item), Step: step.ID}
+	}
+	if s.flaky[item] && attempt == 1 {
+		return "", &FlowError{Type: ErrorTypeTransient, Code: "TEMPORARY", Message: "retry me", Step: step.ID}
+	}
+	it.SetResult(item * 2)
+	return "", nil
+}
+
+func (s *itemStepExecutor) ExecuteOnErrorHandler(execution *Execution, body string, fe *FlowError) error {
+	return nil
+}
+
+func (s *itemStepExecutor) ExecuteCompensation(execution *Execution, body string, stepID string, path SuccessPath) error {
+	loop, _ := execution.Values()["loop"].(map[string]any)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.compensate = append(s.compensate, fmt.Sprintf("%s:%v:%v", stepID, execution.Values()["n"], loop["index"]))
+	return nil
+}
+
+func runForEachFlow(t *testing.T, stepExecutor StepExecutor, steps ...Step) (*Execution, error) {
+	t.Helper()
+	flow := &Flow{ID: "fanout", Steps: steps}
+	execution := NewExecution(flow, NewContainer(NewLogger(nil)), nil, NewValueStore())
+	execution.AddValue("numbers", []int{1, 2, 3, 4})
+	err := NewExecutor(lookupEvaluator{}, stepExecutor).ExecuteSteps(execution)
+	return execution, err
+}
+
+func TestExecuteForEach_CollectsResultsInOrder(t *testing.T) {
+	stepExecutor := &itemStepExecutor{flaky: map[int]bool{3: true}, delay: 20 * time.Millisecond}
+	step := Step{
+		ID:      "double",
+		Retry:   &RetryConfig{MaxAttempts: 2},
+		ForEach: &ForEachConfig{Items: "numbers", As: "n", Concurrency: 2},
+	}
+
+	execution, err := runForEachFlow(t, stepExecutor, step)
+	if err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	got, _ := execution.State().Store().Get("double")
+	if want := []any{2, 4, 6, 8}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("double = %#v, want %#v", got, want)
+	}
+	if stepExecutor.attempts[3] != 2 {
+		t.Errorf("item 3 attempts = %d, want 2 (per-item retry)", stepExecutor.attempts[3])
+	}
+	if got := stepExecutor.maxRunning.Load(); got != 2 {
+		t.Errorf("max concurrent items = %d, want 2", got)
+	}
+}
+
+// transientWhenEvaluator answers the `when:` expression "transient" with
+// whether the error in scope is transient and looks up anything else.
+type transientWhenEvaluator struct{}
+
+func (transientWhenEvaluator) Eval(execution *Execution, expression string) (any, error) {
+	if expression == "transient" {
+		fe, _ := execution.Values()["error"].(map[string]any)
+		return fe["type"] == string(ErrorTypeTransient), nil
+	}
+	return execution.Values()[expression], nil
+}
+
+func TestExecuteForEach_RetryWhenSeesItsOwnError(t *testing.T) {
+	stepExecutor := &itemStepExecutor{flaky: map[int]bool{1: true, 2: true, 3: true, 4: true}, delay: 5 * time.Millisecond}
+	step := Step{
+		ID:      "double",
+		Retry:   &RetryConfig{MaxAttempts: 2, When: "transient"},
+		ForEach: &ForEachConfig{Items: "numbers", As: "n", Concurrency: 4},
+	}
+	flow := &Flow{ID: "batch", Steps: []Step{step}}
+	execution := NewExecution(flow, NewContainer(NewLogger(nil)), nil, NewValueStore())
+	execution.AddValue("numbers", []int{1, 2, 3, 4})
+
+	if err := NewExecutor(transientWhenEvaluator{}, stepExecutor).ExecuteSteps(execution); err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	if _, ok := execution.State().Store().Get("error"); ok {
+		t.Fatal("retry when wrote error into the shared store")
+	}
+	got, _ := execution.State().Store().Get("double")
+	if want := []any{2, 4, 6, 8}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("double = %#v, want %#v", got, want)
+	}
+}
+
+func TestExecuteForEach_ToleratesFailuresUpToThreshold(t *testing.T) {
+	stepExecutor := &itemStepExecutor{fail: map[int]bool{2: true}}
+	step := Step{ID: "double", ForEach: &ForEachConfig{Items: "numbers", As: "n", MaxFailures: 1}}
+
+	execution, err := runForEachFlow(t, stepExecutor, step)
+	if err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	got, _ := execution.State().Store().Get("double")
+	if want := []any{2, nil, 6, 8}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("double = %#v, want %#v", got, want)
+	}
+}
+
+func TestExecuteForEach_FailsAboveThresholdAndCompensatesItems(t *testing.T) {
+	stepExecutor := &itemStepExecutor{fail: map[int]bool{3: true}}
+	step := Step{
+		ID:             "double",
+		CompensateBody: "undo",
+		ForEach:        &ForEachConfig{Items: "numbers", As: "n"},
+	}
+
+	_, err := runForEachFlow(t, stepExecutor, step)
+	fe, ok := err.(*FlowError)
+	if !ok {
+		t.Fatalf("expected *FlowError, got %T: %v", err, err)
+	}
+	if fe.Code != "ITEM_FAILED" || fe.Step != "double" {
+		t.Fatalf("unexpected error: %+v", fe)
+	}
+	items, _ := fe.Meta["items"].([]any)
+	if len(items) != 1 || items[0].(map[string]any)["index"] != 2 {
+		t.Fatalf("meta.items = %#v", fe.Meta["items"])
+	}
+	// Sequential: items 1 and 2 succeeded, item 4 never ran.
+	if stepExecutor.attempts[4] != 0 {
+		t.Error("items after the failure threshold must not run")
+	}
+	want := []string{"double:2:1", "double:1:0"}
+	if !reflect.DeepEqual(stepExecutor.compensate, want) {
+		t.Fatalf("compensations = %v, want %v", stepExecutor.compensate, want)
+	}
+}
+
+func TestExecuteForEach_RejectsNonList(t *testing.T) {
+	step := Step{ID: "double", ForEach: &ForEachConfig{Items: "missing_map"}}
+	flow := &Flow{ID: "fanout", Steps: []Step{step}}
+	execution := NewExecution(flow, nil, nil, NewValueStore())
+	execution.AddValue("missing_map", map[string]any{"a": 1})
+
+	err := NewExecutor(lookupEvaluator{}, &itemStepExecutor{}).ExecuteSteps(execution)
+	fe, ok := err.(*FlowError)
+	if !ok || fe.Code != string(ErrorCodeRuntimeError) {
+		t.Fatalf("expected runtime error, got %v", err)
+	}
+}
@@ -2,9 +2,8 @@ package runtime
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 	"time"
@@ -17,21 +16,99 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-func NewHttpHandler(flow *Flow, container *Container, executor *Executor, globalProperties map[string]any, newValueStore func() ValueStore, g *gin.Engine) {
+// httpMethodBodies lists the HTTP methods an entrypoint may declare and whether
+// the request body is extracted for that method.
+var httpMethodBodies = map[string]bool{
+	http.MethodGet:     false,
+	http.MethodHead:    false,
+	http.MethodOptions: false,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+}
+
+// NewHttpHandler registers the flow's HTTP entrypoint on the router.
+// Returns an error when the entrypoint config is incomplete, declares a method
+// the runtime does not support, or the route cannot be registered (e.g. it
+// conflicts with a route declared by another flow).
+func NewHttpHandler(flow *Flow, container *Container, executor *Executor, globalProperties map[string]any, newValueStore func() ValueStore, g *gin.Engine) (err error) {
 	config := flow.Entrypoint.Config
-	method := strings.ToLower(config["method"].(string))
-	path := config["path"].(string)
+	rawMethod, _ := config["method"].(string)
+	path, _ := config["path"].(string)
+	if rawMethod == "" {
+		return fmt.Errorf("flow %s: http entrypoint requires a method", flow.ID)
+	}
+	if path == "" {
+		return fmt.Errorf("flow %s: http entrypoint requires a path", flow.ID)
+	}
 
-	container.logger.Info("Registering HTTP entrypoint", "method", method, "path", path, "flow_id", flow.ID)
+	method := strings.ToUpper(rawMethod)
+	withBody, ok := httpMethodBodies[method]
+	if !ok {
+		return fmt.Errorf("flow %s: unsupported HTTP method %q", flow.ID, rawMethod)
+	}
 
-	switch method {
-	case "get":
-		g.GET(path, handleRequest(flow, path, container, executor, globalProperties, newValueStore, false))
-	case "post":
-		g.POST(path, handleRequest(flow, path, container, executor, globalProperties, newValueStore, true))
-	default:
-		container.logger.Error("Unsupported HTTP method", "method", method, "flow_id", flow.ID)
+	if rawBody, ok := config["body"].(map[string]any); ok {
+		if _, hasType := rawBody["type"]; hasType {
+			if _, err := parseBodyConfig(rawBody); err != nil {
+				return fmt.Errorf("flow %s: %w", flow.ID, err)
+			}
+		}
+	}
+
+	for _, key := range []string{PathVariablesKey, QueryParametersKey, HeadersKey} {
+		switch v := config[key].(type) {
+		case nil, []any:
+		case string:
+			if v != CaptureAll {
+				return fmt.Errorf("flow %s: %s must be a list of names or %q, got %q", flow.ID, key, CaptureAll, v)
+			}
+		default:
+			return fmt.Errorf("flow %s: %s must be a list of names or %q, got %T", flow.ID, key, CaptureAll, v)
+		}
+	}
+
+	idempotency, err := parseIdempotencyConfig(config[IdempotencyKey])
+	if err != nil {
+		return fmt.Errorf("flow %s: %w", flow.ID, err)
+	}
+	var guard *idempotencyGuard
+	if idempotency != nil {
+		guard = newIdempotencyGuard(flow, container, idempotency)
+	}
+	async, err := parseAsyncEntrypoint(flow, container, executor)
+	if err != nil {
+		return fmt.Errorf("flow %s: %w", flow.ID, err)
+	}
+	rateLimit, err := parseRateLimitConfig(config[RateLimitKey])
+	if err != nil {
+		return fmt.Errorf("flow %s: %w", flow.ID, err)
+	}
+	var limiter *rateLimiter
+	if rateLimit != nil {
+		limiter = newRateLimiter(rateLimit, executor.evaluator)
+	}
+
+	// Flows built outside the DSL loader carry the raw schema only; compile it here.
+	if flow.Entrypoint.Schema == nil {
+		schema, err := CompileRequestSchema(config, "")
+		if err != nil {
+			return fmt.Errorf("flow %s: %w", flow.ID, err)
+		}
+		flow.Entrypoint.Schema = schema
 	}
+
+	container.logger.Info("Registering HTTP entrypoint", "method", method, "path", path, "flow_id", flow.ID)
+
+	// gin panics on duplicate or conflicting routes; surface that as a startup error.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("flow %s: cannot register %s %s: %v", flow.ID, method, path, r)
+		}
+	}()
+	g.Handle(method, path, handleRequest(flow, path, container, executor, globalProperties, newValueStore, withBody, guard, async, limiter))
+	return nil
 }
 
 type requestScope struct {
@@ -43,6 +120,8 @@ type requestScope struct {
 	span      trace.Span
 	cancel    context.CancelFunc
 	log       Logger
+	async     bool // the flow runs after the request; skip the flow metric
+	detached  bool // a worker owns the execution and its uploads
 }
 
 func beginRequestScope(c *gin.Context, flow *Flow, route string, execution *Execution) *requestScope {
@@ -94,7 +173,9 @@ func (s *requestScope) finish(c *gin.Context, requestErr error) {
 		"status_code", statusCode,
 		"duration_ms", duration.Milliseconds())
 
-	s.execution.Metrics().RecordFlow(s.spanCtx, s.flow.ID, classifyMetricOutcome(finalErr), duration)
+	if !s.async {
+		s.execution.Metrics().RecordFlow(s.spanCtx, s.flow.ID, classifyMetricOutcome(finalErr), duration)
+	}
 	s.execution.Metrics().RecordHTTPRequest(
 		s.spanCtx,
 		s.flow.ID,
@@ -114,7 +195,7 @@ func (s *requestScope) finish(c *gin.Context, requestErr error) {
 	s.span.End()
 }
 
-func handleRequest(flow *Flow, route string, container *Container, executor *Executor, globalProperties map[string]any, newValueStore func() ValueStore, withBody bool) gin.HandlerFunc {
+func handleRequest(flow *Flow, route string, container *Container, executor *Executor, globalProperties map[string]any, newValueStore func() ValueStore, withBody bool, idempotency *idempotencyGuard, async *asyncEntrypoint, limiter *rateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		e := NewExecution(flow, container, globalProperties, newValueStore())
 		var requestErr error
@@ -126,11 +207,40 @@ func handleRequest(flow *Flow, route string, container *Container, executor *Exe
 		defer func() {
 			scope.finish(c, requestErr)
 		}()
+		// Queued executions remove their uploads when the worker is done.
+		defer func() {
+			if !scope.detached {
+				removeRequestFiles(e)
+			}
+		}()
 		log := scope.log
 
-		extractRequestData(c, flow, e, withBody)
+		if reqErr := extractRequestData(c, flow, e, withBody, limiter); reqErr != nil {
+			requestErr = rejectRequest(c, scope, executor, reqErr)
+			return
+		}
+
+		// The response a replay of this request gets.
+		var final *ResponseDescriptor
+		if idempotency != nil {
+			reserved, done, err := idempotency.begin(c, e)
+			if done {
+				requestErr = err
+				scope.span.SetAttributes(attribute.Bool("idempotency.replayed", err == nil))
+				return
+			}
+			defer func() { idempotency.finish(c, e, reserved, final) }()
+		}
+
+		if async != nil {
+			// The flow metric is recorded when the worker finishes.
+			scope.async = true
+			final, requestErr = async.accept(c, scope)
+			return
+		}
 
 		flowErr = executor.ExecuteSteps(e)
+		final = e.State().Response()
 		if flowErr != nil {
 			requestErr = flowErr
 			scope.span.RecordError(flowErr)
@@ -148,9 +258,7 @@ func handleRequest(flow *Flow, route string, container *Container, executor *Exe
 				}
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "Error in task execution: " + flowErr.Error(),
-			})
+			final = writeFlowError(c, container.ErrorResponses(), flowErr)
 			return
 		}
 
@@ -162,6 +270,35 @@ func handleRequest(flow *Flow, route string, container *Container, executor *Exe
 	}
 }
 
+// rejectRequest short-circuits a request whose data could not be extracted.
+// The flow's on_error handler sees the failure as a client FlowError and may set
+// its own response; otherwise the client receives the RequestError status.
+func rejectRequest(c *gin.Context, scope *requestScope, executor *Executor, reqErr *RequestError) error {
+	fe := reqErr.FlowError()
+	e := scope.execution
+	scope.span.RecordError(fe)
+	scope.span.SetStatus(codes.Error, fe.Error())
+	scope.span.SetAttributes(
+		attribute.String("error.type", string(fe.Type)),
+		attribute.String("error.code", fe.Code),
+	)
+	scope.log.Warn("Request rejected before flow execution",
+		"path", c.Request.URL.Path,
+		"method", c.Request.Method,
+		"status_code", reqErr.Status,
+		"error", reqErr)
+
+	if err := executor.HandleFailure(e, fe); err == nil && e.State().Response() != nil {
+		if err := dispatchResponse(c, e); err != nil {
+			return err
+		}
+		return fe
+	}
+
+	writeRequestError(c, e.Container.ErrorResponses(), reqErr)
+	return fe
+}
+
 // dispatchResponse handles the HTTP response dispatch based on the execution's RunState response.
 // If no descriptor was set by any step, returns a default 200 OK.
 func dispatchResponse(c *gin.Context, execution *Execution) error {
@@ -178,9 +315,7 @@ func dispatchResponse(c *gin.Context, execution *Execution) error {
 		log.Error("Unknown response handler",
 			"handler", rd.HandlerName,
 			"error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": err.Error(),
-		})
+		writeFlowError(c, execution.Container.ErrorResponses(), err)
 		return err
 	}
 
@@ -188,9 +323,7 @@ func dispatchResponse(c *gin.Context, execution *Execution) error {
 		log.Error("Response handler execution failed",
 			"handler", rd.HandlerName,
 			"error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "Error generating response: " + err.Error(),
-		})
+		writeFlowError(c, execution.Container.ErrorResponses(), fmt.Errorf("generating response: %w", err))
 		return err
 	}
 
@@ -207,67 +340,211 @@ const (
 	HeadersPrefix         = "request.headers"
 	RequestBodyPrefix     = "request.body"
 	RequestRawBodyKey     = "request.rawBody"
+
+	// CaptureAll as the value of queryParameters or headers exposes every
+	// value the request carries instead of a whitelist.
+	CaptureAll = "*"
 )
 
-func extractRequestData(c *gin.Context, f *Flow, e *Execution, withBody bool) {
-	if pathVariables, ok := f.Entrypoint.Config[PathVariablesKey].([]any); ok {
-		extractValues(e, pathVariables, PathVariablesPrefix, c.Param)
+// extractRequestData copies request data into the execution and enforces the
+// entrypoint schema and rate limit. A non-nil RequestError means the request
+// must not reach the flow steps. The rate limit is checked before the body is
+// read, unless its key needs the body.
+func extractRequestData(c *gin.Context, f *Flow, e *Execution, withBody bool, limiter *rateLimiter) *RequestError {
+	schema := f.Entrypoint.Schema
+	var violations []FieldViolation
+
+	sources := []struct {
+		section  string
+		prefix   string
+		getValue func(string) string
+		getAll   func() map[string]any
+		name     func(string) string // the key a value is exposed under
+	}{
+		{PathVariablesKey, PathVariablesPrefix, c.Param, func() map[string]any { return allPathVariables(c) }, sameName},
+		{QueryParametersKey, QueryParametersPrefix, c.Query, func() map[string]any { return allQueryParameters(c) }, sameName},
+		{HeadersKey, HeadersPrefix, c.GetHeader, func() map[string]any { return allHeaders(c) }, strings.ToLower},
 	}
+	for _, src := range sources {
+		raw := f.Entrypoint.Config[src.section]
+		keys := exposedNames(raw, src.name)
+
+		var values map[string]any
+		// Path variables always come from the route's :name segments.
+		if raw == CaptureAll || src.section == PathVariablesKey {
+			values = src.getAll()
+		} else {
+			values = collectValues(keys, schema.Properties(src.section), src.getValue)
+		}
 
-	if queryParameters, ok := f.Entrypoint.Config[QueryParametersKey].([]any); ok {
-		extractValues(e, queryParameters, QueryParametersPrefix, c.Query)
+		if schema.Has(src.section) {
+			coerced, sectionViolations := schema.Apply(src.section, values, true)
+			violations = append(violations, sectionViolations...)
+			values = coerced.(map[string]any)
+		} else {
+			// Listed keys are always present, empty when the request omits them.
+			for _, key := range keys {
+				if _, exists := values[key]; !exists {
+					values[key] = ""
+				}
+			}
+		}
+
+		for key, value := range values {
+			e.AddValue(fmt.Sprintf("%s.%s", src.prefix, key), value)
+		}
 	}
 
-	if headers, ok := f.Entrypoint.Config[HeadersKey].([]any); ok {
-		extractValues(e, headers, HeadersPrefix, c.GetHeader)
+	if limiter != nil && !(withBody && limiter.readsBody) {
+		if reqErr := limiter.check(c, e); reqErr != nil {
+			return reqErr
+		}
 	}
 
 	if withBody {
-		extractBody(c, f, e)
+		bodyType, reqErr := extractBody(c, f, e)
+		if reqErr != nil {
+			return reqErr
+		}
+		if schema.Has(BodyKey) {
+			body, _ := e.State().Store().Get(RequestBodyPrefix)
+			// JSON bodies are already typed; other body types carry strings.
+			body, bodyViolations := schema.Apply(BodyKey, body, bodyType != BodyTypeJSON)
+			violations = append(violations, bodyViolations...)
+			if body != nil {
+				e.State().Store().SetNested(RequestBodyPrefix, body)
+			}
+		}
+		if limiter != nil && limiter.readsBody {
+			if reqErr := limiter.check(c, e); reqErr != nil {
+				return reqErr
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return validationFailed(violations)
+	}
+	return nil
+}
+
+func allPathVariables(c *gin.Context) map[string]any {
+	values := make(map[string]any, len(c.Params))
+	for _, p := range c.Params {
+		values[p.Key] = p.Value
+	}
+	return values
+}
+
+// allQueryParameters returns every query parameter; repeated keys become lists.
+func allQueryParameters(c *gin.Context) map[string]any {
+	query := c.Request.URL.Query()
+	values := make(map[string]any, len(query))
+	for key, vals := range query {
+		values[key] = singleOrList(vals)
 	}
+	return values
 }
 
-func extractValues(e *Execution, keys []any, prefix string, getValue func(string) string) {
+// allHeaders returns every request header keyed by its lower-cased name;
+// repeated headers become lists.
+func allHeaders(c *gin.Context) map[string]any {
+	values := make(map[string]any, len(c.Request.Header))
+	for name, vals := range c.Request.Header {
+		values[strings.ToLower(name)] = singleOrList(vals)
+	}
+	return values
+}
+
+func singleOrList(vals []string) any {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	list := make([]any, len(vals))
+	for i, v := range vals {
+		list[i] = v
+	}
+	return list
+}
+
+// collectValues reads the listed keys plus the schema-declared properties.
+// Absent values are omitted so `required` can report them.
+func collectValues(keys []string, properties []string, getValue func(string) string) map[string]any {
+	values := make(map[string]any, len(keys)+len(properties))
+	add := func(key string) {
+		if v := getValue(key); v != "" {
+			values[key] = v
+		}
+	}
 	for _, key := range keys {
-		if v, ok := key.(string); ok {
-			e.AddValue(fmt.Sprintf("%s.%s", prefix, v), getValue(v))
+		add(key)
+	}
+	for _, key := range properties {
+		add(key)
+	}
+	return values
+}
+
+// exposedNames returns the listed keys of an entrypoint section under the
+// names they are exposed as.
+func exposedNames(raw any, name func(string) string) []string {
+	list, _ := raw.([]any)
+	keys := make([]string, 0, len(list))
+	for _, key := range list {
+		if k, ok := key.(string); ok {
+			keys = append(keys, name(k))
 		}
 	}
+	return keys
 }
 
-func extractBody(c *gin.Context, f *Flow, e *Execution) {
-	bodyConfig, ok := f.Entrypoint.Config["body"].(map[string]any)
+func sameName(key string) string { return key }
+
+// extractBody reads and decodes the request body. It returns the resolved
+// body type ("" when the entrypoint declares no body or none was sent).
+func extractBody(c *gin.Context, f *Flow, e *Execution) (string, *RequestError) {
+	rawConfig, ok := f.Entrypoint.Config["body"].(map[string]any)
 	if !ok {
-		return
+		return "", nil
 	}
-	bodyType, ok := bodyConfig["type"].(string)
-	if !ok {
-		return
+	if _, ok := rawConfig["type"].(string); !ok {
+		return "", nil
 	}
 
-	if bodyType == "json" {
-		extractJsonBody(c, e)
-	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Body type is not supported"})
+	bodyType, err := readRequestBody(c, e, rawConfig)
+	if err != nil {
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) {
+			return "", reqErr
+		}
+		return "", malformedBody(err)
 	}
+	return bodyType, nil
 }
 
-var wrongBodyFormatRes = gin.H{"message": "Wrong request body format"}
-
-func extractJsonBody(c *gin.Context, e *Execution) {
-	body, err := io.ReadAll(c.Request.Body)
+// readRequestBody reads the raw body, keeps it under request.rawBody so signature
+// checks see the exact bytes, and decodes it according to the body config.
+// Multipart bodies are decoded while they stream in.
+func readRequestBody(c *gin.Context, e *Execution, rawConfig map[string]any) (string, error) {
+	cfg, err := parseBodyConfig(rawConfig)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, wrongBodyFormatRes)
-		return
+		return "", unsupportedMediaType("Body type is not supported", err)
 	}
 
-	e.AddValue(RequestRawBodyKey, string(body))
+	contentType := c.GetHeader("Content-Type")
+	if isMultipart(cfg.Type, contentType) {
+		return BodyTypeMultipart, readMultipart(c, e, contentType, cfg)
+	}
 
-	var parsed any
-	if err := json.Unmarshal(body, &parsed); err != nil {
-		c.JSON(http.StatusBadRequest, wrongBodyFormatRes)
-		return
+	body, err := readRawBody(c, cfg)
+	if err != nil {
+		return "", err
 	}
+	e.AddValue(RequestRawBodyKey, string(body))
 
-	e.State().Store().SetNested(RequestBodyPrefix, parsed)
+	bodyType, err := resolveBodyType(cfg.Type, contentType, body)
+	if err != nil {
+		return "", err
+	}
+	return bodyType, parseBody(e, bodyType, body)
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -90,7 +91,9 @@ func TestHandleRequest_LogsCompletedRequests(t *testing.T) {
 	}
 	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
 
-	NewHttpHandler(flow, container, executor, nil, newTestValueStore, router)
+	if err := NewHttpHandler(flow, container, executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
 
 	req := httptest.NewRequest(http.MethodGet, "/payments", nil)
 	rec := httptest.NewRecorder()
@@ -144,7 +147,9 @@ func TestHandleRequest_ContinuesInboundTraceContext(t *testing.T) {
 	}
 	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
 
-	NewHttpHandler(flow, container, executor, nil, newTestValueStore, router)
+	if err := NewHttpHandler(flow, container, executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
 
 	req := httptest.NewRequest(http.MethodGet, "/payments", nil)
 	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
@@ -193,7 +198,9 @@ func TestHandleRequest_MarksRootSpanErrorWhenResponseDispatchFails(t *testing.T)
 		descriptor: &ResponseDescriptor{HandlerName: "missing.handler"},
 	})
 
-	NewHttpHandler(flow, container, executor, nil, newTestValueStore, router)
+	if err := NewHttpHandler(flow, container, executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
 
 	req := httptest.NewRequest(http.MethodGet, "/payments", nil)
 	rec := httptest.NewRecorder()
@@ -215,6 +222,223 @@ func TestHandleRequest_MarksRootSpanErrorWhenResponseDispatchFails(t *testing.T)
 	}
 }
 
+type capturingStepExecutor struct {
+	values map[string]any
+}
+
+func (s *capturingStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	s.values = execution.Values()
+	return "", nil
+}
+
+func TestNewHttpHandler_RegistersStandardMethods(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	tests := []struct {
+		method   string
+		withBody bool
+	}{
+		{http.MethodGet, false},
+		{http.MethodHead, false},
+		{http.MethodOptions, false},
+		{http.MethodPost, true},
+		{http.MethodPut, true},
+		{http.MethodPatch, true},
+		{http.MethodDelete, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			container := NewContainer(NewLogger(nil))
+			router := gin.New()
+			flow := &Flow{
+				ID: "orders",
+				Entrypoint: Entrypoint{
+					Type: "http",
+					Config: map[string]any{
+						"method": strings.ToLower(tt.method),
+						"path":   "/orders/:id",
+						"body":   map[string]any{"type": "json"},
+					},
+				},
+				Steps: []Step{{ID: "capture"}},
+			}
+			stepExecutor := &capturingStepExecutor{}
+			executor := NewExecutor(noopEvaluator{}, stepExecutor)
+
+			if err := NewHttpHandler(flow, container, executor, nil, newTestValueStore, router); err != nil {
+				t.Fatalf("NewHttpHandler failed: %v", err)
+			}
+
+			req := httptest.NewRequest(tt.method, "/orders/42", strings.NewReader(`{"reason":"duplicate"}`))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %d", rec.Code)
+			}
+			_, hasBody := stepExecutor.values[RequestRawBodyKey]
+			if hasBody != tt.withBody {
+				t.Fatalf("expected body extraction=%v, got %v", tt.withBody, hasBody)
+			}
+		})
+	}
+}
+
+func TestNewHttpHandler_RejectsUnsupportedMethod(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	flow := &Flow{
+		ID: "orders",
+		Entrypoint: Entrypoint{
+			Type:   "http",
+			Config: map[string]any{"method": "TRACE", "path": "/orders"},
+		},
+	}
+	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
+
+	err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newTestValueStore, gin.New())
+	if err == nil {
+		t.Fatal("expected error for unsupported method")
+	}
+	if !strings.Contains(err.Error(), `unsupported HTTP method "TRACE"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewHttpHandler_ReturnsErrorOnConflictingRoute(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	container := NewContainer(NewLogger(nil))
+	router := gin.New()
+	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
+	newFlow := func(id string) *Flow {
+		return &Flow{
+			ID: id,
+			Entrypoint: Entrypoint{
+				Type:   "http",
+				Config: map[string]any{"method": "DELETE", "path": "/orders/:id"},
+			},
+		}
+	}
+
+	if err := NewHttpHandler(newFlow("cancel_order"), container, executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("first registration failed: %v", err)
+	}
+	err := NewHttpHandler(newFlow("delete_order"), container, executor, nil, newTestValueStore, router)
+	if err == nil {
+		t.Fatal("expected error for duplicate route")
+	}
+	if !strings.Contains(err.Error(), "flow delete_order: cannot register DELETE /orders/:id") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type onErrorStepExecutor struct {
+	stepsRun int
+	handled  *FlowError
+	respond  bool
+}
+
+func (s *onErrorStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	s.stepsRun++
+	return "", nil
+}
+
+func (s *onErrorStepExecutor) ExecuteOnErrorHandler(execution *Execution, body string, fe *FlowError) error {
+	s.handled = fe
+	if s.respond {
+		execution.State().SetResponse(&ResponseDescriptor{
+			HandlerName: "http.json",
+			Args: map[string]any{
+				"status": 422,
+				"body":   map[string]any{"error": fe.Code},
+			},
+		})
+	}
+	return nil
+}
+
+func (s *onErrorStepExecutor) ExecuteCompensation(execution *Execution, body string, stepID string, path SuccessPath) error {
+	return nil
+}
+
+func TestHandleRequest_MalformedBodyAbortsFlow(t *testing.T) {
+	tests := []struct {
+		name       string
+		onError    string
+		respond    bool
+		wantStatus int
+		wantBody   string
+	}{
+		{"default response", "", false, http.StatusBadRequest, `"detail":"Wrong request body format"`},
+		{"on_error without response", "log()", false, http.StatusBadRequest, `"detail":"Wrong request body format"`},
+		{"on_error response", "respond()", true, http.StatusUnprocessableEntity, `"error":"INVALID_REQUEST"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.ReleaseMode)
+
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider()
+			provider.RegisterSpanProcessor(recorder)
+			defer func() {
+				_ = provider.Shutdown(context.Background())
+			}()
+			container := NewContainer(NewLogger(nil))
+			container.SetTracer(provider.Tracer("test"))
+
+			router := gin.New()
+			flow := &Flow{
+				ID: "payments",
+				Entrypoint: Entrypoint{
+					Type: "http",
+					Config: map[string]any{
+						"method": "POST",
+						"path":   "/payments",
+						"body":   map[string]any{"type": "json"},
+					},
+				},
+				Steps:       []Step{{ID: "charge"}},
+				OnErrorBody: tt.onError,
+			}
+			stepExecutor := &onErrorStepExecutor{respond: tt.respond}
+			executor := NewExecutor(noopEvaluator{}, stepExecutor)
+			if err := NewHttpHandler(flow, container, executor, nil, newTestValueStore, router); err != nil {
+				t.Fatalf("NewHttpHandler failed: %v", err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("{not json"))
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d status, got %d", tt.wantStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Fatalf("expected body to contain %s, got %s", tt.wantBody, rec.Body.String())
+			}
+			if stepExecutor.stepsRun != 0 {
+				t.Fatalf("expected no steps to run, got %d", stepExecutor.stepsRun)
+			}
+			if tt.onError != "" {
+				if stepExecutor.handled == nil || stepExecutor.handled.Type != ErrorTypeClient {
+					t.Fatalf("expected on_error to receive a client error, got %+v", stepExecutor.handled)
+				}
+			}
+
+			flowSpan := findSpanByName(t, recorder.Ended(), "flow payments")
+			if flowSpan.Status().Code != codes.Error {
+				t.Fatalf("expected root span status=error, got %s", flowSpan.Status().Code)
+			}
+			if value, ok := spanAttribute(flowSpan.Attributes(), attribute.Key("error.type")); !ok || value.AsString() != "client" {
+				t.Fatalf("expected root span error.type=client, got %v (present=%v)", value, ok)
+			}
+		})
+	}
+}
+
 func findSpanByName(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
 	t.Helper()
 	for _, span := range spans {
@@ -234,3 +458,102 @@ func spanAttribute(attrs []attribute.KeyValue, key attribute.Key) (attribute.Val
 	}
 	return attribute.Value{}, false
 }
+
+func TestExtractRequestData_CaptureAll(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	router := gin.New()
+	flow := &Flow{
+		ID: "orders",
+		Entrypoint: Entrypoint{
+			Type: "http",
+			Config: map[string]any{
+				"method":          "GET",
+				"path":            "/customers/:customerId/orders/:id",
+				"queryParameters": "*",
+				"headers":         "*",
+			},
+		},
+		Steps: []Step{{ID: "capture"}},
+	}
+	stepExecutor := &capturingStepExecutor{}
+	executor := NewExecutor(noopEvaluator{}, stepExecutor)
+	newStore := func() ValueStore { return NewValueStore() }
+	if err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/customers/c1/orders/42?status=open&tag=a&tag=b", nil)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept", "text/plain")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", rec.Code)
+	}
+	request, _ := stepExecutor.values["request"].(map[string]any)
+
+	wantPath := map[string]any{"customerId": "c1", "id": "42"}
+	if !reflect.DeepEqual(request["pathVariables"], wantPath) {
+		t.Fatalf("pathVariables = %#v, want %#v", request["pathVariables"], wantPath)
+	}
+	wantQuery := map[string]any{"status": "open", "tag": []any{"a", "b"}}
+	if !reflect.DeepEqual(request["queryParameters"], wantQuery) {
+		t.Fatalf("queryParameters = %#v, want %#v", request["queryParameters"], wantQuery)
+	}
+	headers, _ := request["headers"].(map[string]any)
+	if headers["x-request-id"] != "req-1" {
+		t.Fatalf("expected lower-cased x-request-id header, got %#v", headers)
+	}
+	if !reflect.DeepEqual(headers["accept"], []any{"application/json", "text/plain"}) {
+		t.Fatalf("accept = %#v, want both values", headers["accept"])
+	}
+}
+
+func TestExtractRequestData_ListedHeadersAreLowerCased(t *testing.T) {
+	listed := map[string]any{
+		"method":  "GET",
+		"path":    "/orders",
+		"headers": []any{"Content-Type", "X-Request-ID"},
+	}
+	rec, request, _ := serveSchemaFlow(t, listed, http.MethodGet, "/orders", "")
+	want := map[string]any{"content-type": "application/json", "x-request-id": ""}
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(request["headers"], want) {
+		t.Fatalf("status = %d, headers = %#v, want %#v", rec.Code, request["headers"], want)
+	}
+
+	declared := map[string]any{
+		"method": "GET",
+		"path":   "/orders",
+		"schema": map[string]any{
+			"headers": map[string]any{
+				"type":       "object",
+				"required":   []any{"Content-Type"},
+				"properties": map[string]any{"Content-Type": map[string]any{"type": "string"}},
+			},
+		},
+	}
+	rec, request, _ = serveSchemaFlow(t, declared, http.MethodGet, "/orders", "")
+	want = map[string]any{"content-type": "application/json"}
+	if rec.Code != http.StatusOK || !reflect.DeepEqual(request["headers"], want) {
+		t.Fatalf("status = %d, headers = %#v, want %#v", rec.Code, request["headers"], want)
+	}
+}
+
+func TestNewHttpHandler_RejectsInvalidCaptureMode(t *testing.T) {
+	flow := &Flow{
+		ID: "orders",
+		Entrypoint: Entrypoint{
+			Type:   "http",
+			Config: map[string]any{"method": "GET", "path": "/orders", "headers": "all"},
+		},
+	}
+	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
+
+	err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newTestValueStore, gin.New())
+	if err == nil || !strings.Contains(err.Error(), "headers must be a list") {
+		t.Fatalf("expected capture mode error, got %v", err)
+	}
+}
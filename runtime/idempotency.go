@@ -0,0 +1,324 @@
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyKey is the http entrypoint option enabling idempotency keys.
+	IdempotencyKey = "idempotency"
+
+	DefaultIdempotencyHeader = "Idempotency-Key"
+	DefaultIdempotencyTTL    = 24 * time.Hour
+	// DefaultIdempotencyLease is how long a key stays reserved for a request
+	// in flight without being renewed, so a crashed instance frees it soon.
+	DefaultIdempotencyLease = 2 * time.Minute
+
+	// IdempotentReplayedHeader marks responses replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	ErrorCodeIdempotencyInProgress  FlowErrorCode = "IDEMPOTENCY_KEY_IN_PROGRESS"
+	ErrorCodeIdempotencyKeyReused   FlowErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	ErrorCodeIdempotencyUnavailable FlowErrorCode = "IDEMPOTENCY_UNAVAILABLE"
+)
+
+// IdempotencyConfig is the parsed `idempotency` option of an http entrypoint.
+type IdempotencyConfig struct {
+	Header string        // request header carrying the key
+	TTL    time.Duration // how long a completed response is replayed
+	Lease  time.Duration // how long an in-flight reservation lasts unless renewed
+}
+
+// IdempotencyRecord is what a store holds for one key.
+type IdempotencyRecord struct {
+	Fingerprint string              `json:"fingerprint"` // hash of the method, path, query and body
+	Completed   bool                `json:"completed"`   // false while the first request is in flight
+	Response    *ResponseDescriptor `json:"response"`    // final response; nil means the default 200
+	ExpiresAt   time.Time           `json:"expires_at"`
+}
+
+// IdempotencyStore keeps the responses of flows with an idempotency option.
+// Keys are already scoped to the flow.
+type IdempotencyStore interface {
+	// Reserve claims key for a new execution and returns nil. If the key is
+	// already claimed and has not expired, it returns the existing record.
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error)
+	// Complete stores the final response of the execution that reserved key.
+	Complete(ctx context.Context, key string, response *ResponseDescriptor, ttl time.Duration) error
+	// Release drops a reservation so the request can be retried.
+	Release(ctx context.Context, key string) error
+	// Renew extends an in-flight reservation of key to ttl from now. Completed
+	// and released keys are left as they are.
+	Renew(ctx context.Context, key string, ttl time.Duration) error
+}
+
+// parseIdempotencyConfig reads `idempotency: { header: ..., ttl: ..., lease: ... }`.
+// ttl and lease are Go durations ("24h") or numbers of milliseconds.
+func parseIdempotencyConfig(raw any) (*IdempotencyConfig, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map, got %T", IdempotencyKey, raw)
+	}
+	cfg := &IdempotencyConfig{Header: DefaultIdempotencyHeader, TTL: DefaultIdempotencyTTL, Lease: DefaultIdempotencyLease}
+	for key, v := range m {
+		switch key {
+		case "header":
+			header, _ := v.(string)
+			if header == "" {
+				return nil, fmt.Errorf("%s.header must be a header name", IdempotencyKey)
+			}
+			cfg.Header = header
+		case "ttl":
+			ttl, err := parseTTL(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s.ttl: %w", IdempotencyKey, err)
+			}
+			cfg.TTL = ttl
+		case "lease":
+			lease, err := parseTTL(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s.lease: %w", IdempotencyKey, err)
+			}
+			cfg.Lease = lease
+		default:
+			return nil, fmt.Errorf("unsupported %s option %q (allowed: header, ttl, lease)", IdempotencyKey, key)
+		}
+	}
+	return cfg, nil
+}
+
+func parseTTL(v any) (time.Duration, error) {
+	var ttl time.Duration
+	switch t := v.(type) {
+	case int:
+		ttl = time.Duration(t) * time.Millisecond
+	case int64:
+		ttl = time.Duration(t) * time.Millisecond
+	case float64:
+		ttl = time.Duration(t) * time.Millisecond
+	case string:
+		if ms, err := strconv.Atoi(t); err == nil {
+			ttl = time.Duration(ms) * time.Millisecond
+			break
+		}
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", t)
+		}
+		ttl = d
+	default:
+		return 0, fmt.Errorf("expected a duration, got %T", v)
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("must be positive")
+	}
+	return ttl, nil
+}
+
+// idempotencyGuard applies a flow's idempotency option to its requests.
+type idempotencyGuard struct {
+	store  IdempotencyStore
+	config IdempotencyConfig
+	flowID string
+}
+
+// reservation is a key reserved by begin. It is renewed until finish.
+type reservation struct {
+	key  string
+	stop func() // stops renewing
+}
+
+func newIdempotencyGuard(flow *Flow, container *Container, cfg *IdempotencyConfig) *idempotencyGuard {
+	store := container.IdempotencyStore()
+	if store == nil {
+		// Handlers are registered sequentially at startup, so every flow shares it.
+		store = NewMemoryIdempotencyStore()
+		container.SetIdempotencyStore(store)
+	}
+	return &idempotencyGuard{store: store, config: *cfg, flowID: flow.ID}
+}
+
+// begin reserves the request's key. It returns the reservation to pass to
+// finish, or nil when the request carries no key. When done is true the
+// response was already written: a replay, a conflict or a store failure.
+func (g *idempotencyGuard) begin(c *gin.Context, e *Execution) (r *reservation, done bool, err error) {
+	header := c.GetHeader(g.config.Header)
+	if header == "" {
+		return nil, false, nil
+	}
+	key := g.flowID + ":" + header
+	fingerprint := requestFingerprint(c, e)
+
+	// The reservation lasts one lease and is renewed while the flow runs, so
+	// the key of a crashed execution is freed after a lease, not the TTL.
+	prior, err := g.store.Reserve(e, key, fingerprint, g.config.Lease)
+	if err != nil {
+		reqErr := NewRequestError(http.StatusServiceUnavailable, string(ErrorCodeIdempotencyUnavailable),
+			"Idempotency store is unavailable", err)
+		writeRequestError(c, e.Container.ErrorResponses(), reqErr)
+		return nil, true, reqErr
+	}
+	if prior == nil {
+		return &reservation{key: key, stop: g.renew(e, key)}, false, nil
+	}
+
+	var reqErr *RequestError
+	switch {
+	case prior.Fingerprint != fingerprint:
+		reqErr = NewRequestError(http.StatusUnprocessableEntity, string(ErrorCodeIdempotencyKeyReused),
+			fmt.Sprintf("%s was already used with a different request", g.config.Header), nil)
+	case !prior.Completed:
+		reqErr = NewRequestError(http.StatusConflict, string(ErrorCodeIdempotencyInProgress),
+			fmt.Sprintf("A request with this %s is still in progress", g.config.Header), nil)
+	}
+	if reqErr != nil {
+		writeRequestError(c, e.Container.ErrorResponses(), reqErr)
+		return nil, true, reqErr.FlowError()
+	}
+
+	e.Logger().Info("Replaying idempotent response", "idempotency_key", header)
+	e.State().SetResponse(prior.Response)
+	c.Header(IdempotentReplayedHeader, "true")
+	return nil, true, dispatchResponse(c, e)
+}
+
+// renew extends the reservation of key every third of a lease until the
+// returned function is called.
+func (g *idempotencyGuard) renew(e *Execution, key string) func() {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(e))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(g.config.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := g.store.Renew(ctx, key, g.config.Lease); err != nil && ctx.Err() == nil {
+					e.Logger().Warn("Renewing idempotency key failed", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// finish stores the response the client received, or releases the key when
+// the request failed with a server error so the client can retry it. A nil
+// response stands for the default 200.
+func (g *idempotencyGuard) finish(c *gin.Context, e *Execution, r *reservation, response *ResponseDescriptor) {
+	if r == nil {
+		return
+	}
+	r.stop()
+	ctx := context.WithoutCancel(e)
+	var err error
+	if c.Writer.Status() >= http.StatusInternalServerError {
+		err = g.store.Release(ctx, r.key)
+	} else {
+		err = g.store.Complete(ctx, r.key, response, g.config.TTL)
+	}
+	if err != nil {
+		e.Logger().Error("Updating idempotency key failed", "error", err)
+	}
+}
+
+// requestFingerprint hashes the method, the resolved path, the query and the
+// raw body, so a key reused for DELETE /orders/2 after DELETE /orders/1 is
+// rejected instead of replaying the first response. Query parameters are
+// compared in sorted order.
+func requestFingerprint(c *gin.Context, e *Execution) string {
+	raw, _ := e.State().Store().Get(RequestRawBodyKey)
+	body, _ := raw.(string)
+	h := sha256.New()
+	for _, part := range []string{c.Request.Method, c.Request.URL.Path, c.Request.URL.Query().Encode(), body} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryIdempotencyStore keeps idempotency records in process memory. It is
+// used when no other store is configured; records do not survive a restart
+// and are not shared between instances.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]*IdempotencyRecord
+	lastSweep time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: make(map[string]*IdempotencyRecord)}
+}
+
+func (s *MemoryIdempotencyStore) Reserve(_ context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	if rec, ok := s.records[key]; ok && now.Before(rec.ExpiresAt) {
+		prior := *rec
+		return &prior, nil
+	}
+	s.records[key] = &IdempotencyRecord{Fingerprint: fingerprint, ExpiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, response *ResponseDescriptor, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[key]
+	if !ok {
+		return fmt.Errorf("idempotency key %q is not reserved", key)
+	}
+	rec.Completed = true
+	rec.Response = response
+	rec.ExpiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Renew(_ context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rec, ok := s.records[key]; ok && !rec.Completed {
+		rec.ExpiresAt = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+// sweep drops expired records, at most once a minute.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, rec := range s.records {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
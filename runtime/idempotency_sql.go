@@ -0,0 +1,124 @@
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultIdempotencyTable is the table SQLIdempotencyStore uses.
+const DefaultIdempotencyTable = "sflowg_idempotency_keys"
+
+// SQLIdempotencyStore keeps idempotency records in a SQL table so replays
+// work across restarts and instances. Expired rows are replaced on the next
+// request with the same key.
+type SQLIdempotencyStore struct {
+	db      *sql.DB
+	dialect SQLDialect
+	table   string
+}
+
+// NewSQLIdempotencyStore uses DefaultIdempotencyTable. Call EnsureSchema
+// once at startup to create the table.
+func NewSQLIdempotencyStore(db *sql.DB, dialect SQLDialect) *SQLIdempotencyStore {
+	return &SQLIdempotencyStore{db: db, dialect: dialect, table: DefaultIdempotencyTable}
+}
+
+// EnsureSchema creates the idempotency table if it does not exist.
+func (s *SQLIdempotencyStore) EnsureSchema(ctx context.Context) error {
+	var ddl string
+	switch s.dialect {
+	case SQLDialectPostgres:
+		ddl = `CREATE TABLE IF NOT EXISTS %s (
+			key         TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			completed   BOOLEAN NOT NULL,
+			response    JSONB,
+			expires_at  TIMESTAMPTZ NOT NULL
+		)`
+	case SQLDialectSQLite:
+		ddl = `CREATE TABLE IF NOT EXISTS %s (
+			key         TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			completed   BOOLEAN NOT NULL,
+			response    TEXT,
+			expires_at  TIMESTAMP NOT NULL
+		)`
+	default:
+		return fmt.Errorf("unsupported SQL dialect %q", s.dialect)
+	}
+	if _, err := s.db.ExecContext(ctx, fmt.Sprintf(ddl, s.table)); err != nil {
+		return fmt.Errorf("creating %s: %w", s.table, err)
+	}
+	return nil
+}
+
+func (s *SQLIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotencyRecord, error) {
+	now := time.Now().UTC()
+	deleteExpired := rebind(s.dialect, fmt.Sprintf(`DELETE FROM %s WHERE key = ? AND expires_at <= ?`, s.table))
+	insert := rebind(s.dialect, fmt.Sprintf(`INSERT INTO %s (key, fingerprint, completed, expires_at)
+		VALUES (?, ?, FALSE, ?)
+		ON CONFLICT (key) DO NOTHING`, s.table))
+	selectRow := rebind(s.dialect, fmt.Sprintf(`SELECT fingerprint, completed, response, expires_at FROM %s WHERE key = ?`, s.table))
+
+	if _, err := s.db.ExecContext(ctx, deleteExpired, key, now); err != nil {
+		return nil, err
+	}
+	// The row may disappear between the insert and the select when its
+	// owner releases it; the second round then claims it.
+	for range 2 {
+		res, err := s.db.ExecContext(ctx, insert, key, fingerprint, now.Add(ttl))
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 1 {
+			return nil, nil
+		}
+
+		var (
+			rec      IdempotencyRecord
+			response sql.NullString
+		)
+		err = s.db.QueryRowContext(ctx, selectRow, key).Scan(&rec.Fingerprint, &rec.Completed, &response, &rec.ExpiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if response.Valid {
+			if err := json.Unmarshal([]byte(response.String), &rec.Response); err != nil {
+				return nil, fmt.Errorf("decoding stored response: %w", err)
+			}
+		}
+		return &rec, nil
+	}
+	return nil, fmt.Errorf("idempotency key %q could not be reserved", key)
+}
+
+func (s *SQLIdempotencyStore) Complete(ctx context.Context, key string, response *ResponseDescriptor, ttl time.Duration) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("encoding response: %w", err)
+	}
+	query := rebind(s.dialect, fmt.Sprintf(`UPDATE %s SET completed = TRUE, response = ?, expires_at = ? WHERE key = ?`, s.table))
+	_, err = s.db.ExecContext(ctx, query, string(data), time.Now().UTC().Add(ttl), key)
+	return err
+}
+
+func (s *SQLIdempotencyStore) Release(ctx context.Context, key string) error {
+	query := rebind(s.dialect, fmt.Sprintf(`DELETE FROM %s WHERE key = ?`, s.table))
+	_, err := s.db.ExecContext(ctx, query, key)
+	return err
+}
+
+func (s *SQLIdempotencyStore) Renew(ctx context.Context, key string, ttl time.Duration) error {
+	query := rebind(s.dialect, fmt.Sprintf(`UPDATE %s SET expires_at = ? WHERE key = ? AND completed = FALSE`, s.table))
+	_, err := s.db.ExecContext(ctx, query, time.Now().UTC().Add(ttl), key)
+	return err
+}
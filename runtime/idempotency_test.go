@@ -0,0 +1,281 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chargeStepExecutor answers 201 with a running charge number. It fails while
+// fail is set and blocks until release is closed when release is non-nil.
+type chargeStepExecutor struct {
+	runs    atomic.Int32
+	fail    atomic.Bool
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *chargeStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	n := s.runs.Add(1)
+	if s.started != nil {
+		s.started <- struct{}{}
+	}
+	if s.release != nil {
+		<-s.release
+	}
+	if s.fail.Load() {
+		return "", errors.New("card network down")
+	}
+	execution.State().SetResponse(&ResponseDescriptor{
+		HandlerName: "http.json",
+		Args:        map[string]any{"status": 201, "body": map[string]any{"charge": n}},
+	})
+	return "", nil
+}
+
+func newIdempotentRouter(t *testing.T, stepExecutor StepExecutor, idempotency map[string]any) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	flow := &Flow{
+		ID: "charges",
+		Entrypoint: Entrypoint{
+			Type: "http",
+			Config: map[string]any{
+				"method":       "POST",
+				"path":         "/charges",
+				"body":         map[string]any{"type": "json"},
+				IdempotencyKey: idempotency,
+			},
+		},
+		Steps: []Step{{ID: "charge"}},
+	}
+	executor := NewExecutor(noopEvaluator{}, stepExecutor)
+	if err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+	return router
+}
+
+func postCharge(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/charges", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotency_ReplaysStoredResponse(t *testing.T) {
+	stepExecutor := &chargeStepExecutor{}
+	router := newIdempotentRouter(t, stepExecutor, map[string]any{"ttl": "1h"})
+
+	first := postCharge(router, "key-1", `{"amount": 100}`)
+	second := postCharge(router, "key-1", `{"amount": 100}`)
+
+	if first.Code != http.StatusCreated || second.Code != http.StatusCreated {
+		t.Fatalf("status codes = %d, %d, want 201", first.Code, second.Code)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Fatalf("replayed body %s, want %s", second.Body.String(), first.Body.String())
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Error("replayed response must carry the Idempotent-Replayed header")
+	}
+	if got := stepExecutor.runs.Load(); got != 1 {
+		t.Fatalf("flow ran %d times, want 1", got)
+	}
+
+	// Requests without a key and with a new key run the flow.
+	postCharge(router, "", `{"amount": 100}`)
+	postCharge(router, "key-2", `{"amount": 100}`)
+	if got := stepExecutor.runs.Load(); got != 3 {
+		t.Fatalf("flow ran %d times, want 3", got)
+	}
+}
+
+func TestIdempotency_RejectsKeyReusedWithDifferentBody(t *testing.T) {
+	stepExecutor := &chargeStepExecutor{}
+	router := newIdempotentRouter(t, stepExecutor, map[string]any{})
+
+	postCharge(router, "key-1", `{"amount": 100}`)
+	rec := postCharge(router, "key-1", `{"amount": 999}`)
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", rec.Code)
+	}
+	if got := stepExecutor.runs.Load(); got != 1 {
+		t.Fatalf("flow ran %d times, want 1", got)
+	}
+}
+
+func TestIdempotency_FingerprintCoversPathAndQuery(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	flow := &Flow{
+		ID: "orders",
+		Entrypoint: Entrypoint{Type: "http", Config: map[string]any{
+			"method":       "DELETE",
+			"path":         "/orders/:id",
+			IdempotencyKey: map[string]any{},
+		}},
+		Steps: []Step{{ID: "cancel"}},
+	}
+	stepExecutor := &chargeStepExecutor{}
+	if err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), NewExecutor(noopEvaluator{}, stepExecutor), nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+	cancel := func(target string) int {
+		req := httptest.NewRequest(http.MethodDelete, target, nil)
+		req.Header.Set("Idempotency-Key", "key-1")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := cancel("/orders/1?reason=dup&notify=true"); code != http.StatusCreated {
+		t.Fatalf("first = %d, want 201", code)
+	}
+	if code := cancel("/orders/1?notify=true&reason=dup"); code != http.StatusCreated {
+		t.Fatalf("replay with reordered query = %d, want 201", code)
+	}
+	for _, target := range []string{"/orders/2?reason=dup&notify=true", "/orders/1?reason=other&notify=true"} {
+		if code := cancel(target); code != http.StatusUnprocessableEntity {
+			t.Errorf("%s = %d, want 422", target, code)
+		}
+	}
+	if got := stepExecutor.runs.Load(); got != 1 {
+		t.Fatalf("flow ran %d times, want 1", got)
+	}
+}
+
+func TestIdempotency_ConflictWhileInFlight(t *testing.T) {
+	stepExecutor := &chargeStepExecutor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	router := newIdempotentRouter(t, stepExecutor, map[string]any{})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postCharge(router, "key-1", `{"amount": 100}`) }()
+	select {
+	case <-stepExecutor.started:
+	case <-time.After(time.Second):
+		t.Fatal("first request did not start")
+	}
+
+	rec := postCharge(router, "key-1", `{"amount": 100}`)
+	close(stepExecutor.release)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate status = %d, want 409", rec.Code)
+	}
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("original status = %d, want 201", first.Code)
+	}
+}
+
+func TestIdempotency_RenewsLeaseWhileInFlight(t *testing.T) {
+	stepExecutor := &chargeStepExecutor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	router := newIdempotentRouter(t, stepExecutor, map[string]any{"lease": "30"})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postCharge(router, "key-1", `{"amount": 100}`) }()
+	<-stepExecutor.started
+
+	// Well past the lease, the running request still holds the key.
+	time.Sleep(100 * time.Millisecond)
+	rec := postCharge(router, "key-1", `{"amount": 100}`)
+	close(stepExecutor.release)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("duplicate status = %d, want 409", rec.Code)
+	}
+	if first := <-done; first.Code != http.StatusCreated {
+		t.Fatalf("original status = %d, want 201", first.Code)
+	}
+}
+
+func TestMemoryIdempotencyStore_LeaseExpires(t *testing.T) {
+	store := NewMemoryIdempotencyStore()
+	if prior, err := store.Reserve(t.Context(), "k", "f", 10*time.Millisecond); prior != nil || err != nil {
+		t.Fatalf("Reserve = %v, %v", prior, err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	// The reservation of a request that never finished has lapsed.
+	if prior, err := store.Reserve(t.Context(), "k", "f", time.Minute); prior != nil || err != nil {
+		t.Fatalf("Reserve after the lease = %v, %v, want a new reservation", prior, err)
+	}
+}
+
+func TestIdempotency_ServerErrorReleasesKey(t *testing.T) {
+	stepExecutor := &chargeStepExecutor{}
+	stepExecutor.fail.Store(true)
+	router := newIdempotentRouter(t, stepExecutor, map[string]any{})
+
+	if rec := postCharge(router, "key-1", `{"amount": 100}`); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", rec.Code)
+	}
+	stepExecutor.fail.Store(false)
+	if rec := postCharge(router, "key-1", `{"amount": 100}`); rec.Code != http.StatusCreated {
+		t.Fatalf("retry status = %d, want 201", rec.Code)
+	}
+	if got := stepExecutor.runs.Load(); got != 2 {
+		t.Fatalf("flow ran %d times, want 2", got)
+	}
+}
+
+func TestIdempotency_ReplaysFlowErrorResponse(t *testing.T) {
+	stepExecutor := failingMetricStepExecutor{err: &FlowError{
+		Type:    ErrorTypePermanent,
+		Code:    "CARD_DECLINED",
+		Message: "card was declined",
+		Status:  http.StatusPaymentRequired,
+	}}
+	router := newIdempotentRouter(t, stepExecutor, map[string]any{})
+
+	first := postCharge(router, "key-1", `{"amount": 100}`)
+	second := postCharge(router, "key-1", `{"amount": 100}`)
+
+	if first.Code != http.StatusPaymentRequired || second.Code != http.StatusPaymentRequired {
+		t.Fatalf("status codes = %d, %d, want 402", first.Code, second.Code)
+	}
+	if second.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatal("expected a replay")
+	}
+	if ct := second.Header().Get("Content-Type"); !strings.HasPrefix(ct, ProblemContentType) {
+		t.Fatalf("replayed Content-Type = %q", ct)
+	}
+	if first.Body.String() != second.Body.String() {
+		t.Fatalf("replayed body %s, want %s", second.Body.String(), first.Body.String())
+	}
+}
+
+func TestParseIdempotencyConfig(t *testing.T) {
+	cfg, err := parseIdempotencyConfig(map[string]any{"header": "X-Request-Id", "ttl": "90000"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Header != "X-Request-Id" || cfg.TTL != 90*time.Second || cfg.Lease != DefaultIdempotencyLease {
+		t.Fatalf("config = %+v", cfg)
+	}
+	if cfg, err := parseIdempotencyConfig(map[string]any{"lease": "5m"}); err != nil || cfg.Lease != 5*time.Minute {
+		t.Fatalf("config = %+v, %v", cfg, err)
+	}
+
+	for _, raw := range []any{
+		"yes",
+		map[string]any{"ttl": "soon"},
+		map[string]any{"ttl": "-1h"},
+		map[string]any{"lease": "0"},
+		map[string]any{"scope": "user"},
+	} {
+		if _, err := parseIdempotencyConfig(raw); err == nil {
+			t.Errorf("expected an error for %v", raw)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package runtime
 
+import "context"
+
 // Initializer interface allows plugins to perform startup initialization.
 // Plugins implementing this interface will have Initialize called at container startup.
 type Initializer interface {
@@ -18,3 +20,41 @@ type Shutdowner interface {
 	// The log parameter is pre-configured with source=plugin and plugin=name.
 	Shutdown(log Logger) error
 }
+
+// EntrypointProvider lets a plugin supply a new entrypoint type, used in flows
+// as entrypoint.<type> { ... } (queue consumers, file watchers, gRPC servers).
+// The container discovers it on registered plugins like Initializer/Shutdowner.
+type EntrypointProvider interface {
+	// EntrypointType is the type name flows use, e.g. "kafka" for entrypoint.kafka.
+	EntrypointType() string
+	// ValidateEntrypoint checks a flow's entrypoint config when flows are loaded.
+	// Returning an error fails startup.
+	ValidateEntrypoint(flowID string, config map[string]any) error
+	// StartEntrypoint begins delivering triggers for one flow. It is called once
+	// per flow after plugins are initialized and must not block.
+	StartEntrypoint(binding EntrypointBinding) error
+	// StopEntrypoints stops delivering triggers for all flows. In-flight
+	// Dispatch calls should be allowed to finish until ctx expires.
+	StopEntrypoints(ctx context.Context) error
+}
+
+// ExecutionStoreProvider lets a plugin supply the ExecutionStore used to
+// checkpoint flows that set a recovery policy. It is queried after plugins
+// are initialized; returning nil means the plugin's store is not enabled.
+type ExecutionStoreProvider interface {
+	ExecutionStore() ExecutionStore
+}
+
+// IdempotencyStoreProvider lets a plugin supply the IdempotencyStore used by
+// HTTP entrypoints with an idempotency option. It is queried after plugins
+// are initialized; returning nil means the plugin's store is not enabled.
+type IdempotencyStoreProvider interface {
+	IdempotencyStore() IdempotencyStore
+}
+
+// DeadLetterSinkProvider lets a plugin supply the DeadLetterSink receiving
+// compensations that failed after their retries. It is queried after plugins
+// are initialized; returning nil means the plugin's sink is not enabled.
+type DeadLetterSinkProvider interface {
+	DeadLetterSink() DeadLetterSink
+}
@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultMaxIterations bounds how often a step may jump back to an earlier
+// step when it does not set max_iterations.
+const DefaultMaxIterations = 100
+
+// Jump error codes.
+const (
+	ErrorCodeUnknownStep       FlowErrorCode = "UNKNOWN_STEP"
+	ErrorCodeLoopLimitExceeded FlowErrorCode = "LOOP_LIMIT_EXCEEDED"
+	ErrorCodeInvalidNextTarget FlowErrorCode = "INVALID_NEXT_TARGET"
+)
+
+// StepIndex returns the position of the top-level step with the given ID,
+// or -1 if the flow has no such step.
+func (f *Flow) StepIndex(id string) int {
+	for i, s := range f.Steps {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsStepReference reports whether a `next:` option names a step directly.
+// Anything else is a Risor expression evaluated after the step.
+func IsStepReference(next string) bool {
+	next = strings.TrimSpace(next)
+	if next == "" || (next[0] >= '0' && next[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(next); i++ {
+		c := next[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveNext returns the step the flow continues at after s, or "" to move
+// on to the following step. A next() call made by the step body wins over
+// the step's `next:` option.
+func (e *Executor) resolveNext(execution *Execution, s Step) (string, *FlowError) {
+	if target := execution.State().takeJump(); target != "" {
+		return target, nil
+	}
+	if s.Next == "" {
+		return "", nil
+	}
+	if IsStepReference(s.Next) {
+		return strings.TrimSpace(s.Next), nil
+	}
+
+	result, err := e.evaluator.Eval(execution, s.Next)
+	if err != nil {
+		return "", toFlowError(fmt.Errorf("error evaluating next %s: %w", s.Next, err), s.ID, 0)
+	}
+	switch v := result.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	default:
+		return "", &FlowError{
+			Type:    ErrorTypePermanent,
+			Code:    string(ErrorCodeInvalidNextTarget),
+			Message: fmt.Sprintf("next %s evaluated to %T, expected a step ID or nil", s.Next, result),
+			Step:    s.ID,
+		}
+	}
+}
+
+// jumpTo validates a jump from the step at index from and returns the index
+// to continue at. Backward jumps count against the source step's
+// max_iterations so polling loops cannot run forever.
+func jumpTo(execution *Execution, from int, target string, iterations map[string]int) (int, *FlowError) {
+	s := execution.Flow.Steps[from]
+	to := execution.Flow.StepIndex(target)
+	if to < 0 {
+		return 0, &FlowError{
+			Type:    ErrorTypePermanent,
+			Code:    string(ErrorCodeUnknownStep),
+			Message: fmt.Sprintf("next step %q does not exist", target),
+			Step:    s.ID,
+		}
+	}
+	if to > from {
+		return to, nil
+	}
+
+	limit := s.MaxIterations
+	if limit <= 0 {
+		limit = DefaultMaxIterations
+	}
+	iterations[s.ID]++
+	if iterations[s.ID] > limit {
+		return 0, &FlowError{
+			Type:    ErrorTypePermanent,
+			Code:    string(ErrorCodeLoopLimitExceeded),
+			Message: fmt.Sprintf("step %s jumped back to %s more than %d times", s.ID, target, limit),
+			Step:    s.ID,
+		}
+	}
+	return to, nil
+}
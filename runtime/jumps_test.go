@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// jumpStepExecutor records the order steps run in and counts polls.
+type jumpStepExecutor struct {
+	ran   []string
+	polls int
+}
+
+func (s *jumpStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	s.ran = append(s.ran, step.ID)
+	if step.ID == "poll" {
+		s.polls++
+		execution.AddValue("ready", s.polls >= 3)
+	}
+	if step.Body == "jump:finish" {
+		execution.State().SetJump("finish")
+	}
+	return "", nil
+}
+
+// readyEvaluator evaluates the `next:` expression of the poll step.
+type readyEvaluator struct{}
+
+func (readyEvaluator) Eval(execution *Execution, expression string) (any, error) {
+	if ready, _ := execution.Values()["ready"].(bool); ready {
+		return nil, nil
+	}
+	return "wait", nil
+}
+
+func runJumpFlow(steps ...Step) (*jumpStepExecutor, error) {
+	stepExecutor := &jumpStepExecutor{}
+	flow := &Flow{ID: "jumps", Steps: steps}
+	execution := NewExecution(flow, nil, nil, NewValueStore())
+	err := NewExecutor(readyEvaluator{}, stepExecutor).ExecuteSteps(execution)
+	return stepExecutor, err
+}
+
+func TestExecuteSteps_BackwardJumpLoopsUntilExpressionIsNil(t *testing.T) {
+	stepExecutor, err := runJumpFlow(
+		Step{ID: "start"},
+		Step{ID: "wait"},
+		Step{ID: "poll", Next: `ready ? nil : "wait"`},
+		Step{ID: "done"},
+	)
+	if err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	want := []string{"start", "wait", "poll", "wait", "poll", "wait", "poll", "done"}
+	if !reflect.DeepEqual(stepExecutor.ran, want) {
+		t.Fatalf("ran %v, want %v", stepExecutor.ran, want)
+	}
+}
+
+func TestExecuteSteps_BackwardJumpHitsMaxIterations(t *testing.T) {
+	_, err := runJumpFlow(
+		Step{ID: "wait"},
+		Step{ID: "check", Next: "wait", MaxIterations: 2},
+	)
+	fe, ok := err.(*FlowError)
+	if !ok || fe.Code != string(ErrorCodeLoopLimitExceeded) || fe.Step != "check" {
+		t.Fatalf("expected LOOP_LIMIT_EXCEEDED from check, got %v", err)
+	}
+}
+
+func TestExecuteSteps_NextCallSkipsForward(t *testing.T) {
+	stepExecutor, err := runJumpFlow(
+		Step{ID: "start", Body: "jump:finish", Next: "middle"},
+		Step{ID: "middle"},
+		Step{ID: "finish"},
+	)
+	if err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	// next() from the body wins over the `next:` option.
+	if want := []string{"start", "finish"}; !reflect.DeepEqual(stepExecutor.ran, want) {
+		t.Fatalf("ran %v, want %v", stepExecutor.ran, want)
+	}
+}
+
+func TestExecuteSteps_UnknownNextTarget(t *testing.T) {
+	_, err := runJumpFlow(Step{ID: "start", Next: "missing"})
+	fe, ok := err.(*FlowError)
+	if !ok || fe.Code != string(ErrorCodeUnknownStep) {
+		t.Fatalf("expected UNKNOWN_STEP, got %v", err)
+	}
+}
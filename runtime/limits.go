@@ -0,0 +1,266 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RateLimitKey is the http entrypoint option limiting requests per second.
+	RateLimitKey = "rate_limit"
+
+	ErrorCodeConcurrencyLimited FlowErrorCode = "CONCURRENCY_LIMITED"
+	ErrorCodeRateLimited        FlowErrorCode = "RATE_LIMITED"
+
+	// rateLimitSweepInterval bounds how often idle rate limit buckets are dropped.
+	rateLimitSweepInterval = time.Minute
+)
+
+// BulkheadConfig is the map form of the `concurrency` step option. Steps
+// naming the same key share its slots across flows and requests.
+type BulkheadConfig struct {
+	Key          string `json:"key"`
+	Limit        int    `json:"limit"`         // attempts running at once
+	QueueTimeout int    `json:"queue_timeout"` // ms to wait for a slot; 0 waits until the step deadline
+}
+
+// bulkhead bounds the concurrent attempts of the steps sharing its key.
+type bulkhead struct {
+	key   string
+	slots chan struct{}
+}
+
+// acquire waits up to timeout (0: until ctx ends) for a slot and returns the
+// function releasing it, or nil when no slot freed up in time.
+func (b *bulkhead) acquire(ctx context.Context, timeout time.Duration) func() {
+	release := func() { <-b.slots }
+	select {
+	case b.slots <- struct{}{}:
+		return release
+	default:
+	}
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case b.slots <- struct{}{}:
+		return release
+	case <-expired:
+		return nil
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// bulkheadRegistry holds the process-wide bulkheads by key.
+type bulkheadRegistry struct {
+	mu        sync.Mutex
+	bulkheads map[string]*bulkhead
+}
+
+// bulkhead returns the bulkhead named by cfg, creating it on first use.
+// A bulkhead keeps the limit it was created with.
+func (c *Container) bulkhead(cfg BulkheadConfig) *bulkhead {
+	c.bulkheads.mu.Lock()
+	defer c.bulkheads.mu.Unlock()
+	if b, ok := c.bulkheads.bulkheads[cfg.Key]; ok {
+		return b
+	}
+	if c.bulkheads.bulkheads == nil {
+		c.bulkheads.bulkheads = make(map[string]*bulkhead)
+	}
+	b := &bulkhead{key: cfg.Key, slots: make(chan struct{}, cfg.Limit)}
+	c.bulkheads.bulkheads[cfg.Key] = b
+	return b
+}
+
+// RegisterBulkheads creates the bulkheads the steps of flows declare. Steps
+// sharing a concurrency key must set the same limit.
+func (c *Container) RegisterBulkheads(flows map[string]Flow) error {
+	declared := make(map[string]string) // key -> "flow/step" declaring it
+	return walkFlowSteps(flows, func(flowID string, s Step) error {
+		if s.Bulkhead == nil {
+			return nil
+		}
+		b := c.bulkhead(*s.Bulkhead)
+		where := flowID + "/" + s.ID
+		if first, ok := declared[b.key]; ok && cap(b.slots) != s.Bulkhead.Limit {
+			return fmt.Errorf("step %s: concurrency key %q has limit %d in %s", where, b.key, cap(b.slots), first)
+		}
+		declared[b.key] = where
+		return nil
+	})
+}
+
+// acquireBulkhead takes a slot of the step's bulkhead for one attempt. It
+// returns the release function, or the transient CONCURRENCY_LIMITED error
+// when no slot freed up within the queue timeout.
+func acquireBulkhead(ctx context.Context, execution *Execution, step Step) (func(), *FlowError) {
+	cfg := step.Bulkhead
+	if cfg == nil || execution.Container == nil {
+		return func() {}, nil
+	}
+	b := execution.Container.bulkhead(*cfg)
+	start := time.Now()
+	release := b.acquire(ctx, time.Duration(cfg.QueueTimeout)*time.Millisecond)
+	execution.Metrics().RecordBulkheadWait(ctx, b.key, release != nil, time.Since(start))
+	if release != nil {
+		return release, nil
+	}
+
+	execution.Metrics().RecordLimitRejection(ctx, execFlowID(execution), step.ID, "concurrency", b.key)
+	if err := ctx.Err(); err != nil {
+		return nil, toFlowError(err, step.ID, 0)
+	}
+	return nil, &FlowError{
+		Type:    ErrorTypeTransient,
+		Code:    string(ErrorCodeConcurrencyLimited),
+		Message: fmt.Sprintf("concurrency limit %s reached (%d running)", b.key, cap(b.slots)),
+		Step:    step.ID,
+		Status:  http.StatusServiceUnavailable,
+		Meta:    map[string]any{"concurrency_key": b.key},
+	}
+}
+
+// RateLimitConfig is the `rate_limit` option of an http entrypoint.
+type RateLimitConfig struct {
+	RPS   float64 // requests per second refilled
+	Burst int     // requests allowed at once (default: RPS rounded up)
+	Key   string  // expression partitioning the limit, e.g. request.headers["x-api-key"]
+}
+
+// parseRateLimitConfig reads the rate_limit option. A nil config means the
+// entrypoint is not rate limited.
+func parseRateLimitConfig(raw any) (*RateLimitConfig, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	m, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map", RateLimitKey)
+	}
+	cfg := &RateLimitConfig{}
+	for key, v := range m {
+		switch key {
+		case "rps":
+			rps, err := strconv.ParseFloat(fmt.Sprintf("%v", v), 64)
+			if err != nil || rps <= 0 {
+				return nil, fmt.Errorf("%s.rps must be a positive number, got %v", RateLimitKey, v)
+			}
+			cfg.RPS = rps
+		case "burst":
+			burst, ok := toInt64(v)
+			if !ok || burst < 1 {
+				return nil, fmt.Errorf("%s.burst must be a positive integer, got %v", RateLimitKey, v)
+			}
+			cfg.Burst = int(burst)
+		case "key":
+			cfg.Key = fmt.Sprintf("%v", v)
+		default:
+			return nil, fmt.Errorf("unsupported %s field: %s (allowed: rps, burst, key)", RateLimitKey, key)
+		}
+	}
+	if cfg.RPS == 0 {
+		return nil, fmt.Errorf("%s requires rps", RateLimitKey)
+	}
+	if cfg.Burst == 0 {
+		cfg.Burst = int(math.Ceil(cfg.RPS))
+	}
+	return cfg, nil
+}
+
+// tokenBucket holds the tokens left for one rate limit key.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter is a token bucket per evaluated key of one entrypoint.
+type rateLimiter struct {
+	config    RateLimitConfig
+	evaluator ExpressionEvaluator
+	readsBody bool // the key needs request.body or request.rawBody
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(cfg *RateLimitConfig, evaluator ExpressionEvaluator) *rateLimiter {
+	return &rateLimiter{
+		config:    *cfg,
+		evaluator: evaluator,
+		readsBody: strings.Contains(cfg.Key, RequestBodyPrefix) || strings.Contains(cfg.Key, RequestRawBodyKey),
+		buckets:   make(map[string]*tokenBucket),
+	}
+}
+
+// check takes a token for the request's key. When none is left it writes
+// Retry-After and returns the 429 RequestError to reject the request with.
+func (l *rateLimiter) check(c *gin.Context, e *Execution) *RequestError {
+	key := ""
+	if l.config.Key != "" {
+		v, err := l.evaluator.Eval(e, l.config.Key)
+		if err != nil {
+			e.Logger().Warn("Evaluating rate limit key failed; using the shared limit", "key", l.config.Key, "error", err)
+		} else if v != nil {
+			key = fmt.Sprintf("%v", v)
+		}
+	}
+
+	wait := l.take(key, time.Now())
+	if wait == 0 {
+		return nil
+	}
+	e.Metrics().RecordLimitRejection(e, e.Flow.ID, "", "rate_limit", e.Flow.ID)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return NewRequestError(http.StatusTooManyRequests, string(ErrorCodeRateLimited), "Rate limit exceeded, retry later", nil)
+}
+
+// take consumes a token of key's bucket. It returns 0 on success, else how
+// long until a token is available.
+func (l *rateLimiter) take(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	burst := float64(l.config.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.config.RPS)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / l.config.RPS * float64(time.Second))
+}
+
+// sweep drops buckets that refilled completely; they equal a new bucket.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	full := time.Duration(float64(l.config.Burst) / l.config.RPS * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= full {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package runtime
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBulkhead_RejectsWhenQueueTimeoutExpires(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	stepExecutor := &chargeStepExecutor{started: make(chan struct{}, 1), release: make(chan struct{})}
+	flow := &Flow{ID: "orders", Steps: []Step{{
+		ID:       "insert",
+		Bulkhead: &BulkheadConfig{Key: "postgres", Limit: 1, QueueTimeout: 20},
+	}}}
+	executor := NewExecutor(noopEvaluator{}, stepExecutor)
+
+	first := make(chan error, 1)
+	go func() { first <- executor.ExecuteSteps(NewExecution(flow, container, nil, newTestValueStore())) }()
+	<-stepExecutor.started
+
+	err := executor.ExecuteSteps(NewExecution(flow, container, nil, newTestValueStore()))
+	var fe *FlowError
+	if !errors.As(err, &fe) || fe.Code != string(ErrorCodeConcurrencyLimited) || fe.Type != ErrorTypeTransient {
+		t.Fatalf("expected CONCURRENCY_LIMITED, got %v", err)
+	}
+	if status := (ErrorResponseConfig{}).status(fe); status != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", status)
+	}
+
+	close(stepExecutor.release)
+	if err := <-first; err != nil {
+		t.Fatalf("first execution failed: %v", err)
+	}
+	// The slot is free again.
+	if err := executor.ExecuteSteps(NewExecution(flow, container, nil, newTestValueStore())); err != nil {
+		t.Fatalf("execution after release failed: %v", err)
+	}
+}
+
+func TestBulkhead_WaitsForSlot(t *testing.T) {
+	container := NewContainer(NewLogger(nil))
+	b := container.bulkhead(BulkheadConfig{Key: "postgres", Limit: 1})
+	release := b.acquire(t.Context(), 0)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	if b.acquire(t.Context(), time.Second) == nil {
+		t.Fatal("expected the slot once released")
+	}
+}
+
+func TestRegisterBulkheads_RejectsDifferentLimits(t *testing.T) {
+	flows := map[string]Flow{
+		"a": {ID: "a", Steps: []Step{{ID: "insert", Bulkhead: &BulkheadConfig{Key: "postgres", Limit: 20}}}},
+		"b": {ID: "b", Steps: []Step{{ID: "update", Bulkhead: &BulkheadConfig{Key: "postgres", Limit: 10}}}},
+	}
+	err := NewContainer(NewLogger(nil)).RegisterBulkheads(flows)
+	if err == nil || !strings.Contains(err.Error(), `concurrency key "postgres" has limit 20 in a/insert`) {
+		t.Fatalf("expected a limit conflict, got %v", err)
+	}
+}
+
+func TestRateLimit_RejectsPerKey(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	flow := &Flow{ID: "search", Entrypoint: Entrypoint{Type: "http", Config: map[string]any{
+		"method":     "GET",
+		"path":       "/search",
+		HeadersKey:   CaptureAll,
+		RateLimitKey: map[string]any{"rps": "1", "burst": "2", "key": "request.headers.x-api-key"},
+	}}}
+	executor := NewExecutor(lookupEvaluator{}, noopStepExecutor{})
+	if err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+
+	get := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/search", nil)
+		req.Header.Set("X-Api-Key", key)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := range 2 {
+		if rec := get("alice"); rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d, want 200", i, rec.Code)
+		}
+	}
+	rec := get("alice")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("third request = %d (Retry-After %q), want 429", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(rec.Body.String(), "Rate limit exceeded") {
+		t.Fatalf("body = %s", rec.Body.String())
+	}
+	if rec := get("bob"); rec.Code != http.StatusOK {
+		t.Fatalf("other key = %d, want 200", rec.Code)
+	}
+}
+
+func TestRateLimit_RejectsBeforeReadingBody(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+	router := gin.New()
+	flow := &Flow{ID: "orders", Entrypoint: Entrypoint{Type: "http", Config: map[string]any{
+		"method":     "POST",
+		"path":       "/orders",
+		RateLimitKey: map[string]any{"rps": "1", "burst": "1"},
+	}}}
+	executor := NewExecutor(lookupEvaluator{}, noopStepExecutor{})
+	if err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+
+	post := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post(`{"id": 1}`); code != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", code)
+	}
+	// A malformed body over the limit is rejected without being parsed.
+	if code := post(`{"id":`); code != http.StatusTooManyRequests {
+		t.Fatalf("malformed request over the limit = %d, want 429", code)
+	}
+}
+
+func TestRateLimiter_ReadsBodyOnlyForBodyKeys(t *testing.T) {
+	for key, want := range map[string]bool{
+		"":                         false,
+		`request.headers["x-key"]`: false,
+		"request.body.customer_id": true,
+		"request.rawBody":          true,
+	} {
+		if l := newRateLimiter(&RateLimitConfig{RPS: 1, Burst: 1, Key: key}, noopEvaluator{}); l.readsBody != want {
+			t.Errorf("readsBody(%q) = %v, want %v", key, l.readsBody, want)
+		}
+	}
+}
+
+func TestRateLimiter_Refills(t *testing.T) {
+	l := newRateLimiter(&RateLimitConfig{RPS: 10, Burst: 1}, noopEvaluator{})
+	now := time.Now()
+	if wait := l.take("", now); wait != 0 {
+		t.Fatalf("first take waited %v", wait)
+	}
+	if wait := l.take("", now); wait != 100*time.Millisecond {
+		t.Fatalf("wait = %v, want 100ms", wait)
+	}
+	if wait := l.take("", now.Add(100*time.Millisecond)); wait != 0 {
+		t.Fatalf("take after refill waited %v", wait)
+	}
+}
+
+func TestParseRateLimitConfig(t *testing.T) {
+	cfg, err := parseRateLimitConfig(map[string]any{"rps": "2.5"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RPS != 2.5 || cfg.Burst != 3 || cfg.Key != "" {
+		t.Fatalf("config = %+v", cfg)
+	}
+
+	for _, raw := range []any{
+		"fast",
+		map[string]any{"burst": 10},
+		map[string]any{"rps": "0"},
+		map[string]any{"rps": 10, "burst": "-1"},
+		map[string]any{"rps": 10, "window": "1m"},
+	} {
+		if _, err := parseRateLimitConfig(raw); err == nil {
+			t.Errorf("expected an error for %v", raw)
+		}
+	}
+}
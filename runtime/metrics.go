@@ -19,6 +19,7 @@ const (
 	metricOutcomeSuccess   = "success"
 	metricOutcomeError     = "error"
 	metricOutcomeTimeout   = "timeout"
+	metricOutcomeClient    = "client_error"
 	metricStatusClass2xx   = "2xx"
 	metricStatusClass4xx   = "4xx"
 	metricStatusClass5xx   = "5xx"
@@ -44,6 +45,12 @@ type Metrics struct {
 	pluginDurationMS otelmetric.Float64Histogram
 	httpRequests     otelmetric.Int64Counter
 	httpDurationMS   otelmetric.Float64Histogram
+	compensations    otelmetric.Int64Counter
+	compensationMS   otelmetric.Float64Histogram
+	breakerChanges   otelmetric.Int64Counter
+	breakerRejects   otelmetric.Int64Counter
+	bulkheadWaitMS   otelmetric.Float64Histogram
+	limitRejects     otelmetric.Int64Counter
 
 	user userMetricsState
 }
@@ -108,6 +115,8 @@ func newMeterProvider(cfg MetricsConfig, reader sdkmetric.Reader) (*sdkmetric.Me
 		newHistogramView("sflowg.flow.duration_ms", resolveHistogramBuckets(cfg.HistogramBuckets.FlowMS, defaultFlowBuckets)),
 		newHistogramView("sflowg.step.duration_ms", resolveHistogramBuckets(cfg.HistogramBuckets.StepMS, defaultStepBuckets)),
 		newHistogramView("sflowg.plugin.duration_ms", resolveHistogramBuckets(cfg.HistogramBuckets.PluginMS, defaultPluginBuckets)),
+		newHistogramView("sflowg.compensation.duration_ms", resolveHistogramBuckets(cfg.HistogramBuckets.StepMS, defaultStepBuckets)),
+		newHistogramView("sflowg.bulkhead.wait_ms", resolveHistogramBuckets(cfg.HistogramBuckets.StepMS, defaultStepBuckets)),
 	}
 	// Register custom bucket views for predeclared user histograms.
 	for name, decl := range cfg.User.Declarations {
@@ -190,6 +199,50 @@ func newMetrics(provider otelmetric.MeterProvider) (*Metrics, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create HTTP duration histogram: %w", err)
 	}
+	compensations, err := meter.Int64Counter(
+		"sflowg.compensation.executions",
+		otelmetric.WithDescription("Total number of completed compensation runs."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create compensation counter: %w", err)
+	}
+	compensationMS, err := meter.Float64Histogram(
+		"sflowg.compensation.duration_ms",
+		otelmetric.WithDescription("Compensation duration in milliseconds, including retries."),
+		otelmetric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create compensation duration histogram: %w", err)
+	}
+	breakerChanges, err := meter.Int64Counter(
+		"sflowg.circuit_breaker.transitions",
+		otelmetric.WithDescription("Total number of circuit breaker state changes."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create circuit breaker transition counter: %w", err)
+	}
+	breakerRejects, err := meter.Int64Counter(
+		"sflowg.circuit_breaker.rejections",
+		otelmetric.WithDescription("Total number of step calls rejected by an open circuit breaker."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create circuit breaker rejection counter: %w", err)
+	}
+	bulkheadWaitMS, err := meter.Float64Histogram(
+		"sflowg.bulkhead.wait_ms",
+		otelmetric.WithDescription("Time steps waited for a concurrency slot in milliseconds."),
+		otelmetric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create bulkhead wait histogram: %w", err)
+	}
+	limitRejects, err := meter.Int64Counter(
+		"sflowg.limit.rejections",
+		otelmetric.WithDescription("Total number of steps and requests rejected by a concurrency or rate limit."),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create limit rejection counter: %w", err)
+	}
 
 	return &Metrics{
 		flowExecutions:   flowExecutions,
@@ -201,6 +254,12 @@ func newMetrics(provider otelmetric.MeterProvider) (*Metrics, error) {
 		pluginDurationMS: pluginDurationMS,
 		httpRequests:     httpRequests,
 		httpDurationMS:   httpDurationMS,
+		compensations:    compensations,
+		compensationMS:   compensationMS,
+		breakerChanges:   breakerChanges,
+		breakerRejects:   breakerRejects,
+		bulkheadWaitMS:   bulkheadWaitMS,
+		limitRejects:     limitRejects,
 		user: userMetricsState{
 			meter: meter,
 		},
@@ -236,6 +295,73 @@ func (m *Metrics) RecordRetry(ctx context.Context, flowID string, stepID string,
 	m.stepRetries.Add(ctx, 1, otelmetric.WithAttributes(attrs...))
 }
 
+func (m *Metrics) RecordCompensation(ctx context.Context, flowID string, stepID string, path string, outcome string, duration time.Duration) {
+	if m.compensations == nil || m.compensationMS == nil {
+		return
+	}
+
+	attrs := m.stepAttributes(flowID, stepID, path, outcome)
+	m.compensations.Add(ctx, 1, otelmetric.WithAttributes(attrs...))
+	m.compensationMS.Record(ctx, durationMilliseconds(duration), otelmetric.WithAttributes(attrs...))
+}
+
+func (m *Metrics) RecordBreakerTransition(ctx context.Context, breaker string, from string, to string) {
+	if m.breakerChanges == nil {
+		return
+	}
+
+	m.breakerChanges.Add(ctx, 1, otelmetric.WithAttributes(
+		attribute.String("breaker", normalizeMetricValue(breaker)),
+		attribute.String("from", normalizeMetricValue(from)),
+		attribute.String("to", normalizeMetricValue(to)),
+	))
+}
+
+func (m *Metrics) RecordBreakerRejection(ctx context.Context, flowID string, stepID string, breaker string) {
+	if m.breakerRejects == nil {
+		return
+	}
+
+	m.breakerRejects.Add(ctx, 1, otelmetric.WithAttributes(
+		attribute.String("flow.id", normalizeMetricValue(flowID)),
+		attribute.String("step.id", normalizeMetricValue(stepID)),
+		attribute.String("breaker", normalizeMetricValue(breaker)),
+	))
+}
+
+func (m *Metrics) RecordBulkheadWait(ctx context.Context, key string, acquired bool, duration time.Duration) {
+	if m.bulkheadWaitMS == nil {
+		return
+	}
+
+	outcome := "acquired"
+	if !acquired {
+		outcome = "rejected"
+	}
+	m.bulkheadWaitMS.Record(ctx, durationMilliseconds(duration), otelmetric.WithAttributes(
+		attribute.String("bulkhead", normalizeMetricValue(key)),
+		attribute.String("outcome", outcome),
+	))
+}
+
+// RecordLimitRejection counts a rejection by a limit of the given kind
+// ("concurrency" or "rate_limit"). stepID is empty for rate limits.
+func (m *Metrics) RecordLimitRejection(ctx context.Context, flowID string, stepID string, kind string, name string) {
+	if m.limitRejects == nil {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("flow.id", normalizeMetricValue(flowID)),
+		attribute.String("limit.kind", kind),
+		attribute.String("limit.name", normalizeMetricValue(name)),
+	}
+	if strings.TrimSpace(stepID) != "" {
+		attrs = append(attrs, attribute.String("step.id", normalizeMetricValue(stepID)))
+	}
+	m.limitRejects.Add(ctx, 1, otelmetric.WithAttributes(attrs...))
+}
+
 func (m *Metrics) RecordPluginCall(ctx context.Context, flowID string, stepID string, pluginName string, method string, outcome string, duration time.Duration) {
 	if m.pluginCalls == nil || m.pluginDurationMS == nil {
 		return
@@ -343,6 +469,8 @@ func classifyMetricOutcome(err error) string {
 		switch flowErr.Type {
 		case ErrorTypeTimeout:
 			return metricOutcomeTimeout
+		case ErrorTypeClient:
+			return metricOutcomeClient
 		default:
 			if flowErr.Code == string(ErrorCodeDeadlineExceeded) || flowErr.Code == string(ErrorCodeContextCancelled) {
 				return metricOutcomeTimeout
@@ -382,6 +510,8 @@ func normalizeOutcome(value string) string {
 		return metricOutcomeError
 	case metricOutcomeTimeout:
 		return metricOutcomeTimeout
+	case metricOutcomeClient:
+		return metricOutcomeClient
 	default:
 		return metricUnknownValue
 	}
@@ -393,6 +523,8 @@ func normalizePath(value string) string {
 		return string(SuccessPathPrimary)
 	case SuccessPathFallback:
 		return string(SuccessPathFallback)
+	case SuccessPathCatch:
+		return string(SuccessPathCatch)
 	default:
 		return metricUnknownValue
 	}
@@ -104,6 +104,9 @@ func TestMetricClassificationHelpers(t *testing.T) {
 	if got := classifyMetricOutcome(&FlowError{Type: ErrorTypeTimeout, Code: string(ErrorCodeDeadlineExceeded)}); got != metricOutcomeTimeout {
 		t.Fatalf("expected timeout outcome for flow error, got %q", got)
 	}
+	if got := classifyMetricOutcome(&FlowError{Type: ErrorTypeClient, Code: string(ErrorCodeInvalidRequest)}); got != metricOutcomeClient {
+		t.Fatalf("expected client_error outcome for client flow error, got %q", got)
+	}
 	if got := classifyMetricOutcome(errors.New("boom")); got != metricOutcomeError {
 		t.Fatalf("expected error outcome, got %q", got)
 	}
@@ -241,6 +244,56 @@ func TestHandleRequest_EmitsErrorMetrics(t *testing.T) {
 	}
 }
 
+func TestHandleRequest_EmitsClientErrorMetricsForMalformedBody(t *testing.T) {
+	gin.SetMode(gin.ReleaseMode)
+
+	metrics, reader := newTestMetrics(t)
+	container := NewContainer(NewLogger(nil))
+	container.SetMetrics(metrics)
+
+	router := gin.New()
+	flow := &Flow{
+		ID: "payments",
+		Entrypoint: Entrypoint{
+			Type: "http",
+			Config: map[string]any{
+				"method": "POST",
+				"path":   "/payments",
+				"body":   map[string]any{"type": "json"},
+			},
+		},
+		Steps: []Step{{ID: "charge"}},
+	}
+	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
+	if err := NewHttpHandler(flow, container, executor, nil, newTestValueStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("{not json"))
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 status, got %d", rec.Code)
+	}
+
+	rm := collectMetrics(t, reader)
+	if got := findInt64SumValue(t, rm, "sflowg.flow.executions", map[string]string{
+		"flow.id": "payments",
+		"outcome": "client_error",
+	}); got != 1 {
+		t.Fatalf("expected client_error flow execution count 1, got %d", got)
+	}
+	if got := findInt64SumValue(t, rm, "sflowg.http.server.requests", map[string]string{
+		"flow.id":           "payments",
+		"http.method":       "POST",
+		"http.route":        "/payments",
+		"http.status_class": "4xx",
+	}); got != 1 {
+		t.Fatalf("expected 4xx HTTP request count 1, got %d", got)
+	}
+}
+
 func TestHandleRequest_EmitsTimeoutMetrics(t *testing.T) {
 	gin.SetMode(gin.ReleaseMode)
 
@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// executeParallel runs the branches of a parallel group concurrently and
+// joins on completion. Branches share the RunState, so each result lands
+// under its own step ID. The group's Timeout bounds all branches together;
+// per-branch retry and timeout settings apply as for sequential steps.
+func (e *Executor) executeParallel(execution *Execution, s Step) *FlowError {
+	group := s.Parallel
+	mode := group.Mode
+	if mode == "" {
+		mode = ParallelFailFast
+	}
+
+	parentCtx := execution.ctx
+	if parentCtx == nil {
+		parentCtx = context.Background()
+	}
+	spanCtx, span := execution.Tracer().Start(parentCtx, fmt.Sprintf("parallel %s", s.ID),
+		trace.WithAttributes(
+			attribute.String("parallel.id", s.ID),
+			attribute.String("parallel.mode", mode),
+			attribute.Int("parallel.branches", len(group.Steps)),
+		),
+	)
+	defer span.End()
+
+	groupCtx, cancel := context.WithCancel(spanCtx)
+	defer cancel()
+	if s.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		groupCtx, cancelTimeout = context.WithTimeout(groupCtx, time.Duration(s.Timeout)*time.Millisecond)
+		defer cancelTimeout()
+	}
+
+	log := execution.Logger()
+	log.Info(fmt.Sprintf("Running parallel group %s (%d branches, %s)", s.ID, len(group.Steps), mode))
+
+	branchExec := execution.WithContext(groupCtx)
+	failures := make([]*FlowError, len(group.Steps))
+	var (
+		wg        sync.WaitGroup
+		firstOnce sync.Once
+		first     *FlowError
+	)
+	for i, branch := range group.Steps {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, fe := e.runStep(branchExec, branch)
+			if fe == nil {
+				return
+			}
+			failures[i] = fe
+			firstOnce.Do(func() {
+				first = fe
+				if mode == ParallelFailFast {
+					// Siblings observe the cancellation at their next
+					// attempt or inside their plugin calls.
+					cancel()
+				}
+			})
+		}()
+	}
+	wg.Wait()
+
+	if first == nil {
+		return nil
+	}
+
+	fe := first
+	if mode == ParallelCollectAll {
+		fe = collectBranchFailures(s.ID, group.Steps, failures)
+	}
+	span.RecordError(fe)
+	span.SetStatus(codes.Error, fe.Message)
+	log.Error(fmt.Sprintf("Parallel group %s failed", s.ID), "error_code", fe.Code, "error", fe.Message)
+	return fe
+}
+
+// collectBranchFailures reports every failed branch of a collect_all group.
+// The type and code of the first failing branch (in declaration order) are
+// kept so retry and on_error policies classify the group like that branch.
+func collectBranchFailures(groupID string, branches []Step, failures []*FlowError) *FlowError {
+	var primary *FlowError
+	failed := make(map[string]any)
+	for i, fe := range failures {
+		if fe == nil {
+			continue
+		}
+		if primary == nil {
+			primary = fe
+		}
+		failed[branches[i].ID] = fe.ToMap()
+	}
+
+	return &FlowError{
+		Type: primary.Type,
+		Code: primary.Code,
+		Message: fmt.Sprintf("parallel group %s: %d of %d branches failed: %s",
+			groupID, len(failed), len(branches), primary.Message),
+		Step: primary.Step,
+		Meta: map[string]any{
+			"parallel": groupID,
+			"branches": failed,
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// parallelStepExecutor runs steps by body: "ok" stores the step ID, "slow"
+// waits for cancellation or 200ms, "fail" fails permanently and "flaky"
+// fails transiently on its first attempt.
+type parallelStepExecutor struct {
+	running    atomic.Int32
+	maxRunning atomic.Int32
+	mu         sync.Mutex
+	attempts   map[string]int
+	cancelled  map[string]bool
+}
+
+func newParallelStepExecutor() *parallelStepExecutor {
+	return &parallelStepExecutor{attempts: map[string]int{}, cancelled: map[string]bool{}}
+}
+
+func (s *parallelStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	n := s.running.Add(1)
+	defer s.running.Add(-1)
+	for {
+		max := s.maxRunning.Load()
+		if n <= max || s.maxRunning.CompareAndSwap(max, n) {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.attempts[step.ID]++
+	attempt := s.attempts[step.ID]
+	s.mu.Unlock()
+
+	switch step.Body {
+	case "fail":
+		return "", &FlowError{Type: ErrorTypePermanent, Code: "BRANCH_FAILED", Message: "boom", Step: step.ID}
+	case "flaky":
+		if attempt == 1 {
+			return "", &FlowError{Type: ErrorTypeTransient, Code: "TEMPORARY", Message: "retry me", Step: step.ID}
+		}
+	case "slow":
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.cancelled[step.ID] = true
+			s.mu.Unlock()
+			return "", ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	execution.State().Store().Set(step.ID, step.ID+" done")
+	return "", nil
+}
+
+func runParallelFlow(t *testing.T, stepExecutor StepExecutor, group Step) (*Execution, error) {
+	t.Helper()
+	flow := &Flow{ID: "parallel", Steps: []Step{group}}
+	execution := NewExecution(flow, NewContainer(NewLogger(nil)), nil, NewValueStore())
+	err := NewExecutor(noopEvaluator{}, stepExecutor).ExecuteSteps(execution)
+	return execution, err
+}
+
+func TestExecuteParallel_RunsBranchesConcurrently(t *testing.T) {
+	stepExecutor := newParallelStepExecutor()
+	group := Step{ID: "fetch", Parallel: &ParallelGroup{Steps: []Step{
+		{ID: "customer", Body: "slow"},
+		{ID: "orders", Body: "slow"},
+		{ID: "invoices", Body: "flaky", Retry: &RetryConfig{MaxAttempts: 2}},
+	}}}
+
+	start := time.Now()
+	execution, err := runParallelFlow(t, stepExecutor, group)
+	if err != nil {
+		t.Fatalf("ExecuteSteps failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 350*time.Millisecond {
+		t.Fatalf("branches did not overlap: took %v", elapsed)
+	}
+	if got := stepExecutor.maxRunning.Load(); got < 2 {
+		t.Fatalf("max concurrent branches = %d, want at least 2", got)
+	}
+	for _, id := range []string{"customer", "orders", "invoices"} {
+		if v, _ := execution.State().Store().Get(id); v != id+" done" {
+			t.Errorf("%s = %v, want %q", id, v, id+" done")
+		}
+	}
+	if stepExecutor.attempts["invoices"] != 2 {
+		t.Errorf("invoices attempts = %d, want 2 (per-branch retry)", stepExecutor.attempts["invoices"])
+	}
+}
+
+func TestExecuteParallel_FailFastCancelsSiblings(t *testing.T) {
+	stepExecutor := newParallelStepExecutor()
+	group := Step{ID: "fetch", Parallel: &ParallelGroup{Mode: ParallelFailFast, Steps: []Step{
+		{ID: "customer", Body: "slow"},
+		{ID: "orders", Body: "fail"},
+	}}}
+
+	start := time.Now()
+	execution, err := runParallelFlow(t, stepExecutor, group)
+	fe, ok := err.(*FlowError)
+	if !ok {
+		t.Fatalf("expected *FlowError, got %T: %v", err, err)
+	}
+	if fe.Code != "BRANCH_FAILED" || fe.Step != "orders" {
+		t.Fatalf("unexpected error: %+v", fe)
+	}
+	// The slow sibling is either cancelled mid-step or never starts.
+	if v, ok := execution.State().Store().Get("customer"); ok {
+		t.Fatalf("customer = %v, expected the slow sibling to be cancelled", v)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("group did not fail fast: took %v", elapsed)
+	}
+}
+
+func TestExecuteParallel_CollectAllReportsEveryFailure(t *testing.T) {
+	stepExecutor := newParallelStepExecutor()
+	group := Step{ID: "fetch", Parallel: &ParallelGroup{Mode: ParallelCollectAll, Steps: []Step{
+		{ID: "customer", Body: "slow"},
+		{ID: "orders", Body: "fail"},
+		{ID: "invoices", Body: "fail"},
+	}}}
+
+	execution, err := runParallelFlow(t, stepExecutor, group)
+	fe, ok := err.(*FlowError)
+	if !ok {
+		t.Fatalf("expected *FlowError, got %T: %v", err, err)
+	}
+	if stepExecutor.cancelled["customer"] {
+		t.Fatal("collect_all must not cancel running branches")
+	}
+	if v, _ := execution.State().Store().Get("customer"); v != "customer done" {
+		t.Fatalf("customer = %v, want the successful branch result", v)
+	}
+	if fe.Code != "BRANCH_FAILED" || fe.Step != "orders" || fe.Meta["parallel"] != "fetch" {
+		t.Fatalf("unexpected error: %+v", fe)
+	}
+	branches, _ := fe.Meta["branches"].(map[string]any)
+	if len(branches) != 2 || branches["orders"] == nil || branches["invoices"] == nil {
+		t.Fatalf("meta.branches = %#v", fe.Meta["branches"])
+	}
+}
+
+func TestExecuteParallel_GroupTimeout(t *testing.T) {
+	stepExecutor := newParallelStepExecutor()
+	group := Step{ID: "fetch", Timeout: 20, Parallel: &ParallelGroup{Steps: []Step{
+		{ID: "customer", Body: "slow"},
+	}}}
+
+	_, err := runParallelFlow(t, stepExecutor, group)
+	fe, ok := err.(*FlowError)
+	if !ok || fe.Type != ErrorTypeTimeout || fe.Code != string(ErrorCodeDeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
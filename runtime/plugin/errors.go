@@ -0,0 +1,52 @@
+package plugin
+
+import "github.com/BDNK1/sflowg/runtime"
+
+// Error is a type alias to runtime.FlowError.
+// Tasks return it to classify a failure. Plain Go errors fail the step as a
+// permanent RUNTIME_ERROR, so a step only retries them with a `when:`
+// expression; a transient Error is retried by default.
+//
+// # Usage in Task Methods
+//
+//	resp, err := p.client.Do(req)
+//	if err != nil {
+//	    return nil, plugin.WrapError(plugin.ErrorTransient, "UPSTREAM_UNAVAILABLE", err, nil)
+//	}
+//	if resp.StatusCode == 402 {
+//	    return nil, plugin.NewError(plugin.ErrorPermanent, "CARD_DECLINED", "card was declined",
+//	        map[string]any{"upstream_status": resp.StatusCode})
+//	}
+//
+// Flows see the classification as error.type and error.code, and the meta as
+// error.meta, in catch blocks, retry `when:` expressions and on_error.
+type Error = runtime.FlowError
+
+// ErrorType is a type alias to runtime.FlowErrorType.
+type ErrorType = runtime.FlowErrorType
+
+// Error types.
+const (
+	ErrorTransient = runtime.ErrorTypeTransient // retried by default
+	ErrorPermanent = runtime.ErrorTypePermanent // not retried unless `when:` says so
+	ErrorTimeout   = runtime.ErrorTypeTimeout
+	ErrorClient    = runtime.ErrorTypeClient
+)
+
+// ClassifiedError is a type alias to runtime.ClassifiedError.
+// Plugins implement it on their own error types to classify them without
+// converting to Error, e.g. to keep errors.As working on a driver error.
+// It is found anywhere in the wrap chain of a returned error.
+type ClassifiedError = runtime.ClassifiedError
+
+// NewError returns a task error with the given type, code and message. meta
+// may be nil.
+func NewError(errType ErrorType, code, message string, meta map[string]any) *Error {
+	return &Error{Type: errType, Code: code, Message: message, Meta: meta}
+}
+
+// WrapError classifies err. The message is err's message and err is kept as
+// the cause. meta may be nil.
+func WrapError(errType ErrorType, code string, err error, meta map[string]any) *Error {
+	return &Error{Type: errType, Code: code, Message: err.Error(), Cause: err, Meta: meta}
+}
@@ -1,6 +1,8 @@
 package plugin
 
 import (
+	"database/sql"
+
 	"github.com/BDNK1/sflowg/runtime"
 )
 
@@ -72,3 +74,135 @@ type Initializer = runtime.Initializer
 // Shutdown is called in reverse order of initialization to properly
 // handle dependencies between plugins.
 type Shutdowner = runtime.Shutdowner
+
+// EntrypointProvider is a type alias to runtime.EntrypointProvider.
+// Plugins implementing this interface supply a new entrypoint type that flows
+// use as entrypoint.<type> { ... }.
+//
+// # Implementation Example
+//
+//	type QueuePlugin struct {
+//	    consumers []*consumer
+//	}
+//
+//	func (p *QueuePlugin) EntrypointType() string { return "queue" }
+//
+//	func (p *QueuePlugin) ValidateEntrypoint(flowID string, config map[string]any) error {
+//	    if _, ok := config["topic"].(string); !ok {
+//	        return fmt.Errorf("topic is required")
+//	    }
+//	    return nil
+//	}
+//
+//	func (p *QueuePlugin) StartEntrypoint(b EntrypointBinding) error {
+//	    c := newConsumer(b.Config["topic"].(string))
+//	    p.consumers = append(p.consumers, c)
+//	    go c.run(func(ctx context.Context, msg Message) error {
+//	        _, err := b.Dispatch(ctx, map[string]any{"topic": msg.Topic, "payload": msg.Body})
+//	        return err
+//	    })
+//	    return nil
+//	}
+//
+//	func (p *QueuePlugin) StopEntrypoints(ctx context.Context) error {
+//	    for _, c := range p.consumers {
+//	        c.stop(ctx)
+//	    }
+//	    return nil
+//	}
+//
+// # Lifecycle
+//
+// ValidateEntrypoint is called when flows are loaded, after Initialize.
+// StartEntrypoint is called once per flow and must not block.
+// StopEntrypoints is called once during graceful shutdown, before Shutdown.
+type EntrypointProvider = runtime.EntrypointProvider
+
+// EntrypointBinding is a type alias to runtime.EntrypointBinding.
+// Dispatch runs the bound flow once; the map passed to it becomes the
+// `trigger` global in the flow.
+type EntrypointBinding = runtime.EntrypointBinding
+
+// TriggerResult is a type alias to runtime.TriggerResult.
+type TriggerResult = runtime.TriggerResult
+
+// ExecutionStoreProvider is a type alias to runtime.ExecutionStoreProvider.
+// Plugins implement it to persist checkpoints of flows that set a
+// `recovery:` policy. ExecutionStore is called after Initialize; returning
+// nil leaves durability disabled.
+//
+// # Example
+//
+//	func (p *PostgresPlugin) ExecutionStore() plugin.ExecutionStore {
+//	    if p.store == nil {
+//	        return nil
+//	    }
+//	    return p.store
+//	}
+type ExecutionStoreProvider = runtime.ExecutionStoreProvider
+
+// ExecutionStore is a type alias to runtime.ExecutionStore.
+type ExecutionStore = runtime.ExecutionStore
+
+// Checkpoint is a type alias to runtime.Checkpoint.
+type Checkpoint = runtime.Checkpoint
+
+// ExecutionStatus is a type alias to runtime.ExecutionStatus.
+type ExecutionStatus = runtime.ExecutionStatus
+
+// SQLExecutionStore is a type alias to runtime.SQLExecutionStore.
+type SQLExecutionStore = runtime.SQLExecutionStore
+
+// SQLDialect is a type alias to runtime.SQLDialect.
+type SQLDialect = runtime.SQLDialect
+
+// SQL dialects supported by NewSQLExecutionStore.
+const (
+	SQLDialectPostgres = runtime.SQLDialectPostgres
+	SQLDialectSQLite   = runtime.SQLDialectSQLite
+)
+
+// NewSQLExecutionStore keeps checkpoints in a table of db. Call EnsureSchema
+// on the result during Initialize.
+func NewSQLExecutionStore(db *sql.DB, dialect SQLDialect) *SQLExecutionStore {
+	return runtime.NewSQLExecutionStore(db, dialect)
+}
+
+// IdempotencyStoreProvider is a type alias to runtime.IdempotencyStoreProvider.
+// Plugins implement it to keep the responses of http entrypoints with an
+// `idempotency` option. Returning nil falls back to the in-memory store.
+type IdempotencyStoreProvider = runtime.IdempotencyStoreProvider
+
+// IdempotencyStore is a type alias to runtime.IdempotencyStore.
+type IdempotencyStore = runtime.IdempotencyStore
+
+// IdempotencyRecord is a type alias to runtime.IdempotencyRecord.
+type IdempotencyRecord = runtime.IdempotencyRecord
+
+// SQLIdempotencyStore is a type alias to runtime.SQLIdempotencyStore.
+type SQLIdempotencyStore = runtime.SQLIdempotencyStore
+
+// NewSQLIdempotencyStore keeps idempotency records in a table of db. Call
+// EnsureSchema on the result during Initialize.
+func NewSQLIdempotencyStore(db *sql.DB, dialect SQLDialect) *SQLIdempotencyStore {
+	return runtime.NewSQLIdempotencyStore(db, dialect)
+}
+
+// ExecutionRecordStore is a type alias to runtime.ExecutionRecordStore.
+// An ExecutionStore that also implements it keeps the status of async
+// executions, so GET /_executions/:id survives restarts.
+type ExecutionRecordStore = runtime.ExecutionRecordStore
+
+// ExecutionRecord is a type alias to runtime.ExecutionRecord.
+type ExecutionRecord = runtime.ExecutionRecord
+
+// DeadLetterSinkProvider is a type alias to runtime.DeadLetterSinkProvider.
+// Plugins implement it to keep compensations that failed after their retries
+// for manual repair. Returning nil leaves failures in the logs only.
+type DeadLetterSinkProvider = runtime.DeadLetterSinkProvider
+
+// DeadLetterSink is a type alias to runtime.DeadLetterSink.
+type DeadLetterSink = runtime.DeadLetterSink
+
+// DeadLetter is a type alias to runtime.DeadLetter.
+type DeadLetter = runtime.DeadLetter
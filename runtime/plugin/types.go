@@ -180,3 +180,12 @@ type TaskExecutor interface {
 	// The framework wraps plugin task methods to implement this interface.
 	Execute(exec *Execution, args Input) (Output, error)
 }
+
+// RequestFile is a type alias to runtime.RequestFile.
+// A task receives one when a flow passes an uploaded file, e.g.
+// `storage.put({file: request.files.document})`. Stream the content with Open
+// rather than loading it; it is only readable while the execution runs.
+//
+//	file, ok := args["file"].(*plugin.RequestFile)
+//	r, err := file.Open()
+type RequestFile = runtime.RequestFile
@@ -0,0 +1,216 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Resume continues a checkpointed execution after its last completed step.
+// The execution must have been rebuilt with RestoreExecution.
+func (e *Executor) Resume(execution *Execution, cp *Checkpoint) error {
+	iterations := make(map[string]int, len(cp.Iterations))
+	for k, v := range cp.Iterations {
+		iterations[k] = v
+	}
+	return e.executeFrom(execution, cp.Cursor, iterations)
+}
+
+// Compensate runs the compensation stack of a checkpointed execution and
+// records it as compensated.
+func (e *Executor) Compensate(execution *Execution) []CompensationResult {
+	results := e.runCompensations(execution)
+	newCheckpointer(execution, nil).finish(ExecutionCompensated)
+	return results
+}
+
+// RestoreExecution rebuilds an execution from its checkpoint: same ID, value
+// store and compensation stack.
+func RestoreExecution(flow *Flow, container *Container, globalProperties map[string]any, store ValueStore, cp *Checkpoint) *Execution {
+	execution := NewExecution(flow, container, globalProperties, store)
+	execution.ID = cp.ExecutionID
+	execution.RootID = cp.ExecutionID
+	for k, v := range cp.Values {
+		store.Set(k, v)
+	}
+	for _, entry := range cp.Compensations {
+		execution.State().AppendCompensation(entry)
+	}
+	return execution
+}
+
+// startRecovery records this instance's heartbeat, recovers what stopped
+// instances left behind and keeps doing both every third of the lease until
+// stopRecovery. Without an ExecutionStore it only fails the async records of
+// the previous run.
+func (a *App) startRecovery(ctx context.Context, executor *Executor, flows map[string]*Flow) error {
+	store := a.Container.ExecutionStore()
+	if store != nil {
+		if err := a.heartbeat(ctx); err != nil {
+			return fmt.Errorf("recording instance heartbeat: %w", err)
+		}
+	}
+	if err := a.recoverExecutions(ctx, executor, flows); err != nil {
+		return err
+	}
+	if err := markInterruptedRecords(ctx, a.Container); err != nil {
+		return err
+	}
+	if store == nil {
+		return nil
+	}
+
+	a.recoveryStop, a.recoveryDone = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(a.recoveryDone)
+		ticker := time.NewTicker(DefaultInstanceLease / 3)
+		defer ticker.Stop()
+		log := a.Container.Logger()
+		for {
+			select {
+			case <-a.recoveryStop:
+				return
+			case <-ticker.C:
+			}
+			ctx := context.Background()
+			if err := a.heartbeat(ctx); err != nil {
+				log.Error("Recording instance heartbeat failed", "error", err)
+				continue
+			}
+			if err := a.recoverExecutions(ctx, executor, flows); err != nil {
+				log.Error("Recovering executions failed", "error", err)
+			}
+			if err := markInterruptedRecords(ctx, a.Container); err != nil {
+				log.Error("Marking interrupted executions failed", "error", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// stopRecovery stops claiming executions. After the running ones finished,
+// releaseInstance lets other instances claim what is left right away.
+func (a *App) stopRecovery() {
+	if a.recoveryStop == nil {
+		return
+	}
+	close(a.recoveryStop)
+	<-a.recoveryDone
+}
+
+func (a *App) releaseInstance(ctx context.Context) error {
+	store := a.Container.ExecutionStore()
+	if store == nil {
+		return nil
+	}
+	return store.Heartbeat(ctx, a.Container.InstanceID(), time.Now())
+}
+
+func (a *App) heartbeat(ctx context.Context) error {
+	return a.Container.ExecutionStore().Heartbeat(ctx, a.Container.InstanceID(), time.Now().Add(DefaultInstanceLease))
+}
+
+// recoverExecutions claims the executions that instances no longer live left
+// incomplete, and resumes or compensates them according to each flow's
+// recovery policy. Recovered runs execute in the background; shutdown waits
+// for them.
+func (a *App) recoverExecutions(ctx context.Context, executor *Executor, flows map[string]*Flow) error {
+	store := a.Container.ExecutionStore()
+	if store == nil {
+		return nil
+	}
+	checkpoints, err := store.ClaimIncomplete(ctx, a.Container.InstanceID())
+	if err != nil {
+		return fmt.Errorf("claiming incomplete executions: %w", err)
+	}
+
+	log := a.Container.Logger()
+	for _, cp := range checkpoints {
+		flow, ok := flows[cp.FlowID]
+		if !ok || flow.Recovery == "" {
+			log.Warn("Dropping incomplete execution: flow not loaded or has no recovery policy",
+				"execution_id", cp.ExecutionID, "flow_id", cp.FlowID)
+			if err := store.CompleteExecution(ctx, cp.ExecutionID, ExecutionFailed); err != nil {
+				log.Error("Dropping incomplete execution failed", "execution_id", cp.ExecutionID, "error", err)
+			}
+			continue
+		}
+
+		execution := RestoreExecution(flow, a.Container, a.GlobalProperties, a.newValueStore(), cp)
+		log.Info("Recovering incomplete execution",
+			"execution_id", cp.ExecutionID, "flow_id", cp.FlowID, "policy", flow.Recovery,
+			"last_step", cp.LastStep, "cursor", cp.Cursor)
+
+		a.recoveries.Add(1)
+		go func() {
+			defer a.recoveries.Done()
+			recoverExecution(executor, flow, execution, cp)
+		}()
+	}
+	return nil
+}
+
+func recoverExecution(executor *Executor, flow *Flow, execution *Execution, cp *Checkpoint) {
+	spanCtx, span := execution.Tracer().Start(context.Background(), fmt.Sprintf("recover %s", flow.ID),
+		trace.WithAttributes(
+			attribute.String("flow.id", flow.ID),
+			attribute.String("execution.id", execution.ID),
+			attribute.String("recovery.policy", flow.Recovery),
+			attribute.String("recovery.last_step", cp.LastStep),
+		),
+	)
+	defer span.End()
+	execution = execution.WithContext(spanCtx)
+	log := execution.Logger()
+
+	if flow.Recovery == RecoveryCompensate {
+		results := executor.Compensate(execution)
+		log.Info("Recovered execution compensated")
+		finishRecoveredRecord(execution, flow, &FlowError{
+			Type:          ErrorTypeTransient,
+			Code:          string(ErrorCodeExecutionInterrupted),
+			Message:       "execution was interrupted by a restart and compensated",
+			Compensations: results,
+		})
+		return
+	}
+
+	ctx := context.Context(spanCtx)
+	if flow.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(spanCtx, time.Duration(flow.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	start := time.Now()
+	err := executor.Resume(execution.WithContext(ctx), cp)
+	execution.Metrics().RecordFlow(spanCtx, flow.ID, classifyMetricOutcome(err), time.Since(start))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Error("Resumed execution failed", "error", err)
+	} else {
+		log.Info("Resumed execution completed")
+	}
+	// A synchronous caller is gone and its response is dropped; async
+	// executions report the outcome through their record.
+	finishRecoveredRecord(execution, flow, err)
+}
+
+// finishRecoveredRecord updates the record of a recovered async execution.
+func finishRecoveredRecord(execution *Execution, flow *Flow, err error) {
+	ctx := context.WithoutCancel(execution)
+	record, getErr := execution.Container.ExecutionRecordStore().GetRecord(ctx, execution.ID)
+	if getErr != nil {
+		execution.Logger().Error("Reading execution record failed", "error", getErr)
+		return
+	}
+	if record == nil {
+		return
+	}
+	callbackURL, _ := flow.Entrypoint.Config[CallbackURLKey].(string)
+	finishExecutionRecord(execution, record, err, callbackURL)
+}
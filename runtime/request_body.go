@@ -0,0 +1,457 @@
+package runtime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Supported values for the entrypoint `body.type` option.
+const (
+	BodyTypeJSON      = "json"
+	BodyTypeForm      = "form"
+	BodyTypeMultipart = "multipart"
+	BodyTypeXML       = "xml"
+	BodyTypeText      = "text"
+	BodyTypeAuto      = "auto"
+)
+
+const (
+	// RequestFilesPrefix is where multipart file parts are exposed to the DSL.
+	RequestFilesPrefix = "request.files"
+
+	// defaultMaxSize caps the request body unless body.max_size is set.
+	defaultMaxSize int64 = 10 << 20
+
+	// defaultMaxFileSize caps a single multipart part.
+	defaultMaxFileSize int64 = 10 << 20
+)
+
+// bodyConfig is the parsed form of the entrypoint `body { ... }` block.
+type bodyConfig struct {
+	Type        string
+	MaxSize     int64 // max body size in bytes
+	MaxFileSize int64 // max size of a single multipart part in bytes
+}
+
+func parseBodyConfig(raw map[string]any) (bodyConfig, error) {
+	cfg := bodyConfig{MaxSize: defaultMaxSize, MaxFileSize: defaultMaxFileSize}
+
+	bodyType, _ := raw["type"].(string)
+	cfg.Type = strings.ToLower(strings.TrimSpace(bodyType))
+	switch cfg.Type {
+	case BodyTypeJSON, BodyTypeForm, BodyTypeMultipart, BodyTypeXML, BodyTypeText, BodyTypeAuto:
+	default:
+		return cfg, fmt.Errorf("unsupported body type %q (allowed: json, form, multipart, xml, text, auto)", bodyType)
+	}
+
+	if v, ok := raw["max_size"]; ok {
+		n, ok := toInt64(v)
+		if !ok || n <= 0 {
+			return cfg, fmt.Errorf("body.max_size must be a positive integer, got %v", v)
+		}
+		cfg.MaxSize = n
+	}
+	if v, ok := raw["max_file_size"]; ok {
+		n, ok := toInt64(v)
+		if !ok || n <= 0 {
+			return cfg, fmt.Errorf("body.max_file_size must be a positive integer, got %v", v)
+		}
+		cfg.MaxFileSize = n
+	}
+
+	return cfg, nil
+}
+
+func malformedBody(cause error) *RequestError {
+	return NewRequestError(http.StatusBadRequest, string(ErrorCodeInvalidRequest), "Wrong request body format", cause)
+}
+
+func bodyTooLarge(message string, cause error) *RequestError {
+	return NewRequestError(http.StatusRequestEntityTooLarge, string(ErrorCodeRequestTooLarge), message, cause)
+}
+
+func unsupportedMediaType(message string, cause error) *RequestError {
+	return NewRequestError(http.StatusUnsupportedMediaType, string(ErrorCodeUnsupportedMediaType), message, cause)
+}
+
+// limitBody returns the request body bounded by cfg.MaxSize.
+func limitBody(c *gin.Context, cfg bodyConfig) io.Reader {
+	if c.Request.Body == nil {
+		return http.NoBody
+	}
+	return http.MaxBytesReader(c.Writer, c.Request.Body, cfg.MaxSize)
+}
+
+// readRawBody reads the full request body, bounded by cfg.MaxSize.
+func readRawBody(c *gin.Context, cfg bodyConfig) ([]byte, error) {
+	body, err := io.ReadAll(limitBody(c, cfg))
+	if err != nil {
+		return nil, bodyReadError(err)
+	}
+	return body, nil
+}
+
+// bodyReadError maps a failed body read to 413 when the size limit was hit.
+func bodyReadError(err error) *RequestError {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return bodyTooLarge("Request body too large", err)
+	}
+	return malformedBody(err)
+}
+
+// isMultipart reports whether the body is read as multipart/form-data.
+func isMultipart(bodyType string, contentType string) bool {
+	if bodyType == BodyTypeMultipart {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return bodyType == BodyTypeAuto && mediaType == "multipart/form-data"
+}
+
+// resolveBodyType maps `auto` to a concrete body type using the request Content-Type.
+// Returns "" when the body is empty and no Content-Type was sent.
+func resolveBodyType(bodyType string, contentType string, body []byte) (string, error) {
+	if bodyType != BodyTypeAuto {
+		return bodyType, nil
+	}
+	if contentType == "" {
+		if len(body) == 0 {
+			return "", nil
+		}
+		return "", unsupportedMediaType("Missing Content-Type header", nil)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", unsupportedMediaType("Invalid Content-Type header", err)
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return BodyTypeJSON, nil
+	case mediaType == "application/x-www-form-urlencoded":
+		return BodyTypeForm, nil
+	case mediaType == "multipart/form-data":
+		return BodyTypeMultipart, nil
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return BodyTypeXML, nil
+	case strings.HasPrefix(mediaType, "text/"):
+		return BodyTypeText, nil
+	default:
+		return "", unsupportedMediaType(fmt.Sprintf("Unsupported Content-Type %q", mediaType), nil)
+	}
+}
+
+// parseBody decodes the raw body according to the resolved body type and stores
+// the result in the execution. Multipart bodies are streamed by readMultipart.
+func parseBody(e *Execution, bodyType string, body []byte) error {
+	switch bodyType {
+	case "":
+		return nil
+	case BodyTypeJSON:
+		var parsed any
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return malformedBody(err)
+		}
+		e.State().Store().SetNested(RequestBodyPrefix, parsed)
+	case BodyTypeForm:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return malformedBody(err)
+		}
+		fields := make(map[string]any, len(values))
+		for key, vals := range values {
+			for _, v := range vals {
+				addFieldValue(fields, key, v)
+			}
+		}
+		e.State().Store().SetNested(RequestBodyPrefix, fields)
+	case BodyTypeXML:
+		parsed, err := decodeXML(body)
+		if err != nil {
+			return malformedBody(err)
+		}
+		e.State().Store().SetNested(RequestBodyPrefix, parsed)
+	case BodyTypeText:
+		e.AddValue(RequestBodyPrefix, string(body))
+	default:
+		return unsupportedMediaType("Body type is not supported", nil)
+	}
+	return nil
+}
+
+// RequestFile is an uploaded multipart file. Its content is spooled to a
+// temporary file while the request is read and removed when the execution
+// ends; the value store only holds the handle, which encodes as metadata so
+// checkpoints and records never carry file bytes. A handle restored from a
+// checkpoint is plain metadata and its content is gone.
+type RequestFile struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	SHA256      string
+
+	path string
+}
+
+// Open returns a reader over the file content.
+func (f *RequestFile) Open() (io.ReadCloser, error) {
+	return os.Open(f.path)
+}
+
+// Bytes reads the whole file content.
+func (f *RequestFile) Bytes() ([]byte, error) {
+	return os.ReadFile(f.path)
+}
+
+// Metadata returns the file's filename, content_type, size and sha256.
+func (f *RequestFile) Metadata() map[string]any {
+	return map[string]any{
+		"filename":     f.Filename,
+		"content_type": f.ContentType,
+		"size":         f.Size,
+		"sha256":       f.SHA256,
+	}
+}
+
+func (f *RequestFile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Metadata())
+}
+
+func (f *RequestFile) remove() {
+	_ = os.Remove(f.path)
+}
+
+// readMultipart streams a multipart/form-data body. Plain fields are stored
+// under request.body and file parts, spooled to disk, under request.files.
+// The bytes read are kept under request.rawBody, like other body types.
+// Every part is bounded by maxFileSize and the whole body by cfg.MaxSize.
+func readMultipart(c *gin.Context, e *Execution, contentType string, cfg bodyConfig) (err error) {
+	_, params, perr := mime.ParseMediaType(contentType)
+	if perr != nil || params["boundary"] == "" {
+		return unsupportedMediaType("Multipart body requires a Content-Type with a boundary", perr)
+	}
+
+	fields := make(map[string]any)
+	files := make(map[string]any)
+	var spooled []*RequestFile
+	defer func() {
+		if err != nil {
+			for _, f := range spooled {
+				f.remove()
+			}
+		}
+	}()
+
+	var raw bytes.Buffer
+	reader := multipart.NewReader(io.TeeReader(limitBody(c, cfg), &raw), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return bodyReadError(err)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			_ = part.Close()
+			continue
+		}
+		if part.FileName() == "" {
+			data, err := io.ReadAll(io.LimitReader(part, cfg.MaxFileSize+1))
+			_ = part.Close()
+			if err != nil {
+				return bodyReadError(err)
+			}
+			if int64(len(data)) > cfg.MaxFileSize {
+				return partTooLarge(name, cfg.MaxFileSize)
+			}
+			addFieldValue(fields, name, string(data))
+			continue
+		}
+
+		file, err := spoolFile(part, cfg.MaxFileSize)
+		_ = part.Close()
+		if file != nil {
+			spooled = append(spooled, file)
+		}
+		if err != nil {
+			return err
+		}
+		addFieldValue(files, name, file)
+	}
+
+	e.AddValue(RequestRawBodyKey, raw.String())
+	e.State().Store().SetNested(RequestBodyPrefix, fields)
+	e.State().Store().SetNested(RequestFilesPrefix, files)
+	return nil
+}
+
+// spoolFile copies a file part to a temporary file. The returned file is
+// non-nil whenever a temporary file was created, so callers can remove it.
+func spoolFile(part *multipart.Part, maxFileSize int64) (*RequestFile, error) {
+	tmp, err := os.CreateTemp("", "sflowg-upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("spooling upload: %w", err)
+	}
+	defer tmp.Close()
+
+	file := &RequestFile{Filename: part.FileName(), ContentType: part.Header.Get("Content-Type"), path: tmp.Name()}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(part, maxFileSize+1))
+	if err != nil {
+		return file, bodyReadError(err)
+	}
+	if n > maxFileSize {
+		return file, partTooLarge(part.FormName(), maxFileSize)
+	}
+	file.Size = n
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+func partTooLarge(name string, maxFileSize int64) *RequestError {
+	return bodyTooLarge(fmt.Sprintf("Multipart part %q exceeds %d bytes", name, maxFileSize), nil)
+}
+
+// removeRequestFiles deletes the spooled uploads of an execution.
+func removeRequestFiles(e *Execution) {
+	files, _ := e.State().Store().Get(RequestFilesPrefix)
+	m, _ := files.(map[string]any)
+	for _, v := range m {
+		list, ok := v.([]any)
+		if !ok {
+			list = []any{v}
+		}
+		for _, item := range list {
+			if f, ok := item.(*RequestFile); ok {
+				f.remove()
+			}
+		}
+	}
+}
+
+// addFieldValue stores value under key, turning repeated keys into a list.
+func addFieldValue(m map[string]any, key string, value any) {
+	existing, ok := m[key]
+	if !ok {
+		m[key] = value
+		return
+	}
+	if list, ok := existing.([]any); ok {
+		m[key] = append(list, value)
+		return
+	}
+	m[key] = []any{existing, value}
+}
+
+// xmlNode accumulates one element while decoding.
+type xmlNode struct {
+	name     string
+	attrs    map[string]any
+	children map[string]any
+	text     strings.Builder
+}
+
+// decodeXML converts an XML document into nested maps keyed by element name.
+// Attributes are stored as "@name", mixed text as "#text", repeated elements
+// become lists, and elements holding only text collapse to a string.
+func decodeXML(data []byte) (map[string]any, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root map[string]any
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local, children: make(map[string]any)}
+			for _, attr := range t.Attr {
+				if node.attrs == nil {
+					node.attrs = make(map[string]any)
+				}
+				node.attrs["@"+attr.Name.Local] = attr.Value
+			}
+			stack = append(stack, node)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		case xml.EndElement:
+			node := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			value := node.value()
+			if len(stack) == 0 {
+				root = map[string]any{node.name: value}
+				continue
+			}
+			addFieldValue(stack[len(stack)-1].children, node.name, value)
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("xml document has no root element")
+	}
+	return root, nil
+}
+
+func (n *xmlNode) value() any {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.attrs) == 0 && len(n.children) == 0 {
+		return text
+	}
+	out := make(map[string]any, len(n.attrs)+len(n.children)+1)
+	for k, v := range n.attrs {
+		out[k] = v
+	}
+	for k, v := range n.children {
+		out[k] = v
+	}
+	if text != "" {
+		out["#text"] = text
+	}
+	return out
+}
+
+// toInt64 converts numeric config values. DSL entrypoint values arrive as
+// strings, YAML values as ints or floats.
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	case string:
+		i, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,249 @@
+package runtime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serveBodyFlow(t *testing.T, body map[string]any, contentType string, payload string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.ReleaseMode)
+
+	router := gin.New()
+	flow := &Flow{
+		ID: "upload",
+		Entrypoint: Entrypoint{
+			Type: "http",
+			Config: map[string]any{
+				"method": "POST",
+				"path":   "/upload",
+				"body":   body,
+			},
+		},
+		Steps: []Step{{ID: "capture"}},
+	}
+	stepExecutor := &capturingStepExecutor{}
+	executor := NewExecutor(noopEvaluator{}, stepExecutor)
+	newStore := func() ValueStore { return NewValueStore() }
+	if err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(payload))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	request, _ := stepExecutor.values["request"].(map[string]any)
+	return rec, request
+}
+
+func TestExtractBody_Form(t *testing.T) {
+	payload := "id=evt_1&type=charge.succeeded&tag=a&tag=b"
+	rec, request := serveBodyFlow(t, map[string]any{"type": "form"}, "application/x-www-form-urlencoded", payload)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := map[string]any{
+		"id":   "evt_1",
+		"type": "charge.succeeded",
+		"tag":  []any{"a", "b"},
+	}
+	if !reflect.DeepEqual(request["body"], want) {
+		t.Fatalf("body = %#v, want %#v", request["body"], want)
+	}
+	if request["rawBody"] != payload {
+		t.Fatalf("rawBody = %q, want %q", request["rawBody"], payload)
+	}
+}
+
+func TestExtractBody_Multipart(t *testing.T) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	_ = writer.WriteField("title", "invoice")
+	part, err := writer.CreateFormFile("document", "invoice.pdf")
+	if err != nil {
+		t.Fatalf("CreateFormFile failed: %v", err)
+	}
+	_, _ = part.Write([]byte("%PDF-1.4"))
+	_ = writer.Close()
+
+	rec, request := serveBodyFlow(t, map[string]any{"type": "multipart"}, writer.FormDataContentType(), buf.String())
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !reflect.DeepEqual(request["body"], map[string]any{"title": "invoice"}) {
+		t.Fatalf("unexpected body: %#v", request["body"])
+	}
+	files, _ := request["files"].(map[string]any)
+	doc, ok := files["document"].(*RequestFile)
+	if !ok || doc.Filename != "invoice.pdf" || doc.Size != 8 {
+		t.Fatalf("unexpected file: %#v", files["document"])
+	}
+	sum := sha256.Sum256([]byte("%PDF-1.4"))
+	if doc.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("sha256 = %s", doc.SHA256)
+	}
+	if request["rawBody"] != buf.String() {
+		t.Fatalf("rawBody = %q, want the body as sent", request["rawBody"])
+	}
+
+	// Checkpoints encode the handle, never the content.
+	encoded, _ := json.Marshal(files)
+	if strings.Contains(string(encoded), "PDF") || !strings.Contains(string(encoded), `"filename":"invoice.pdf"`) {
+		t.Fatalf("encoded files = %s", encoded)
+	}
+	if _, err := os.Stat(doc.path); !os.IsNotExist(err) {
+		t.Fatalf("spooled file still exists after the request: %v", err)
+	}
+}
+
+func TestExtractBody_MultipartFileTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("document", "big.bin")
+	_, _ = part.Write(bytes.Repeat([]byte("x"), 32))
+	_ = writer.Close()
+
+	rec, _ := serveBodyFlow(t, map[string]any{"type": "multipart", "max_file_size": "16"}, writer.FormDataContentType(), buf.String())
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", rec.Code)
+	}
+}
+
+func TestExtractBody_XML(t *testing.T) {
+	payload := `<order id="7"><item>a</item><item>b</item><note>rush</note></order>`
+	rec, request := serveBodyFlow(t, map[string]any{"type": "xml"}, "application/xml", payload)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := map[string]any{
+		"order": map[string]any{
+			"@id":  "7",
+			"item": []any{"a", "b"},
+			"note": "rush",
+		},
+	}
+	if !reflect.DeepEqual(request["body"], want) {
+		t.Fatalf("body = %#v, want %#v", request["body"], want)
+	}
+}
+
+func TestExtractBody_Text(t *testing.T) {
+	rec, request := serveBodyFlow(t, map[string]any{"type": "text"}, "text/plain", "hello")
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", rec.Code)
+	}
+	if request["body"] != "hello" {
+		t.Fatalf("body = %#v, want hello", request["body"])
+	}
+}
+
+func TestExtractBody_AutoSelectsByContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		payload     string
+		want        any
+	}{
+		{"json", "application/json; charset=utf-8", `{"a":1}`, map[string]any{"a": float64(1)}},
+		{"vendor json", "application/vnd.api+json", `{"a":1}`, map[string]any{"a": float64(1)}},
+		{"form", "application/x-www-form-urlencoded", "a=1", map[string]any{"a": "1"}},
+		{"xml", "text/xml", "<a>1</a>", map[string]any{"a": "1"}},
+		{"text", "text/csv", "a,b", "a,b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, request := serveBodyFlow(t, map[string]any{"type": "auto"}, tt.contentType, tt.payload)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected 200 OK, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if !reflect.DeepEqual(request["body"], tt.want) {
+				t.Fatalf("body = %#v, want %#v", request["body"], tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractBody_AutoRejectsUnknownContentType(t *testing.T) {
+	rec, _ := serveBodyFlow(t, map[string]any{"type": "auto"}, "application/octet-stream", "\x00\x01")
+
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got %d", rec.Code)
+	}
+}
+
+func TestExtractBody_MaxSize(t *testing.T) {
+	rec, _ := serveBodyFlow(t, map[string]any{"type": "text", "max_size": 4}, "text/plain", "too long")
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", rec.Code)
+	}
+
+	// Bodies are bounded by default.
+	rec, _ = serveBodyFlow(t, map[string]any{"type": "text"}, "text/plain", strings.Repeat("x", int(defaultMaxSize)+1))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 above the default limit, got %d", rec.Code)
+	}
+}
+
+func TestExtractBody_MultipartBodyTooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, name := range []string{"a", "b", "c"} {
+		part, _ := writer.CreateFormFile(name, name+".bin")
+		_, _ = part.Write(bytes.Repeat([]byte("x"), 32))
+	}
+	_ = writer.Close()
+
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "sflowg-upload-*"))
+	rec, _ := serveBodyFlow(t, map[string]any{"type": "multipart", "max_size": "64"}, writer.FormDataContentType(), buf.String())
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", rec.Code)
+	}
+	after, _ := filepath.Glob(filepath.Join(os.TempDir(), "sflowg-upload-*"))
+	if len(after) > len(before) {
+		t.Fatalf("spooled files left behind: %v", after)
+	}
+}
+
+func TestNewHttpHandler_RejectsUnknownBodyType(t *testing.T) {
+	flow := &Flow{
+		ID: "upload",
+		Entrypoint: Entrypoint{
+			Type: "http",
+			Config: map[string]any{
+				"method": "POST",
+				"path":   "/upload",
+				"body":   map[string]any{"type": "yaml"},
+			},
+		},
+	}
+	executor := NewExecutor(noopEvaluator{}, noopStepExecutor{})
+
+	err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newTestValueStore, gin.New())
+	if err == nil || !strings.Contains(err.Error(), `unsupported body type "yaml"`) {
+		t.Fatalf("expected unsupported body type error, got %v", err)
+	}
+}
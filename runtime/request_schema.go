@@ -0,0 +1,435 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	// SchemaKey is the entrypoint config key holding the request validation schema.
+	SchemaKey = "schema"
+	// ValidateKey is accepted as an alias of SchemaKey.
+	ValidateKey = "validate"
+
+	// BodyKey names the request body section of a schema.
+	BodyKey = "body"
+)
+
+// requestSchemaSections lists the request sections a schema may describe,
+// in the order violations are reported.
+var requestSchemaSections = []string{PathVariablesKey, QueryParametersKey, HeadersKey, BodyKey}
+
+// Numeric and boolean JSON Schema keywords. DSL maps carry every scalar as a
+// string, so these are converted before the schema is compiled.
+var (
+	numericSchemaKeywords = map[string]bool{
+		"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+		"multipleOf": true, "minLength": true, "maxLength": true, "minItems": true,
+		"maxItems": true, "minProperties": true, "maxProperties": true,
+	}
+	booleanSchemaKeywords = map[string]bool{
+		"additionalProperties": true, "uniqueItems": true, "nullable": true,
+	}
+)
+
+// FieldViolation describes one failed validation rule for a request field.
+type FieldViolation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// RequestSchema is the compiled form of an entrypoint `schema` block.
+// Each request section (body, queryParameters, pathVariables, headers) is an
+// independent JSON Schema.
+type RequestSchema struct {
+	sections map[string]*sectionSchema
+}
+
+type sectionSchema struct {
+	compiled *jsonschema.Schema
+	doc      map[string]any // source document, drives type coercion
+}
+
+// CompileRequestSchema compiles the `schema` (or `validate`) block of an entrypoint
+// config. A section is either an inline JSON Schema map or a path to a .json
+// schema file, resolved relative to baseDir. Returns nil when no schema is declared.
+func CompileRequestSchema(config map[string]any, baseDir string) (*RequestSchema, error) {
+	raw, ok := config[SchemaKey]
+	if !ok {
+		raw, ok = config[ValidateKey]
+	}
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	block, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("schema must be a map of request sections, got %T", raw)
+	}
+
+	rs := &RequestSchema{sections: make(map[string]*sectionSchema, len(block))}
+	for name, value := range block {
+		section := trimSchemaKey(name)
+		if !isSchemaSection(section) {
+			return nil, fmt.Errorf("schema: unknown request section %q (allowed: %s)", section, strings.Join(requestSchemaSections, ", "))
+		}
+		compiled, err := compileSection(section, value, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("schema.%s: %w", section, err)
+		}
+		rs.sections[section] = compiled
+	}
+	return rs, nil
+}
+
+func isSchemaSection(name string) bool {
+	for _, s := range requestSchemaSections {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+func compileSection(section string, value any, baseDir string) (*sectionSchema, error) {
+	var doc map[string]any
+	var url string
+
+	switch v := value.(type) {
+	case string:
+		path := v
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(baseDir, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading schema file: %w", err)
+		}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parsing schema file %s: %w", path, err)
+		}
+		if url, err = filepath.Abs(path); err != nil {
+			return nil, err
+		}
+	case map[string]any:
+		doc, _ = normalizeSchemaLiteral(v).(map[string]any)
+		url = "sflowg:///schema/" + section + ".json"
+	default:
+		return nil, fmt.Errorf("expected a schema map or a path to a .json file, got %T", value)
+	}
+	if section == HeadersKey {
+		lowerHeaderNames(doc)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+	return &sectionSchema{compiled: compiled, doc: doc}, nil
+}
+
+// lowerHeaderNames lower-cases the properties and required names of a headers
+// schema, matching the names headers are exposed under.
+func lowerHeaderNames(doc map[string]any) {
+	if props, ok := doc["properties"].(map[string]any); ok {
+		lowered := make(map[string]any, len(props))
+		for name, prop := range props {
+			lowered[strings.ToLower(name)] = prop
+		}
+		doc["properties"] = lowered
+	}
+	if required, ok := doc["required"].([]any); ok {
+		for i, name := range required {
+			if s, ok := name.(string); ok {
+				required[i] = strings.ToLower(s)
+			}
+		}
+	}
+}
+
+// normalizeSchemaLiteral turns a schema written in the DSL into a JSON Schema
+// document: quoted keys are unquoted, numeric/boolean keywords lose their
+// string form and enum/const values take the type the schema declares. Values
+// that are already typed (YAML, JSON files) pass through.
+func normalizeSchemaLiteral(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		var types []string
+		for k, val := range t {
+			if trimSchemaKey(k) == "type" {
+				types = schemaTypes(val)
+			}
+		}
+		for k, val := range t {
+			key := trimSchemaKey(k)
+			switch key {
+			case "enum":
+				if items, ok := val.([]any); ok {
+					values := make([]any, len(items))
+					for i, item := range items {
+						values[i] = typedSchemaValue(item, types)
+					}
+					out[key] = values
+					continue
+				}
+			case "const":
+				out[key] = typedSchemaValue(val, types)
+				continue
+			}
+			if s, ok := val.(string); ok {
+				switch {
+				case numericSchemaKeywords[key]:
+					if n, err := strconv.ParseFloat(s, 64); err == nil {
+						out[key] = n
+						continue
+					}
+				case booleanSchemaKeywords[key]:
+					if b, err := strconv.ParseBool(s); err == nil {
+						out[key] = b
+						continue
+					}
+				}
+			}
+			out[key] = normalizeSchemaLiteral(val)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, item := range t {
+			out[i] = normalizeSchemaLiteral(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// schemaTypes returns the names of a `type` keyword, a name or a list.
+func schemaTypes(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{trimSchemaKey(t)}
+	case []any:
+		var types []string
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, trimSchemaKey(s))
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// typedSchemaValue converts an enum or const value the DSL carries as a
+// string to the first of types it parses as. Strings stay strings when the
+// schema allows them or declares no type.
+func typedSchemaValue(v any, types []string) any {
+	s, ok := v.(string)
+	if !ok || slices.Contains(types, "string") {
+		return v
+	}
+	for _, typ := range types {
+		switch typ {
+		case "integer", "number":
+			if n, err := strconv.ParseFloat(s, 64); err == nil {
+				return n
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b
+			}
+		case "null":
+			if s == "null" {
+				return nil
+			}
+		}
+	}
+	return v
+}
+
+func trimSchemaKey(k string) string {
+	return strings.Trim(strings.TrimSpace(k), `"'`)
+}
+
+// Has reports whether the schema describes the given request section.
+func (rs *RequestSchema) Has(section string) bool {
+	if rs == nil {
+		return false
+	}
+	_, ok := rs.sections[section]
+	return ok
+}
+
+// Properties returns the property names declared for a section. Entrypoints
+// extract these in addition to the explicitly listed keys.
+func (rs *RequestSchema) Properties(section string) []string {
+	if rs == nil || rs.sections[section] == nil {
+		return nil
+	}
+	props, _ := rs.sections[section].doc["properties"].(map[string]any)
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply coerces a section value to the types declared by its schema and
+// validates it. The coerced value is returned together with every violation.
+func (rs *RequestSchema) Apply(section string, value any, coerce bool) (any, []FieldViolation) {
+	if rs == nil || rs.sections[section] == nil {
+		return value, nil
+	}
+	s := rs.sections[section]
+	if coerce {
+		value = coerceToSchema(value, s.doc)
+	}
+	return value, validateSection(s.compiled, section, value)
+}
+
+// validateSection runs the compiled schema and flattens the error tree into
+// one violation per failing field.
+func validateSection(schema *jsonschema.Schema, section string, value any) (violations []FieldViolation) {
+	defer func() {
+		// Validate panics on values that are not JSON-compatible.
+		if r := recover(); r != nil {
+			violations = []FieldViolation{{Field: section, Message: fmt.Sprintf("cannot be validated: %v", r)}}
+		}
+	}()
+
+	err := schema.Validate(value)
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []FieldViolation{{Field: section, Message: err.Error()}}
+	}
+	collectViolations(verr, section, &violations)
+	return violations
+}
+
+func collectViolations(verr *jsonschema.ValidationError, section string, out *[]FieldViolation) {
+	if len(verr.Causes) > 0 {
+		for _, cause := range verr.Causes {
+			collectViolations(cause, section, out)
+		}
+		return
+	}
+
+	field := fieldPath(section, verr.InstanceLocation)
+	if strings.HasSuffix(verr.KeywordLocation, "/required") {
+		if missing, ok := strings.CutPrefix(verr.Message, "missing properties: "); ok {
+			for _, name := range strings.Split(missing, ", ") {
+				*out = append(*out, FieldViolation{
+					Field:   field + "." + strings.Trim(name, "'"),
+					Message: "is required",
+				})
+			}
+			return
+		}
+	}
+	*out = append(*out, FieldViolation{Field: field, Message: verr.Message})
+}
+
+// fieldPath converts a JSON pointer ("/items/0/sku") into a dotted field
+// path prefixed with the request section ("body.items.0.sku").
+func fieldPath(section, pointer string) string {
+	if pointer == "" || pointer == "/" {
+		return section
+	}
+	parts := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, p := range parts {
+		p = strings.ReplaceAll(p, "~1", "/")
+		parts[i] = strings.ReplaceAll(p, "~0", "~")
+	}
+	return section + "." + strings.Join(parts, ".")
+}
+
+// coerceToSchema converts string values to the integer, number or boolean
+// types declared by the schema. Values that do not parse are left as-is so
+// validation reports them.
+func coerceToSchema(value any, doc map[string]any) any {
+	if doc == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		switch {
+		case schemaAllows(doc, "integer"):
+			if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return n
+			}
+		case schemaAllows(doc, "number"):
+			if n, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return n
+			}
+		case schemaAllows(doc, "boolean"):
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
+		case schemaAllows(doc, "array"):
+			items, _ := doc["items"].(map[string]any)
+			return []any{coerceToSchema(v, items)}
+		}
+		return v
+	case map[string]any:
+		props, _ := doc["properties"].(map[string]any)
+		for key, item := range v {
+			if propDoc, ok := props[key].(map[string]any); ok {
+				v[key] = coerceToSchema(item, propDoc)
+			}
+		}
+		return v
+	case []any:
+		items, _ := doc["items"].(map[string]any)
+		for i, item := range v {
+			v[i] = coerceToSchema(item, items)
+		}
+		return v
+	default:
+		return value
+	}
+}
+
+func schemaAllows(doc map[string]any, typ string) bool {
+	switch t := doc["type"].(type) {
+	case string:
+		return t == typ
+	case []any:
+		for _, item := range t {
+			if item == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validationFailed builds the RequestError returned when a request does not
+// match the entrypoint schema.
+func validationFailed(violations []FieldViolation) *RequestError {
+	reqErr := NewRequestError(http.StatusBadRequest, string(ErrorCodeValidationFailed), "Request validation failed", nil)
+	reqErr.Violations = violations
+	return reqErr
+}
@@ -0,0 +1,215 @@
+package runtime
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func serveSchemaFlow(t *testing.T, config map[string]any, method, target, payload string) (*httptest.ResponseRecorder, map[string]any, bool) {
+	t.Helper()
+	gin.SetMode(gin.ReleaseMode)
+
+	router := gin.New()
+	flow := &Flow{
+		ID:         "orders",
+		Entrypoint: Entrypoint{Type: "http", Config: config},
+		Steps:      []Step{{ID: "capture"}},
+	}
+	stepExecutor := &capturingStepExecutor{}
+	executor := NewExecutor(noopEvaluator{}, stepExecutor)
+	newStore := func() ValueStore { return NewValueStore() }
+	if err := NewHttpHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newStore, router); err != nil {
+		t.Fatalf("NewHttpHandler failed: %v", err)
+	}
+
+	req := httptest.NewRequest(method, target, strings.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	request, _ := stepExecutor.values["request"].(map[string]any)
+	return rec, request, stepExecutor.values != nil
+}
+
+func TestRequestSchema_CoercesQueryParameters(t *testing.T) {
+	config := map[string]any{
+		"method": "GET",
+		"path":   "/orders",
+		"schema": map[string]any{
+			"queryParameters": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"limit":    map[string]any{"type": "integer", "minimum": "1", "maximum": "100"},
+					"detailed": map[string]any{"type": "boolean"},
+				},
+			},
+		},
+	}
+
+	rec, request, ran := serveSchemaFlow(t, config, http.MethodGet, "/orders?limit=10&detailed=true", "")
+
+	if rec.Code != http.StatusOK || !ran {
+		t.Fatalf("expected flow to run with 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := map[string]any{"limit": int64(10), "detailed": true}
+	if !reflect.DeepEqual(request["queryParameters"], want) {
+		t.Fatalf("queryParameters = %#v, want %#v", request["queryParameters"], want)
+	}
+}
+
+func TestRequestSchema_NormalizesEnumAndConstLiterals(t *testing.T) {
+	// DSL maps carry every scalar as a string.
+	config := map[string]any{
+		"method": "GET",
+		"path":   "/orders",
+		"schema": map[string]any{
+			"queryParameters": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"page":     map[string]any{"type": "integer", "enum": []any{"1", "2"}},
+					"detailed": map[string]any{"type": "boolean", "const": "true"},
+					"sort":     map[string]any{"type": "string", "enum": []any{"1", "asc"}},
+				},
+			},
+		},
+	}
+
+	rec, request, ran := serveSchemaFlow(t, config, http.MethodGet, "/orders?page=2&detailed=true&sort=1", "")
+	if rec.Code != http.StatusOK || !ran {
+		t.Fatalf("expected flow to run with 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := map[string]any{"page": int64(2), "detailed": true, "sort": "1"}
+	if !reflect.DeepEqual(request["queryParameters"], want) {
+		t.Fatalf("queryParameters = %#v, want %#v", request["queryParameters"], want)
+	}
+
+	rec, _, ran = serveSchemaFlow(t, config, http.MethodGet, "/orders?page=3", "")
+	if rec.Code != http.StatusBadRequest || ran {
+		t.Fatalf("expected 400 for a value outside the enum, got %d", rec.Code)
+	}
+}
+
+func TestRequestSchema_ReportsEveryViolation(t *testing.T) {
+	config := map[string]any{
+		"method": "POST",
+		"path":   "/orders",
+		"body":   map[string]any{"type": "json"},
+		"schema": map[string]any{
+			"queryParameters": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"limit": map[string]any{"type": "integer", "maximum": "100"}},
+			},
+			"body": map[string]any{
+				"type":     "object",
+				"required": []any{"email", "amount"},
+				"properties": map[string]any{
+					"email":    map[string]any{"type": "string"},
+					"amount":   map[string]any{"type": "number"},
+					"currency": map[string]any{"type": "string", "enum": []any{"USD", "EUR"}},
+				},
+			},
+		},
+	}
+
+	rec, _, ran := serveSchemaFlow(t, config, http.MethodPost, "/orders?limit=500", `{"currency":"GBP"}`)
+
+	if ran {
+		t.Fatal("expected steps not to run")
+	}
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/problem+json") {
+		t.Fatalf("Content-Type = %q, want application/problem+json", ct)
+	}
+
+	var problem struct {
+		Status int              `json:"status"`
+		Code   string           `json:"code"`
+		Errors []FieldViolation `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid problem body: %v", err)
+	}
+	if problem.Status != http.StatusBadRequest || problem.Code != string(ErrorCodeValidationFailed) {
+		t.Fatalf("unexpected problem: %s", rec.Body.String())
+	}
+
+	fields := make(map[string]bool)
+	for _, v := range problem.Errors {
+		fields[v.Field] = true
+	}
+	for _, field := range []string{"queryParameters.limit", "body.email", "body.amount", "body.currency"} {
+		if !fields[field] {
+			t.Errorf("missing violation for %s in %s", field, rec.Body.String())
+		}
+	}
+}
+
+func TestRequestSchema_ViolationsExposedToOnError(t *testing.T) {
+	reqErr := validationFailed([]FieldViolation{{Field: "body.email", Message: "is required"}})
+	fe := reqErr.FlowError()
+
+	if fe.Type != ErrorTypeClient || fe.Code != string(ErrorCodeValidationFailed) {
+		t.Fatalf("unexpected flow error: %+v", fe)
+	}
+	errs, _ := fe.Meta["errors"].([]any)
+	if len(errs) != 1 || errs[0].(map[string]any)["field"] != "body.email" {
+		t.Fatalf("meta.errors = %#v", fe.Meta["errors"])
+	}
+}
+
+func TestCompileRequestSchema_LoadsFileRelativeToBaseDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "schemas"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	doc := `{"type":"object","required":["id"],"properties":{"id":{"type":"integer"}}}`
+	if err := os.WriteFile(filepath.Join(dir, "schemas", "path.json"), []byte(doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := CompileRequestSchema(map[string]any{
+		"validate": map[string]any{"pathVariables": "schemas/path.json"},
+	}, dir)
+	if err != nil {
+		t.Fatalf("CompileRequestSchema failed: %v", err)
+	}
+
+	got, violations := schema.Apply(PathVariablesKey, map[string]any{"id": "42"}, true)
+	if len(violations) != 0 || !reflect.DeepEqual(got, map[string]any{"id": int64(42)}) {
+		t.Fatalf("got %#v, violations %v", got, violations)
+	}
+	if _, violations := schema.Apply(PathVariablesKey, map[string]any{"id": "abc"}, true); len(violations) != 1 {
+		t.Fatalf("expected one violation for non-integer id, got %v", violations)
+	}
+}
+
+func TestCompileRequestSchema_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema any
+		want   string
+	}{
+		{"unknown section", map[string]any{"cookies": map[string]any{}}, `unknown request section "cookies"`},
+		{"invalid keyword", map[string]any{"body": map[string]any{"type": "object", "minProperties": "many"}}, "schema.body"},
+		{"missing file", map[string]any{"body": "missing.json"}, "reading schema file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileRequestSchema(map[string]any{"schema": tt.schema}, t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
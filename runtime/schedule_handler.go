@@ -0,0 +1,220 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Overlap policies for scheduled flows: what to do when a run is due while
+// the previous one is still executing.
+const (
+	OverlapSkip  = "skip"  // drop the new run
+	OverlapQueue = "queue" // run it after the current one finishes
+	OverlapAllow = "allow" // run it concurrently
+)
+
+// maxQueuedRuns bounds the backlog of the queue overlap policy.
+const maxQueuedRuns = 16
+
+// ScheduleHandler runs a flow on a cron schedule. Each run is its own
+// Execution with its own span, metrics and `trigger` global.
+type ScheduleHandler struct {
+	triggerRunner
+
+	cron     string
+	schedule *cronSchedule
+	location *time.Location
+	overlap  string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	running int
+	queue   chan time.Time
+	stop    chan struct{}
+	done    chan struct{}
+	runs    sync.WaitGroup
+	// runCtx outlives Stop so in-flight runs can finish; it is cancelled only
+	// when the shutdown deadline expires.
+	runCtx    context.Context
+	runCancel context.CancelFunc
+}
+
+// NewScheduleHandler validates the flow's schedule entrypoint config.
+// Call Start to begin firing runs and Stop to shut down gracefully.
+func NewScheduleHandler(flow *Flow, container *Container, executor *Executor, globalProperties map[string]any, newValueStore func() ValueStore) (*ScheduleHandler, error) {
+	config := flow.Entrypoint.Config
+	expr, _ := config["cron"].(string)
+	if expr == "" {
+		return nil, fmt.Errorf("flow %s: schedule entrypoint requires a cron expression", flow.ID)
+	}
+	schedule, err := parseCron(expr)
+	if err != nil {
+		return nil, fmt.Errorf("flow %s: %w", flow.ID, err)
+	}
+
+	location := time.UTC
+	if tz, _ := config["timezone"].(string); tz != "" {
+		if location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("flow %s: invalid timezone %q: %w", flow.ID, tz, err)
+		}
+	}
+
+	overlap := OverlapSkip
+	if v, _ := config["overlap"].(string); v != "" {
+		overlap = strings.ToLower(v)
+	}
+	switch overlap {
+	case OverlapSkip, OverlapQueue, OverlapAllow:
+	default:
+		return nil, fmt.Errorf("flow %s: unsupported overlap policy %q (allowed: skip, queue, allow)", flow.ID, overlap)
+	}
+
+	return &ScheduleHandler{
+		triggerRunner: triggerRunner{
+			flow:             flow,
+			container:        container,
+			executor:         executor,
+			globalProperties: globalProperties,
+			newValueStore:    newValueStore,
+			triggerType:      EntrypointSchedule,
+		},
+		cron:     expr,
+		schedule: schedule,
+		location: location,
+		overlap:  overlap,
+		now:      time.Now,
+	}, nil
+}
+
+// Start begins firing runs in the background.
+func (h *ScheduleHandler) Start() {
+	h.stop = make(chan struct{})
+	h.done = make(chan struct{})
+	h.runCtx, h.runCancel = context.WithCancel(context.Background())
+	if h.overlap == OverlapQueue {
+		h.queue = make(chan time.Time, maxQueuedRuns)
+		h.runs.Add(1)
+		go h.drainQueue()
+	}
+
+	h.container.Logger().Info("Registering schedule entrypoint",
+		"cron", h.cron, "timezone", h.location.String(), "overlap", h.overlap, "flow_id", h.flow.ID)
+	go h.loop()
+}
+
+// Stop stops firing new runs, discards queued ones and waits for in-flight
+// runs to finish. When ctx expires first, in-flight runs are cancelled.
+func (h *ScheduleHandler) Stop(ctx context.Context) error {
+	if h.stop == nil {
+		return nil
+	}
+	close(h.stop)
+	<-h.done
+	if h.queue != nil {
+		close(h.queue)
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		h.runs.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		h.runCancel()
+		return nil
+	case <-ctx.Done():
+		h.runCancel()
+		<-finished
+		return fmt.Errorf("flow %s: scheduled runs cancelled on shutdown: %w", h.flow.ID, ctx.Err())
+	}
+}
+
+func (h *ScheduleHandler) loop() {
+	defer close(h.done)
+	for {
+		next := h.schedule.Next(h.now().In(h.location))
+		if next.IsZero() {
+			h.container.Logger().Warn("Schedule never fires", "cron", h.cron, "flow_id", h.flow.ID)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-h.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			h.fire(next)
+		}
+	}
+}
+
+// fire dispatches one due run according to the overlap policy.
+func (h *ScheduleHandler) fire(scheduled time.Time) {
+	log := h.container.Logger()
+	switch h.overlap {
+	case OverlapQueue:
+		select {
+		case h.queue <- scheduled:
+		default:
+			log.Warn("Scheduled run dropped: queue is full",
+				"flow_id", h.flow.ID, "scheduled_time", scheduled, "queued", maxQueuedRuns)
+		}
+	case OverlapSkip:
+		h.mu.Lock()
+		busy := h.running > 0
+		if !busy {
+			h.running++
+		}
+		h.mu.Unlock()
+		if busy {
+			log.Warn("Scheduled run skipped: previous run still executing",
+				"flow_id", h.flow.ID, "scheduled_time", scheduled)
+			return
+		}
+		h.runs.Add(1)
+		go func() {
+			defer h.runs.Done()
+			h.runAt(scheduled)
+			h.mu.Lock()
+			h.running--
+			h.mu.Unlock()
+		}()
+	default:
+		h.runs.Add(1)
+		go func() {
+			defer h.runs.Done()
+			h.runAt(scheduled)
+		}()
+	}
+}
+
+// drainQueue runs the queued runs one after another. Runs still queued when
+// Stop is called are discarded.
+func (h *ScheduleHandler) drainQueue() {
+	defer h.runs.Done()
+	for scheduled := range h.queue {
+		select {
+		case <-h.stop:
+			h.container.Logger().Warn("Queued scheduled run discarded on shutdown",
+				"flow_id", h.flow.ID, "scheduled_time", scheduled)
+			continue
+		default:
+		}
+		h.runAt(scheduled)
+	}
+}
+
+// runAt executes the flow once for the given scheduled time.
+func (h *ScheduleHandler) runAt(scheduled time.Time) {
+	_, _ = h.run(h.runCtx, map[string]any{
+		"cron":           h.cron,
+		"timezone":       h.location.String(),
+		"scheduled_time": scheduled.Format(time.RFC3339),
+		"fired_time":     h.now().In(h.location).Format(time.RFC3339Nano),
+	})
+}
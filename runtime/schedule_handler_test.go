@@ -0,0 +1,172 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingStepExecutor holds each step until release is closed and records
+// the trigger global of every run.
+type blockingStepExecutor struct {
+	release  chan struct{}
+	started  chan struct{}
+	calls    atomic.Int32
+	mu       sync.Mutex
+	triggers []map[string]any
+}
+
+func (s *blockingStepExecutor) ExecuteStep(ctx context.Context, execution *Execution, step Step) (string, error) {
+	s.calls.Add(1)
+	s.mu.Lock()
+	trigger, _ := execution.Values()[TriggerKey].(map[string]any)
+	s.triggers = append(s.triggers, trigger)
+	s.mu.Unlock()
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+		return "", nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func newTestScheduleHandler(t *testing.T, config map[string]any, stepExecutor StepExecutor) *ScheduleHandler {
+	t.Helper()
+	flow := &Flow{
+		ID:         "reconcile",
+		Entrypoint: Entrypoint{Type: "schedule", Config: config},
+		Steps:      []Step{{ID: "work"}},
+	}
+	executor := NewExecutor(noopEvaluator{}, stepExecutor)
+	newStore := func() ValueStore { return NewValueStore() }
+	h, err := NewScheduleHandler(flow, NewContainer(NewLogger(nil)), executor, nil, newStore)
+	if err != nil {
+		t.Fatalf("NewScheduleHandler failed: %v", err)
+	}
+	return h
+}
+
+func TestScheduleHandler_TriggerGlobal(t *testing.T) {
+	steps := &blockingStepExecutor{release: make(chan struct{}), started: make(chan struct{}, 1)}
+	close(steps.release)
+	h := newTestScheduleHandler(t, map[string]any{"cron": "*/5 * * * *", "timezone": "UTC"}, steps)
+	h.Start()
+
+	scheduled := time.Date(2026, time.March, 6, 10, 5, 0, 0, time.UTC)
+	h.fire(scheduled)
+	<-steps.started
+	if err := h.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	trigger := steps.triggers[0]
+	if trigger["type"] != "schedule" || trigger["scheduled_time"] != "2026-03-06T10:05:00Z" || trigger["cron"] != "*/5 * * * *" {
+		t.Fatalf("unexpected trigger: %#v", trigger)
+	}
+}
+
+func TestScheduleHandler_OverlapPolicies(t *testing.T) {
+	tests := []struct {
+		overlap string
+		want    int32
+	}{
+		{OverlapSkip, 1},
+		{OverlapQueue, 3},
+		{OverlapAllow, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.overlap, func(t *testing.T) {
+			steps := &blockingStepExecutor{release: make(chan struct{}), started: make(chan struct{}, 3)}
+			h := newTestScheduleHandler(t, map[string]any{"cron": "* * * * *", "overlap": tt.overlap}, steps)
+			h.Start()
+
+			now := time.Now()
+			for i := 0; i < 3; i++ {
+				h.fire(now.Add(time.Duration(i) * time.Minute))
+			}
+			<-steps.started
+			if tt.overlap == OverlapAllow {
+				<-steps.started
+				<-steps.started
+			}
+			close(steps.release)
+			if tt.overlap == OverlapQueue {
+				<-steps.started
+				<-steps.started
+			}
+
+			if err := h.Stop(context.Background()); err != nil {
+				t.Fatalf("Stop failed: %v", err)
+			}
+			if got := steps.calls.Load(); got != tt.want {
+				t.Fatalf("runs = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleHandler_StopDiscardsQueuedRuns(t *testing.T) {
+	steps := &blockingStepExecutor{release: make(chan struct{}), started: make(chan struct{}, 3)}
+	h := newTestScheduleHandler(t, map[string]any{"cron": "* * * * *", "overlap": OverlapQueue}, steps)
+	h.Start()
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		h.fire(now.Add(time.Duration(i) * time.Minute))
+	}
+	<-steps.started
+
+	stopped := make(chan error)
+	go func() { stopped <- h.Stop(context.Background()) }()
+	// Let Stop begin before the running run finishes.
+	time.Sleep(20 * time.Millisecond)
+	close(steps.release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if got := steps.calls.Load(); got != 1 {
+		t.Fatalf("runs = %d, want only the one in flight", got)
+	}
+}
+
+func TestScheduleHandler_StopCancelsRunsAfterDeadline(t *testing.T) {
+	steps := &blockingStepExecutor{release: make(chan struct{}), started: make(chan struct{}, 1)}
+	h := newTestScheduleHandler(t, map[string]any{"cron": "* * * * *"}, steps)
+	h.Start()
+	h.fire(time.Now())
+	<-steps.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := h.Stop(ctx)
+	if err == nil || !strings.Contains(err.Error(), "cancelled on shutdown") {
+		t.Fatalf("expected shutdown cancellation error, got %v", err)
+	}
+}
+
+func TestNewScheduleHandler_ValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]any
+		want   string
+	}{
+		{"missing cron", map[string]any{}, "requires a cron expression"},
+		{"bad cron", map[string]any{"cron": "* *"}, "must have 5 fields"},
+		{"bad timezone", map[string]any{"cron": "* * * * *", "timezone": "Mars/Olympus"}, "invalid timezone"},
+		{"bad overlap", map[string]any{"cron": "* * * * *", "overlap": "replace"}, "unsupported overlap policy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := &Flow{ID: "reconcile", Entrypoint: Entrypoint{Type: "schedule", Config: tt.config}}
+			_, err := NewScheduleHandler(flow, NewContainer(NewLogger(nil)), NewExecutor(noopEvaluator{}, noopStepExecutor{}), nil, newTestValueStore)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
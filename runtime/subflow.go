@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// EntrypointInternal marks flows that have no trigger of their own and
+	// are only run through flow.call().
+	EntrypointInternal = "internal"
+
+	// SubflowArgsKey is where the arguments passed to flow.call() are exposed
+	// in the called flow.
+	SubflowArgsKey = "args"
+
+	// maxSubflowDepth guards against unbounded recursion between flows.
+	maxSubflowDepth = 16
+)
+
+// Subflow error codes.
+const (
+	ErrorCodeFlowNotFound         FlowErrorCode = "FLOW_NOT_FOUND"
+	ErrorCodeSubflowDepthExceeded FlowErrorCode = "SUBFLOW_DEPTH_EXCEEDED"
+)
+
+// flowRegistry holds the loaded flows so executions can call each other.
+type flowRegistry struct {
+	flows            map[string]*Flow
+	executor         *Executor
+	globalProperties map[string]any
+	newValueStore    func() ValueStore
+}
+
+// RegisterFlows makes flows callable through Execution.CallFlow.
+// App.Start registers every loaded flow.
+func (c *Container) RegisterFlows(flows map[string]*Flow, executor *Executor, globalProperties map[string]any, newValueStore func() ValueStore) {
+	c.flows = &flowRegistry{
+		flows:            flows,
+		executor:         executor,
+		globalProperties: globalProperties,
+		newValueStore:    newValueStore,
+	}
+}
+
+// CallFlow runs another flow in-process as a child of this execution.
+// The child gets a fresh RunState with args under `args`, inherits the
+// caller's deadline and trace span, and records the caller as its parent.
+// It returns the body of the response the child set (nil if none), or a
+// FlowError attributed to the calling step so retry/fallback apply.
+func (e *Execution) CallFlow(flowID string, args map[string]any) (any, error) {
+	callerStep := e.ActiveStepID()
+	if e.Container == nil || e.Container.flows == nil {
+		return nil, subflowError(callerStep, ErrorCodeFlowNotFound, fmt.Sprintf("flow %q not found: no flows registered", flowID))
+	}
+	registry := e.Container.flows
+	target, ok := registry.flows[flowID]
+	if !ok {
+		return nil, subflowError(callerStep, ErrorCodeFlowNotFound, fmt.Sprintf("flow %q not found", flowID))
+	}
+	if e.depth >= maxSubflowDepth {
+		return nil, subflowError(callerStep, ErrorCodeSubflowDepthExceeded,
+			fmt.Sprintf("calling flow %q exceeds max subflow depth %d", flowID, maxSubflowDepth))
+	}
+
+	child := NewExecution(target, e.Container, registry.globalProperties, registry.newValueStore())
+	child.ParentID = e.ID
+	child.RootID = e.RootID
+	child.depth = e.depth + 1
+	if args == nil {
+		args = map[string]any{}
+	}
+	child.State().Store().SetNested(SubflowArgsKey, args)
+	child.AddValue(TriggerKey, map[string]any{
+		"type":                EntrypointInternal,
+		"parent_flow_id":      execFlowID(e),
+		"parent_execution_id": e.ID,
+		"root_execution_id":   e.RootID,
+	})
+
+	// The caller's context carries its deadline and active span.
+	spanCtx, span := e.Tracer().Start(e, fmt.Sprintf("flow %s", flowID),
+		trace.WithAttributes(
+			attribute.String("flow.id", flowID),
+			attribute.String("execution.id", child.ID),
+			attribute.String("execution.parent_id", e.ID),
+			attribute.String("execution.root_id", e.RootID),
+			attribute.String("trigger.type", EntrypointInternal),
+		),
+	)
+	defer span.End()
+
+	ctx := spanCtx
+	if target.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(spanCtx, time.Duration(target.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	child = child.WithContext(ctx)
+
+	start := time.Now()
+	err := registry.executor.ExecuteSteps(child)
+	child.Metrics().RecordFlow(spanCtx, flowID, classifyMetricOutcome(err), time.Since(start))
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, wrapSubflowError(err, flowID, child, callerStep)
+	}
+
+	if rd := child.State().Response(); rd != nil {
+		return rd.Args["body"], nil
+	}
+	return nil, nil
+}
+
+// wrapSubflowError re-attributes a child failure to the calling step while
+// keeping its type, code, status and details, so the caller's retry policy
+// sees a transient child failure as transient. The child error is the cause.
+func wrapSubflowError(err error, flowID string, child *Execution, callerStep string) *FlowError {
+	childFE := toFlowError(err, "", 0)
+	fe := &FlowError{
+		Type:    childFE.Type,
+		Code:    childFE.Code,
+		Message: fmt.Sprintf("flow %s: %s", flowID, childFE.Message),
+		Step:    callerStep,
+		Cause:   childFE,
+		Status:  childFE.Status,
+		Details: childFE.Details,
+		Meta:    make(map[string]any, len(childFE.Meta)+1),
+	}
+	for k, v := range childFE.Meta {
+		fe.Meta[k] = v
+	}
+	fe.Meta["subflow"] = map[string]any{
+		"flow":         flowID,
+		"execution_id": child.ID,
+		"step":         childFE.Step,
+	}
+	return fe
+}
+
+func subflowError(step string, code FlowErrorCode, message string) *FlowError {
+	return &FlowError{
+		Type:    ErrorTypePermanent,
+		Code:    string(code),
+		Message: message,
+		Step:    step,
+	}
+}